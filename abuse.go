@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Reasons a client IP is given a strike
+const (
+	abuseBadPath          = "bad_path"
+	abuseInvalidSignature = "invalid_signature"
+	abuseInvalidToken     = "invalid_token"
+)
+
+// abuseSettings tunes abuse detection
+type abuseSettings struct {
+	// Window is the period strikes are counted over
+	Window time.Duration
+	// Strikes is the number of strikes in a window that bans an IP
+	Strikes int
+	// BanDuration is how long a banned IP is refused
+	BanDuration time.Duration
+	// MaxTracked caps the IPs tracked at once
+	MaxTracked int
+}
+
+// defaultAbuseSettings are the detector settings used unless overridden
+var defaultAbuseSettings = abuseSettings{
+	Window:      10 * time.Minute,
+	Strikes:     20,
+	BanDuration: time.Hour,
+	MaxTracked:  10000,
+}
+
+// abuseDetector counts the requests each client IP makes that Slack never
+// would, such as probes of unknown paths and requests failing signature
+// verification, and bans IPs that make too many for a cooldown period
+type abuseDetector struct {
+	mu        sync.Mutex
+	settings  abuseSettings
+	offenders map[string]*abuseOffender
+}
+
+// abuseOffender is the strikes of a client IP in the current window
+type abuseOffender struct {
+	windowStart time.Time
+	strikes     int
+	bannedUntil time.Time
+}
+
+// abuse is the relay's abuse detector; nil when protection is disabled
+var abuse *abuseDetector
+
+// newAbuseDetector creates a detector with the given settings
+func newAbuseDetector(settings abuseSettings) *abuseDetector {
+	return &abuseDetector{settings: settings, offenders: make(map[string]*abuseOffender)}
+}
+
+var metricAbuseStrikes = newCounterVec("slack_relay_abuse_strikes_total",
+	"Requests counted against their client IP by abuse detection, by reason.", "reason")
+var metricAbuseBans = newCounterVec("slack_relay_abuse_bans_total",
+	"Client IPs banned by abuse detection.")
+var metricBannedRequests = newCounterVec("slack_relay_banned_requests_total",
+	"Requests refused because their client IP is banned.")
+
+func init() {
+	newGaugeFunc("slack_relay_banned_ips", "Client IPs currently banned by abuse detection.", func() float64 {
+		if abuse == nil {
+			return 0
+		}
+		return float64(abuse.bannedCount(clock.Now()))
+	})
+}
+
+// strike counts a request from ip against it, reporting whether it got ip banned
+func (d *abuseDetector) strike(ip string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	offender, ok := d.offenders[ip]
+	if !ok {
+		if len(d.offenders) >= d.settings.MaxTracked {
+			d.prune(now)
+			if len(d.offenders) >= d.settings.MaxTracked {
+				return false
+			}
+		}
+		offender = &abuseOffender{windowStart: now}
+		d.offenders[ip] = offender
+	}
+	if now.Before(offender.bannedUntil) {
+		return false
+	}
+	if now.Sub(offender.windowStart) >= d.settings.Window {
+		offender.windowStart = now
+		offender.strikes = 0
+	}
+	offender.strikes++
+	if offender.strikes < d.settings.Strikes {
+		return false
+	}
+	offender.bannedUntil = now.Add(d.settings.BanDuration)
+	offender.strikes = 0
+	return true
+}
+
+// prune forgets the IPs neither banned nor struck within the window
+func (d *abuseDetector) prune(now time.Time) {
+	for ip, offender := range d.offenders {
+		if !now.Before(offender.bannedUntil) && now.Sub(offender.windowStart) >= d.settings.Window {
+			delete(d.offenders, ip)
+		}
+	}
+}
+
+// banned reports whether ip is banned at now
+func (d *abuseDetector) banned(ip string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	offender, ok := d.offenders[ip]
+	return ok && now.Before(offender.bannedUntil)
+}
+
+// bannedCount returns the number of IPs banned at now
+func (d *abuseDetector) bannedCount(now time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	count := 0
+	for _, offender := range d.offenders {
+		if now.Before(offender.bannedUntil) {
+			count++
+		}
+	}
+	return count
+}
+
+// recordAbuse counts r against its client IP for reason, banning the IP once
+// it made too many such requests
+func recordAbuse(r *http.Request, reason string) {
+	if abuse == nil {
+		return
+	}
+	metricAbuseStrikes.Inc(reason)
+	ip := clientIP(r)
+	if abuse.strike(ip, clock.Now()) {
+		logWarn("Banning %s for %s after %d suspicious requests within %s", ip, abuse.settings.BanDuration, abuse.settings.Strikes, abuse.settings.Window)
+		metricAbuseBans.Inc()
+	}
+}
+
+// refuseBanned wraps next to refuse requests from banned client IPs
+func refuseBanned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if abuse != nil && abuse.banned(clientIP(r), clock.Now()) {
+			metricBannedRequests.Inc()
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// notFoundHandler answers requests to paths the relay does not serve, counting
+// them against their client IP
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	recordAbuse(r, abuseBadPath)
+	http.NotFound(w, r)
+}
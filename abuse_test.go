@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAbuseDetectorBans(t *testing.T) {
+	detector := newAbuseDetector(abuseSettings{Window: time.Minute, Strikes: 3, BanDuration: time.Hour, MaxTracked: 10})
+	now := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	detector.strike("203.0.113.7", now)
+	detector.strike("203.0.113.7", now.Add(2*time.Minute))
+	if detector.banned("203.0.113.7", now.Add(2*time.Minute)) {
+		t.Fatal("expected strikes in separate windows not to ban")
+	}
+	detector.strike("203.0.113.7", now.Add(2*time.Minute+time.Second))
+	if !detector.strike("203.0.113.7", now.Add(2*time.Minute+2*time.Second)) {
+		t.Fatal("expected the third strike in a window to ban")
+	}
+	if !detector.banned("203.0.113.7", now.Add(time.Hour)) || detector.banned("198.51.100.1", now) {
+		t.Error("expected only the offending IP to be banned")
+	}
+	if count := detector.bannedCount(now.Add(3 * time.Minute)); count != 1 {
+		t.Errorf("expected 1 banned IP, got %d", count)
+	}
+	if detector.banned("203.0.113.7", now.Add(2*time.Hour)) {
+		t.Error("expected the ban to expire")
+	}
+}
+
+func TestAbuseDetectorMaxTracked(t *testing.T) {
+	detector := newAbuseDetector(abuseSettings{Window: time.Minute, Strikes: 5, BanDuration: time.Hour, MaxTracked: 2})
+	now := time.Now()
+	detector.strike("192.0.2.1", now)
+	detector.strike("192.0.2.2", now)
+	detector.strike("192.0.2.3", now)
+	if len(detector.offenders) != 2 {
+		t.Errorf("expected 2 tracked IPs, got %d", len(detector.offenders))
+	}
+	detector.strike("192.0.2.3", now.Add(2*time.Minute))
+	if _, ok := detector.offenders["192.0.2.3"]; !ok {
+		t.Error("expected expired IPs to be pruned to track a new one")
+	}
+}
+
+func TestRefuseBanned(t *testing.T) {
+	original := abuse
+	abuse = newAbuseDetector(abuseSettings{Window: time.Minute, Strikes: 2, BanDuration: time.Hour, MaxTracked: 10})
+	defer func() { abuse = original }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slack", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/", notFoundHandler)
+	handler := refuseBanned(mux)
+	get := func(path string) int {
+		rr := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.RemoteAddr = "203.0.113.7:4242"
+		handler.ServeHTTP(rr, request)
+		return rr.Code
+	}
+
+	before := metricAbuseBans.values[""]
+	if code := get("/wp-login.php"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown path, got %d", code)
+	}
+	get("/.env")
+	if got := metricAbuseBans.values[""] - before; got != 1 {
+		t.Errorf("expected 1 ban, got %v", got)
+	}
+	if code := get("/slack"); code != http.StatusForbidden {
+		t.Errorf("expected a banned IP to be refused, got %d", code)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	// The container image has no zoneinfo database
+	_ "time/tzdata"
+)
+
+// Actions taken on a route's events outside its active hours
+const (
+	outsideHoursDrop   = "drop"
+	outsideHoursBuffer = "buffer"
+	outsideHoursDivert = "divert"
+)
+
+const (
+	// defaultHeldEventsSize caps the events held until their route's active hours begin
+	defaultHeldEventsSize = 10000
+	// heldEventsCheckInterval is how often held events are checked for release
+	heldEventsCheckInterval = 15 * time.Second
+)
+
+// weekdays maps the day names accepted in active hours to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+var metricOutsideActiveHours = newCounterVec("slack_relay_outside_active_hours_total",
+	"Events received outside their route's active hours, by event type and action.", "event_type", "action")
+
+// ActiveHoursPolicy limits a route to a daily time window, such as working
+// hours, and decides what happens to its events outside the window
+type ActiveHoursPolicy struct {
+	// Timezone is the IANA time zone of the window (default UTC)
+	Timezone string `json:"timezone,omitempty"`
+	// Days are the days the window opens on, e.g. ["mon", "tue"] (default every day)
+	Days []string `json:"days,omitempty"`
+	// Start and End are the "15:04" times the window opens and closes. A window
+	// ending before it starts runs overnight into the next day.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// Outside is the action on events outside the window: drop (default), buffer
+	// them until the window opens or divert them to Channel
+	Outside string `json:"outside,omitempty"`
+	// Channel receives events outside the window with the divert action
+	Channel string `json:"channel,omitempty"`
+}
+
+// enabled reports whether the route has active hours
+func (p ActiveHoursPolicy) enabled() bool {
+	return p.Start != "" || p.End != ""
+}
+
+// action returns the action on events outside the window
+func (p ActiveHoursPolicy) action() string {
+	if p.Outside == "" {
+		return outsideHoursDrop
+	}
+	return p.Outside
+}
+
+// activeHoursLocations caches the time zones of active hours by name
+var activeHoursLocations sync.Map
+
+// location returns the policy's time zone
+func (p ActiveHoursPolicy) location() (*time.Location, error) {
+	name := p.Timezone
+	if name == "" {
+		name = "UTC"
+	}
+	if cached, ok := activeHoursLocations.Load(name); ok {
+		return cached.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	activeHoursLocations.Store(name, location)
+	return location, nil
+}
+
+// parseClock parses a "15:04" time of day into minutes after midnight
+func parseClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// validate checks the policy's time zone, days, times and action
+func (p ActiveHoursPolicy) validate() error {
+	if _, err := p.location(); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", p.Timezone, err)
+	}
+	for _, day := range p.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid day %q, expected one of mon, tue, wed, thu, fri, sat or sun", day)
+		}
+	}
+	if _, err := parseClock(p.Start); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if _, err := parseClock(p.End); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	switch p.action() {
+	case outsideHoursDrop, outsideHoursBuffer:
+	case outsideHoursDivert:
+		if p.Channel == "" {
+			return fmt.Errorf("the divert action needs a channel")
+		}
+	default:
+		return fmt.Errorf("invalid outside action %q, expected drop, buffer or divert", p.Outside)
+	}
+	return nil
+}
+
+// validateActiveHours checks the active hours of every route
+func validateActiveHours(configs []EventConfig) error {
+	for _, config := range configs {
+		if !config.ActiveHours.enabled() {
+			continue
+		}
+		if err := config.ActiveHours.validate(); err != nil {
+			return fmt.Errorf("route '%s' has invalid active hours: %w", config.EventType, err)
+		}
+	}
+	return nil
+}
+
+// opensOn reports whether the window opens on day
+func (p ActiveHoursPolicy) opensOn(day time.Weekday) bool {
+	if len(p.Days) == 0 {
+		return true
+	}
+	for _, name := range p.Days {
+		if weekdays[strings.ToLower(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// active reports whether now is within the window. Policies that fail to
+// validate are always active, so a bad window never loses events.
+func (p ActiveHoursPolicy) active(now time.Time) bool {
+	location, errLocation := p.location()
+	start, errStart := parseClock(p.Start)
+	end, errEnd := parseClock(p.End)
+	if errLocation != nil || errStart != nil || errEnd != nil {
+		return true
+	}
+
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+	switch {
+	case start == end:
+		return p.opensOn(day)
+	case start < end:
+		return p.opensOn(day) && minute >= start && minute < end
+	default:
+		// Overnight windows belong to the day they start on
+		return (p.opensOn(day) && minute >= start) || (p.opensOn((day+6)%7) && minute < end)
+	}
+}
+
+// nextOpening returns when the window next opens after now
+func (p ActiveHoursPolicy) nextOpening(now time.Time) time.Time {
+	location, _ := p.location()
+	start, _ := parseClock(p.Start)
+	if location == nil {
+		return now
+	}
+	local := now.In(location)
+	for offset := 0; offset <= 7; offset++ {
+		day := local.AddDate(0, 0, offset)
+		opening := time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, location)
+		if opening.After(now) && p.opensOn(opening.Weekday()) {
+			return opening
+		}
+	}
+	return now
+}
+
+// heldEvent is an event buffered until its route's active hours begin
+type heldEvent struct {
+	eventType string
+	region    string
+	target    publishTarget
+	payload   []byte
+	retry     RetryPolicy
+	until     time.Time
+}
+
+// heldEventBuffer holds events received outside their route's active hours
+type heldEventBuffer struct {
+	mu      sync.Mutex
+	events  []heldEvent
+	maxSize int
+}
+
+// heldEvents holds buffered events for the whole relay
+var heldEvents = &heldEventBuffer{maxSize: defaultHeldEventsSize}
+
+func init() {
+	newGaugeFunc("slack_relay_held_events", "Events buffered until their route's active hours begin.", func() float64 {
+		return float64(heldEvents.depth())
+	})
+}
+
+// hold buffers an event until until. It reports false when the buffer is full.
+func (b *heldEventBuffer) hold(event heldEvent) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.events) >= b.maxSize {
+		return false
+	}
+	b.events = append(b.events, event)
+	return true
+}
+
+// due removes and returns the held events whose window has opened by now, in
+// the order they were received
+func (b *heldEventBuffer) due(now time.Time) []heldEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var due []heldEvent
+	kept := b.events[:0]
+	for _, event := range b.events {
+		if event.until.After(now) {
+			kept = append(kept, event)
+		} else {
+			due = append(due, event)
+		}
+	}
+	b.events = kept
+	return due
+}
+
+// depth returns the number of held events
+func (b *heldEventBuffer) depth() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.events)
+}
+
+// holdEvent buffers an event of a route outside its active hours until the
+// window opens
+func holdEvent(eventType string, region string, target publishTarget, payload []byte, config EventConfig, now time.Time) {
+	until := config.ActiveHours.nextOpening(now)
+	if !heldEvents.hold(heldEvent{eventType: eventType, region: region, target: target, payload: payload, retry: config.Retry, until: until}) {
+		logWarn("Held events buffer full, dropping event type '%s'", eventType)
+		return
+	}
+	logDebug("Holding event type '%s' until %s", eventType, until.Format(time.RFC3339))
+}
+
+// watchHeldEvents publishes held events once their route's active hours begin
+func watchHeldEvents(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, event := range heldEvents.due(now) {
+				publishAndRecord(event.eventType, event.region, event.target, event.payload, event.retry)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveHoursActive(t *testing.T) {
+	workingHours := ActiveHoursPolicy{Timezone: "Europe/London", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:30"}
+	overnight := ActiveHoursPolicy{Days: []string{"fri"}, Start: "22:00", End: "06:00"}
+
+	tests := []struct {
+		name   string
+		policy ActiveHoursPolicy
+		now    string
+		want   bool
+	}{
+		{"working hours in summer time", workingHours, "2030-07-01T08:30:00Z", true},
+		{"before opening in summer time", workingHours, "2030-07-01T07:59:00Z", false},
+		{"closing time", workingHours, "2030-01-07T17:30:00Z", false},
+		{"weekend", workingHours, "2030-07-06T12:00:00Z", false},
+		{"overnight start", overnight, "2030-07-05T23:00:00Z", true},
+		{"overnight into the next day", overnight, "2030-07-06T05:59:00Z", true},
+		{"overnight on another day", overnight, "2030-07-04T23:00:00Z", false},
+		{"whole day", ActiveHoursPolicy{Days: []string{"sat"}, Start: "00:00", End: "00:00"}, "2030-07-06T12:00:00Z", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, _ := time.Parse(time.RFC3339, tt.now)
+			if got := tt.policy.active(now); got != tt.want {
+				t.Errorf("active(%s) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveHoursNextOpening(t *testing.T) {
+	policy := ActiveHoursPolicy{Timezone: "America/New_York", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}
+
+	// Friday evening opens on Monday morning
+	now, _ := time.Parse(time.RFC3339, "2030-07-05T22:00:00Z")
+	if got, want := policy.nextOpening(now), "2030-07-08T13:00:00Z"; got.UTC().Format(time.RFC3339) != want {
+		t.Errorf("expected the window to open at %s, got %s", want, got.UTC().Format(time.RFC3339))
+	}
+	// Early morning opens the same day
+	now, _ = time.Parse(time.RFC3339, "2030-07-09T10:00:00Z")
+	if got, want := policy.nextOpening(now), "2030-07-09T13:00:00Z"; got.UTC().Format(time.RFC3339) != want {
+		t.Errorf("expected the window to open at %s, got %s", want, got.UTC().Format(time.RFC3339))
+	}
+}
+
+func TestValidateActiveHours(t *testing.T) {
+	for _, policy := range []ActiveHoursPolicy{
+		{Timezone: "Mars/Olympus_Mons", Start: "09:00", End: "17:00"},
+		{Days: []string{"monday"}, Start: "09:00", End: "17:00"},
+		{Start: "9am", End: "17:00"},
+		{Start: "09:00"},
+		{Start: "09:00", End: "17:00", Outside: "divert"},
+		{Start: "09:00", End: "17:00", Outside: "page"},
+	} {
+		if err := validateActiveHours([]EventConfig{{EventType: "message", ActiveHours: policy}}); err == nil {
+			t.Errorf("expected %+v to be invalid", policy)
+		}
+	}
+
+	configs, err := parseEventConfig([]byte(`[{"slack-event-type": "message", "channel": "pager", "active-hours": {"timezone": "Europe/Paris", "start": "08:00", "end": "20:00", "outside": "divert", "channel": "after-hours"}}]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if configs[0].ActiveHours.action() != outsideHoursDivert || configs[0].ActiveHours.Channel != "after-hours" {
+		t.Errorf("expected active hours diverting to after-hours, got %+v", configs[0].ActiveHours)
+	}
+}
+
+func TestRouteEventOutsideActiveHours(t *testing.T) {
+	// A whole-day window two days from now is closed today, even across midnight
+	var closedDay string
+	for name, day := range weekdays {
+		if day == (time.Now().UTC().Weekday()+2)%7 {
+			closedDay = name
+		}
+	}
+	defer setupTestEnvironment()
+
+	for _, tt := range []struct {
+		outside string
+		skip    string
+		channel string
+	}{
+		{outsideHoursDrop, skipOutsideHours, "pager"},
+		{outsideHoursDivert, "", "after-hours"},
+		{outsideHoursBuffer, "", "pager"},
+	} {
+		policy := ActiveHoursPolicy{Days: []string{closedDay}, Start: "00:00", End: "00:00", Outside: tt.outside, Channel: "after-hours"}
+		setEventConfigs([]EventConfig{{EventType: "message", Channel: "pager", ActiveHours: policy}})
+
+		routed := routeEvent(map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{"type": "message"}}, nil)
+		if routed.OutsideHours != tt.outside || routed.Skip != tt.skip || routed.Config.Channel != tt.channel {
+			t.Errorf("%s: expected skip %q to channel %q, got %+v", tt.outside, tt.skip, tt.channel, routed)
+		}
+	}
+}
+
+func TestHeldEventBuffer(t *testing.T) {
+	buffer := &heldEventBuffer{maxSize: 2}
+	now := time.Now()
+	buffer.hold(heldEvent{eventType: "a", until: now.Add(time.Hour)})
+	buffer.hold(heldEvent{eventType: "b", until: now.Add(time.Minute)})
+	if buffer.hold(heldEvent{eventType: "c", until: now}) {
+		t.Error("expected a full buffer to refuse events")
+	}
+
+	if due := buffer.due(now); len(due) != 0 {
+		t.Errorf("expected no events due yet, got %v", due)
+	}
+	due := buffer.due(now.Add(2 * time.Minute))
+	if len(due) != 1 || due[0].eventType != "b" || buffer.depth() != 1 {
+		t.Errorf("expected event b to be released and a kept, got %v with %d held", due, buffer.depth())
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Kinds of event rate anomaly
+const (
+	anomalySpike = "spike"
+	anomalyDrop  = "drop"
+)
+
+// anomalyBaselineWeight is the weight of the latest interval in the rolling
+// baseline, an exponentially weighted moving average of each route's rate
+const anomalyBaselineWeight = 0.1
+
+// anomalySettings tunes the event rate anomaly detector
+type anomalySettings struct {
+	// Interval is the length of the window events are counted over
+	Interval time.Duration
+	// SpikeFactor flags a window with this many times the baseline rate
+	SpikeFactor int
+	// DropFactor flags a window with the baseline rate divided by this factor
+	DropFactor int
+	// MinEvents ignores spikes to, and drops from, rates below this many events
+	// per window, so quiet routes do not alert on noise
+	MinEvents int
+	// Warmup is the number of windows observed before a route's baseline is trusted
+	Warmup int
+}
+
+// defaultAnomalySettings are the detector settings used unless overridden
+var defaultAnomalySettings = anomalySettings{
+	Interval:    time.Minute,
+	SpikeFactor: 5,
+	DropFactor:  5,
+	MinEvents:   20,
+	Warmup:      10,
+}
+
+// routeRate is the rate history of one event type
+type routeRate struct {
+	count    int
+	baseline float64
+	windows  int
+	anomaly  string
+}
+
+// rateMonitor counts events per configured event type and compares each window
+// with the route's rolling baseline
+type rateMonitor struct {
+	mu       sync.Mutex
+	settings anomalySettings
+	rates    map[string]*routeRate
+}
+
+// rateAnomalies is the relay's event rate anomaly detector; nil when disabled
+var rateAnomalies *rateMonitor
+
+// newRateMonitor creates a rateMonitor with the given settings
+func newRateMonitor(settings anomalySettings) *rateMonitor {
+	return &rateMonitor{settings: settings, rates: make(map[string]*routeRate)}
+}
+
+var metricRateAnomalies = newCounterVec("slack_relay_rate_anomalies_total",
+	"Abnormal spikes or drops in a route's event rate, by event type and kind.", "event_type", "kind")
+
+// record counts an event of eventType in the current window
+func (m *rateMonitor) record(eventType string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rate, ok := m.rates[eventType]
+	if !ok {
+		rate = &routeRate{}
+		m.rates[eventType] = rate
+	}
+	rate.count++
+}
+
+// rateAlert describes a route whose rate became abnormal, or returned to normal
+type rateAlert struct {
+	EventType string
+	Kind      string
+	Count     int
+	Baseline  float64
+}
+
+// check closes the current window, returning the routes whose rate became
+// abnormal or returned to normal. Only the configured event types are checked.
+func (m *rateMonitor) check(configs []EventConfig) []rateAlert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var alerts []rateAlert
+	checked := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		// Event types split across several filtered routes are counted once
+		if checked[config.EventType] {
+			continue
+		}
+		checked[config.EventType] = true
+		rate, ok := m.rates[config.EventType]
+		if !ok {
+			rate = &routeRate{}
+			m.rates[config.EventType] = rate
+		}
+		count := rate.count
+		rate.count = 0
+
+		kind := ""
+		if rate.windows >= m.settings.Warmup {
+			kind = m.settings.classify(float64(count), rate.baseline)
+		}
+		if kind != rate.anomaly {
+			rate.anomaly = kind
+			alerts = append(alerts, rateAlert{EventType: config.EventType, Kind: kind, Count: count, Baseline: rate.baseline})
+		}
+
+		if rate.windows == 0 {
+			rate.baseline = float64(count)
+		} else {
+			rate.baseline += anomalyBaselineWeight * (float64(count) - rate.baseline)
+		}
+		rate.windows++
+	}
+	return alerts
+}
+
+// classify returns the kind of anomaly a window of count events is against
+// baseline, or an empty string when it is normal
+func (s anomalySettings) classify(count float64, baseline float64) string {
+	minEvents := float64(s.MinEvents)
+	switch {
+	case s.SpikeFactor > 0 && count >= minEvents && count > math.Max(baseline, 1)*float64(s.SpikeFactor):
+		return anomalySpike
+	case s.DropFactor > 0 && baseline >= minEvents && count < baseline/float64(s.DropFactor):
+		return anomalyDrop
+	}
+	return ""
+}
+
+// reportRateAnomalies closes the current window, and logs and publishes an
+// alert to the control channel for every route whose rate changed state
+func reportRateAnomalies(now time.Time) {
+	for _, alert := range rateAnomalies.check(currentEventConfigs()) {
+		record := map[string]interface{}{
+			"type":       "event_rate_normal",
+			"event_type": alert.EventType,
+			"count":      alert.Count,
+			"baseline":   math.Round(alert.Baseline*10) / 10,
+			"window":     rateAnomalies.settings.Interval.String(),
+			"timestamp":  now.UTC().Format(time.RFC3339),
+		}
+		if alert.Kind != "" {
+			record["type"] = "event_rate_anomaly"
+			record["kind"] = alert.Kind
+			metricRateAnomalies.Inc(eventTypeLabel(alert.EventType), alert.Kind)
+			logWarn("Abnormal %s in '%s' events: %d in the last %s against a baseline of %.1f",
+				alert.Kind, alert.EventType, alert.Count, rateAnomalies.settings.Interval, alert.Baseline)
+		} else {
+			logInfo("Rate of '%s' events is back to normal", alert.EventType)
+		}
+		publishControlEvent(record)
+	}
+}
+
+// watchRateAnomalies checks event rates at the end of every window until ctx is cancelled
+func watchRateAnomalies(ctx context.Context) {
+	ticker := time.NewTicker(rateAnomalies.settings.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reportRateAnomalies(clock.Now())
+		}
+	}
+}
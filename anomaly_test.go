@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestRateMonitorCheck(t *testing.T) {
+	monitor := newRateMonitor(anomalySettings{SpikeFactor: 5, DropFactor: 5, MinEvents: 20, Warmup: 3})
+	configs := []EventConfig{{EventType: "message"}}
+
+	window := func(count int) []rateAlert {
+		for i := 0; i < count; i++ {
+			monitor.record("message")
+		}
+		return monitor.check(configs)
+	}
+
+	for i := 0; i < 3; i++ {
+		if alerts := window(100); len(alerts) != 0 {
+			t.Fatalf("expected no alerts while warming up, got %v", alerts)
+		}
+	}
+	if alerts := window(120); len(alerts) != 0 {
+		t.Errorf("expected no alert for a normal window, got %v", alerts)
+	}
+	if alerts := window(1000); len(alerts) != 1 || alerts[0].Kind != anomalySpike {
+		t.Errorf("expected a spike alert, got %v", alerts)
+	}
+	if alerts := window(1000); len(alerts) != 0 {
+		t.Errorf("expected a continuing spike to alert once, got %v", alerts)
+	}
+	if alerts := window(150); len(alerts) != 1 || alerts[0].Kind != "" {
+		t.Errorf("expected a return to normal, got %v", alerts)
+	}
+	if alerts := window(0); len(alerts) != 1 || alerts[0].Kind != anomalyDrop {
+		t.Errorf("expected a drop alert, got %v", alerts)
+	}
+}
+
+func TestAnomalySettingsClassify(t *testing.T) {
+	settings := anomalySettings{SpikeFactor: 5, DropFactor: 5, MinEvents: 20}
+	tests := []struct {
+		count    float64
+		baseline float64
+		expected string
+	}{
+		{100, 100, ""},
+		{600, 100, anomalySpike},
+		{10, 1, ""},
+		{10, 100, anomalyDrop},
+		{1, 10, ""},
+	}
+	for _, tt := range tests {
+		if got := settings.classify(tt.count, tt.baseline); got != tt.expected {
+			t.Errorf("classify(%v, %v) = %q, want %q", tt.count, tt.baseline, got, tt.expected)
+		}
+	}
+}
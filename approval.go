@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// approvalBlockID identifies the buttons block of approval requests
+	approvalBlockID = "slack_relay_approval"
+	// Action IDs of the approve and deny buttons
+	approveActionID = "slack_relay_approve"
+	denyActionID    = "slack_relay_deny"
+	// defaultApprovalChannel is the Redis channel approval decisions are published to
+	defaultApprovalChannel = "slack-relay-approvals"
+)
+
+// approvalChannel is the Redis channel decisions are published to when the
+// request does not name one
+var approvalChannel = defaultApprovalChannel
+
+var metricApprovalDecisions = newCounterVec("slack_relay_approval_decisions_total",
+	"Clicks on approval request buttons, by decision.", "decision")
+
+// approvalRequest is carried in the value of approval buttons, so decisions can
+// be correlated with the request without keeping state in the relay
+type approvalRequest struct {
+	RequestID    string   `json:"id"`
+	ReplyChannel string   `json:"reply,omitempty"`
+	Approvers    []string `json:"approvers,omitempty"`
+}
+
+// buildApprovalMessage turns the params of an approval outbound message into
+// chat.postMessage arguments: the message's blocks, or a section with its text,
+// followed by approve and deny buttons carrying the request
+func buildApprovalMessage(params url.Values) (url.Values, error) {
+	request := approvalRequest{
+		RequestID:    params.Get("request_id"),
+		ReplyChannel: params.Get("reply_channel"),
+	}
+	if approvers := params.Get("approvers"); approvers != "" {
+		if err := json.Unmarshal([]byte(approvers), &request.Approvers); err != nil {
+			return nil, fmt.Errorf("approvers must be a list of user IDs: %w", err)
+		}
+	}
+	value, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []interface{}
+	if encoded := params.Get("blocks"); encoded != "" {
+		if err := json.Unmarshal([]byte(encoded), &blocks); err != nil {
+			return nil, fmt.Errorf("invalid blocks: %w", err)
+		}
+	} else {
+		blocks = []interface{}{map[string]interface{}{
+			"type": "section",
+			"text": map[string]interface{}{"type": "mrkdwn", "text": params.Get("text")},
+		}}
+	}
+	button := func(actionID string, label string, style string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":      "button",
+			"action_id": actionID,
+			"text":      map[string]interface{}{"type": "plain_text", "text": label},
+			"style":     style,
+			"value":     string(value),
+		}
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type":     "actions",
+		"block_id": approvalBlockID,
+		"elements": []interface{}{
+			button(approveActionID, "Approve", "primary"),
+			button(denyActionID, "Deny", "danger"),
+		},
+	})
+	encodedBlocks, err := json.Marshal(blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	message := cloneValues(params)
+	for _, name := range []string{"request_id", "reply_channel", "approvers"} {
+		message.Del(name)
+	}
+	message.Set("blocks", string(encodedBlocks))
+	return message, nil
+}
+
+// requestApproval posts an approval request. It returns the outcome.
+func requestApproval(ctx context.Context, params url.Values) string {
+	channel, requestID := params.Get("channel"), params.Get("request_id")
+	message, err := buildApprovalMessage(params)
+	if err == nil {
+		err = callSlackBotAPI(ctx, "chat.postMessage", message, nil)
+	}
+	if err != nil {
+		logWarn("Error requesting approval %s in '%s': %v", requestID, channel, err)
+		return outboundResultFailed
+	}
+	logInfo("Requested approval %s in '%s'", requestID, channel)
+	return "requested"
+}
+
+// payloadApprovalAction returns the approval button clicked in a block_actions
+// payload, if any
+func payloadApprovalAction(payload map[string]interface{}) (map[string]interface{}, bool) {
+	if payload["type"] != "block_actions" {
+		return nil, false
+	}
+	actions, _ := payload["actions"].([]interface{})
+	for _, action := range actions {
+		action, _ := action.(map[string]interface{})
+		if id := action["action_id"]; id == approveActionID || id == denyActionID {
+			return action, true
+		}
+	}
+	return nil, false
+}
+
+// handleApprovalAction handles clicks on the buttons of approval requests: the
+// decision is published to the request's Redis channel and the request message
+// is updated to show it. It reports whether the payload was an approval click.
+func handleApprovalAction(w http.ResponseWriter, payload map[string]interface{}) bool {
+	action, ok := payloadApprovalAction(payload)
+	if !ok {
+		return false
+	}
+	// Slack only needs the click acknowledged; the message is updated through the response_url
+	w.WriteHeader(http.StatusOK)
+
+	value, _ := action["value"].(string)
+	var request approvalRequest
+	if err := json.Unmarshal([]byte(value), &request); err != nil || request.RequestID == "" {
+		logWarn("Ignoring approval click with invalid request %q", value)
+		return true
+	}
+	user, _ := payload["user"].(map[string]interface{})
+	userID, _ := user["id"].(string)
+	responseURL := payloadResponseURL(payload)
+
+	ctx, cancel := context.WithTimeout(context.Background(), slackAPITimeout)
+	defer cancel()
+
+	if len(request.Approvers) > 0 && !containsString(request.Approvers, userID) {
+		logInfo("User %s is not an approver of request %s", userID, request.RequestID)
+		metricApprovalDecisions.Inc("unauthorized")
+		if responseURL != "" {
+			err := postResponseURL(ctx, responseURL, map[string]interface{}{
+				"response_type":    "ephemeral",
+				"replace_original": false,
+				"text":             "You are not an approver of this request.",
+			})
+			if err != nil {
+				logWarn("Error telling user %s they cannot decide request %s: %v", userID, request.RequestID, err)
+			}
+		}
+		return true
+	}
+
+	decision := "denied"
+	if action["action_id"] == approveActionID {
+		decision = "approved"
+	}
+	metricApprovalDecisions.Inc(decision)
+	if err := publishApprovalDecision(request, decision, payload, clock.Now()); err != nil {
+		logError("Error publishing decision of approval request %s: %v", request.RequestID, err)
+	}
+	if responseURL != "" {
+		if err := postResponseURL(ctx, responseURL, decidedApprovalMessage(payload, decision, userID)); err != nil {
+			logWarn("Error updating approval request %s: %v", request.RequestID, err)
+		}
+	}
+	return true
+}
+
+// publishApprovalDecision publishes a decision to the request's reply channel
+func publishApprovalDecision(request approvalRequest, decision string, payload map[string]interface{}, now time.Time) error {
+	channel := request.ReplyChannel
+	if channel == "" {
+		channel = approvalChannel
+	}
+	data, err := json.Marshal(approvalDecision(request, decision, payload, now))
+	if err != nil {
+		return err
+	}
+	return publishEvent(channel, data)
+}
+
+// approvalDecision returns the record published for a decision: the request ID,
+// the decision, who made it and where the request message is
+func approvalDecision(request approvalRequest, decision string, payload map[string]interface{}, now time.Time) map[string]interface{} {
+	user, _ := payload["user"].(map[string]interface{})
+	container, _ := payload["container"].(map[string]interface{})
+	slackChannel, _ := payload["channel"].(map[string]interface{})
+
+	record := map[string]interface{}{
+		"type":       "approval_decision",
+		"request_id": request.RequestID,
+		"decision":   decision,
+		"user":       user,
+		"decided_at": now.UTC().Format(time.RFC3339),
+	}
+	if id, ok := slackChannel["id"]; ok {
+		record["channel"] = id
+	}
+	if ts, ok := container["message_ts"]; ok {
+		record["message_ts"] = ts
+	}
+	if team, ok := payload["team"].(map[string]interface{}); ok {
+		record["team_id"] = team["id"]
+	}
+	return record
+}
+
+// decidedApprovalMessage returns the approval request message with its buttons
+// replaced by the decision
+func decidedApprovalMessage(payload map[string]interface{}, decision string, userID string) map[string]interface{} {
+	message, _ := payload["message"].(map[string]interface{})
+	original, _ := message["blocks"].([]interface{})
+	blocks := make([]interface{}, 0, len(original)+1)
+	for _, block := range original {
+		if block, ok := block.(map[string]interface{}); ok && block["block_id"] == approvalBlockID {
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+
+	summary := fmt.Sprintf(":x: Denied by <@%s>", userID)
+	if decision == "approved" {
+		summary = fmt.Sprintf(":white_check_mark: Approved by <@%s>", userID)
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type":     "context",
+		"elements": []interface{}{map[string]interface{}{"type": "mrkdwn", "text": summary}},
+	})
+
+	text, _ := message["text"].(string)
+	return map[string]interface{}{
+		"replace_original": true,
+		"text":             text,
+		"blocks":           blocks,
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildApprovalMessage(t *testing.T) {
+	outboundMessage, err := parseOutboundMessage([]byte(`{"op":"approval","channel":"C1","request_id":"deploy-42","text":"Deploy api to prod?","approvers":["U1","U2"],"reply_channel":"deploy-approvals"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	message, err := buildApprovalMessage(outboundMessage.Params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"request_id", "reply_channel", "approvers"} {
+		if message.Has(name) {
+			t.Errorf("expected %s not to be passed to Slack", name)
+		}
+	}
+
+	var blocks []map[string]interface{}
+	if err := json.Unmarshal([]byte(message.Get("blocks")), &blocks); err != nil {
+		t.Fatalf("invalid blocks: %v", err)
+	}
+	if len(blocks) != 2 || blocks[0]["type"] != "section" || blocks[1]["block_id"] != approvalBlockID {
+		t.Fatalf("expected a section and the approval buttons, got %v", blocks)
+	}
+	elements, _ := blocks[1]["elements"].([]interface{})
+	approve, _ := elements[0].(map[string]interface{})
+	var request approvalRequest
+	json.Unmarshal([]byte(approve["value"].(string)), &request)
+	if approve["action_id"] != approveActionID || request.RequestID != "deploy-42" || request.ReplyChannel != "deploy-approvals" || len(request.Approvers) != 2 {
+		t.Errorf("expected the approve button to carry the request, got %v", approve)
+	}
+
+	if _, err := parseOutboundMessage([]byte(`{"op":"approval","channel":"C1","request_id":"deploy-42"}`)); err == nil {
+		t.Error("expected an approval without text or blocks to be invalid")
+	}
+}
+
+func TestHandleApprovalAction(t *testing.T) {
+	var posted []map[string]interface{}
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+		posted = append(posted, message)
+	}))
+	defer slack.Close()
+
+	click := func(actionID string, userID string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":         "block_actions",
+			"user":         map[string]interface{}{"id": userID},
+			"team":         map[string]interface{}{"id": "T1"},
+			"channel":      map[string]interface{}{"id": "C1"},
+			"container":    map[string]interface{}{"message_ts": "1.000001"},
+			"response_url": slack.URL,
+			"message": map[string]interface{}{"text": "Deploy?", "blocks": []interface{}{
+				map[string]interface{}{"type": "section"},
+				map[string]interface{}{"type": "actions", "block_id": approvalBlockID},
+			}},
+			"actions": []interface{}{map[string]interface{}{
+				"action_id": actionID,
+				"value":     `{"id":"deploy-42","approvers":["U1"]}`,
+			}},
+		}
+	}
+
+	if handleApprovalAction(httptest.NewRecorder(), map[string]interface{}{"type": "block_actions", "actions": []interface{}{map[string]interface{}{"action_id": "other"}}}) {
+		t.Error("expected other actions not to be handled")
+	}
+
+	rr := httptest.NewRecorder()
+	if !handleApprovalAction(rr, click(approveActionID, "U1")) || rr.Code != http.StatusOK {
+		t.Fatalf("expected the click to be acknowledged, got %d", rr.Code)
+	}
+	if len(posted) != 1 || posted[0]["replace_original"] != true {
+		t.Fatalf("expected the request message to be replaced, got %v", posted)
+	}
+	blocks, _ := posted[0]["blocks"].([]interface{})
+	summary := fmt.Sprint(blocks[len(blocks)-1])
+	if len(blocks) != 2 || !strings.Contains(summary, "Approved by <@U1>") {
+		t.Errorf("expected the buttons to be replaced by the decision, got %v", blocks)
+	}
+
+	posted = nil
+	handleApprovalAction(httptest.NewRecorder(), click(denyActionID, "U9"))
+	if len(posted) != 1 || posted[0]["response_type"] != "ephemeral" {
+		t.Errorf("expected users other than the approvers to be told they cannot decide, got %v", posted)
+	}
+
+	record := approvalDecision(approvalRequest{RequestID: "deploy-42"}, "denied", click(denyActionID, "U1"), time.Unix(1700000000, 0))
+	if record["request_id"] != "deploy-42" || record["decision"] != "denied" || record["channel"] != "C1" || record["message_ts"] != "1.000001" || record["team_id"] != "T1" || record["decided_at"] != "2023-11-14T22:13:20Z" {
+		t.Errorf("unexpected decision record %v", record)
+	}
+}
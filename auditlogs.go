@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// auditLogEventType is the event type audit log entries are routed as
+const auditLogEventType = "audit_log_entry"
+
+// defaultAuditLogsInterval is how often the Audit Logs API is polled
+const defaultAuditLogsInterval = time.Minute
+
+// defaultAuditLogsStateKey is the Redis key holding the date of the newest
+// published audit log entry, so restarts resume where they stopped
+const defaultAuditLogsStateKey = "slack-relay:audit-logs:oldest"
+
+// auditLogsPageSize is the number of entries requested per Audit Logs API page
+const auditLogsPageSize = 200
+
+// slackAuditAPIBaseURL is the Slack Audit Logs API base URL, overridable in tests
+var slackAuditAPIBaseURL = "https://api.slack.com/audit/v1/"
+
+// slackAuditToken is the org-level user token (xoxp-...) with the auditlogs:read
+// scope used to poll the Audit Logs API
+var slackAuditToken string
+
+// getSlackAuditToken returns the current Audit Logs API token
+func getSlackAuditToken() string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return slackAuditToken
+}
+
+// auditLogsResponse is a page of the Audit Logs API logs endpoint
+type auditLogsResponse struct {
+	OK               *bool                    `json:"ok,omitempty"`
+	Error            string                   `json:"error,omitempty"`
+	Entries          []map[string]interface{} `json:"entries"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+}
+
+// auditLogPoller publishes new Audit Logs API entries through the relay's routes
+type auditLogPoller struct {
+	// actions limits the polled entries to these comma-separated actions
+	actions string
+	// stateKey is the Redis key the poller's position is saved to
+	stateKey string
+	// oldest is the creation date of the newest entry published so far
+	oldest int64
+	// seen holds the IDs of the published entries created at oldest, which the
+	// next poll returns again
+	seen map[string]bool
+}
+
+// fetchAuditLogs returns every entry created at or after oldest, following the
+// response cursor across pages
+func fetchAuditLogs(ctx context.Context, token string, oldest int64, actions string) ([]map[string]interface{}, error) {
+	var entries []map[string]interface{}
+	cursor := ""
+	for {
+		params := url.Values{}
+		params.Set("oldest", strconv.FormatInt(oldest, 10))
+		params.Set("limit", strconv.Itoa(auditLogsPageSize))
+		if actions != "" {
+			params.Set("action", actions)
+		}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, slackAuditAPIBaseURL+"logs?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := slackAPIClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("audit logs API returned status %d", resp.StatusCode)
+		}
+
+		var page auditLogsResponse
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("audit logs API returned invalid JSON: %w", err)
+		}
+		if page.OK != nil && !*page.OK {
+			return nil, fmt.Errorf("audit logs API error: %s", page.Error)
+		}
+		entries = append(entries, page.Entries...)
+
+		cursor = page.ResponseMetadata.NextCursor
+		if cursor == "" {
+			return entries, nil
+		}
+	}
+}
+
+// auditLogPayload converts an audit log entry into an event callback payload, so
+// it is routed and published like any Slack event
+func auditLogPayload(entry map[string]interface{}) map[string]interface{} {
+	event := make(map[string]interface{}, len(entry)+1)
+	for key, value := range entry {
+		event[key] = value
+	}
+	event["type"] = auditLogEventType
+
+	payload := map[string]interface{}{
+		"type":       "event_callback",
+		"event_id":   entry["id"],
+		"event_time": entry["date_create"],
+		"event":      event,
+	}
+	if entryContext, ok := entry["context"].(map[string]interface{}); ok {
+		if location, ok := entryContext["location"].(map[string]interface{}); ok {
+			if location["type"] == "enterprise" {
+				payload["enterprise_id"] = location["id"]
+			} else if location["type"] == "workspace" {
+				payload["team_id"] = location["id"]
+			}
+		}
+	}
+	return payload
+}
+
+// auditEntryDate returns the creation date of an audit log entry
+func auditEntryDate(entry map[string]interface{}) int64 {
+	date, _ := entry["date_create"].(float64)
+	return int64(date)
+}
+
+// poll fetches the entries created since the last poll and publishes them,
+// oldest first
+func (p *auditLogPoller) poll(ctx context.Context) error {
+	entries, err := fetchAuditLogs(ctx, getSlackAuditToken(), p.oldest, p.actions)
+	if err != nil {
+		return err
+	}
+	// The API returns the newest entries first
+	sort.SliceStable(entries, func(i, j int) bool {
+		return auditEntryDate(entries[i]) < auditEntryDate(entries[j])
+	})
+
+	published := 0
+	for _, entry := range entries {
+		id, _ := entry["id"].(string)
+		date := auditEntryDate(entry)
+		if date < p.oldest || (date == p.oldest && p.seen[id]) {
+			continue
+		}
+		if date > p.oldest {
+			p.oldest = date
+			p.seen = make(map[string]bool)
+		}
+		p.seen[id] = true
+
+		payload := auditLogPayload(entry)
+		data, err := json.Marshal(payload)
+		if err != nil {
+			logError("Error encoding audit log entry %s: %v", id, err)
+			continue
+		}
+		routed := routeEvent(payload, data)
+		metricEventsReceived.Inc(eventTypeLabel(routed.EventType), teamLabel(routed.TeamID))
+		if routed.Skip != "" {
+			logDebug("Ignoring audit log entry %s: %s", id, routed.Skip)
+			continue
+		}
+		publishAndRecord(routed.EventType, routed.Region, routed.Config.publishTarget(routed.Config.Channel), routed.Payload, routed.Config.Retry)
+		published++
+	}
+
+	if published > 0 {
+		logInfo("Published %d audit log entries", published)
+	}
+	p.saveState(ctx)
+	return nil
+}
+
+// loadState resumes from the position saved in Redis, or starts at now
+func (p *auditLogPoller) loadState(ctx context.Context, now time.Time) {
+	p.oldest = now.Unix()
+	p.seen = make(map[string]bool)
+	if redisClient == nil || p.stateKey == "" {
+		return
+	}
+	value, err := redisClient.Get(ctx, p.stateKey).Int64()
+	if err != nil {
+		return
+	}
+	p.oldest = value
+}
+
+// saveState stores the poller's position in Redis
+func (p *auditLogPoller) saveState(ctx context.Context) {
+	if redisClient == nil || p.stateKey == "" {
+		return
+	}
+	if err := redisClient.Set(ctx, p.stateKey, p.oldest, 0).Err(); err != nil {
+		logWarn("Error saving audit log position to Redis key '%s': %v", p.stateKey, err)
+	}
+}
+
+// watchAuditLogs polls the Audit Logs API every interval until ctx is cancelled
+func watchAuditLogs(ctx context.Context, poller *auditLogPoller, interval time.Duration) {
+	poller.loadState(ctx, clock.Now())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := poller.poll(ctx); err != nil {
+				logWarn("Error polling the Slack Audit Logs API: %v", err)
+			}
+		}
+	}
+}
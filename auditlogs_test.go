@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuditLogPayload(t *testing.T) {
+	entry := map[string]interface{}{
+		"id":          "0123a45b-6c7d-8900-e12f-3456789gh0i1",
+		"date_create": float64(1521214343),
+		"action":      "user_login",
+		"context":     map[string]interface{}{"location": map[string]interface{}{"type": "enterprise", "id": "E1701NCCA"}},
+	}
+
+	payload := auditLogPayload(entry)
+	if getEventType(payload) != auditLogEventType {
+		t.Errorf("expected event type %q, got %q", auditLogEventType, getEventType(payload))
+	}
+	if payload["enterprise_id"] != "E1701NCCA" || payload["event_id"] != entry["id"] {
+		t.Errorf("unexpected payload %v", payload)
+	}
+	if event := payload["event"].(map[string]interface{}); event["action"] != "user_login" {
+		t.Errorf("expected the entry fields in the event, got %v", event)
+	}
+	if _, ok := entry["type"]; ok {
+		t.Error("expected the entry itself not to be modified")
+	}
+}
+
+func TestAuditLogPollerPoll(t *testing.T) {
+	setupTestEnvironment()
+	setEventConfigs([]EventConfig{{EventType: auditLogEventType, Channel: "slack-audit"}})
+	defer setupTestEnvironment()
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		if r.URL.Path != "/logs" || r.Header.Get("Authorization") != "Bearer xoxp-audit" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		response := map[string]interface{}{
+			"entries": []map[string]interface{}{
+				{"id": "3", "date_create": 120, "action": "user_login"},
+				{"id": "2", "date_create": 110, "action": "user_login"},
+			},
+		}
+		if r.URL.Query().Get("cursor") == "" {
+			response["response_metadata"] = map[string]string{"next_cursor": "page2"}
+		} else {
+			response["entries"] = []map[string]interface{}{{"id": "1", "date_create": 100, "action": "user_logout"}}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+	originalURL := slackAuditAPIBaseURL
+	slackAuditAPIBaseURL = server.URL + "/"
+	defer func() { slackAuditAPIBaseURL = originalURL }()
+	slackAuditToken = "xoxp-audit"
+	defer func() { slackAuditToken = "" }()
+
+	poller := &auditLogPoller{actions: "user_login,user_logout", oldest: 100, seen: map[string]bool{"1": true}}
+	if err := poller.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 page requests, got %d", len(requests))
+	}
+	if poller.oldest != 120 || !poller.seen["3"] || poller.seen["2"] {
+		t.Errorf("unexpected poller position %d, seen %v", poller.oldest, poller.seen)
+	}
+}
+
+func TestFetchAuditLogsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"feature_not_enabled"}`))
+	}))
+	defer server.Close()
+	originalURL := slackAuditAPIBaseURL
+	slackAuditAPIBaseURL = server.URL + "/"
+	defer func() { slackAuditAPIBaseURL = originalURL }()
+
+	if _, err := fetchAuditLogs(context.Background(), "xoxp-audit", 0, ""); err == nil {
+		t.Error("expected an error when the API responds with ok=false")
+	}
+}
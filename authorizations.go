@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+// slackAppToken is the app-level token (xapp-...) with the authorizations:read
+// scope, used to expand event authorizations
+var slackAppToken string
+
+// getSlackAppToken returns the current Slack app-level token
+func getSlackAppToken() string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return slackAppToken
+}
+
+// authorizationsListResponse is the apps.event.authorizations.list response
+type authorizationsListResponse struct {
+	slackAPIResponse
+	Authorizations []interface{} `json:"authorizations"`
+}
+
+// expandAuthorizations fetches the full list of authorizations for an event.
+// Slack truncates the authorizations delivered with an event to a single entry,
+// so consumers that need every installation able to see the event (e.g. on
+// Enterprise Grid or shared channels) must look them up by event_context.
+func expandAuthorizations(ctx context.Context, payload map[string]interface{}) ([]interface{}, error) {
+	appToken := getSlackAppToken()
+	if appToken == "" {
+		return nil, errors.New("SLACK_APP_TOKEN is not configured")
+	}
+
+	eventContext, ok := payload["event_context"].(string)
+	if !ok || eventContext == "" {
+		return nil, errors.New("payload has no event_context")
+	}
+
+	var authorizations []interface{}
+	cursor := ""
+	for {
+		params := url.Values{}
+		params.Set("event_context", eventContext)
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+
+		var result authorizationsListResponse
+		if err := callSlackAPI(ctx, "apps.event.authorizations.list", appToken, params, &result); err != nil {
+			return nil, err
+		}
+		authorizations = append(authorizations, result.Authorizations...)
+
+		cursor = result.ResponseMetadata.NextCursor
+		if cursor == "" {
+			return authorizations, nil
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpandAuthorizations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apps.event.authorizations.list" {
+			t.Errorf("unexpected API method: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer xapp-test" {
+			t.Errorf("unexpected Authorization header: %s", got)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %v", err)
+		}
+		if r.Form.Get("event_context") != "ctx-123" {
+			t.Errorf("unexpected event_context: %s", r.Form.Get("event_context"))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Form.Get("cursor") == "" {
+			w.Write([]byte(`{"ok":true,"authorizations":[{"team_id":"T1"}],"response_metadata":{"next_cursor":"page2"}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"authorizations":[{"team_id":"T2"}],"response_metadata":{"next_cursor":""}}`))
+	}))
+	defer server.Close()
+
+	originalURL, originalToken := slackAPIBaseURL, slackAppToken
+	slackAPIBaseURL, slackAppToken = server.URL+"/", "xapp-test"
+	defer func() { slackAPIBaseURL, slackAppToken = originalURL, originalToken }()
+
+	payload := map[string]interface{}{"event_context": "ctx-123"}
+	authorizations, err := expandAuthorizations(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("expandAuthorizations returned error: %v", err)
+	}
+	if len(authorizations) != 2 {
+		t.Fatalf("expected 2 authorizations, got %d", len(authorizations))
+	}
+}
+
+func TestExpandAuthorizationsSlackError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+	}))
+	defer server.Close()
+
+	originalURL, originalToken := slackAPIBaseURL, slackAppToken
+	slackAPIBaseURL, slackAppToken = server.URL+"/", "xapp-test"
+	defer func() { slackAPIBaseURL, slackAppToken = originalURL, originalToken }()
+
+	_, err := expandAuthorizations(context.Background(), map[string]interface{}{"event_context": "ctx-123"})
+	if err == nil {
+		t.Error("expected error for ok=false response, got nil")
+	}
+}
+
+func TestExpandAuthorizationsWithoutToken(t *testing.T) {
+	originalToken := slackAppToken
+	slackAppToken = ""
+	defer func() { slackAppToken = originalToken }()
+
+	_, err := expandAuthorizations(context.Background(), map[string]interface{}{"event_context": "ctx-123"})
+	if err == nil {
+		t.Error("expected error without SLACK_APP_TOKEN, got nil")
+	}
+}
+
+func TestWithRelayMetadata(t *testing.T) {
+	payload := map[string]interface{}{"type": "event_callback"}
+	data, err := withRelayMetadata(payload, map[string]interface{}{"authorizations": []interface{}{"a"}})
+	if err != nil {
+		t.Fatalf("withRelayMetadata returned error: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if _, ok := decoded[relayMetadataKey].(map[string]interface{}); !ok {
+		t.Errorf("expected %s metadata in result, got %v", relayMetadataKey, decoded)
+	}
+	if _, ok := payload[relayMetadataKey]; ok {
+		t.Error("expected input payload to be left unchanged")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// defaultBatchMaxLatency is how long a batch waits for more events when the
+// route's batch policy does not set max-latency
+const defaultBatchMaxLatency = time.Second
+
+// BatchPolicy configures coalescing a route's events into batched publishes
+type BatchPolicy struct {
+	// MaxSize is the number of events that triggers a publish; batching is
+	// enabled when it is greater than 1
+	MaxSize int `json:"max-size,omitempty"`
+	// MaxLatency is the longest an event waits in a batch before it is published
+	MaxLatency Duration `json:"max-latency,omitempty"`
+}
+
+// enabled reports whether the policy batches events
+func (p BatchPolicy) enabled() bool {
+	return p.MaxSize > 1
+}
+
+// batchEnvelope is the message published for a batch of events
+type batchEnvelope struct {
+	Type      string            `json:"type"`
+	EventType string            `json:"event_type"`
+	Count     int               `json:"count"`
+	Events    []json.RawMessage `json:"events"`
+}
+
+// routeBatcher collects the events of one route until the batch is full or its
+// oldest event reaches the maximum latency
+type routeBatcher struct {
+	mu        sync.Mutex
+	eventType string
+	region    string
+	target    publishTarget
+	events    []json.RawMessage
+	timer     *time.Timer
+}
+
+// batchers holds a batcher per event type, region and publish target
+var batchers = make(map[string]*routeBatcher)
+var batchersMu sync.Mutex
+
+var metricBatchesPublished = newCounterVec("slack_relay_batches_published_total",
+	"Batch envelopes published, by event type.", "event_type")
+
+// addToBatch adds an event to its route's batch, publishing the batch when it
+// reaches the policy's max size
+func addToBatch(eventType string, region string, target publishTarget, payload []byte, policy BatchPolicy, retry RetryPolicy) {
+	key := eventType + "\xff" + region + "\xff" + target.String()
+	batchersMu.Lock()
+	batcher, ok := batchers[key]
+	if !ok {
+		batcher = &routeBatcher{eventType: eventType, region: region, target: target}
+		batchers[key] = batcher
+	}
+	batchersMu.Unlock()
+
+	batcher.add(payload, policy, retry)
+}
+
+// add appends payload to the batch, starting the latency timer for the first event
+func (b *routeBatcher) add(payload []byte, policy BatchPolicy, retry RetryPolicy) {
+	b.mu.Lock()
+	b.events = append(b.events, json.RawMessage(payload))
+	if len(b.events) >= policy.MaxSize {
+		events := b.take()
+		b.mu.Unlock()
+		go b.publish(events, retry)
+		return
+	}
+
+	if b.timer == nil {
+		latency := time.Duration(policy.MaxLatency)
+		if latency <= 0 {
+			latency = defaultBatchMaxLatency
+		}
+		var timer *time.Timer
+		timer = time.AfterFunc(latency, func() {
+			b.mu.Lock()
+			if b.timer != timer {
+				// The batch filled up and was published while this timer fired
+				b.mu.Unlock()
+				return
+			}
+			events := b.take()
+			b.mu.Unlock()
+			b.publish(events, retry)
+		})
+		b.timer = timer
+	}
+	b.mu.Unlock()
+}
+
+// take removes and returns the batched events. The caller must hold b.mu.
+func (b *routeBatcher) take() []json.RawMessage {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	events := b.events
+	b.events = nil
+	return events
+}
+
+// publish publishes events as a single batch envelope
+func (b *routeBatcher) publish(events []json.RawMessage, retry RetryPolicy) {
+	if len(events) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(batchEnvelope{Type: "batch", EventType: b.eventType, Count: len(events), Events: events})
+	if err != nil {
+		logError("Error encoding batch of %d '%s' event(s): %v", len(events), b.eventType, err)
+		metricPublishErrors.Add(float64(len(events)), eventTypeLabel(b.eventType))
+		return
+	}
+
+	err = retry.withRetry(func() error {
+		return publishRegionTarget(b.region, b.target, data)
+	}, func(attempt int, err error) {
+		logWarn("Retrying publish of '%s' batch to %s after attempt %d: %v", b.eventType, b.target, attempt, err)
+		metricPublishRetries.Inc(eventTypeLabel(b.eventType))
+	})
+	if err != nil {
+		metricPublishErrors.Add(float64(len(events)), eventTypeLabel(b.eventType))
+		return
+	}
+	metricBatchesPublished.Inc(eventTypeLabel(b.eventType))
+	metricEventsPublished.Add(float64(len(events)), eventTypeLabel(b.eventType))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRouteBatcherFlushesWhenFull(t *testing.T) {
+	batcher := &routeBatcher{eventType: "message", target: pubsubTarget("messages")}
+	policy := BatchPolicy{MaxSize: 3, MaxLatency: Duration(time.Hour)}
+
+	batcher.add([]byte(`{"n":1}`), policy, RetryPolicy{})
+	batcher.add([]byte(`{"n":2}`), policy, RetryPolicy{})
+	batcher.mu.Lock()
+	if len(batcher.events) != 2 || batcher.timer == nil {
+		t.Errorf("expected 2 pending events and a latency timer, got %d events", len(batcher.events))
+	}
+	batcher.mu.Unlock()
+
+	batcher.add([]byte(`{"n":3}`), policy, RetryPolicy{})
+	batcher.mu.Lock()
+	defer batcher.mu.Unlock()
+	if len(batcher.events) != 0 || batcher.timer != nil {
+		t.Errorf("expected full batch to be taken for publishing, got %d pending events", len(batcher.events))
+	}
+}
+
+func TestRouteBatcherFlushesAfterLatency(t *testing.T) {
+	batcher := &routeBatcher{eventType: "message", target: pubsubTarget("messages")}
+	policy := BatchPolicy{MaxSize: 100, MaxLatency: Duration(10 * time.Millisecond)}
+
+	batcher.add([]byte(`{"n":1}`), policy, RetryPolicy{})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		batcher.mu.Lock()
+		pending := len(batcher.events)
+		batcher.mu.Unlock()
+		if pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the batch to be published after its max latency")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBatchEnvelopeEncoding(t *testing.T) {
+	envelope := batchEnvelope{Type: "batch", EventType: "message", Count: 2, Events: []json.RawMessage{[]byte(`{"n":1}`), []byte(`{"n":2}`)}}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("failed to encode envelope: %v", err)
+	}
+	if string(data) != `{"type":"batch","event_type":"message","count":2,"events":[{"n":1},{"n":2}]}` {
+		t.Errorf("unexpected envelope: %s", data)
+	}
+}
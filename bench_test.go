@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// benchmarkPayload is a typical message event callback
+var benchmarkPayload = []byte(`{"token":"XXYYZZ","team_id":"T1H9RESGL","api_app_id":"A2H9RFS1A","type":"event_callback","event_id":"Ev08MFMKH6","event_time":1355517523,"event":{"type":"message","channel":"C2147483705","user":"U2147483697","text":"Hello world","ts":"1355517523.000005"}}`)
+
+// quietLogs raises the log level for the duration of a benchmark, so per-event
+// log lines do not dominate the measurement
+func quietLogs(b *testing.B) {
+	level := currentLogLevel
+	currentLogLevel = ERROR
+	b.Cleanup(func() { currentLogLevel = level })
+}
+
+func BenchmarkVerifySlackSignature(b *testing.B) {
+	signingSecret = []byte("benchmark-secret")
+	defer func() { signingSecret = []byte{} }()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := computeSlackSignature(benchmarkPayload, timestamp, signingSecret)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if !verifySlackSignature(benchmarkPayload, timestamp, signature) {
+			b.Fatal("expected the signature to verify")
+		}
+	}
+}
+
+func BenchmarkParseSlackPayload(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := parseSlackPayload("application/json", benchmarkPayload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLookupEventConfig(b *testing.B) {
+	configs := make([]EventConfig, 0, 50)
+	for i := 0; i < 50; i++ {
+		configs = append(configs, EventConfig{EventType: "event_" + strconv.Itoa(i), Channel: "channel"})
+	}
+	configs = append(configs, EventConfig{EventType: "message", Channel: "test-channel"})
+	setEventConfigs(configs)
+	defer setupTestEnvironment()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, ok := lookupEventConfig("message"); !ok {
+			b.Fatal("expected the message route to be found")
+		}
+	}
+}
+
+func BenchmarkRouteEvent(b *testing.B) {
+	setupTestEnvironment()
+	quietLogs(b)
+	parsed, err := parseSlackPayload("application/json", benchmarkPayload)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if routed := routeEvent(parsed.Fields(), parsed.Raw); routed.Skip != "" {
+			b.Fatalf("expected the event to be routed, got %q", routed.Skip)
+		}
+	}
+}
+
+func BenchmarkRouteEventWithTags(b *testing.B) {
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "test-channel", Tags: map[string]string{"team": "platform"}}})
+	defer setupTestEnvironment()
+	quietLogs(b)
+	parsed, err := parseSlackPayload("application/json", benchmarkPayload)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		routeEvent(parsed.Fields(), parsed.Raw)
+	}
+}
+
+func BenchmarkSignPayload(b *testing.B) {
+	envelopeSigningKey = []byte("benchmark-key")
+	defer func() { envelopeSigningKey = nil }()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		signPayload(benchmarkPayload)
+	}
+}
+
+func BenchmarkSlackHandler(b *testing.B) {
+	setupTestEnvironment()
+	quietLogs(b)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(benchmarkPayload))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		slackHandler(recorder, req)
+		if recorder.Code != http.StatusOK {
+			b.Fatalf("expected status 200, got %d", recorder.Code)
+		}
+	}
+}
+
+func BenchmarkCounterAdd(b *testing.B) {
+	counter := &counterVec{name: "test_events_total", labels: []string{"event_type", "team_id"}, values: make(map[string]float64)}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		counter.Inc("message", "T1H9RESGL")
+	}
+}
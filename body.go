@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// defaultMaxBodyBytes is the largest request body accepted unless overridden
+const defaultMaxBodyBytes = 10 << 20
+
+// maxPooledBodyBytes is the largest buffer returned to the pool, so a few huge
+// payloads do not pin their memory for the life of the process
+const maxPooledBodyBytes = 1 << 20
+
+// maxRequestBodyBytes is the largest request body accepted on /slack
+var maxRequestBodyBytes int64 = defaultMaxBodyBytes
+
+// errBodyTooLarge is returned when a request body exceeds maxRequestBodyBytes
+var errBodyTooLarge = errors.New("request body too large")
+
+// bodyBuffers pools the buffers request bodies are read into
+var bodyBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// readRequestBody reads at most maxRequestBodyBytes of r's body into a pooled
+// buffer. The returned bytes are only valid until release is called, so copy
+// anything that outlives the request.
+func readRequestBody(w http.ResponseWriter, r *http.Request) (body []byte, release func(), err error) {
+	buffer := bodyBuffers.Get().(*bytes.Buffer)
+	buffer.Reset()
+	release = func() {
+		if buffer.Cap() <= maxPooledBodyBytes {
+			bodyBuffers.Put(buffer)
+		}
+	}
+
+	if r.ContentLength > 0 && r.ContentLength <= maxRequestBodyBytes {
+		buffer.Grow(int(r.ContentLength))
+	}
+	if _, err := buffer.ReadFrom(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)); err != nil {
+		release()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, nil, errBodyTooLarge
+		}
+		return nil, nil, err
+	}
+	return buffer.Bytes(), release, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadRequestBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(`{"type":"event_callback"}`))
+	body, release, err := readRequestBody(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != `{"type":"event_callback"}` {
+		t.Errorf("unexpected body %q", body)
+	}
+	release()
+}
+
+func TestSlackHandlerRejectsLargeBody(t *testing.T) {
+	setupTestEnvironment()
+	maxRequestBodyBytes = 16
+	defer func() { maxRequestBodyBytes = defaultMaxBodyBytes }()
+
+	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader([]byte(`{"type":"event_callback","event":{"type":"message"}}`)))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	slackHandler(recorder, req)
+
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// canaryEventType is the event type of the relay's synthetic canary events
+const canaryEventType = "relay_canary"
+
+// canaryLatencyBuckets are the histogram buckets, in seconds, of canary latencies
+var canaryLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// canaryClient is the HTTP client canary events are sent with
+var canaryClient = &http.Client{Timeout: 10 * time.Second}
+
+var metricCanariesSent = newCounterVec("slack_relay_canaries_sent_total",
+	"Canary events sent through the relay's HTTP endpoint, by result.", "result")
+var metricCanariesReceived = newCounterVec("slack_relay_canaries_received_total",
+	"Canary events received back from Redis by the canary consumer.")
+var metricCanaryAckLatency = newHistogram("slack_relay_canary_ack_seconds",
+	"Time for the relay to acknowledge a canary event over HTTP.", canaryLatencyBuckets)
+var metricCanaryLatency = newHistogram("slack_relay_canary_latency_seconds",
+	"Time from sending a canary event to receiving it from Redis.", canaryLatencyBuckets)
+
+// canaryURLFromEnv returns CANARY_URL, or the relay's own /slack endpoint on the
+// loopback interface when it is not set
+func canaryURLFromEnv() string {
+	if target := os.Getenv("CANARY_URL"); target != "" {
+		return target
+	}
+	addr := listenAddrFromEnv()
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	return "http://" + addr + "/slack"
+}
+
+// buildCanaryEvent returns a canary event callback sent at now
+func buildCanaryEvent(now time.Time) ([]byte, error) {
+	id := strconv.FormatInt(now.UnixNano(), 36)
+	return json.Marshal(map[string]interface{}{
+		"type":       "event_callback",
+		"event_id":   "canary-" + id,
+		"event_time": now.Unix(),
+		"event": map[string]interface{}{
+			"type":    canaryEventType,
+			"sent_at": now.UnixNano(),
+		},
+	})
+}
+
+// sendCanary posts a canary event, signed like a Slack request, to target and
+// records how long the relay took to acknowledge it
+func sendCanary(ctx context.Context, target string, now time.Time) error {
+	body, err := buildCanaryEvent(now)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	if secret := getSigningSecret(); len(secret) > 0 {
+		req.Header.Set("X-Slack-Signature", computeSlackSignature(body, timestamp, secret))
+	}
+	// Canaries are always processed by the replica that sent them
+	req.Header.Set(shardForwardedHeader, instanceID)
+
+	resp, err := canaryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("relay returned status %d", resp.StatusCode)
+	}
+	metricCanaryAckLatency.Observe(time.Since(now).Seconds())
+	return nil
+}
+
+// watchCanary sends a canary event to target every interval until ctx is cancelled
+func watchCanary(ctx context.Context, target string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, ok := lookupEventConfig(canaryEventType); !ok {
+				logWarn("Not sending canary event: no route is configured for '%s'", canaryEventType)
+				continue
+			}
+			if err := sendCanary(ctx, target, now); err != nil {
+				logWarn("Canary event failed: %v", err)
+				metricCanariesSent.Inc("failure")
+				continue
+			}
+			metricCanariesSent.Inc("success")
+		}
+	}
+}
+
+// canarySentAt returns when a canary event read from Redis was sent. Envelopes
+// signed by the relay are unwrapped; other messages are not canaries.
+func canarySentAt(message string) (time.Time, bool) {
+	var payload struct {
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+		Event   struct {
+			Type   string `json:"type"`
+			SentAt int64  `json:"sent_at"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal([]byte(message), &payload); err != nil {
+		return time.Time{}, false
+	}
+	if payload.Type == "signed" {
+		return canarySentAt(string(payload.Payload))
+	}
+	if payload.Event.Type != canaryEventType || payload.Event.SentAt == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, payload.Event.SentAt), true
+}
+
+// runCanaryConsumer subscribes to the canary route's channel and records the
+// latency of every canary event received until ctx is cancelled
+func runCanaryConsumer(ctx context.Context, channel string) error {
+	if redisClient == nil {
+		return errRedisUnavailable
+	}
+
+	pubsub := redisClient.Subscribe(ctx, channel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			sentAt, ok := canarySentAt(message.Payload)
+			if !ok {
+				continue
+			}
+			metricCanariesReceived.Inc()
+			metricCanaryLatency.Observe(time.Since(sentAt).Seconds())
+		}
+	}
+}
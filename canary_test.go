@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendCanary(t *testing.T) {
+	setupTestEnvironment()
+	setEventConfigs([]EventConfig{{EventType: canaryEventType, Channel: "slack-relay-canary"}})
+	defer setupTestEnvironment()
+	signingSecret = []byte("canary-secret")
+	defer func() { signingSecret = []byte{} }()
+
+	server := httptest.NewServer(http.HandlerFunc(slackHandler))
+	defer server.Close()
+
+	if err := sendCanary(context.Background(), server.URL, time.Now()); err != nil {
+		t.Errorf("expected the relay to accept a signed canary event, got %v", err)
+	}
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { rejectQueueFull(w) }))
+	defer unavailable.Close()
+	if err := sendCanary(context.Background(), unavailable.URL, time.Now()); err == nil {
+		t.Error("expected an error when the relay does not acknowledge the canary")
+	}
+}
+
+func TestCanarySentAt(t *testing.T) {
+	now := time.Unix(1700000000, 123)
+	event, err := buildCanaryEvent(now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sentAt, ok := canarySentAt(string(event)); !ok || !sentAt.Equal(now) {
+		t.Errorf("expected sent time %v, got %v (%v)", now, sentAt, ok)
+	}
+
+	envelopeSigningKey = []byte("relay-key")
+	signed := signPayload(event)
+	envelopeSigningKey = nil
+	if sentAt, ok := canarySentAt(string(signed)); !ok || !sentAt.Equal(now) {
+		t.Errorf("expected signed canaries to be unwrapped, got %v (%v)", sentAt, ok)
+	}
+
+	if _, ok := canarySentAt(`{"type":"event_callback","event":{"type":"message"}}`); ok {
+		t.Error("expected other events not to be treated as canaries")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the relay the time. Signature and timestamp checks, dedup and
+// retry windows and periodic aggregations read it, so tests can freeze and
+// advance time instead of sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// clock is the relay's clock
+var clock Clock = systemClock{}
+
+// systemClock is the wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// manualClock is a Clock that stands still until it is set or advanced
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// newManualClock creates a manualClock frozen at now
+func newManualClock(now time.Time) *manualClock {
+	return &manualClock{now: now}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// set moves the clock to now
+func (c *manualClock) set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// advance moves the clock forward by d
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// useClock makes c the relay's clock, returning a function restoring the
+// previous one
+func useClock(c Clock) func() {
+	previous := clock
+	clock = c
+	return func() { clock = previous }
+}
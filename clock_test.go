@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+	c := newManualClock(start)
+	if !c.Now().Equal(start) {
+		t.Errorf("expected the clock frozen at %s, got %s", start, c.Now())
+	}
+	c.advance(90 * time.Second)
+	if want := start.Add(90 * time.Second); !c.Now().Equal(want) {
+		t.Errorf("expected %s after advancing, got %s", want, c.Now())
+	}
+	c.set(start)
+	if !c.Now().Equal(start) {
+		t.Errorf("expected %s after setting, got %s", start, c.Now())
+	}
+}
+
+func TestVerifySlackSignatureTimestampWindow(t *testing.T) {
+	signingSecret = []byte("test-signing-secret")
+	defer func() { signingSecret = []byte{} }()
+	start := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+	c := newManualClock(start)
+	defer useClock(c)()
+
+	body := []byte(`{"type":"event_callback"}`)
+	ts := strconv.FormatInt(start.Unix(), 10)
+	sig := computeTestSignature(body, ts, signingSecret)
+
+	c.advance(slackTimestampToleranceSeconds * time.Second)
+	if !verifySlackSignature(body, ts, sig) {
+		t.Error("expected a request at the edge of the window to pass")
+	}
+	c.advance(time.Second)
+	if verifySlackSignature(body, ts, sig) {
+		t.Error("expected a request past the window to be rejected")
+	}
+	c.set(start.Add(-slackTimestampToleranceSeconds*time.Second - time.Second))
+	if verifySlackSignature(body, ts, sig) {
+		t.Error("expected a request from too far in the future to be rejected")
+	}
+}
+
+func TestMemoryDedupStoreFollowsClock(t *testing.T) {
+	c := newManualClock(time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC))
+	defer useClock(c)()
+	store := newMemoryDedupStore(time.Minute, 10)
+	ctx := context.Background()
+
+	store.claim(ctx, "Ev1")
+	if first, _ := store.claim(ctx, "Ev1"); first {
+		t.Error("expected a redelivery within the TTL to be dropped")
+	}
+	c.advance(time.Minute + time.Second)
+	if first, _ := store.claim(ctx, "Ev1"); !first {
+		t.Error("expected a redelivery after the TTL to be relayed")
+	}
+}
+
+func TestRoutingFollowsClock(t *testing.T) {
+	defer setupTestEnvironment()
+	// A Friday at noon
+	start := time.Date(2030, 7, 5, 12, 0, 0, 0, time.UTC)
+	c := newManualClock(start)
+	defer useClock(c)()
+
+	payload := map[string]interface{}{
+		"type":       "event_callback",
+		"event_time": float64(start.Add(-time.Minute).Unix()),
+		"event":      map[string]interface{}{"type": "message"},
+	}
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "messages", Stale: StalePolicy{MaxAge: Duration(10 * time.Minute)}}})
+	if routed := routeEvent(payload, nil); routed.Stale != "" || routed.Skip != "" {
+		t.Errorf("expected a recent event to be routed, got %+v", routed)
+	}
+	c.advance(20 * time.Minute)
+	if routed := routeEvent(payload, nil); routed.Skip != skipStale {
+		t.Errorf("expected the event to be stale once the clock advanced, got %+v", routed)
+	}
+
+	delete(payload, "event_time")
+	policy := ActiveHoursPolicy{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "messages", ActiveHours: policy}})
+	if routed := routeEvent(payload, nil); routed.OutsideHours != "" || routed.Skip != "" {
+		t.Errorf("expected an event within active hours to be routed, got %+v", routed)
+	}
+	c.advance(24 * time.Hour)
+	if routed := routeEvent(payload, nil); routed.Skip != skipOutsideHours {
+		t.Errorf("expected an event on Saturday to be dropped, got %+v", routed)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultRequestQueueTimeout is how long a request waits for a free slot when
+// the concurrent request limit is reached
+const defaultRequestQueueTimeout = time.Second
+
+// concurrencyRetryAfterSeconds is the Retry-After sent with requests rejected
+// by the concurrent request limit
+const concurrencyRetryAfterSeconds = 1
+
+// requestLimiter caps the /slack requests handled at once. Requests over the
+// cap wait up to queueTimeout for a slot and are rejected when none frees up.
+type requestLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+// requestLimit is the concurrent request limit of /slack; nil means unlimited
+var requestLimit *requestLimiter
+
+var metricConcurrencyRejections = newCounterVec("slack_relay_concurrency_rejections_total",
+	"Requests rejected with 503 because the concurrent request limit was reached.")
+
+func init() {
+	newGaugeFunc("slack_relay_inflight_requests", "Slack requests currently being handled under the concurrent request limit.", func() float64 {
+		if limiter := requestLimit; limiter != nil {
+			return float64(len(limiter.slots))
+		}
+		return 0
+	})
+}
+
+// newRequestLimiter returns a limiter allowing max concurrent requests, or nil
+// when max is not positive
+func newRequestLimiter(max int, queueTimeout time.Duration) *requestLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &requestLimiter{slots: make(chan struct{}, max), queueTimeout: queueTimeout}
+}
+
+// acquire takes a slot, waiting up to the queue timeout or until done is
+// closed. It reports whether a slot was taken.
+func (l *requestLimiter) acquire(done <-chan struct{}) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.queueTimeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-done:
+		return false
+	}
+}
+
+// release frees a slot taken by acquire
+func (l *requestLimiter) release() {
+	<-l.slots
+}
+
+// limitConcurrency wraps a handler with the concurrent request limit. Requests
+// that find no free slot get 503 Service Unavailable, so Slack retries them later.
+func limitConcurrency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limiter := requestLimit
+		if limiter == nil {
+			next(w, r)
+			return
+		}
+		if !limiter.acquire(r.Context().Done()) {
+			logWarn("Rejecting request: %d concurrent request(s) already in flight", cap(limiter.slots))
+			metricConcurrencyRejections.Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(concurrencyRetryAfterSeconds))
+			http.Error(w, "Too many concurrent requests", http.StatusServiceUnavailable)
+			return
+		}
+		defer limiter.release()
+		next(w, r)
+	}
+}
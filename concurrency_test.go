@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	if newRequestLimiter(0, time.Second) != nil {
+		t.Error("expected no limiter without a cap")
+	}
+
+	limiter := newRequestLimiter(1, 20*time.Millisecond)
+	if !limiter.acquire(nil) {
+		t.Fatal("expected the first request to get a slot")
+	}
+	start := time.Now()
+	if limiter.acquire(nil) {
+		t.Fatal("expected the second request to be rejected")
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("expected the second request to wait for the queue timeout, waited %s", waited)
+	}
+
+	// A slot freed while waiting is taken
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		limiter.release()
+	}()
+	if !limiter.acquire(nil) {
+		t.Error("expected the released slot to be taken")
+	}
+
+	// Cancelled requests stop waiting
+	done := make(chan struct{})
+	close(done)
+	limiter.queueTimeout = time.Minute
+	if limiter.acquire(done) {
+		t.Error("expected a cancelled request to be rejected")
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	requestLimit = newRequestLimiter(1, 0)
+	defer func() { requestLimit = nil }()
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	handler := limitConcurrency(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+	})
+
+	go handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/slack", nil))
+	<-entered
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/slack", nil))
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 503 with Retry-After while the limit is reached, got %d %q", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+	close(unblock)
+}
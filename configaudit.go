@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+)
+
+// Route change actions recorded in configuration audit records
+const (
+	routeAdded   = "added"
+	routeRemoved = "removed"
+	routeChanged = "changed"
+)
+
+// configAuditChannel is the Redis channel receiving configuration change audit
+// records. Empty disables publishing; records are always logged.
+var configAuditChannel string
+
+// routeChange describes how a single route differs between two configurations
+type routeChange struct {
+	EventType string       `json:"event_type"`
+	Action    string       `json:"action"`
+	Before    *EventConfig `json:"before,omitempty"`
+	After     *EventConfig `json:"after,omitempty"`
+}
+
+// diffEventConfigs returns the routes added, removed or changed between before
+// and after, ordered by event type and filters
+func diffEventConfigs(before []EventConfig, after []EventConfig) []routeChange {
+	beforeMap := make(map[string]EventConfig, len(before))
+	for _, config := range before {
+		beforeMap[config.routeKey()] = config
+	}
+	afterMap := make(map[string]EventConfig, len(after))
+	for _, config := range after {
+		afterMap[config.routeKey()] = config
+	}
+
+	routeKeys := make([]string, 0, len(beforeMap)+len(afterMap))
+	for key := range beforeMap {
+		routeKeys = append(routeKeys, key)
+	}
+	for key := range afterMap {
+		if _, ok := beforeMap[key]; !ok {
+			routeKeys = append(routeKeys, key)
+		}
+	}
+	sort.Strings(routeKeys)
+
+	var changes []routeChange
+	for _, key := range routeKeys {
+		oldConfig, hadRoute := beforeMap[key]
+		newConfig, hasRoute := afterMap[key]
+		switch {
+		case !hadRoute:
+			changes = append(changes, routeChange{EventType: newConfig.EventType, Action: routeAdded, After: &newConfig})
+		case !hasRoute:
+			changes = append(changes, routeChange{EventType: oldConfig.EventType, Action: routeRemoved, Before: &oldConfig})
+		case !sameEventConfig(oldConfig, newConfig):
+			changes = append(changes, routeChange{EventType: newConfig.EventType, Action: routeChanged, Before: &oldConfig, After: &newConfig})
+		}
+	}
+	return changes
+}
+
+// sameEventConfig reports whether two routes have the same configuration
+func sameEventConfig(a EventConfig, b EventConfig) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+// auditConfigChange logs and publishes an audit record describing the route
+// changes between before and after. actor identifies who made the change and
+// source where the new configuration came from. Nothing is recorded when the
+// routes are unchanged.
+func auditConfigChange(actor string, source string, before []EventConfig, after []EventConfig) {
+	changes := diffEventConfigs(before, after)
+	if len(changes) == 0 {
+		logDebug("Configuration from %s has no route changes", source)
+		return
+	}
+
+	host, _ := os.Hostname()
+	record := map[string]interface{}{
+		"type":      "config_changed",
+		"actor":     actor,
+		"source":    source,
+		"host":      host,
+		"routes":    len(after),
+		"changes":   changes,
+		"timestamp": clock.Now().UTC().Format(time.RFC3339),
+	}
+
+	logAudit(record)
+	publishConfigAudit(record)
+}
+
+// publishConfigAudit publishes a configuration audit record to the audit channel, if configured
+func publishConfigAudit(record map[string]interface{}) {
+	if configAuditChannel == "" || redisClient == nil {
+		return
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		logError("Error formatting configuration audit record: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := redisClient.Publish(ctx, configAuditChannel, data).Err(); err != nil {
+		logError("Error publishing to config audit channel '%s': %v", configAuditChannel, err)
+	}
+}
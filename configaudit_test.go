@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestDiffEventConfigs(t *testing.T) {
+	before := []EventConfig{
+		{EventType: "message", Channel: "slack-messages"},
+		{EventType: "reaction_added", Channel: "slack-reactions"},
+		{EventType: "app_mention", Channel: "slack-mentions"},
+	}
+	after := []EventConfig{
+		{EventType: "message", Channel: "slack-messages"},
+		{EventType: "reaction_added", Channel: "slack-reactions-v2"},
+		{EventType: "team_join", Channel: "slack-joins"},
+	}
+
+	changes := diffEventConfigs(before, after)
+	expected := []struct {
+		eventType string
+		action    string
+	}{
+		{"app_mention", routeRemoved},
+		{"reaction_added", routeChanged},
+		{"team_join", routeAdded},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i, want := range expected {
+		if changes[i].EventType != want.eventType || changes[i].Action != want.action {
+			t.Errorf("change %d = %s %s, want %s %s", i, changes[i].EventType, changes[i].Action, want.eventType, want.action)
+		}
+	}
+	if changes[1].Before.Channel != "slack-reactions" || changes[1].After.Channel != "slack-reactions-v2" {
+		t.Errorf("expected changed route to carry both versions, got %+v", changes[1])
+	}
+	if changes[0].After != nil || changes[2].Before != nil {
+		t.Error("expected added and removed routes to carry only one version")
+	}
+}
+
+func TestDiffEventConfigsUnchanged(t *testing.T) {
+	ackBody := ""
+	configs := []EventConfig{{EventType: "message", Channel: "slack-messages", AckBody: &ackBody}}
+	sameBody := ""
+	same := []EventConfig{{EventType: "message", Channel: "slack-messages", AckBody: &sameBody}}
+
+	if changes := diffEventConfigs(configs, same); len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
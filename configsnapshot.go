@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// configSnapshot is an immutable view of the active configuration. A reload
+// builds a new snapshot and swaps it in whole, so handlers loading the snapshot
+// once per request see one consistent configuration without locking.
+type configSnapshot struct {
+	routes []EventConfig
+	// byEventType holds the route of each event type, preferring its route
+	// without filters. Routes are held by pointer into routes, so lookups do
+	// not copy them.
+	byEventType map[string]*EventConfig
+	// filteredRoutes holds, per event type, the routes limited by channel types,
+	// commands, domains or the other route filters
+	filteredRoutes map[string][]*EventConfig
+	// routeMatchers holds the matcher of each event type with filtered routes
+	routeMatchers map[string]routeMatcher
+	// eventTypePatterns holds the patterns of the routes, in configuration order
+	eventTypePatterns []eventTypePattern
+	// templates are the named message templates
+	templates map[string]map[string]interface{}
+	// endpoints holds the custom endpoints by path
+	endpoints map[string]endpointConfig
+}
+
+// activeConfig is the active configuration snapshot
+var activeConfig atomic.Pointer[configSnapshot]
+
+// configMu serializes configuration updates. Readers load activeConfig instead.
+var configMu sync.Mutex
+
+// emptyConfig is the snapshot read before any configuration is loaded
+var emptyConfig = &configSnapshot{}
+
+// currentConfig returns the active configuration snapshot. It must not be modified.
+func currentConfig() *configSnapshot {
+	if snapshot := activeConfig.Load(); snapshot != nil {
+		return snapshot
+	}
+	return emptyConfig
+}
+
+// updateConfig replaces the active configuration with a copy of it changed by
+// update. The maps and slices of the copy are shared with the active snapshot,
+// so update must replace them rather than modify them.
+func updateConfig(update func(next *configSnapshot)) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	next := *currentConfig()
+	update(&next)
+	activeConfig.Store(&next)
+}
+
+// setRoutes replaces the routes of the snapshot and rebuilds their lookup maps
+func (s *configSnapshot) setRoutes(configs []EventConfig) {
+	s.routes = configs
+	s.byEventType = make(map[string]*EventConfig)
+	s.filteredRoutes = make(map[string][]*EventConfig)
+	for i := range configs {
+		config := &configs[i]
+		if config.filtered() {
+			s.filteredRoutes[config.EventType] = append(s.filteredRoutes[config.EventType], config)
+			// The lookup map prefers the event type's route without filters
+			if _, ok := s.byEventType[config.EventType]; ok {
+				continue
+			}
+		}
+		s.byEventType[config.EventType] = config
+	}
+
+	s.eventTypePatterns = newEventTypePatterns(configs)
+
+	s.routeMatchers = make(map[string]routeMatcher, len(s.filteredRoutes))
+	for eventType, routes := range s.filteredRoutes {
+		s.routeMatchers[eventType] = newRouteMatcher(routes)
+	}
+}
+
+// lookup returns the configuration for eventType, if it is routed by its name
+// or a pattern
+func (s *configSnapshot) lookup(eventType string) (EventConfig, bool) {
+	config, ok := s.byEventType[eventType]
+	if !ok {
+		config, ok = s.byEventType[s.matchEventType(eventType, nil)]
+	}
+	if !ok {
+		return EventConfig{}, false
+	}
+	return *config, true
+}
+
+// activateConfig replaces the routes, message templates and custom endpoints of
+// the active configuration at once, so no request sees routes of one
+// configuration with templates of another
+func activateConfig(configs []EventConfig, templates map[string]map[string]interface{}, endpoints []endpointConfig) {
+	warnDeprecatedRoutes(configs)
+	updateConfig(func(next *configSnapshot) {
+		next.setRoutes(configs)
+		next.templates = templates
+		next.endpoints = endpointsByPath(endpoints)
+	})
+	allowRouteLabels(configs)
+}
+
+// allowRouteLabels keeps the metrics label of every configured event type
+func allowRouteLabels(configs []EventConfig) {
+	eventTypes := make([]string, 0, len(configs))
+	for _, config := range configs {
+		eventTypes = append(eventTypes, config.EventType)
+	}
+	eventTypeLabels.setAllowed(eventTypes)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestReloadWhileRouting(t *testing.T) {
+	defer setupTestEnvironment()
+	configs := [][]byte{
+		[]byte(`[{"slack-event-type": "message", "channel": "slack-messages"}, {"slack-event-type": "message", "channel": "slack-dms", "channel-types": ["im"]}]`),
+		[]byte(`[{"slack-event-type": "message", "channel": "slack-channels", "channel-types": ["channel"]}]`),
+	}
+	if err := reloadEventConfig("test", "test", ".", configs[0]); err != nil {
+		t.Fatal(err)
+	}
+	payload := map[string]interface{}{
+		"type":  "event_callback",
+		"event": map[string]interface{}{"type": "message", "channel_type": "im"},
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := reloadEventConfig("test", "test", ".", configs[i%2]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	var routers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		routers.Add(1)
+		go func() {
+			defer routers.Done()
+			for j := 0; j < 500; j++ {
+				routed := routeEvent(payload, nil)
+				// Each snapshot routes the event to the DM route, or has no
+				// route for direct messages; never a mix of the two
+				if (routed.Skip != "" || routed.Config.Channel != "slack-dms") && routed.Skip != skipNoRouteMatch {
+					t.Errorf("expected a route of one configuration, got channel %q and skip %q", routed.Config.Channel, routed.Skip)
+					return
+				}
+			}
+		}()
+	}
+	routers.Wait()
+	close(stop)
+	wg.Wait()
+}
+
+func TestUpdateConfigKeepsOtherParts(t *testing.T) {
+	setupTestEnvironment()
+	defer setupTestEnvironment()
+	before := currentConfig()
+
+	setMessageTemplates(map[string]map[string]interface{}{"greeting": {"text": "hi"}})
+	defer setMessageTemplates(nil)
+	if config, ok := lookupEventConfig("message"); !ok || config.Channel != "test-channel" {
+		t.Errorf("expected replacing the templates to keep the routes, got %+v", config)
+	}
+	if _, ok := before.templates["greeting"]; ok {
+		t.Error("expected the previous snapshot not to be modified")
+	}
+	if _, err := renderMessageTemplate("greeting", nil); err != nil {
+		t.Errorf("expected the new template to be active, got %v", err)
+	}
+}
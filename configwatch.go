@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultConfigFileWatchInterval is how often the config file is checked for changes
+const defaultConfigFileWatchInterval = 5 * time.Second
+
+// watchConfigFile reloads the configuration whenever the content of filename
+// differs from loaded, the content the active configuration was loaded from,
+// checking every interval until ctx is cancelled. A change made between
+// loading and watching is therefore still reloaded. Invalid configuration is
+// logged and ignored, keeping the active routes.
+func watchConfigFile(ctx context.Context, filename string, loaded []byte, interval time.Duration) {
+	current := loaded
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current = reloadChangedConfigFile(filename, current)
+		}
+	}
+}
+
+// reloadChangedConfigFile reloads the configuration from filename if its
+// content differs from previous, and returns the content to compare the next
+// check with. The content is read rather than stat'ed, so files replaced
+// through a symlink, as Kubernetes does for mounted ConfigMaps, are noticed.
+func reloadChangedConfigFile(filename string, previous []byte) []byte {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		logDebug("Not reloading configuration file '%s': %v", filename, err)
+		return previous
+	}
+	if bytes.Equal(data, previous) {
+		return previous
+	}
+
+	decrypted, err := decryptConfigIfNeeded(filename, data)
+	if err == nil {
+		err = reloadEventConfig("config-file", filename, filepath.Dir(filename), decrypted)
+	}
+	if err != nil {
+		logError("Ignoring invalid configuration in '%s': %v", filename, err)
+	}
+	return data
+}
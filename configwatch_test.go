@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadChangedConfigFile(t *testing.T) {
+	setupTestEnvironment()
+	defer setupTestEnvironment()
+	filename := filepath.Join(t.TempDir(), "config.json")
+	original := []byte(`[{"slack-event-type": "message", "channel": "slack-messages"}]`)
+	if err := os.WriteFile(filename, original, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	current := reloadChangedConfigFile(filename, original)
+	if config, ok := lookupEventConfig("message"); !ok || config.Channel != "test-channel" {
+		t.Errorf("expected an unchanged file not to be reloaded, got %+v", config)
+	}
+
+	changed := []byte(`[{"slack-event-type": "message", "channel": "slack-messages-v2"}]`)
+	if err := os.WriteFile(filename, changed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	current = reloadChangedConfigFile(filename, current)
+	if config, _ := lookupEventConfig("message"); config.Channel != "slack-messages-v2" {
+		t.Errorf("expected the changed file to be reloaded, got %+v", config)
+	}
+
+	if err := os.WriteFile(filename, []byte(`[{"slack-event-type": "message"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	current = reloadChangedConfigFile(filename, current)
+	if config, _ := lookupEventConfig("message"); config.Channel != "slack-messages-v2" {
+		t.Errorf("expected invalid configuration to keep the active routes, got %+v", config)
+	}
+
+	if err := os.Remove(filename); err != nil {
+		t.Fatal(err)
+	}
+	if kept := reloadChangedConfigFile(filename, current); string(kept) != string(current) {
+		t.Error("expected a missing file to keep the last content")
+	}
+}
+
+func TestWatchConfigFileSeededFromLoadedContent(t *testing.T) {
+	defer setupTestEnvironment()
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(`[{"slack-event-type": "message", "channel": "slack-messages"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, loaded, err := loadEventConfigFile(filename, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A change made after loading but before the watcher starts is reloaded
+	if err := os.WriteFile(filename, []byte(`[{"slack-event-type": "message", "channel": "slack-messages-v2"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		watchConfigFile(ctx, filename, loaded, 10*time.Millisecond)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if config, _ := lookupEventConfig("message"); config.Channel == "slack-messages-v2" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the change made before watching to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultConsumerKeyPrefix prefixes the heartbeat keys consumers register under
+	defaultConsumerKeyPrefix = "slack-relay:consumers:"
+	// routeConsumersMetric is the name of the live consumers per route gauge
+	routeConsumersMetric = "slack_relay_route_consumers"
+)
+
+// consumerKeyPrefix prefixes the heartbeat keys consumers register under
+var consumerKeyPrefix = defaultConsumerKeyPrefix
+
+// consumerHeartbeat is the value of a consumer's heartbeat key
+type consumerHeartbeat struct {
+	// Channels are the Redis channels the consumer subscribes to. Glob patterns
+	// such as "slack-*" match like PSUBSCRIBE patterns.
+	Channels []string `json:"channels"`
+}
+
+// consumerRegistry tracks the live downstream consumers and the channels they
+// consume, from heartbeat keys they refresh in Redis with a TTL
+type consumerRegistry struct {
+	mu sync.RWMutex
+	// enabled is set once the registry has been checked
+	enabled bool
+	// consumers are the channels of each live consumer, by name
+	consumers map[string][]string
+	checkedAt time.Time
+	// void are the keys of the routes that had no live consumer at the last check
+	void map[string]bool
+}
+
+// consumers is the relay's consumer registry
+var consumers = &consumerRegistry{}
+
+func init() {
+	metricsRegistry = append(metricsRegistry, consumers)
+	newGaugeFunc("slack_relay_routes_without_consumers", "Routes whose channel had no live registered consumer at the last check.", func() float64 {
+		return float64(len(consumers.voidRoutes(currentEventConfigs())))
+	})
+}
+
+// set replaces the live consumers
+func (r *consumerRegistry) set(live map[string][]string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = true
+	r.consumers = live
+	r.checkedAt = now
+}
+
+// liveConsumers returns the names of the live consumers of channel, sorted
+func (r *consumerRegistry) liveConsumers(channel string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var names []string
+	for name, patterns := range r.consumers {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, channel); matched || pattern == channel {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// voidRoutes returns the routes of configs whose channel has no live consumer.
+// It returns nil until the registry has been checked.
+func (r *consumerRegistry) voidRoutes(configs []EventConfig) []EventConfig {
+	r.mu.RLock()
+	enabled := r.enabled
+	r.mu.RUnlock()
+	if !enabled {
+		return nil
+	}
+	var void []EventConfig
+	for _, config := range configs {
+		if len(r.liveConsumers(config.Channel)) == 0 {
+			void = append(void, config)
+		}
+	}
+	return void
+}
+
+// writeMetrics writes the number of live consumers of each route's channel,
+// once the registry has been checked
+func (r *consumerRegistry) writeMetrics(w io.Writer) {
+	r.mu.RLock()
+	enabled := r.enabled
+	r.mu.RUnlock()
+	if !enabled {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", routeConsumersMetric,
+		"Live registered consumers of each route's channel.", routeConsumersMetric)
+	for _, config := range currentEventConfigs() {
+		labels := formatLabels([]string{"event_type", "channel"}, []string{config.EventType, config.Channel})
+		fmt.Fprintf(w, "%s%s %d\n", routeConsumersMetric, labels, len(r.liveConsumers(config.Channel)))
+	}
+}
+
+// loadConsumers reads the heartbeat keys of the live consumers from Redis.
+// Keys whose value is not a valid heartbeat are skipped.
+func loadConsumers(ctx context.Context) (map[string][]string, error) {
+	if redisClient == nil {
+		return nil, errRedisUnavailable
+	}
+	var keys []string
+	iter := redisClient.Scan(ctx, 0, consumerKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	live := make(map[string][]string, len(keys))
+	if len(keys) == 0 {
+		return live, nil
+	}
+	values, err := redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			// The key expired between the scan and the read
+			continue
+		}
+		var heartbeat consumerHeartbeat
+		if err := json.Unmarshal([]byte(data), &heartbeat); err != nil {
+			logWarn("Ignoring invalid consumer heartbeat '%s': %v", keys[i], err)
+			continue
+		}
+		live[strings.TrimPrefix(keys[i], consumerKeyPrefix)] = heartbeat.Channels
+	}
+	return live, nil
+}
+
+// checkConsumers refreshes the registry and logs the routes that lost their
+// last live consumer or got one back since the previous check
+func (r *consumerRegistry) checkConsumers(live map[string][]string, now time.Time) {
+	r.set(live, now)
+
+	void := make(map[string]bool)
+	for _, config := range r.voidRoutes(currentEventConfigs()) {
+		void[config.routeKey()] = true
+	}
+	r.mu.Lock()
+	previous := r.void
+	r.void = void
+	r.mu.Unlock()
+
+	for _, config := range currentEventConfigs() {
+		key := config.routeKey()
+		switch {
+		case void[key] && !previous[key]:
+			logWarn("Route '%s' publishes to '%s', which has no live consumer", key, config.Channel)
+		case !void[key] && previous[key]:
+			logInfo("Route '%s' has a live consumer of '%s' again", key, config.Channel)
+		}
+	}
+}
+
+// watchConsumers checks the consumer registry every interval
+func watchConsumers(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		live, err := loadConsumers(checkCtx)
+		cancel()
+		if err != nil {
+			logWarn("Error reading the consumer registry: %v", err)
+		} else {
+			consumers.checkConsumers(live, clock.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// consumersHandler serves GET /admin/consumers: the live consumers and each
+// route's consumers as of the last check
+func consumersHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	consumers.mu.RLock()
+	live := consumers.consumers
+	checkedAt := consumers.checkedAt
+	consumers.mu.RUnlock()
+
+	routes := []map[string]interface{}{}
+	for _, config := range currentEventConfigs() {
+		names := consumers.liveConsumers(config.Channel)
+		if names == nil {
+			names = []string{}
+		}
+		routes = append(routes, map[string]interface{}{
+			"route":     config.routeKey(),
+			"channel":   config.Channel,
+			"consumers": names,
+		})
+	}
+	response := map[string]interface{}{
+		"consumers": live,
+		"routes":    routes,
+	}
+	if !checkedAt.IsZero() {
+		response["checked_at"] = checkedAt.UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logError("Error writing response: %v", err)
+	}
+}
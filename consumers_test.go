@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsumerRegistry(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "slack-messages"},
+		{EventType: "reaction_added", Channel: "slack-reactions"},
+		{EventType: "app_mention", Channel: "mentions"},
+	})
+	defer setupTestEnvironment()
+	registry := &consumerRegistry{}
+
+	if void := registry.voidRoutes(currentEventConfigs()); void != nil {
+		t.Errorf("expected no void routes before the first check, got %v", void)
+	}
+
+	registry.checkConsumers(map[string][]string{
+		"archiver": {"slack-*"},
+		"bot":      {"slack-messages"},
+	}, time.Now())
+	if names := registry.liveConsumers("slack-messages"); !reflect.DeepEqual(names, []string{"archiver", "bot"}) {
+		t.Errorf("expected archiver and bot to consume slack-messages, got %v", names)
+	}
+	void := registry.voidRoutes(currentEventConfigs())
+	if len(void) != 1 || void[0].Channel != "mentions" {
+		t.Errorf("expected only the mentions route to have no consumer, got %v", void)
+	}
+
+	var metrics strings.Builder
+	registry.writeMetrics(&metrics)
+	for _, expected := range []string{
+		`slack_relay_route_consumers{event_type="message",channel="slack-messages"} 2`,
+		`slack_relay_route_consumers{event_type="reaction_added",channel="slack-reactions"} 1`,
+		`slack_relay_route_consumers{event_type="app_mention",channel="mentions"} 0`,
+	} {
+		if !strings.Contains(metrics.String(), expected) {
+			t.Errorf("expected %s in metrics, got:\n%s", expected, metrics.String())
+		}
+	}
+
+	registry.checkConsumers(map[string][]string{"bot": {"slack-messages", "mentions"}}, time.Now())
+	if void := registry.voidRoutes(currentEventConfigs()); len(void) != 1 || void[0].Channel != "slack-reactions" {
+		t.Errorf("expected the reactions route to have lost its consumer, got %v", void)
+	}
+}
+
+func TestConsumersHandler(t *testing.T) {
+	adminToken = "admin-secret"
+	defer func() { adminToken = "" }()
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "slack-messages"}})
+	defer setupTestEnvironment()
+	original := consumers
+	consumers = &consumerRegistry{}
+	defer func() { consumers = original }()
+	consumers.checkConsumers(map[string][]string{"bot": {"slack-messages"}}, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/consumers", nil)
+	request.Header.Set("Authorization", "Bearer admin-secret")
+	consumersHandler(recorder, request)
+
+	var response struct {
+		Consumers map[string][]string `json:"consumers"`
+		Routes    []struct {
+			Route     string   `json:"route"`
+			Consumers []string `json:"consumers"`
+		} `json:"routes"`
+		CheckedAt string `json:"checked_at"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(response.Routes) != 1 || !reflect.DeepEqual(response.Routes[0].Consumers, []string{"bot"}) || response.CheckedAt != "2030-01-02T03:04:05Z" {
+		t.Errorf("unexpected response %+v", response)
+	}
+
+	recorder = httptest.NewRecorder()
+	consumersHandler(recorder, httptest.NewRequest(http.MethodGet, "/admin/consumers", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected requests without the admin token to be rejected, got %d", recorder.Code)
+	}
+}
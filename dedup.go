@@ -0,0 +1,204 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Dedup stores selected with DEDUP_STORE
+const (
+	dedupStoreNone   = "none"
+	dedupStoreMemory = "memory"
+	dedupStoreRedis  = "redis"
+)
+
+const (
+	// defaultDedupTTL is how long delivered event IDs are remembered, longer
+	// than Slack's retries of an event take
+	defaultDedupTTL = 10 * time.Minute
+	// defaultDedupMaxEvents caps the event IDs remembered by the memory store
+	defaultDedupMaxEvents = 100000
+	// defaultDedupKeyPrefix prefixes the event ID keys of the Redis store
+	defaultDedupKeyPrefix = "slack-relay:dedup:"
+	// dedupTimeout bounds a dedup store operation
+	dedupTimeout = time.Second
+)
+
+var metricDuplicateEvents = newCounterVec("slack_relay_duplicate_events_total",
+	"Redeliveries of already delivered events dropped by the dedup store.")
+var metricDedupErrors = newCounterVec("slack_relay_dedup_errors_total",
+	"Dedup store operations that failed, by operation. Events are delivered when a claim fails.", "operation")
+
+// dedupStore remembers the IDs of delivered events, so Slack's redeliveries of
+// an event are only relayed once
+type dedupStore interface {
+	// claim records id as delivered. It reports false when id was already
+	// claimed within the TTL.
+	claim(ctx context.Context, id string) (bool, error)
+	// release forgets id, so a redelivery of an event that failed is relayed
+	release(ctx context.Context, id string) error
+	String() string
+}
+
+// dedup is the relay's dedup store
+var dedup dedupStore = noopDedupStore{}
+
+// noopDedupStore claims every event, relaying all redeliveries. It is the
+// default, leaving Slack's retries to consumers.
+type noopDedupStore struct{}
+
+func (noopDedupStore) claim(ctx context.Context, id string) (bool, error) { return true, nil }
+func (noopDedupStore) release(ctx context.Context, id string) error       { return nil }
+func (noopDedupStore) String() string                                     { return "no-op store" }
+
+// memoryDedupStore remembers event IDs in this replica's memory, evicting the
+// oldest once max IDs are remembered. Replicas do not share it.
+type memoryDedupStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	now     func() time.Time
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// memoryDedupEntry is a claimed event ID and when its claim expires
+type memoryDedupEntry struct {
+	id      string
+	expires time.Time
+}
+
+// newMemoryDedupStore creates a memoryDedupStore
+func newMemoryDedupStore(ttl time.Duration, max int) *memoryDedupStore {
+	return &memoryDedupStore{ttl: ttl, max: max, now: func() time.Time { return clock.Now() }, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (s *memoryDedupStore) claim(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if element, ok := s.entries[id]; ok {
+		if now.Before(element.Value.(*memoryDedupEntry).expires) {
+			return false, nil
+		}
+		s.order.Remove(element)
+	}
+	s.entries[id] = s.order.PushFront(&memoryDedupEntry{id: id, expires: now.Add(s.ttl)})
+	for s.order.Len() > s.max {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryDedupEntry).id)
+	}
+	return true, nil
+}
+
+func (s *memoryDedupStore) release(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.entries[id]; ok {
+		s.order.Remove(element)
+		delete(s.entries, id)
+	}
+	return nil
+}
+
+func (s *memoryDedupStore) String() string {
+	return fmt.Sprintf("memory store of up to %d events", s.max)
+}
+
+// redisDedupStore claims event IDs with SET NX in Redis, shared by every replica
+type redisDedupStore struct {
+	prefix string
+	ttl    time.Duration
+}
+
+func (s redisDedupStore) claim(ctx context.Context, id string) (bool, error) {
+	if redisClient == nil {
+		return false, errRedisUnavailable
+	}
+	return redisClient.SetNX(ctx, s.prefix+id, instanceID, s.ttl).Result()
+}
+
+func (s redisDedupStore) release(ctx context.Context, id string) error {
+	if redisClient == nil {
+		return errRedisUnavailable
+	}
+	return redisClient.Del(ctx, s.prefix+id).Err()
+}
+
+func (s redisDedupStore) String() string {
+	return "Redis keys " + s.prefix + "*"
+}
+
+// dedupStoreFromEnv returns the dedup store configured by DEDUP_STORE,
+// DEDUP_TTL, DEDUP_MAX_EVENTS and DEDUP_KEY_PREFIX
+func dedupStoreFromEnv() (dedupStore, error) {
+	ttl := getEnvDuration("DEDUP_TTL", defaultDedupTTL)
+	switch store := os.Getenv("DEDUP_STORE"); store {
+	case "", dedupStoreNone:
+		return noopDedupStore{}, nil
+	case dedupStoreMemory:
+		max := getEnvInt("DEDUP_MAX_EVENTS", defaultDedupMaxEvents)
+		if max <= 0 {
+			return nil, fmt.Errorf("DEDUP_MAX_EVENTS must be positive, got %d", max)
+		}
+		return newMemoryDedupStore(ttl, max), nil
+	case dedupStoreRedis:
+		prefix := os.Getenv("DEDUP_KEY_PREFIX")
+		if prefix == "" {
+			prefix = defaultDedupKeyPrefix
+		}
+		return redisDedupStore{prefix: prefix, ttl: ttl}, nil
+	default:
+		return nil, fmt.Errorf("invalid DEDUP_STORE '%s', expected none, memory or redis", store)
+	}
+}
+
+// handleDuplicate claims the event ID of an event callback in the dedup store.
+// It returns the writer the rest of the request should use, which releases the
+// claim if the event fails so Slack's retry is relayed, or nil when the event
+// was already delivered and the request has been fully handled.
+func handleDuplicate(w http.ResponseWriter, parsed slackPayload) http.ResponseWriter {
+	if dedup == (noopDedupStore{}) || parsed.Type != "event_callback" || parsed.EventID == "" {
+		return w
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dedupTimeout)
+	defer cancel()
+	first, err := dedup.claim(ctx, parsed.EventID)
+	if err != nil {
+		logWarn("Error claiming event %s in the dedup %s: %v", parsed.EventID, dedup, err)
+		metricDedupErrors.Inc("claim")
+		return w
+	}
+	if !first {
+		logDebug("Dropping redelivery of already delivered event %s", parsed.EventID)
+		metricDuplicateEvents.Inc()
+		writeSkipped(w, "already delivered")
+		return nil
+	}
+	return &dedupResponseWriter{ResponseWriter: w, eventID: parsed.EventID}
+}
+
+// dedupResponseWriter releases the dedup claim of an event when the response
+// asks Slack to retry it
+type dedupResponseWriter struct {
+	http.ResponseWriter
+	eventID string
+}
+
+func (d *dedupResponseWriter) WriteHeader(status int) {
+	if status >= http.StatusInternalServerError {
+		ctx, cancel := context.WithTimeout(context.Background(), dedupTimeout)
+		if err := dedup.release(ctx, d.eventID); err != nil {
+			logWarn("Error releasing event %s in the dedup %s: %v", d.eventID, dedup, err)
+			metricDedupErrors.Inc("release")
+		}
+		cancel()
+	}
+	d.ResponseWriter.WriteHeader(status)
+}
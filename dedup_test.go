@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+	store := newMemoryDedupStore(time.Minute, 2)
+	store.now = func() time.Time { return now }
+
+	if first, _ := store.claim(ctx, "Ev1"); !first {
+		t.Fatal("expected the first claim of Ev1 to succeed")
+	}
+	if first, _ := store.claim(ctx, "Ev1"); first {
+		t.Error("expected a second claim of Ev1 to fail")
+	}
+	store.release(ctx, "Ev1")
+	if first, _ := store.claim(ctx, "Ev1"); !first {
+		t.Error("expected a released event to be claimed again")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if first, _ := store.claim(ctx, "Ev1"); !first {
+		t.Error("expected an expired claim to be claimed again")
+	}
+
+	store.claim(ctx, "Ev2")
+	store.claim(ctx, "Ev3")
+	if first, _ := store.claim(ctx, "Ev1"); !first {
+		t.Error("expected the oldest event to be evicted beyond the maximum")
+	}
+	if len(store.entries) != 2 || store.order.Len() != 2 {
+		t.Errorf("expected 2 remembered events, got %d", len(store.entries))
+	}
+}
+
+func TestDedupStoreFromEnv(t *testing.T) {
+	tests := []struct {
+		store string
+		want  string
+		err   string
+	}{
+		{"", "no-op store", ""},
+		{"none", "no-op store", ""},
+		{"memory", "memory store of up to 100000 events", ""},
+		{"redis", "Redis keys slack-relay:dedup:*", ""},
+		{"etcd", "", "invalid DEDUP_STORE 'etcd'"},
+	}
+	for _, tt := range tests {
+		t.Setenv("DEDUP_STORE", tt.store)
+		store, err := dedupStoreFromEnv()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: expected an error containing %q, got %v", tt.store, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || store.String() != tt.want {
+			t.Errorf("%q: expected %s, got %v, %v", tt.store, tt.want, store, err)
+		}
+	}
+}
+
+func TestSlackHandlerDedup(t *testing.T) {
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "slack-messages", RetryOnPublishFailure: true}})
+	defer setupTestEnvironment()
+	signingSecret = []byte{}
+	dedup = newMemoryDedupStore(time.Minute, 10)
+	defer func() { dedup = noopDedupStore{} }()
+
+	deliver := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		slackHandler(rr, req)
+		return rr
+	}
+	event := `{"type":"event_callback","event_id":"Ev1","event":{"type":"message"}}`
+
+	// Without Redis the publish fails, so the claim is released for Slack's retry
+	if rr := deliver(event); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 for a failed publish, got %d", rr.Code)
+	}
+	if rr := deliver(event); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the retry of a failed event to be relayed, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "slack-messages"}})
+	if rr := deliver(event); rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "already delivered") {
+		t.Fatalf("expected the event to be relayed, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := deliver(event); !strings.Contains(rr.Body.String(), "already delivered") {
+		t.Errorf("expected the redelivery to be dropped, got %d %q", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// deprecatedEventTypesData lists the Slack event types that are deprecated,
+// retired or never delivered to the Events API, compiled into the binary
+//
+//go:embed deprecated_event_types.json
+var deprecatedEventTypesData []byte
+
+var metricDeprecatedEvents = newCounterVec("slack_relay_deprecated_events_total",
+	"Events relayed whose event type is deprecated, by event type.", "event_type")
+
+// eventTypeDeprecation describes why an event type should no longer be routed
+type eventTypeDeprecation struct {
+	EventType string `json:"slack-event-type"`
+	// Reason completes "Event type '<type>' ..."
+	Reason string `json:"reason"`
+	// Replacement is what to route instead, if anything
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// deprecatedEventTypes holds the deprecations, by event type
+var deprecatedEventTypes = parseDeprecatedEventTypes(deprecatedEventTypesData)
+
+// warnedDeprecatedEvents holds the deprecated event types already warned about
+// at runtime, so each is only logged once
+var warnedDeprecatedEvents sync.Map
+
+// parseDeprecatedEventTypes parses the embedded deprecation table
+func parseDeprecatedEventTypes(data []byte) map[string]eventTypeDeprecation {
+	var entries []eventTypeDeprecation
+	if err := json.Unmarshal(data, &entries); err != nil {
+		panic(fmt.Sprintf("invalid deprecated_event_types.json: %v", err))
+	}
+	deprecations := make(map[string]eventTypeDeprecation, len(entries))
+	for _, entry := range entries {
+		deprecations[entry.EventType] = entry
+	}
+	return deprecations
+}
+
+// String describes the deprecation and its replacement
+func (d eventTypeDeprecation) String() string {
+	message := fmt.Sprintf("Event type '%s' %s", d.EventType, d.Reason)
+	if d.Replacement != "" {
+		message += "; route " + d.Replacement + " instead"
+	}
+	return message
+}
+
+// deprecatedRouteWarnings describes the routes of configs that reference a
+// deprecated event type
+func deprecatedRouteWarnings(configs []EventConfig) []string {
+	var warnings []string
+	for _, config := range configs {
+		if deprecation, ok := deprecatedEventTypes[config.EventType]; ok {
+			warnings = append(warnings, fmt.Sprintf("Route '%s': %s", config.routeKey(), deprecation))
+		}
+	}
+	return warnings
+}
+
+// warnDeprecatedRoutes logs a warning for each route referencing a deprecated
+// event type
+func warnDeprecatedRoutes(configs []EventConfig) {
+	for _, warning := range deprecatedRouteWarnings(configs) {
+		logWarn("%s", warning)
+	}
+}
+
+// warnDeprecatedEvent counts a relayed event of a deprecated type, logging a
+// warning the first time the type is seen
+func warnDeprecatedEvent(eventType string) {
+	deprecation, ok := deprecatedEventTypes[eventType]
+	if !ok {
+		return
+	}
+	metricDeprecatedEvents.Inc(eventTypeLabel(eventType))
+	if _, warned := warnedDeprecatedEvents.LoadOrStore(eventType, true); !warned {
+		logWarn("Relaying an event of a deprecated type: %s", deprecation)
+	}
+}
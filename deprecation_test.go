@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDeprecatedEventTypesTable(t *testing.T) {
+	if len(deprecatedEventTypes) == 0 {
+		t.Fatal("expected the embedded table to list deprecated event types")
+	}
+	for eventType, deprecation := range deprecatedEventTypes {
+		if eventType == "" || deprecation.Reason == "" {
+			t.Errorf("expected an event type and a reason, got %+v", deprecation)
+		}
+	}
+	defaults, err := parseEventConfig(defaultConfigData)
+	if err != nil {
+		t.Fatalf("invalid embedded defaults: %v", err)
+	}
+	if warnings := deprecatedRouteWarnings(defaults); len(warnings) > 0 {
+		t.Errorf("expected the embedded defaults to use no deprecated event types, got %v", warnings)
+	}
+}
+
+func TestDeprecatedRouteWarnings(t *testing.T) {
+	warnings := deprecatedRouteWarnings([]EventConfig{
+		{EventType: "message", Channel: "slack-messages"},
+		{EventType: "message.im", Channel: "slack-dms"},
+		{EventType: "user_typing", Channel: "slack-typing"},
+	})
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %v", warnings)
+	}
+	if warnings[0] != `Route 'message.im': Event type 'message.im' is an event subscription name, events arrive as 'message'; route message with "channel-types": ["im"] instead` {
+		t.Errorf("unexpected renamed event type warning %q", warnings[0])
+	}
+	if warnings[1] != "Route 'user_typing': Event type 'user_typing' is only sent over the legacy RTM API" {
+		t.Errorf("unexpected RTM event type warning %q", warnings[1])
+	}
+}
+
+func TestWarnDeprecatedEvent(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	level := currentLogLevel
+	currentLogLevel = WARN
+	defer func() { currentLogLevel = level }()
+	warnedDeprecatedEvents.Delete("star_added")
+
+	before := metricDeprecatedEvents.values["star_added"]
+	warnDeprecatedEvent("star_added")
+	warnDeprecatedEvent("star_added")
+	warnDeprecatedEvent("message")
+	if got := metricDeprecatedEvents.values["star_added"] - before; got != 2 {
+		t.Errorf("expected 2 deprecated events counted, got %v", got)
+	}
+	if count := strings.Count(logs.String(), "deprecated type"); count != 1 {
+		t.Errorf("expected a single warning, got %d in:\n%s", count, logs.String())
+	}
+}
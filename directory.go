@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultDirectoryRefreshInterval is how often the cached directories are
+	// fetched again
+	defaultDirectoryRefreshInterval = time.Hour
+	// directoryPageSize is the number of users or channels requested per page
+	directoryPageSize = 200
+)
+
+var metricDirectoryRefreshes = newCounterVec("slack_relay_directory_refreshes_total",
+	"Fetches of the user and channel directories, by result.", "result")
+
+// slackDirectory caches the workspace's user and channel names by ID, so
+// enrichment resolves them without calling the Slack Web API per event
+type slackDirectory struct {
+	mu       sync.RWMutex
+	users    map[string]string
+	channels map[string]string
+}
+
+// directory is the cached workspace directory; nil when it is not cached
+var directory *slackDirectory
+
+func init() {
+	newGaugeFunc("slack_relay_directory_users", "Users in the cached user directory.", func() float64 {
+		return float64(directory.size(false))
+	})
+	newGaugeFunc("slack_relay_directory_channels", "Channels in the cached channel directory.", func() float64 {
+		return float64(directory.size(true))
+	})
+}
+
+// usersListResponse is the users.list response
+type usersListResponse struct {
+	slackAPIResponse
+	Members []struct {
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+		Profile struct {
+			DisplayName string `json:"display_name"`
+			RealName    string `json:"real_name"`
+		} `json:"profile"`
+	} `json:"members"`
+}
+
+// conversationsListResponse is the conversations.list response
+type conversationsListResponse struct {
+	slackAPIResponse
+	Channels []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"channels"`
+}
+
+// size returns the number of cached users, or channels
+func (d *slackDirectory) size(channels bool) int {
+	if d == nil {
+		return 0
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if channels {
+		return len(d.channels)
+	}
+	return len(d.users)
+}
+
+// userName returns the name of a cached user
+func (d *slackDirectory) userName(id string) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	name, ok := d.users[id]
+	return name, ok
+}
+
+// channelName returns the name of a cached channel
+func (d *slackDirectory) channelName(id string) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	name, ok := d.channels[id]
+	return name, ok
+}
+
+// directoryUserName returns the cached name of a user, or id when it is not cached
+func directoryUserName(id string) string {
+	if name, ok := directory.userName(id); ok && name != "" {
+		return name
+	}
+	return id
+}
+
+// directoryChannelName returns the cached name of a channel, or id when it is
+// not cached
+func directoryChannelName(id string) string {
+	if name, ok := directory.channelName(id); ok && name != "" {
+		return name
+	}
+	return id
+}
+
+// refresh fetches both directories and replaces the cached ones. On error the
+// previous directories are kept.
+func (d *slackDirectory) refresh(ctx context.Context) error {
+	token := getSlackBotToken()
+	if token == "" {
+		return errors.New("SLACK_BOT_TOKEN is not configured")
+	}
+	users, err := fetchUserDirectory(ctx, token)
+	if err != nil {
+		return err
+	}
+	channels, err := fetchChannelDirectory(ctx, token)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.users, d.channels = users, channels
+	return nil
+}
+
+// fetchUserDirectory returns the names of the workspace's users by ID: their
+// display name, or their real name or username when they have none
+func fetchUserDirectory(ctx context.Context, token string) (map[string]string, error) {
+	users := make(map[string]string)
+	err := fetchDirectoryPages(url.Values{}, func(params url.Values) (string, error) {
+		var page usersListResponse
+		if err := callDirectoryPage(ctx, "users.list", token, params, &page); err != nil {
+			return "", err
+		}
+		for _, member := range page.Members {
+			name := member.Profile.DisplayName
+			if name == "" {
+				name = member.Profile.RealName
+			}
+			if name == "" {
+				name = member.Name
+			}
+			users[member.ID] = name
+		}
+		return page.ResponseMetadata.NextCursor, nil
+	})
+	return users, err
+}
+
+// fetchChannelDirectory returns the names of the public and private channels
+// the bot can see by ID, archived channels excluded
+func fetchChannelDirectory(ctx context.Context, token string) (map[string]string, error) {
+	channels := make(map[string]string)
+	params := url.Values{"types": {"public_channel,private_channel"}, "exclude_archived": {"true"}}
+	err := fetchDirectoryPages(params, func(params url.Values) (string, error) {
+		var page conversationsListResponse
+		if err := callDirectoryPage(ctx, "conversations.list", token, params, &page); err != nil {
+			return "", err
+		}
+		for _, channel := range page.Channels {
+			channels[channel.ID] = channel.Name
+		}
+		return page.ResponseMetadata.NextCursor, nil
+	})
+	return channels, err
+}
+
+// fetchDirectoryPages calls fetch with the params of every page of a paginated
+// list method, following the cursor it returns
+func fetchDirectoryPages(params url.Values, fetch func(params url.Values) (string, error)) error {
+	cursor := ""
+	for {
+		page := url.Values{"limit": {strconv.Itoa(directoryPageSize)}}
+		for key, values := range params {
+			page[key] = values
+		}
+		if cursor != "" {
+			page.Set("cursor", cursor)
+		}
+		next, err := fetch(page)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// callDirectoryPage fetches a page of a list method, waiting as long as Slack
+// asks whenever the method is rate limited
+func callDirectoryPage(ctx context.Context, method string, token string, params url.Values, result interface{}) error {
+	for {
+		callCtx, cancel := context.WithTimeout(ctx, slackAPITimeout)
+		err := callSlackAPI(callCtx, method, token, params, result)
+		cancel()
+		var rateLimited *slackRateLimitedError
+		if !errors.As(err, &rateLimited) {
+			return err
+		}
+		logDebug("Waiting %s to fetch the next page of %s", rateLimited.RetryAfter, method)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rateLimited.RetryAfter):
+		}
+	}
+}
+
+// watchDirectory fetches the directories, then fetches them again every
+// interval until ctx is cancelled
+func watchDirectory(ctx context.Context, d *slackDirectory, interval time.Duration) {
+	refresh := func() {
+		if err := d.refresh(ctx); err != nil {
+			logWarn("Error fetching the Slack user and channel directories: %v", err)
+			metricDirectoryRefreshes.Inc("failure")
+			return
+		}
+		logInfo("Cached %d users and %d channels of the Slack directory", d.size(false), d.size(true))
+		metricDirectoryRefreshes.Inc("success")
+	}
+	refresh()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
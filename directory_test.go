@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlackDirectoryRefresh(t *testing.T) {
+	rateLimited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case r.URL.Path == "/users.list" && r.Form.Get("cursor") == "":
+			w.Write([]byte(`{"ok":true,"members":[{"id":"U1","name":"ada","profile":{"display_name":"Ada"}}],"response_metadata":{"next_cursor":"page2"}}`))
+		case r.URL.Path == "/users.list" && !rateLimited:
+			rateLimited = true
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case r.URL.Path == "/users.list":
+			w.Write([]byte(`{"ok":true,"members":[{"id":"U2","name":"grace","profile":{"real_name":"Grace Hopper"}},{"id":"U3","name":"alan"}]}`))
+		case r.URL.Path == "/conversations.list":
+			w.Write([]byte(`{"ok":true,"channels":[{"id":"C1","name":"general"}]}`))
+		default:
+			http.Error(w, "unexpected method", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	originalURL := slackAPIBaseURL
+	slackAPIBaseURL = server.URL + "/"
+	defer func() { slackAPIBaseURL = originalURL }()
+	slackBotToken = "xoxb-test"
+	defer func() { slackBotToken = "" }()
+
+	d := &slackDirectory{}
+	if err := d.refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !rateLimited {
+		t.Error("expected the rate limited page to be fetched again")
+	}
+	for id, expected := range map[string]string{"U1": "Ada", "U2": "Grace Hopper", "U3": "alan"} {
+		if name, ok := d.userName(id); !ok || name != expected {
+			t.Errorf("expected user %s to be named %q, got %q", id, expected, name)
+		}
+	}
+	if name, _ := d.channelName("C1"); name != "general" {
+		t.Errorf("expected channel C1 to be named general, got %q", name)
+	}
+}
+
+func TestFlattenMrkdwnWithDirectory(t *testing.T) {
+	directory = &slackDirectory{users: map[string]string{"U1": "ada"}, channels: map[string]string{"C1": "general"}}
+	defer func() { directory = nil }()
+
+	if got := flattenMrkdwn("<@U1> and <@U2> in <#C1>"); got != "@ada and @U2 in #general" {
+		t.Errorf("expected cached mentions to be named, got %q", got)
+	}
+	if got := flattenMrkdwn("<@U1|lovelace>"); got != "@lovelace" {
+		t.Errorf("expected the label to take precedence, got %q", got)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+// Results of a doctor check
+const (
+	doctorPass = "PASS"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+	doctorSkip = "SKIP"
+)
+
+// doctorCheck is the result of a single doctor check
+type doctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// runDoctorChecks verifies the configuration, secrets, Redis and listen port the
+// server would use, and optionally the Slack bot token
+func runDoctorChecks(checkSlack bool) []doctorCheck {
+	var checks []doctorCheck
+	add := func(name string, status string, format string, args ...interface{}) {
+		checks = append(checks, doctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	// Secret providers come first: the config source and Redis depend on them
+	provider, err := newSecretProviderFromEnv()
+	if err != nil {
+		add("secrets", doctorFail, "%v", err)
+	} else {
+		secretProvider = provider
+		add("secrets", doctorPass, "secret providers configured")
+	}
+
+	remoteConfig, err := newConfigSourceFromEnv()
+	switch {
+	case err != nil:
+		add("config", doctorFail, "%v", err)
+	case remoteConfig != nil:
+		if err := loadRemoteEventConfig(remoteConfig); err != nil {
+			add("config", doctorFail, "loading %s: %v", remoteConfig, err)
+		} else {
+			add("config", doctorPass, "loaded %d route(s) from %s", len(currentEventConfigs()), remoteConfig)
+		}
+	default:
+		configFile, required := configFileFromEnv()
+		source, err := loadEventConfigWithDefaults(configFile, required)
+		if err != nil {
+			add("config", doctorFail, "loading %s: %v", configFile, err)
+		} else {
+			add("config", doctorPass, "loaded %d route(s) from %s", len(currentEventConfigs()), source)
+		}
+	}
+
+	for _, warning := range deprecatedRouteWarnings(currentEventConfigs()) {
+		add("deprecated event type", doctorWarn, "%s", warning)
+	}
+
+	for _, name := range []string{secretSigningSecret, secretRedisPassword, secretSlackAppToken, secretSlackBotToken, secretSlackConfigToken, secretEnvelopeKey, secretSlackAuditToken, secretAdminToken} {
+		value, err := loadSecret(name)
+		switch {
+		case err != nil:
+			add("secret "+name, doctorFail, "%v", err)
+		case value != "":
+			add("secret "+name, doctorPass, "loaded")
+		case name == secretSigningSecret:
+			add("secret "+name, doctorWarn, "not found, Slack signature verification will be skipped")
+		default:
+			add("secret "+name, doctorSkip, "not configured")
+		}
+	}
+
+	redisClient = newRedisClientFromEnv()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := probeRedis(ctx, redisClient); err != nil {
+		add("redis", doctorFail, "%v: %s", err, redisHint(err, redisClient.Options().Addr))
+	} else {
+		add("redis", doctorPass, "connected to %s and wrote a probe key", redisClient.Options().Addr)
+	}
+	cancel()
+
+	for _, port := range []struct{ name, addr string }{
+		{"port", listenAddrFromEnv()},
+		{"admin port", adminAddrFromEnv()},
+	} {
+		if listener, err := net.Listen("tcp", port.addr); err != nil {
+			add(port.name, doctorFail, "cannot listen on %s: %v", port.addr, err)
+		} else {
+			listener.Close()
+			add(port.name, doctorPass, "%s is free", port.addr)
+		}
+	}
+
+	if checkSlack {
+		token, _ := loadSecret(secretSlackBotToken)
+		if token == "" {
+			add("slack", doctorFail, "auth.test needs SLACK_BOT_TOKEN")
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), slackAPITimeout)
+			if user, team, err := slackAuthTest(ctx, token); err != nil {
+				add("slack", doctorFail, "auth.test: %v: %s", err, slackTokenHint(err, "SLACK_BOT_TOKEN"))
+			} else {
+				add("slack", doctorPass, "authenticated as %s in %s", user, team)
+			}
+			cancel()
+		}
+	}
+
+	return checks
+}
+
+// runDoctorCommand implements the "doctor" subcommand, which prints a pass/fail
+// report of the relay's startup prerequisites
+func runDoctorCommand(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	checkSlack := flags.Bool("slack", false, "also verify the Slack bot token with auth.test")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Keep the relay's own logging out of the report
+	log.SetOutput(io.Discard)
+	checks := runDoctorChecks(*checkSlack)
+	log.SetOutput(os.Stderr)
+
+	failures := 0
+	for _, check := range checks {
+		if check.Status == doctorFail {
+			failures++
+		}
+		fmt.Fprintf(stdout, "%-4s  %-26s %s\n", check.Status, check.Name, check.Detail)
+	}
+	if failures > 0 {
+		fmt.Fprintf(stdout, "\n%d check(s) failed\n", failures)
+		return 1
+	}
+	fmt.Fprintln(stdout, "\nAll checks passed")
+	return 0
+}
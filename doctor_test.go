@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunDoctorCommand(t *testing.T) {
+	originalProvider, originalClient := secretProvider, redisClient
+	defer func() {
+		secretProvider, redisClient = originalProvider, originalClient
+		setupTestEnvironment()
+	}()
+	dir := t.TempDir()
+	config := writeTestFile(t, dir, "config.json", `[{"slack-event-type":"message","channel":"messages"}]`)
+	writeTestFile(t, dir, ".slack-bot-token", "xoxb-test")
+
+	// Hold a port so the listen check fails
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"team":"Acme","user":"relay"}`))
+	}))
+	defer server.Close()
+	originalURL := slackAPIBaseURL
+	slackAPIBaseURL = server.URL + "/"
+	defer func() { slackAPIBaseURL = originalURL }()
+
+	t.Setenv("CONFIG_FILE", config)
+	t.Setenv("SECRET_PROVIDERS", "file")
+	t.Setenv("SECRETS_DIR", dir)
+	t.Setenv("REDIS_HOST", "127.0.0.1")
+	t.Setenv("REDIS_PORT", "1")
+	t.Setenv("PORT", listener.Addr().String())
+
+	var stdout bytes.Buffer
+	if code := runDoctorCommand([]string{"-slack"}, &stdout); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+
+	report := stdout.String()
+	for _, want := range []string{
+		"PASS  config",
+		"loaded 1 route(s) from " + config,
+		"WARN  secret signing-secret",
+		"PASS  secret slack-bot-token",
+		"FAIL  redis",
+		"FAIL  port",
+		"PASS  slack                      authenticated as relay in Acme",
+		"2 check(s) failed",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected report to contain %q, got:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// defaultDriftCheckInterval is how often the Slack app configuration is compared
+// against the routes
+const defaultDriftCheckInterval = time.Hour
+
+// slackAppID is the ID of the Slack app (A...) whose manifest is checked for drift
+var slackAppID string
+
+// slackConfigToken is the app configuration token (xoxe.xoxp-...) used to export
+// the app manifest
+var slackConfigToken string
+
+// getSlackConfigToken returns the current Slack app configuration token
+func getSlackConfigToken() string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return slackConfigToken
+}
+
+// driftIssues is the number of drift issues found by the last check
+var driftIssues atomic.Int64
+
+func init() {
+	newGaugeFunc("slack_relay_config_drift_issues", "Differences between the routes and the Slack app configuration found by the last drift check.", func() float64 {
+		return float64(driftIssues.Load())
+	})
+}
+
+// manifestExportResponse is the apps.manifest.export response
+type manifestExportResponse struct {
+	slackAPIResponse
+	Manifest appManifest `json:"manifest"`
+}
+
+// configDrift lists the differences between the routes and the Slack app configuration
+type configDrift struct {
+	// UnsubscribedEvents are routed event subscriptions the app is not subscribed to
+	UnsubscribedEvents []string
+	// MissingScopes are bot scopes needed by the routes that the app does not have
+	MissingScopes []string
+	// InteractivityDisabled is set when interactive payloads are routed but the
+	// app has interactivity turned off
+	InteractivityDisabled bool
+}
+
+// count returns the number of drift issues
+func (d configDrift) count() int {
+	count := len(d.UnsubscribedEvents) + len(d.MissingScopes)
+	if d.InteractivityDisabled {
+		count++
+	}
+	return count
+}
+
+// checkConfigDrift compares configs against the Slack app's configuration. The
+// app manifest is exported with the configuration token when SLACK_APP_ID and
+// SLACK_CONFIG_TOKEN are set; the bot token's granted scopes are read from
+// auth.test when SLACK_BOT_TOKEN is set.
+func checkConfigDrift(ctx context.Context, configs []EventConfig) (configDrift, error) {
+	var drift configDrift
+	expected := buildAppManifest("", "", configs)
+
+	var manifestScopes []string
+	if configToken := getSlackConfigToken(); configToken != "" && slackAppID != "" {
+		params := url.Values{}
+		params.Set("app_id", slackAppID)
+		var result manifestExportResponse
+		if err := callSlackAPI(ctx, "apps.manifest.export", configToken, params, &result); err != nil {
+			return drift, err
+		}
+		actual := result.Manifest
+
+		var subscribed []string
+		if actual.Settings.EventSubscriptions != nil {
+			subscribed = actual.Settings.EventSubscriptions.BotEvents
+		}
+		if expected.Settings.EventSubscriptions != nil {
+			drift.UnsubscribedEvents = missingValues(expected.Settings.EventSubscriptions.BotEvents, subscribed)
+		}
+		if expected.Settings.Interactivity != nil && (actual.Settings.Interactivity == nil || !actual.Settings.Interactivity.IsEnabled) {
+			drift.InteractivityDisabled = true
+		}
+		manifestScopes = actual.OAuthConfig.Scopes.Bot
+	}
+
+	if botToken := getSlackBotToken(); botToken != "" {
+		header, err := callSlackAPIWithHeaders(ctx, "auth.test", botToken, url.Values{}, nil)
+		if err != nil {
+			return drift, err
+		}
+		granted := splitList(header.Get("X-OAuth-Scopes"))
+		drift.MissingScopes = missingValues(expected.OAuthConfig.Scopes.Bot, granted)
+	} else if manifestScopes != nil {
+		drift.MissingScopes = missingValues(expected.OAuthConfig.Scopes.Bot, manifestScopes)
+	}
+
+	return drift, nil
+}
+
+// missingValues returns the values of want that are not in have
+func missingValues(want []string, have []string) []string {
+	present := make(map[string]bool, len(have))
+	for _, value := range have {
+		present[value] = true
+	}
+	var missing []string
+	for _, value := range want {
+		if !present[value] {
+			missing = append(missing, value)
+		}
+	}
+	return missing
+}
+
+// reportConfigDrift runs a drift check and logs a warning for every issue found
+func reportConfigDrift(ctx context.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx, 2*slackAPITimeout)
+	defer cancel()
+
+	drift, err := checkConfigDrift(checkCtx, currentEventConfigs())
+	if err != nil {
+		logWarn("Could not check Slack app configuration for drift: %v", err)
+		return
+	}
+	driftIssues.Store(int64(drift.count()))
+
+	for _, event := range drift.UnsubscribedEvents {
+		logWarn("Configuration drift: routes expect event '%s' but the Slack app is not subscribed to it", event)
+	}
+	for _, scope := range drift.MissingScopes {
+		logWarn("Configuration drift: routes need bot scope '%s' but the Slack app does not have it", scope)
+	}
+	if drift.InteractivityDisabled {
+		logWarn("Configuration drift: interactive payloads are routed but the Slack app has interactivity disabled")
+	}
+	if drift.count() == 0 {
+		logDebug("No drift between routes and the Slack app configuration")
+	}
+}
+
+// watchConfigDrift checks for drift at startup and then every interval, until
+// ctx is cancelled
+func watchConfigDrift(ctx context.Context, interval time.Duration) {
+	reportConfigDrift(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reportConfigDrift(ctx)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCheckConfigDrift(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apps.manifest.export":
+			if got := r.Header.Get("Authorization"); got != "Bearer xoxe-test" {
+				t.Errorf("unexpected Authorization header: %s", got)
+			}
+			if err := r.ParseForm(); err != nil || r.Form.Get("app_id") != "A123" {
+				t.Errorf("unexpected app_id: %s", r.Form.Get("app_id"))
+			}
+			w.Write([]byte(`{"ok":true,"manifest":{"oauth_config":{"scopes":{"bot":["reactions:read"]}},"settings":{"event_subscriptions":{"bot_events":["reaction_added"]}}}}`))
+		case "/auth.test":
+			if got := r.Header.Get("Authorization"); got != "Bearer xoxb-test" {
+				t.Errorf("unexpected Authorization header: %s", got)
+			}
+			w.Header().Set("X-OAuth-Scopes", "reactions:read, app_mentions:read")
+			w.Write([]byte(`{"ok":true}`))
+		default:
+			t.Errorf("unexpected API method: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	originalURL, originalBot, originalConfig, originalApp := slackAPIBaseURL, slackBotToken, slackConfigToken, slackAppID
+	slackAPIBaseURL, slackBotToken, slackConfigToken, slackAppID = server.URL+"/", "xoxb-test", "xoxe-test", "A123"
+	defer func() {
+		slackAPIBaseURL, slackBotToken, slackConfigToken, slackAppID = originalURL, originalBot, originalConfig, originalApp
+	}()
+
+	configs := []EventConfig{
+		{EventType: "reaction_added"},
+		{EventType: "app_mention"},
+		{EventType: "pin_added"},
+		{EventType: "view_submission"},
+	}
+	drift, err := checkConfigDrift(context.Background(), configs)
+	if err != nil {
+		t.Fatalf("checkConfigDrift returned error: %v", err)
+	}
+	if want := []string{"app_mention", "pin_added"}; !reflect.DeepEqual(drift.UnsubscribedEvents, want) {
+		t.Errorf("unsubscribed events = %v, want %v", drift.UnsubscribedEvents, want)
+	}
+	if want := []string{"pins:read"}; !reflect.DeepEqual(drift.MissingScopes, want) {
+		t.Errorf("missing scopes = %v, want %v", drift.MissingScopes, want)
+	}
+	if !drift.InteractivityDisabled {
+		t.Error("expected interactivity drift for routed view_submission")
+	}
+	if drift.count() != 4 {
+		t.Errorf("expected 4 drift issues, got %d", drift.count())
+	}
+}
+
+func TestCheckConfigDriftNoTokens(t *testing.T) {
+	originalBot, originalConfig := slackBotToken, slackConfigToken
+	slackBotToken, slackConfigToken = "", ""
+	defer func() { slackBotToken, slackConfigToken = originalBot, originalConfig }()
+
+	drift, err := checkConfigDrift(context.Background(), []EventConfig{{EventType: "app_mention"}})
+	if err != nil {
+		t.Fatalf("checkConfigDrift returned error: %v", err)
+	}
+	if drift.count() != 0 {
+		t.Errorf("expected no drift without tokens, got %+v", drift)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// maxEchoPostLength caps the payload text re-posted to the Slack debug channel,
+// keeping messages well below Slack's message size limit
+const maxEchoPostLength = 3000
+
+// formatEchoMessage renders a message received on a relay output channel for display
+func formatEchoMessage(channel string, payload string) string {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(payload), "", "  "); err != nil {
+		return fmt.Sprintf("[%s] %s", channel, payload)
+	}
+	return fmt.Sprintf("[%s] %s", channel, indented.String())
+}
+
+// isBotMessagePayload reports whether payload is a message event posted by a bot.
+// These are not re-posted to Slack: the debug post would itself be relayed and
+// echoed again.
+func isBotMessagePayload(payload string) bool {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &parsed); err != nil {
+		return false
+	}
+	// Look inside envelopes signed by the relay
+	if inner, ok := parsed["payload"].(map[string]interface{}); ok && parsed["type"] == "signed" {
+		parsed = inner
+	}
+	event, ok := parsed["event"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if botID, _ := event["bot_id"].(string); botID != "" {
+		return true
+	}
+	return event["subtype"] == "bot_message"
+}
+
+// postEchoToSlack re-posts a relayed payload to a Slack debug channel with the bot token
+func postEchoToSlack(ctx context.Context, slackChannel string, redisChannel string, payload string) error {
+	token := getSlackBotToken()
+	if token == "" {
+		return errors.New("SLACK_BOT_TOKEN is not configured")
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(payload), "", "  "); err != nil {
+		indented.Reset()
+		indented.WriteString(payload)
+	}
+	text := indented.String()
+	if len(text) > maxEchoPostLength {
+		text = strings.ToValidUTF8(text[:maxEchoPostLength], "") + "\n…"
+	}
+
+	params := url.Values{}
+	params.Set("channel", slackChannel)
+	params.Set("text", fmt.Sprintf("Relayed on `%s`:\n```%s```", redisChannel, text))
+	params.Set("unfurl_links", "false")
+	return callSlackAPI(ctx, "chat.postMessage", token, params, nil)
+}
+
+// runEchoConsumer subscribes to relay output channels and passes every message to
+// print, optionally re-posting it to slackChannel, until ctx is cancelled
+func runEchoConsumer(ctx context.Context, channels []string, slackChannel string, print func(string)) error {
+	if redisClient == nil {
+		return errRedisUnavailable
+	}
+
+	pubsub := redisClient.Subscribe(ctx, channels...)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			print(formatEchoMessage(message.Channel, message.Payload))
+			if key := getEnvelopeSigningKey(); len(key) > 0 {
+				if _, ok := verifyEnvelope([]byte(message.Payload), key, 0, clock.Now()); !ok {
+					logWarn("Message on '%s' is not signed with the relay's envelope signing key", message.Channel)
+				}
+			}
+			if slackChannel == "" || isBotMessagePayload(message.Payload) {
+				continue
+			}
+			postCtx, cancel := context.WithTimeout(ctx, slackAPITimeout)
+			if err := postEchoToSlack(postCtx, slackChannel, message.Channel, message.Payload); err != nil {
+				logWarn("Error re-posting event from '%s' to Slack channel '%s': %v", message.Channel, slackChannel, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// runEchoCommand implements the "echo" subcommand, which prints everything the
+// relay publishes to the given channels
+func runEchoCommand(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("echo", flag.ContinueOnError)
+	channels := flags.String("channels", "", "comma-separated Redis channels to subscribe to (uses REDIS_HOST/REDIS_PORT/REDIS_PASSWORD)")
+	slackChannel := flags.String("slack-channel", "", "Slack channel ID to re-post events to (uses SLACK_BOT_TOKEN)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	channelList := splitList(*channels)
+	if len(channelList) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: slack-relay echo -channels CHANNEL[,CHANNEL...] [-slack-channel C0123456789]")
+		return 2
+	}
+
+	if *slackChannel != "" {
+		token, err := loadSecret(secretSlackBotToken)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading Slack bot token: %v\n", err)
+			return 1
+		}
+		slackBotToken = token
+	}
+
+	// Flag messages not signed by the relay when envelope signing is enabled
+	if key, err := loadSecret(secretEnvelopeKey); err == nil {
+		envelopeSigningKey = []byte(key)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	redisClient = newRedisClientFromEnv()
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", strings.Join(channelList, ", "))
+	err := runEchoConsumer(ctx, channelList, *slackChannel, func(message string) {
+		fmt.Fprintln(stdout, message)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error subscribing to Redis: %v\n", err)
+		return 1
+	}
+	return 0
+}
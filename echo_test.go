@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFormatEchoMessage(t *testing.T) {
+	got := formatEchoMessage("slack-relay-message", `{"type":"event_callback"}`)
+	if got != "[slack-relay-message] {\n  \"type\": \"event_callback\"\n}" {
+		t.Errorf("unexpected formatted message: %q", got)
+	}
+	if got := formatEchoMessage("raw", "not json"); got != "[raw] not json" {
+		t.Errorf("unexpected formatted message: %q", got)
+	}
+}
+
+func TestIsBotMessagePayload(t *testing.T) {
+	tests := []struct {
+		payload  string
+		expected bool
+	}{
+		{`{"event":{"type":"message","bot_id":"B1"}}`, true},
+		{`{"event":{"type":"message","subtype":"bot_message"}}`, true},
+		{`{"event":{"type":"message","user":"U1"}}`, false},
+		{`{"type":"view_submission"}`, false},
+		{`{"type":"signed","payload":{"event":{"type":"message","bot_id":"B1"}}}`, true},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		if got := isBotMessagePayload(tt.payload); got != tt.expected {
+			t.Errorf("isBotMessagePayload(%s) = %v, want %v", tt.payload, got, tt.expected)
+		}
+	}
+}
+
+func TestPostEchoToSlack(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" {
+			t.Errorf("unexpected API method: %s", r.URL.Path)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %v", err)
+		}
+		if r.Form.Get("channel") != "C123" {
+			t.Errorf("unexpected channel: %s", r.Form.Get("channel"))
+		}
+		if text := r.Form.Get("text"); !strings.Contains(text, "`slack-relay-message`") || !strings.Contains(text, `"type": "event_callback"`) {
+			t.Errorf("unexpected text: %s", text)
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	originalURL, originalToken := slackAPIBaseURL, slackBotToken
+	slackAPIBaseURL, slackBotToken = server.URL+"/", "xoxb-test"
+	defer func() { slackAPIBaseURL, slackBotToken = originalURL, originalToken }()
+
+	if err := postEchoToSlack(context.Background(), "C123", "slack-relay-message", `{"type":"event_callback"}`); err != nil {
+		t.Fatalf("postEchoToSlack returned error: %v", err)
+	}
+}
+
+func TestRunEchoConsumerWithoutRedis(t *testing.T) {
+	setupTestEnvironment()
+	if err := runEchoConsumer(context.Background(), []string{"c"}, "", func(string) {}); err != errRedisUnavailable {
+		t.Errorf("expected errRedisUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key providers for route payload encryption
+const (
+	keyProviderSecret       = "secret"
+	keyProviderVaultTransit = "vault-transit"
+)
+
+// encryptionAlgorithm is the cipher used for encrypted payloads
+const encryptionAlgorithm = "AES-256-GCM"
+
+// payloadKeySecretPrefix prefixes the key ID to form the name of the secret
+// holding a route's encryption key
+const payloadKeySecretPrefix = "payload-key-"
+
+// payloadKeyCacheTTL is how long an encryption key is reused before it is
+// loaded again, so rotated keys are picked up
+const payloadKeyCacheTTL = 5 * time.Minute
+
+// payloadKeyFailureTTL is how long a failure to load a key is remembered, so an
+// unavailable key provider is not called again for every event
+const payloadKeyFailureTTL = 10 * time.Second
+
+// skipEncryptionFailed is the skip reason for events whose payload could not be
+// encrypted. They are never published in plaintext.
+const skipEncryptionFailed = "payload could not be encrypted"
+
+// EncryptionPolicy configures encrypting a route's payloads before they are published
+type EncryptionPolicy struct {
+	// KeyID names the key: the secret payload-key-<key-id>, or the Vault transit key
+	KeyID string `json:"key-id,omitempty"`
+	// Provider is where the key comes from: secret (default) or vault-transit
+	Provider string `json:"provider,omitempty"`
+}
+
+// enabled reports whether the policy encrypts payloads
+func (p EncryptionPolicy) enabled() bool {
+	return p.KeyID != ""
+}
+
+// encryptedEnvelope is the message published in place of an encrypted payload
+type encryptedEnvelope struct {
+	Type       string           `json:"type"`
+	EventType  string           `json:"event_type"`
+	Encryption encryptionHeader `json:"encryption"`
+	Ciphertext string           `json:"ciphertext"`
+}
+
+// encryptionHeader describes how to decrypt an encryptedEnvelope
+type encryptionHeader struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	Provider  string `json:"provider"`
+	Nonce     string `json:"nonce"`
+	// WrappedKey is the data key encrypted by Vault transit, for the vault-transit provider
+	WrappedKey string `json:"wrapped_key,omitempty"`
+}
+
+// payloadKey is a loaded data key and, for Vault transit, its wrapped form, or
+// the error loading it
+type payloadKey struct {
+	key     []byte
+	wrapped string
+	err     error
+	expires time.Time
+}
+
+// payloadKeyLoad is a key being loaded, shared by the events waiting for it
+type payloadKeyLoad struct {
+	done chan struct{}
+	key  payloadKey
+}
+
+// payloadKeys caches loaded keys and load failures by provider and key ID
+var payloadKeys = make(map[string]payloadKey)
+
+// payloadKeyLoads holds the keys being loaded by provider and key ID
+var payloadKeyLoads = make(map[string]*payloadKeyLoad)
+
+// payloadKeysMu guards payloadKeys and payloadKeyLoads. It is not held while
+// a key is loaded.
+var payloadKeysMu sync.Mutex
+
+var metricEncryptionErrors = newCounterVec("slack_relay_encryption_errors_total",
+	"Events not published because their payload could not be encrypted, by event type.", "event_type")
+
+// encryptPayload encrypts payload with the policy's key and returns the
+// encoded envelope. The event type is authenticated as additional data, so it
+// cannot be altered without failing decryption.
+func encryptPayload(eventType string, payload []byte, policy EncryptionPolicy) ([]byte, error) {
+	provider := policy.Provider
+	if provider == "" {
+		provider = keyProviderSecret
+	}
+	key, err := loadPayloadKey(provider, policy.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(encryptedEnvelope{
+		Type:      "encrypted",
+		EventType: eventType,
+		Encryption: encryptionHeader{
+			Algorithm:  encryptionAlgorithm,
+			KeyID:      policy.KeyID,
+			Provider:   provider,
+			Nonce:      base64.StdEncoding.EncodeToString(nonce),
+			WrappedKey: key.wrapped,
+		},
+		Ciphertext: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, payload, []byte(eventType))),
+	})
+}
+
+// loadPayloadKey returns the cached key for provider and keyID, loading it when
+// it is missing or expired. Concurrent events needing the same key wait for a
+// single load, and other keys stay available while it runs.
+func loadPayloadKey(provider string, keyID string) (payloadKey, error) {
+	cacheKey := provider + "\xff" + keyID
+	payloadKeysMu.Lock()
+	if key, ok := payloadKeys[cacheKey]; ok && clock.Now().Before(key.expires) {
+		payloadKeysMu.Unlock()
+		return key, key.err
+	}
+	load, loading := payloadKeyLoads[cacheKey]
+	if !loading {
+		load = &payloadKeyLoad{done: make(chan struct{})}
+		payloadKeyLoads[cacheKey] = load
+	}
+	payloadKeysMu.Unlock()
+
+	if !loading {
+		load.key = fetchPayloadKey(provider, keyID)
+		payloadKeysMu.Lock()
+		payloadKeys[cacheKey] = load.key
+		delete(payloadKeyLoads, cacheKey)
+		payloadKeysMu.Unlock()
+		close(load.done)
+	}
+	<-load.done
+	return load.key, load.key.err
+}
+
+// fetchPayloadKey loads the key for provider and keyID, or the error loading
+// it, with the time it is cached until
+func fetchPayloadKey(provider string, keyID string) payloadKey {
+	var key payloadKey
+	var err error
+	switch provider {
+	case keyProviderSecret:
+		key, err = loadSecretPayloadKey(keyID)
+	case keyProviderVaultTransit:
+		key, err = generateTransitDataKey(keyID)
+	default:
+		err = fmt.Errorf("unknown key provider '%s'", provider)
+	}
+	if err != nil {
+		return payloadKey{err: err, expires: clock.Now().Add(payloadKeyFailureTTL)}
+	}
+	key.expires = clock.Now().Add(payloadKeyCacheTTL)
+	return key
+}
+
+// loadSecretPayloadKey reads a base64-encoded 256-bit key from the secret
+// payload-key-<keyID>
+func loadSecretPayloadKey(keyID string) (payloadKey, error) {
+	name := payloadKeySecretPrefix + keyID
+	value, err := loadSecret(name)
+	if err != nil {
+		return payloadKey{}, err
+	}
+	if value == "" {
+		return payloadKey{}, fmt.Errorf("secret '%s' not found", name)
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return payloadKey{}, fmt.Errorf("secret '%s' is not valid base64: %w", name, err)
+	}
+	if len(key) != 32 {
+		return payloadKey{}, fmt.Errorf("secret '%s' must hold a 32-byte key, got %d bytes", name, len(key))
+	}
+	return payloadKey{key: key}, nil
+}
+
+// generateTransitDataKey asks Vault's transit engine for a new data key under
+// keyID. Vault returns the key in plaintext for encrypting and wrapped by keyID
+// for the envelope; consumers unwrap it with transit/decrypt.
+func generateTransitDataKey(keyID string) (payloadKey, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	token, err := vaultTokenFromEnv()
+	if err != nil {
+		return payloadKey{}, err
+	}
+	if addr == "" || token == "" {
+		return payloadKey{}, errors.New("vault-transit encryption requires VAULT_ADDR and VAULT_TOKEN")
+	}
+	mount := os.Getenv("VAULT_TRANSIT_MOUNT")
+	if mount == "" {
+		mount = "transit"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	endpoint := strings.TrimSuffix(addr, "/") + "/v1/" + strings.Trim(mount, "/") + "/datakey/plaintext/" + keyID
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader([]byte(`{"bits":256}`)))
+	if err != nil {
+		return payloadKey{}, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return payloadKey{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return payloadKey{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return payloadKey{}, fmt.Errorf("vault transit returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data struct {
+			Plaintext  string `json:"plaintext"`
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return payloadKey{}, fmt.Errorf("vault transit returned invalid JSON: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(result.Data.Plaintext)
+	if err != nil || len(key) != 32 || result.Data.Ciphertext == "" {
+		return payloadKey{}, errors.New("vault transit returned an invalid data key")
+	}
+	return payloadKey{key: key, wrapped: result.Data.Ciphertext}, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// decryptEnvelope decrypts an encrypted envelope with key, as a consumer would
+func decryptEnvelope(t *testing.T, data []byte, key []byte, eventType string) (encryptedEnvelope, []byte, error) {
+	t.Helper()
+	var envelope encryptedEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		t.Fatalf("unexpected error decoding envelope: %v", err)
+	}
+	nonce, _ := base64.StdEncoding.DecodeString(envelope.Encryption.Nonce)
+	ciphertext, _ := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("unexpected error creating cipher: %v", err)
+	}
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(eventType))
+	return envelope, plaintext, err
+}
+
+func TestEncryptPayloadWithSecretKey(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	t.Setenv("PAYLOAD_KEY_PII", base64.StdEncoding.EncodeToString(key))
+	payloadKeys = make(map[string]payloadKey)
+
+	payload := []byte(`{"type":"event_callback","event":{"type":"message","text":"secret"}}`)
+	data, err := encryptPayload("message", payload, EncryptionPolicy{KeyID: "pii"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	envelope, plaintext, err := decryptEnvelope(t, data, key, "message")
+	if err != nil {
+		t.Fatalf("unexpected error decrypting: %v", err)
+	}
+	if string(plaintext) != string(payload) {
+		t.Errorf("expected decrypted payload %s, got %s", payload, plaintext)
+	}
+	if envelope.Type != "encrypted" || envelope.EventType != "message" || envelope.Encryption.KeyID != "pii" ||
+		envelope.Encryption.Algorithm != encryptionAlgorithm || envelope.Encryption.Provider != keyProviderSecret {
+		t.Errorf("unexpected envelope %+v", envelope)
+	}
+
+	if _, _, err := decryptEnvelope(t, data, key, "app_mention"); err == nil {
+		t.Error("expected decryption to fail when the event type is altered")
+	}
+}
+
+func TestEncryptPayloadInvalidKey(t *testing.T) {
+	payloadKeys = make(map[string]payloadKey)
+	if _, err := encryptPayload("message", []byte(`{}`), EncryptionPolicy{KeyID: "missing"}); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+
+	t.Setenv("PAYLOAD_KEY_SHORT", base64.StdEncoding.EncodeToString([]byte("too short")))
+	if _, err := encryptPayload("message", []byte(`{}`), EncryptionPolicy{KeyID: "short"}); err == nil {
+		t.Error("expected an error for a key of the wrong size")
+	}
+}
+
+func TestEncryptPayloadWithVaultTransit(t *testing.T) {
+	key := []byte("abcdef0123456789abcdef0123456789")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/transit/datakey/plaintext/slack-relay" || r.Header.Get("X-Vault-Token") != "vault-token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+			"plaintext":  base64.StdEncoding.EncodeToString(key),
+			"ciphertext": "vault:v1:wrapped",
+		}})
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	payloadKeys = make(map[string]payloadKey)
+
+	data, err := encryptPayload("message", []byte(`{"text":"secret"}`), EncryptionPolicy{KeyID: "slack-relay", Provider: keyProviderVaultTransit})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	envelope, plaintext, err := decryptEnvelope(t, data, key, "message")
+	if err != nil || string(plaintext) != `{"text":"secret"}` {
+		t.Fatalf("unexpected decryption result %s: %v", plaintext, err)
+	}
+	if envelope.Encryption.WrappedKey != "vault:v1:wrapped" {
+		t.Errorf("expected the wrapped data key in the envelope, got %q", envelope.Encryption.WrappedKey)
+	}
+}
+
+func TestRouteEventEncryptionFailureSkips(t *testing.T) {
+	setupTestEnvironment()
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "test-channel", Encryption: EncryptionPolicy{KeyID: "missing"}}})
+	defer setupTestEnvironment()
+	payloadKeys = make(map[string]payloadKey)
+
+	routed := routeEvent(map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{"type": "message"}}, []byte(`{}`))
+	if routed.Skip != skipEncryptionFailed {
+		t.Errorf("expected skip %q, got %q", skipEncryptionFailed, routed.Skip)
+	}
+}
+
+func TestLoadPayloadKeySharesLoads(t *testing.T) {
+	key := []byte("abcdef0123456789abcdef0123456789")
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+			"plaintext":  base64.StdEncoding.EncodeToString(key),
+			"ciphertext": "vault:v1:wrapped",
+		}})
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	t.Setenv("PAYLOAD_KEY_PII", base64.StdEncoding.EncodeToString(key))
+	payloadKeys = make(map[string]payloadKey)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := loadPayloadKey(keyProviderVaultTransit, "slack-relay"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Other keys load while Vault is still answering
+	loaded := make(chan error, 1)
+	go func() {
+		_, err := loadPayloadKey(keyProviderSecret, "pii")
+		loaded <- err
+	}()
+	select {
+	case err := <-loaded:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected a secret key to load while a Vault key is loading")
+	}
+
+	close(release)
+	wg.Wait()
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected one Vault request for concurrent events, got %d", n)
+	}
+}
+
+func TestLoadPayloadKeyCachesFailures(t *testing.T) {
+	c := newManualClock(time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC))
+	defer useClock(c)()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "sealed", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	payloadKeys = make(map[string]payloadKey)
+
+	for i := 0; i < 3; i++ {
+		if _, err := loadPayloadKey(keyProviderVaultTransit, "slack-relay"); err == nil {
+			t.Fatal("expected an error while Vault is unavailable")
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected the failure to be cached, got %d Vault requests", n)
+	}
+	c.advance(payloadKeyFailureTTL)
+	loadPayloadKey(keyProviderVaultTransit, "slack-relay")
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected the key to be requested again after %s, got %d Vault requests", payloadKeyFailureTTL, n)
+	}
+}
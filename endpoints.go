@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var metricEndpointRequests = newCounterVec("slack_relay_endpoint_requests_total",
+	"Requests to custom endpoints, by endpoint path and result.", "endpoint", "result")
+
+// endpointConfig is a custom endpoint accepting arbitrary JSON from internal
+// tools and publishing it to a channel alongside the Slack events
+type endpointConfig struct {
+	// Path is the URL path the endpoint is served at on the Slack event port
+	Path string `json:"path"`
+	// Token is the bearer token requests must carry
+	Token string `json:"token"`
+	// Channel is the Redis channel requests are published to
+	Channel string `json:"channel"`
+	// Description is what the endpoint is for, for operators
+	Description string `json:"description,omitempty"`
+}
+
+// endpointsByPath indexes custom endpoints by path
+func endpointsByPath(endpoints []endpointConfig) map[string]endpointConfig {
+	byPath := make(map[string]endpointConfig, len(endpoints))
+	for _, endpoint := range endpoints {
+		byPath[endpoint.Path] = endpoint
+	}
+	return byPath
+}
+
+// setCustomEndpoints replaces the custom endpoints of the active configuration
+func setCustomEndpoints(endpoints []endpointConfig) {
+	byPath := endpointsByPath(endpoints)
+	updateConfig(func(next *configSnapshot) {
+		next.endpoints = byPath
+	})
+}
+
+// customEndpoint returns the custom endpoint served at path
+func customEndpoint(path string) (endpointConfig, bool) {
+	endpoint, ok := currentConfig().endpoints[path]
+	return endpoint, ok
+}
+
+// mergeEndpoints overlays endpoints on base, replacing endpoints with the same path
+func mergeEndpoints(base []endpointConfig, overlay []endpointConfig) []endpointConfig {
+	result := append([]endpointConfig(nil), base...)
+	for _, endpoint := range overlay {
+		replaced := false
+		for i := range result {
+			if result[i].Path == endpoint.Path {
+				result[i] = endpoint
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			result = append(result, endpoint)
+		}
+	}
+	return result
+}
+
+// validateEndpoints checks that every custom endpoint has a path of its own, a
+// token and a channel
+func validateEndpoints(endpoints []endpointConfig) error {
+	for _, endpoint := range endpoints {
+		if !strings.HasPrefix(endpoint.Path, "/") {
+			return fmt.Errorf("endpoint path '%s' must start with /", endpoint.Path)
+		}
+		if endpoint.Path == "/" || endpoint.Path == "/slack" || endpoint.Path == federationPath {
+			return fmt.Errorf("endpoint path '%s' is reserved", endpoint.Path)
+		}
+		if endpoint.Token == "" {
+			return fmt.Errorf("endpoint '%s' has no token", endpoint.Path)
+		}
+		if endpoint.Channel == "" {
+			return fmt.Errorf("endpoint '%s' has no channel", endpoint.Path)
+		}
+	}
+	return nil
+}
+
+// endpointPayload returns body with the relay metadata naming the endpoint
+// attached. JSON objects get the metadata alongside their fields; other JSON
+// values are wrapped under "payload".
+func endpointPayload(path string, body []byte) ([]byte, error) {
+	metadata := map[string]interface{}{"endpoint": path}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(trimmed, &fields); err != nil {
+			return nil, err
+		}
+		return withRelayMetadata(fields, metadata)
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, err
+	}
+	return withRelayMetadata(map[string]interface{}{"payload": value}, metadata)
+}
+
+// customEndpointHandler serves the custom endpoints of the configuration,
+// answering other paths as not found
+func customEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := customEndpoint(r.URL.Path)
+	if !ok {
+		notFoundHandler(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(endpoint.Token)) != 1 {
+		logWarn("Invalid token for endpoint %s from %s", endpoint.Path, clientIP(r))
+		metricEndpointRequests.Inc(endpoint.Path, "unauthorized")
+		recordAbuse(r, abuseInvalidToken)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	defer r.Body.Close()
+	body, release, err := readRequestBody(w, r)
+	if err == errBodyTooLarge {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	defer release()
+
+	payload, err := endpointPayload(endpoint.Path, body)
+	if err != nil {
+		metricEndpointRequests.Inc(endpoint.Path, "invalid")
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := publishEvent(endpoint.Channel, payload); err != nil {
+		metricEndpointRequests.Inc(endpoint.Path, "error")
+		http.Error(w, "Error publishing event", http.StatusInternalServerError)
+		return
+	}
+	metricEndpointRequests.Inc(endpoint.Path, "published")
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigEndpoints(t *testing.T) {
+	parsed, err := parseConfigFrom(".", []byte(`
+{"endpoints": [{"path": "/hooks/deploys", "token": "one", "channel": "deploys"}], "routes": []}
+{"endpoints": [{"path": "/hooks/deploys", "token": "two", "channel": "deploys-v2"}, {"path": "/hooks/alerts", "token": "three", "channel": "alerts"}], "routes": []}
+`), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed.Endpoints) != 2 || parsed.Endpoints[0].Channel != "deploys-v2" || parsed.Endpoints[1].Path != "/hooks/alerts" {
+		t.Errorf("expected the later endpoint to replace the earlier one, got %+v", parsed.Endpoints)
+	}
+
+	for _, invalid := range []string{
+		`{"endpoints": [{"path": "hooks", "token": "t", "channel": "c"}], "routes": []}`,
+		`{"endpoints": [{"path": "/slack", "token": "t", "channel": "c"}], "routes": []}`,
+		`{"endpoints": [{"path": "/hooks", "channel": "c"}], "routes": []}`,
+		`{"endpoints": [{"path": "/hooks", "token": "t"}], "routes": []}`,
+	} {
+		if _, err := parseConfigFrom(".", []byte(invalid), 0); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
+
+func TestEndpointPayload(t *testing.T) {
+	payload, err := endpointPayload("/hooks/deploys", []byte(`{"service": "api"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(payload, &fields)
+	metadata, _ := fields[relayMetadataKey].(map[string]interface{})
+	if fields["service"] != "api" || metadata["endpoint"] != "/hooks/deploys" {
+		t.Errorf("expected the object with relay metadata, got %s", payload)
+	}
+
+	payload, err = endpointPayload("/hooks/deploys", []byte(`[1, 2]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(payload), `"payload":[1,2]`) {
+		t.Errorf("expected a non-object to be wrapped, got %s", payload)
+	}
+
+	if _, err := endpointPayload("/hooks/deploys", []byte(`{"service"`)); err == nil {
+		t.Error("expected invalid JSON to be rejected")
+	}
+}
+
+func TestCustomEndpointHandler(t *testing.T) {
+	setCustomEndpoints([]endpointConfig{{Path: "/hooks/deploys", Token: "deploy-token", Channel: "deploys"}})
+	defer setCustomEndpoints(nil)
+
+	post := func(path string, token string, body string) int {
+		rr := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		customEndpointHandler(rr, request)
+		return rr.Code
+	}
+
+	if code := post("/hooks/other", "deploy-token", `{}`); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown path, got %d", code)
+	}
+	before := metricEndpointRequests.values["/hooks/deploys\xffunauthorized"]
+	if code := post("/hooks/deploys", "wrong", `{}`); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong token, got %d", code)
+	}
+	if got := metricEndpointRequests.values["/hooks/deploys\xffunauthorized"] - before; got != 1 {
+		t.Errorf("expected 1 unauthorized request counted, got %v", got)
+	}
+	if code := post("/hooks/deploys", "deploy-token", `not json`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid JSON, got %d", code)
+	}
+	// Without Redis the publish fails, so the tool is asked to retry
+	if code := post("/hooks/deploys", "deploy-token", `{"service": "api"}`); code != http.StatusInternalServerError {
+		t.Errorf("expected 500 without Redis, got %d", code)
+	}
+}
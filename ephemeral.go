@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ephemeralAckTimeout bounds each post of an ephemeral acknowledgement
+const ephemeralAckTimeout = 5 * time.Second
+
+// ephemeralAckClient is the HTTP client used to post ephemeral acknowledgements
+// and other messages to response URLs
+var ephemeralAckClient = &http.Client{Timeout: ephemeralAckTimeout}
+
+var metricEphemeralAcks = newCounterVec("slack_relay_ephemeral_acks_total",
+	"Ephemeral acknowledgements posted to response URLs, by event type and result.", "event_type", "result")
+
+// payloadResponseURL returns the response_url of an interactive payload or slash
+// command, or an empty string when it has none
+func payloadResponseURL(payload map[string]interface{}) string {
+	responseURL, _ := payload["response_url"].(string)
+	return responseURL
+}
+
+// postEphemeralAck posts text as an ephemeral message to the payload's
+// response_url, so the user sees the action was received while the consumer
+// works on it. Consumers replace it later through the same response_url. It runs
+// independently of the publish, whose outcome it does not affect.
+func postEphemeralAck(eventType string, responseURL string, text string) {
+	ctx, cancel := context.WithTimeout(context.Background(), ephemeralAckTimeout)
+	defer cancel()
+
+	err := postResponseURL(ctx, responseURL, map[string]interface{}{
+		"response_type":    "ephemeral",
+		"replace_original": false,
+		"text":             text,
+	})
+	if err != nil {
+		logWarn("Error posting ephemeral acknowledgement for event type '%s': %v", eventType, err)
+		metricEphemeralAcks.Inc(eventTypeLabel(eventType), "failure")
+		return
+	}
+	metricEphemeralAcks.Inc(eventTypeLabel(eventType), "success")
+}
+
+// postResponseURL posts message as JSON to the response_url of an interactive
+// payload or slash command
+func postResponseURL(ctx context.Context, responseURL string, message map[string]interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := ephemeralAckClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
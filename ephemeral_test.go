@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostEphemeralAck(t *testing.T) {
+	var received map[string]interface{}
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected a JSON post, got %q", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		if r.URL.Path == "/expired" {
+			http.Error(w, "expired_url", http.StatusNotFound)
+		}
+	}))
+	defer slack.Close()
+
+	postEphemeralAck("ephemeral_test", slack.URL+"/actions", "Working on it…")
+	if received["response_type"] != "ephemeral" || received["replace_original"] != false || received["text"] != "Working on it…" {
+		t.Errorf("expected an ephemeral message, got %v", received)
+	}
+
+	postEphemeralAck("ephemeral_test", slack.URL+"/expired", "Working on it…")
+
+	recorder := httptest.NewRecorder()
+	metricsHandler(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, expected := range []string{
+		`slack_relay_ephemeral_acks_total{event_type="ephemeral_test",result="success"} 1`,
+		`slack_relay_ephemeral_acks_total{event_type="ephemeral_test",result="failure"} 1`,
+	} {
+		if !strings.Contains(recorder.Body.String(), expected) {
+			t.Errorf("expected %q in metrics output", expected)
+		}
+	}
+}
+
+func TestSlackHandlerEphemeralAck(t *testing.T) {
+	posted := make(chan string, 1)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+		text, _ := message["text"].(string)
+		posted <- text
+	}))
+	defer slack.Close()
+
+	setupTestEnvironment()
+	setEventConfigs([]EventConfig{
+		{EventType: "block_actions", Channel: "slack-actions", EphemeralAck: "Working on it, {{.user.name}}…"},
+	})
+	defer setupTestEnvironment()
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":         "block_actions",
+		"user":         map[string]interface{}{"id": "U123", "name": "alice"},
+		"response_url": slack.URL + "/actions/T123/456/abc",
+	})
+	form := url.Values{"payload": {string(payload)}}
+	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader([]byte(form.Encode())))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	slackHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	select {
+	case text := <-posted:
+		if text != "Working on it, alice…" {
+			t.Errorf("expected the rendered acknowledgement, got %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an ephemeral acknowledgement to be posted")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// eventTypePattern is a slack-event-type matching a family of event types: a
+// glob such as "subteam_*", or a regular expression between slashes such as
+// "/^subteam_/". Patterns also match events with a subtype as
+// "type.subtype", so "message.*" matches every message subtype.
+type eventTypePattern struct {
+	// Pattern is the slack-event-type as configured
+	Pattern string
+	regexp  *regexp.Regexp
+}
+
+// isEventTypePattern reports whether a slack-event-type is a pattern rather
+// than an event type
+func isEventTypePattern(eventType string) bool {
+	return isRegexpEventType(eventType) || strings.ContainsAny(eventType, "*?[")
+}
+
+// isRegexpEventType reports whether a slack-event-type is a regular expression
+func isRegexpEventType(eventType string) bool {
+	return len(eventType) > 2 && strings.HasPrefix(eventType, "/") && strings.HasSuffix(eventType, "/")
+}
+
+// compileEventTypePattern compiles a slack-event-type pattern
+func compileEventTypePattern(pattern string) (eventTypePattern, error) {
+	if isRegexpEventType(pattern) {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return eventTypePattern{}, err
+		}
+		return eventTypePattern{Pattern: pattern, regexp: re}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return eventTypePattern{}, err
+	}
+	return eventTypePattern{Pattern: pattern}, nil
+}
+
+// matches reports whether eventType belongs to the pattern's family
+func (p eventTypePattern) matches(eventType string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(eventType)
+	}
+	matched, _ := path.Match(p.Pattern, eventType)
+	return matched
+}
+
+// subscribes reports whether the pattern matches events of eventType, with or
+// without a subtype. Globs matching subtypes such as "message.channel_*" match
+// the event type before the dot; regular expressions only match event types.
+func (p eventTypePattern) subscribes(eventType string) bool {
+	if p.matches(eventType) {
+		return true
+	}
+	if p.regexp != nil {
+		return false
+	}
+	base, _, ok := strings.Cut(p.Pattern, ".")
+	if !ok {
+		return false
+	}
+	matched, _ := path.Match(base, eventType)
+	return matched
+}
+
+// qualifyEventType returns eventType as "type.subtype" when the payload is an
+// event callback whose event has a subtype, or eventType otherwise
+func qualifyEventType(eventType string, payload map[string]interface{}) string {
+	if payload["type"] != "event_callback" {
+		return eventType
+	}
+	event, _ := payload["event"].(map[string]interface{})
+	if subtype, _ := event["subtype"].(string); subtype != "" {
+		return eventType + "." + subtype
+	}
+	return eventType
+}
+
+// newEventTypePatterns compiles the distinct patterns of configs, in order.
+// Patterns are validated when the configuration is parsed, so invalid ones
+// are skipped.
+func newEventTypePatterns(configs []EventConfig) []eventTypePattern {
+	var patterns []eventTypePattern
+	seen := make(map[string]bool)
+	for _, config := range configs {
+		if !isEventTypePattern(config.EventType) || seen[config.EventType] {
+			continue
+		}
+		seen[config.EventType] = true
+		if pattern, err := compileEventTypePattern(config.EventType); err == nil {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// validateEventTypePatterns checks that every slack-event-type pattern compiles
+func validateEventTypePatterns(configs []EventConfig) error {
+	for _, config := range configs {
+		if !isEventTypePattern(config.EventType) {
+			continue
+		}
+		if _, err := compileEventTypePattern(config.EventType); err != nil {
+			return fmt.Errorf("slack-event-type '%s' is not a valid pattern: %w", config.EventType, err)
+		}
+	}
+	return nil
+}
+
+// matchEventType returns the slack-event-type whose routes handle eventType
+// events of payload: eventType itself when it has routes, otherwise the first
+// pattern matching it with or without its subtype, or eventType when none
+// does. payload may be nil when the subtype is unknown.
+func (s *configSnapshot) matchEventType(eventType string, payload map[string]interface{}) string {
+	if _, ok := s.byEventType[eventType]; ok || len(s.eventTypePatterns) == 0 {
+		return eventType
+	}
+	qualified := qualifyEventType(eventType, payload)
+	for _, pattern := range s.eventTypePatterns {
+		if pattern.matches(eventType) || (qualified != eventType && pattern.matches(qualified)) {
+			return pattern.Pattern
+		}
+	}
+	return eventType
+}
+
+// expandEventTypePatterns replaces the routes of patterns with a copy per known
+// event type the pattern matches, for the app manifest, which can only
+// subscribe to event types by name
+func expandEventTypePatterns(configs []EventConfig) []EventConfig {
+	known := make([]string, 0, len(eventSubscriptions)+len(interactivityTypes))
+	for eventType := range eventSubscriptions {
+		known = append(known, eventType)
+	}
+	for eventType := range interactivityTypes {
+		known = append(known, eventType)
+	}
+	sort.Strings(known)
+
+	expanded := make([]EventConfig, 0, len(configs))
+	for _, config := range configs {
+		if !isEventTypePattern(config.EventType) {
+			expanded = append(expanded, config)
+			continue
+		}
+		pattern, err := compileEventTypePattern(config.EventType)
+		if err != nil {
+			continue
+		}
+		for _, eventType := range known {
+			if pattern.subscribes(eventType) {
+				route := config
+				route.EventType = eventType
+				expanded = append(expanded, route)
+			}
+		}
+	}
+	return expanded
+}
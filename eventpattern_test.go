@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEventTypePatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		eventType string
+		want      bool
+	}{
+		{"subteam_*", "subteam_created", true},
+		{"subteam_*", "team_join", false},
+		{"reaction_*", "reaction_added", true},
+		{"/^(pin|star)_(added|removed)$/", "pin_added", true},
+		{"/^(pin|star)_(added|removed)$/", "pin_added_extra", false},
+		{"/channel_/", "member_joined_channel", false},
+		{"/channel_/", "channel_rename", true},
+	}
+	for _, tt := range tests {
+		pattern, err := compileEventTypePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("compileEventTypePattern(%q): %v", tt.pattern, err)
+		}
+		if got := pattern.matches(tt.eventType); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.eventType, got, tt.want)
+		}
+	}
+}
+
+func TestRouteEventByPattern(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "subteam_created", Channel: "slack-subteam-created"},
+		{EventType: "subteam_*", Channel: "slack-subteams"},
+		{EventType: "/^(reaction|pin)_/", Channel: "slack-reactions-and-pins"},
+		{EventType: "reaction_*", Channel: "slack-unreachable"},
+	})
+	defer setEventConfigs(nil)
+
+	tests := []struct {
+		eventType  string
+		want       string
+		configured string
+	}{
+		{"subteam_created", "slack-subteam-created", "subteam_created"},
+		{"subteam_updated", "slack-subteams", "subteam_*"},
+		{"reaction_added", "slack-reactions-and-pins", "/^(reaction|pin)_/"},
+		{"pin_removed", "slack-reactions-and-pins", "/^(reaction|pin)_/"},
+		{"channel_archive", "", "channel_archive"},
+		{"subteam_self_add", "slack-subteams", "subteam_*"},
+	}
+	for _, tt := range tests {
+		routed := routeEvent(map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{"type": tt.eventType}}, nil)
+		if routed.Config.Channel != tt.want {
+			t.Errorf("%s routed to %q, want %q (skip: %q)", tt.eventType, routed.Config.Channel, tt.want, routed.Skip)
+		}
+		if tt.want != "" && routed.EventType != tt.eventType {
+			t.Errorf("expected the event type %s to be kept, got %s", tt.eventType, routed.EventType)
+		}
+		if routed.ConfiguredType != tt.configured {
+			t.Errorf("expected %s to be handled by the %s routes, got %s", tt.eventType, tt.configured, routed.ConfiguredType)
+		}
+	}
+}
+
+func TestRouteEventBySubtypePattern(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "message.*", Channel: "slack-message-subtypes"},
+		{EventType: "app_mention", Channel: "slack-mentions"},
+	})
+	defer setEventConfigs(nil)
+
+	tests := []struct {
+		event map[string]interface{}
+		want  string
+	}{
+		{map[string]interface{}{"type": "message", "subtype": "channel_join"}, "slack-message-subtypes"},
+		{map[string]interface{}{"type": "message", "subtype": "bot_message"}, "slack-message-subtypes"},
+		{map[string]interface{}{"type": "message"}, ""},
+		{map[string]interface{}{"type": "app_mention"}, "slack-mentions"},
+	}
+	for _, tt := range tests {
+		routed := routeEvent(map[string]interface{}{"type": "event_callback", "event": tt.event}, nil)
+		if routed.Config.Channel != tt.want {
+			t.Errorf("%v routed to %q, want %q (skip: %q)", tt.event, routed.Config.Channel, tt.want, routed.Skip)
+		}
+		if routed.EventType != "message" && routed.EventType != "app_mention" {
+			t.Errorf("expected the event type without its subtype, got %s", routed.EventType)
+		}
+	}
+
+	manifest := buildAppManifest("Relay", "https://relay.example.com/slack", []EventConfig{
+		{EventType: "message.*", Channel: "slack-message-subtypes"},
+	})
+	for _, event := range manifest.Settings.EventSubscriptions.BotEvents {
+		if event != "message" && !strings.HasPrefix(event, "message.") {
+			t.Errorf("expected only message events to be subscribed, got %s", event)
+		}
+	}
+	if len(manifest.Settings.EventSubscriptions.BotEvents) == 0 {
+		t.Error("expected message.* to subscribe to message events")
+	}
+}
+
+func TestParseConfigEventTypePatterns(t *testing.T) {
+	if _, err := parseConfigFrom(".", []byte(`[{"slack-event-type": "subteam_*", "channel": "subteams"}]`), 0); err != nil {
+		t.Errorf("unexpected error for a glob: %v", err)
+	}
+	for _, invalid := range []string{
+		`[{"slack-event-type": "subteam_[", "channel": "subteams"}]`,
+		`[{"slack-event-type": "/subteam_(/", "channel": "subteams"}]`,
+	} {
+		if _, err := parseConfigFrom(".", []byte(invalid), 0); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
+
+func TestBuildAppManifestPatterns(t *testing.T) {
+	manifest := buildAppManifest("Relay", "https://relay.example.com/slack", []EventConfig{
+		{EventType: "reaction_*", Channel: "reactions"},
+	})
+	if want := []string{"reaction_added", "reaction_removed"}; !reflect.DeepEqual(manifest.Settings.EventSubscriptions.BotEvents, want) {
+		t.Errorf("bot events = %v, want %v", manifest.Settings.EventSubscriptions.BotEvents, want)
+	}
+}
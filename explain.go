@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// routeExplanation describes how a payload is routed and why each route of its
+// event type did or did not match it
+type routeExplanation struct {
+	EventType string `json:"event_type"`
+	// Result is "routed", or why the payload is not published
+	Result string `json:"result"`
+	// Route and Channel are the route the payload matched and its channel
+	Route   string `json:"route,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	// Attributes are the payload attributes the routes filter on
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Routes     []routeVerdict         `json:"routes"`
+	// Notes describe the matched route's policies that apply to the payload
+	Notes []string `json:"notes,omitempty"`
+}
+
+// routeVerdict is whether one route matched a payload, and why not
+type routeVerdict struct {
+	Route    string `json:"route"`
+	Matched  bool   `json:"matched"`
+	Selected bool   `json:"selected"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// explainRouting explains how the active configuration routes payload at now.
+// Unlike routeEvent it records nothing and calls no external service, so the
+// policies that need them, such as sensitive content detection, are not
+// evaluated.
+func explainRouting(payload map[string]interface{}, now time.Time) routeExplanation {
+	explanation := routeExplanation{EventType: getEventType(payload), Routes: []routeVerdict{}}
+	if explanation.EventType == "" {
+		explanation.Result = skipUnknownType
+		return explanation
+	}
+	teamID, _ := payload["team_id"].(string)
+	if !isLifecycleEvent(explanation.EventType) && isTeamDisabled(teamID) {
+		explanation.Result = skipTeamDisabled
+		return explanation
+	}
+	if residency.enabled() {
+		if _, ok := residency.payloadRegion(payload); !ok && residency.Strict {
+			explanation.Result = skipNoRegion
+			return explanation
+		}
+	}
+
+	snapshot := currentConfig()
+	configured := snapshot.matchEventType(explanation.EventType, payload)
+	attributes := snapshot.routeAttributes(explanation.EventType, configured, payload)
+	explanation.Attributes = describeRouteAttributes(attributes)
+	selected, ok := snapshot.lookupFilteredRoute(configured, attributes)
+	for _, config := range snapshot.routes {
+		if config.EventType != configured {
+			continue
+		}
+		verdict := routeVerdict{Route: config.routeKey()}
+		if filter := config.rejectingFilter(attributes); filter != "" {
+			verdict.Reason = describeRejection(config, filter, attributes)
+		} else {
+			verdict.Matched = true
+			verdict.Selected = ok && verdict.Route == selected.routeKey()
+			if !verdict.Selected {
+				verdict.Reason = fmt.Sprintf("route '%s' is tried first", selected.routeKey())
+			}
+		}
+		explanation.Routes = append(explanation.Routes, verdict)
+	}
+
+	switch {
+	case len(explanation.Routes) == 0:
+		explanation.Result = skipNotConfigured
+		return explanation
+	case !ok:
+		explanation.Result = skipNoRouteMatch
+		return explanation
+	}
+	explanation.Result = "routed"
+	explanation.Route = selected.routeKey()
+	explanation.Channel = selected.Channel
+
+	if selected.Stale.enabled() {
+		if age, ok := eventAge(payload, now); ok && age > time.Duration(selected.Stale.MaxAge) {
+			explanation.Notes = append(explanation.Notes, fmt.Sprintf("event is %s old, older than stale max-age %s: %s", age.Round(time.Second), time.Duration(selected.Stale.MaxAge), selected.Stale.action()))
+			if selected.Stale.action() == staleDrop {
+				explanation.Result = skipStale
+			}
+		}
+	}
+	if selected.ActiveHours.enabled() && !selected.ActiveHours.active(now) {
+		explanation.Notes = append(explanation.Notes, fmt.Sprintf("outside active hours: %s", selected.ActiveHours.action()))
+		if selected.ActiveHours.action() == outsideHoursDrop {
+			explanation.Result = skipOutsideHours
+		}
+	}
+	if selected.Sensitive.enabled() {
+		explanation.Notes = append(explanation.Notes, "sensitive content detection is not evaluated when explaining")
+	}
+	if federates(selected) {
+		explanation.Notes = append(explanation.Notes, "forwarded to the upstream relay "+federationUpstream)
+	}
+	return explanation
+}
+
+// describeRouteAttributes returns the attributes that are set, by the route
+// option filtering on them
+func describeRouteAttributes(attributes routeAttributes) map[string]interface{} {
+	described := make(map[string]interface{})
+	if attributes.ChannelType != "" {
+		described["channel-type"] = attributes.ChannelType
+	}
+	if attributes.Command != "" {
+		described["command"] = attributes.Command
+	}
+	if len(attributes.Domains) > 0 {
+		described["domains"] = attributes.Domains
+	}
+	if attributes.Language != "" {
+		described["language"] = attributes.Language
+	}
+	if attributes.External {
+		described["external"] = true
+	}
+	if len(attributes.ActionIDs) > 0 {
+		described["action-ids"] = attributes.ActionIDs
+	}
+	if attributes.ContainerType != "" {
+		described["container-type"] = attributes.ContainerType
+	}
+	if attributes.CallbackID != "" {
+		described["callback-id"] = attributes.CallbackID
+	}
+	if attributes.ChannelID != "" {
+		described["slack-channel-id"] = attributes.ChannelID
+	}
+	if attributes.TeamID != "" {
+		described["team-id"] = attributes.TeamID
+	}
+	if attributes.UserID != "" {
+		described["user-id"] = attributes.UserID
+	}
+	return described
+}
+
+// describeRejection explains why a route's filter rejects payloads with the
+// given attributes
+func describeRejection(config EventConfig, filter string, attributes routeAttributes) string {
+	switch filter {
+	case "channel-types":
+		return fmt.Sprintf("channel type %q is not in channel-types [%s]", attributes.ChannelType, sortedJoin(config.ChannelTypes))
+	case "commands":
+		return fmt.Sprintf("command %q is not in commands [%s]", attributes.Command, sortedJoin(config.Commands))
+	case "domains":
+		return fmt.Sprintf("link domains [%s] are not in domains [%s]", strings.Join(attributes.Domains, ","), sortedJoin(config.Domains))
+	case "languages":
+		return fmt.Sprintf("language %q is not in languages [%s]", attributes.Language, sortedJoin(config.Languages))
+	case "external":
+		if attributes.External {
+			return "event is external, and external is exclude"
+		}
+		return "event is not external, and external is only"
+	case "action-ids":
+		return fmt.Sprintf("action IDs [%s] are not in action-ids [%s]", strings.Join(attributes.ActionIDs, ","), sortedJoin(config.ActionIDs))
+	case "container-types":
+		return fmt.Sprintf("container type %q is not in container-types [%s]", attributes.ContainerType, sortedJoin(config.ContainerTypes))
+	case "callback-ids":
+		return fmt.Sprintf("callback ID %q is not in callback-ids [%s]", attributes.CallbackID, sortedJoin(config.CallbackIDs))
+	case "slack-channel-id":
+		return fmt.Sprintf("channel %q is not in slack-channel-id [%s]", attributes.ChannelID, sortedJoin(config.ChannelIDs))
+	case "team-id":
+		return fmt.Sprintf("team %q is not in team-id [%s]", attributes.TeamID, sortedJoin(config.TeamIDs))
+	case "user-id":
+		return fmt.Sprintf("user %q is not in user-id [%s]", attributes.UserID, sortedJoin(config.UserIDs))
+	}
+	return filter + " does not match"
+}
+
+// writeExplanation prints an explanation for people
+func writeExplanation(w io.Writer, explanation routeExplanation) {
+	fmt.Fprintf(w, "Event type: %s\n", explanation.EventType)
+	if len(explanation.Attributes) > 0 {
+		attributes, _ := json.Marshal(explanation.Attributes)
+		fmt.Fprintf(w, "Attributes: %s\n", attributes)
+	}
+	for _, verdict := range explanation.Routes {
+		switch {
+		case verdict.Selected:
+			fmt.Fprintf(w, "  MATCH  %s\n", verdict.Route)
+		case verdict.Matched:
+			fmt.Fprintf(w, "  SKIP   %s: %s\n", verdict.Route, verdict.Reason)
+		default:
+			fmt.Fprintf(w, "  MISS   %s: %s\n", verdict.Route, verdict.Reason)
+		}
+	}
+	for _, note := range explanation.Notes {
+		fmt.Fprintf(w, "Note:       %s\n", note)
+	}
+	if explanation.Result != "routed" {
+		fmt.Fprintf(w, "Result:     not published (%s)\n", explanation.Result)
+		return
+	}
+	fmt.Fprintf(w, "Result:     published to %s by route '%s'\n", explanation.Channel, explanation.Route)
+}
+
+// runExplainCommand implements the "explain" subcommand, which prints why each
+// route did or did not match a fixture payload
+func runExplainCommand(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	eventFile := flags.String("event", "", "JSON fixture of a Slack payload")
+	configPath := flags.String("config", "", "config file to explain (default: CONFIG_FILE or config.json)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *eventFile == "" {
+		fmt.Fprintln(os.Stderr, "usage: slack-relay explain -event fixture.json [-config config.json]")
+		return 2
+	}
+
+	configFile, required := configFileFromEnv()
+	if *configPath != "" {
+		configFile, required = *configPath, true
+	}
+	if _, err := loadEventConfigWithDefaults(configFile, required); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration file '%s': %v\n", configFile, err)
+		return 1
+	}
+
+	rawPayload, err := os.ReadFile(*eventFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading event fixture: %v\n", err)
+		return 1
+	}
+	parsed, err := parseSlackPayload("application/json", bytes.TrimSpace(rawPayload))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing event fixture: %v\n", err)
+		return 1
+	}
+
+	explanation := explainRouting(parsed.Fields(), clock.Now())
+	writeExplanation(stdout, explanation)
+	if explanation.Result != "routed" {
+		return 1
+	}
+	return 0
+}
+
+// explainHandler serves POST /admin/explain, which explains how the active
+// configuration routes the Slack payload in the request body
+func explainHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	defer r.Body.Close()
+	body, release, err := readRequestBody(w, r)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	defer release()
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	parsed, err := parseSlackPayload(contentType, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(explainRouting(parsed.Fields(), clock.Now())); err != nil {
+		logError("Error writing response: %v", err)
+	}
+}
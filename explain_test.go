@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainRouting(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "slack-dms", ChannelTypes: []string{"im", "mpim"}},
+		{EventType: "message", Channel: "slack-channels", ChannelTypes: []string{"channel"}},
+		{EventType: "message", Channel: "slack-messages"},
+		{EventType: "app_mention", Channel: "slack-mentions"},
+	})
+	defer setEventConfigs(nil)
+
+	explanation := explainRouting(map[string]interface{}{
+		"type":  "event_callback",
+		"event": map[string]interface{}{"type": "message", "channel_type": "channel"},
+	}, time.Now())
+
+	if explanation.Result != "routed" || explanation.Channel != "slack-channels" {
+		t.Fatalf("expected the payload routed to slack-channels, got %+v", explanation)
+	}
+	if len(explanation.Routes) != 3 {
+		t.Fatalf("expected the 3 message routes explained, got %+v", explanation.Routes)
+	}
+	if verdict := explanation.Routes[0]; verdict.Matched || !strings.Contains(verdict.Reason, `channel type "channel" is not in channel-types [im,mpim]`) {
+		t.Errorf("expected the DM route to miss on channel type, got %+v", verdict)
+	}
+	if verdict := explanation.Routes[1]; !verdict.Matched || !verdict.Selected {
+		t.Errorf("expected the channel route to be selected, got %+v", verdict)
+	}
+	if verdict := explanation.Routes[2]; !verdict.Matched || verdict.Selected || verdict.Reason == "" {
+		t.Errorf("expected the catch-all route to match but not be selected, got %+v", verdict)
+	}
+}
+
+func TestExplainRoutingNoMatch(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "slack-dms", ChannelTypes: []string{"im"}},
+	})
+	defer setEventConfigs(nil)
+
+	explanation := explainRouting(map[string]interface{}{
+		"type":  "event_callback",
+		"event": map[string]interface{}{"type": "message", "channel_type": "group"},
+	}, time.Now())
+	if explanation.Result != skipNoRouteMatch || len(explanation.Routes) != 1 || explanation.Routes[0].Matched {
+		t.Errorf("expected no route to match, got %+v", explanation)
+	}
+
+	explanation = explainRouting(map[string]interface{}{
+		"type":  "event_callback",
+		"event": map[string]interface{}{"type": "reaction_added"},
+	}, time.Now())
+	if explanation.Result != skipNotConfigured {
+		t.Errorf("expected an unconfigured event type, got %+v", explanation)
+	}
+}
+
+func TestRunExplainCommand(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestFile(t, dir, "config.json", `[
+		{"slack-event-type":"message","channel":"slack-dms","channel-types":["im"]},
+		{"slack-event-type":"message","channel":"slack-messages"}
+	]`)
+	event := writeTestFile(t, dir, "event.json", `{"type":"event_callback","event":{"type":"message","channel_type":"channel"}}`)
+
+	var out strings.Builder
+	if code := runExplainCommand([]string{"-event", event, "-config", config}, &out); code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+	for _, expected := range []string{"Event type: message", "MISS", "channel-types [im]", "MATCH", "published to slack-messages"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+
+	if code := runExplainCommand(nil, &out); code != 2 {
+		t.Errorf("expected usage exit code 2, got %d", code)
+	}
+}
+
+func TestExplainHandler(t *testing.T) {
+	adminToken = "admin-secret"
+	defer func() { adminToken = "" }()
+	setEventConfigs([]EventConfig{{EventType: "app_mention", Channel: "slack-mentions"}})
+	defer setEventConfigs(nil)
+
+	body := `{"type":"event_callback","event":{"type":"app_mention"}}`
+	rr := httptest.NewRecorder()
+	explainHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/explain", strings.NewReader(body)))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin token, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/admin/explain", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer admin-secret")
+	explainHandler(rr, request)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var explanation routeExplanation
+	if err := json.Unmarshal(rr.Body.Bytes(), &explanation); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if explanation.Result != "routed" || explanation.Channel != "slack-mentions" {
+		t.Errorf("expected the mention routed, got %+v", explanation)
+	}
+}
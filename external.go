@@ -0,0 +1,72 @@
+package main
+
+import "sort"
+
+// Values of a route's external filter
+const (
+	externalOnly    = "only"
+	externalExclude = "exclude"
+)
+
+// externalTeamKeys are the event fields naming the team of its user, message or channel
+var externalTeamKeys = []string{"user_team", "source_team", "team"}
+
+// payloadExternal reports whether an event callback comes from a Slack Connect
+// channel shared with another organization, or from a user of another organization
+func payloadExternal(payload map[string]interface{}) bool {
+	if shared, _ := payload["is_ext_shared_channel"].(bool); shared {
+		return true
+	}
+	teamID, _ := payload["team_id"].(string)
+	event, _ := payload["event"].(map[string]interface{})
+	if teamID == "" || event == nil {
+		return false
+	}
+	for _, key := range externalTeamKeys {
+		if team, _ := event[key].(string); team != "" && team != teamID {
+			return true
+		}
+	}
+	return false
+}
+
+// payloadExternalTeams returns the teams other than the receiving workspace
+// that an event's user, message or channel belongs to, sorted
+func payloadExternalTeams(payload map[string]interface{}) []string {
+	teamID, _ := payload["team_id"].(string)
+	event, _ := payload["event"].(map[string]interface{})
+	if teamID == "" || event == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, key := range externalTeamKeys {
+		if team, _ := event[key].(string); team != "" && team != teamID {
+			seen[team] = true
+		}
+	}
+	teams := make([]string, 0, len(seen))
+	for team := range seen {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+// externalMetadata returns the relay metadata describing the external
+// organizations involved in an event, or nil for internal events
+func externalMetadata(payload map[string]interface{}) map[string]interface{} {
+	if !payloadExternal(payload) {
+		return nil
+	}
+	metadata := map[string]interface{}{
+		"shared_channel": payload["is_ext_shared_channel"] == true,
+		"teams":          payloadExternalTeams(payload),
+	}
+	teamID, _ := payload["team_id"].(string)
+	event, _ := payload["event"].(map[string]interface{})
+	if userTeam, _ := event["user_team"].(string); userTeam != "" {
+		metadata["user_team"] = userTeam
+		metadata["external_user"] = userTeam != teamID
+	}
+	return metadata
+}
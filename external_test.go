@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExternalMetadata(t *testing.T) {
+	payload := map[string]interface{}{
+		"team_id":               "T1",
+		"is_ext_shared_channel": true,
+		"event":                 map[string]interface{}{"type": "message", "user_team": "T2", "source_team": "T2", "team": "T1"},
+	}
+	expected := map[string]interface{}{
+		"shared_channel": true,
+		"teams":          []string{"T2"},
+		"user_team":      "T2",
+		"external_user":  true,
+	}
+	if got := externalMetadata(payload); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	internal := map[string]interface{}{
+		"team_id": "T1",
+		"event":   map[string]interface{}{"type": "message", "user_team": "T1"},
+	}
+	if got := externalMetadata(internal); got != nil {
+		t.Errorf("expected no metadata for an internal event, got %v", got)
+	}
+}
+
+func TestRouteExternalEvents(t *testing.T) {
+	defer setupTestEnvironment()
+
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "external-messages", External: externalOnly},
+		{EventType: "message", Channel: "messages", External: externalExclude},
+	})
+	for _, tt := range []struct {
+		shared   bool
+		userTeam string
+		channel  string
+		external bool
+	}{
+		{false, "T1", "messages", false},
+		{true, "T1", "external-messages", true},
+		{false, "T2", "external-messages", true},
+	} {
+		payload := map[string]interface{}{
+			"type":                  "event_callback",
+			"team_id":               "T1",
+			"is_ext_shared_channel": tt.shared,
+			"event":                 map[string]interface{}{"type": "message", "user_team": tt.userTeam},
+		}
+		raw, _ := json.Marshal(payload)
+		routed := routeEvent(payload, raw)
+		if routed.Config.Channel != tt.channel {
+			t.Errorf("shared %v from %s: expected channel %q, got %q", tt.shared, tt.userTeam, tt.channel, routed.Config.Channel)
+		}
+		var published map[string]interface{}
+		json.Unmarshal(routed.Payload, &published)
+		metadata, _ := published[relayMetadataKey].(map[string]interface{})
+		if _, ok := metadata["external"]; ok != tt.external {
+			t.Errorf("shared %v from %s: expected external metadata %v, got %v", tt.shared, tt.userTeam, tt.external, metadata)
+		}
+	}
+
+	if err := validateRouteFilters([]EventConfig{{EventType: "message", External: "include"}}); err == nil {
+		t.Error("expected an invalid external filter to be rejected")
+	}
+}
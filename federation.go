@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// federationPath is where a relay accepts events federated by another relay
+	federationPath = "/federation"
+	// federationTimeout bounds each forward to the upstream relay
+	federationTimeout = 10 * time.Second
+	// Headers carrying the signature of a federated event
+	federationTimestampHeader = "X-Slack-Relay-Federation-Timestamp"
+	federationSignatureHeader = "X-Slack-Relay-Federation-Signature"
+)
+
+// federationUpstream is the URL of the relay federated routes' events are
+// forwarded to; empty when this relay publishes every route itself
+var federationUpstream string
+
+// federationSecret signs federated events; a relay without one accepts none
+var federationSecret []byte
+
+// federationClient is the HTTP client used to forward events upstream
+var federationClient = &http.Client{Timeout: federationTimeout}
+
+var metricFederatedEvents = newCounterVec("slack_relay_federated_events_total",
+	"Events forwarded to the upstream relay, by event type and result.", "event_type", "result")
+var metricFederationReceived = newCounterVec("slack_relay_federation_received_total",
+	"Events received from a downstream relay, by result.", "result")
+
+// federatedEvent is a routed event forwarded to the upstream relay, which
+// publishes it as is
+type federatedEvent struct {
+	EventType string `json:"event_type"`
+	Channel   string `json:"channel"`
+	Region    string `json:"region,omitempty"`
+	// PublishMode, StreamMaxLen, Output and ListKey are how the route writes
+	// its events to Redis
+	PublishMode  string          `json:"publish_mode,omitempty"`
+	StreamMaxLen int64           `json:"stream_maxlen,omitempty"`
+	Output       string          `json:"output,omitempty"`
+	ListKey      string          `json:"list_key,omitempty"`
+	Payload      json.RawMessage `json:"payload"`
+	// Instance is the downstream relay that received the event from Slack
+	Instance string `json:"instance,omitempty"`
+}
+
+// federates reports whether a route's events are forwarded to the upstream relay
+func federates(config EventConfig) bool {
+	return config.Federate && federationUpstream != ""
+}
+
+// newFederatedEvent returns the federated event of a route's event written to
+// channel. The route's list-key only applies to events written to its own
+// channel, so it is not passed on for diverted events.
+func newFederatedEvent(eventType string, region string, channel string, config EventConfig, payload []byte) federatedEvent {
+	event := federatedEvent{
+		EventType:    eventType,
+		Channel:      channel,
+		Region:       region,
+		PublishMode:  config.PublishMode,
+		StreamMaxLen: config.StreamMaxLen,
+		Output:       config.Output,
+		Payload:      payload,
+		Instance:     instanceID,
+	}
+	if channel == config.Channel {
+		event.ListKey = config.ListKey
+	}
+	return event
+}
+
+// federate forwards a routed event to the upstream relay, retrying according
+// to the route's retry policy, and records the outcome in metrics
+func federate(event federatedEvent, retry RetryPolicy) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	err = retry.withRetry(func() error {
+		return postFederatedEvent(body)
+	}, func(attempt int, err error) {
+		logWarn("Retrying forward of event type '%s' to upstream relay after attempt %d: %v", event.EventType, attempt, err)
+	})
+	if err != nil {
+		logError("Error forwarding event type '%s' to upstream relay %s: %v", event.EventType, federationUpstream, err)
+		metricFederatedEvents.Inc(eventTypeLabel(event.EventType), "failure")
+		return err
+	}
+	logInfo("Forwarded event type '%s' to upstream relay", event.EventType)
+	metricFederatedEvents.Inc(eventTypeLabel(event.EventType), "success")
+	return nil
+}
+
+// postFederatedEvent signs body and posts it to the upstream relay
+func postFederatedEvent(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), federationTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, federationUpstream, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(clock.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(federationTimestampHeader, timestamp)
+	req.Header.Set(federationSignatureHeader, computeSlackSignature(body, timestamp, federationSecret))
+
+	resp, err := federationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// verifyFederationSignature checks the signature of a federated event, signed
+// like Slack requests but with the federation secret
+func verifyFederationSignature(body []byte, timestamp string, signature string) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || absInt64(clock.Now().Unix()-ts) > slackTimestampToleranceSeconds {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(computeSlackSignature(body, timestamp, federationSecret)))
+}
+
+// federationHandler publishes the events forwarded by downstream relays. It is
+// only served when a federation secret is configured.
+func federationHandler(w http.ResponseWriter, r *http.Request) {
+	if len(federationSecret) == 0 {
+		notFoundHandler(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	defer r.Body.Close()
+	body, release, err := readRequestBody(w, r)
+	if err == errBodyTooLarge {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	defer release()
+
+	if !verifyFederationSignature(body, r.Header.Get(federationTimestampHeader), r.Header.Get(federationSignatureHeader)) {
+		logWarn("Invalid federation signature from %s", clientIP(r))
+		metricFederationReceived.Inc("unauthorized")
+		recordAbuse(r, abuseInvalidSignature)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var event federatedEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.EventType == "" || event.Channel == "" || len(event.Payload) == 0 {
+		metricFederationReceived.Inc("invalid")
+		http.Error(w, "Invalid federated event", http.StatusBadRequest)
+		return
+	}
+	logDebug("Received event type '%s' federated by %s", event.EventType, event.Instance)
+	route := EventConfig{Channel: event.Channel, PublishMode: event.PublishMode, StreamMaxLen: event.StreamMaxLen, Output: event.Output, ListKey: event.ListKey}
+	if err := publishAndRecord(event.EventType, event.Region, route.publishTarget(event.Channel), bytes.Clone(event.Payload), RetryPolicy{}); err != nil {
+		metricFederationReceived.Inc("error")
+		http.Error(w, "Error publishing event", http.StatusInternalServerError)
+		return
+	}
+	metricFederationReceived.Inc("published")
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// withFederation configures federation to upstream with secret for a test
+func withFederation(t *testing.T, upstream string, secret string) {
+	originalUpstream, originalSecret := federationUpstream, federationSecret
+	federationUpstream, federationSecret = upstream, []byte(secret)
+	t.Cleanup(func() { federationUpstream, federationSecret = originalUpstream, originalSecret })
+}
+
+func TestFederateSignsEvents(t *testing.T) {
+	var received federatedEvent
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		expected := computeSlackSignature(body, r.Header.Get(federationTimestampHeader), []byte("federation-secret"))
+		if r.Header.Get(federationSignatureHeader) != expected {
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer upstream.Close()
+	withFederation(t, upstream.URL+federationPath, "federation-secret")
+
+	event := federatedEvent{EventType: "message", Channel: "slack-messages", Payload: json.RawMessage(`{"type":"event_callback"}`), Instance: "dmz-0"}
+	if err := federate(event, RetryPolicy{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received.EventType != "message" || received.Channel != "slack-messages" || string(received.Payload) != `{"type":"event_callback"}` || received.Instance != "dmz-0" {
+		t.Errorf("unexpected federated event %+v", received)
+	}
+
+	federationSecret = []byte("wrong-secret")
+	if err := federate(event, RetryPolicy{}); err == nil {
+		t.Error("expected an event signed with another secret to be rejected")
+	}
+}
+
+func TestSlackHandlerFederatesRoute(t *testing.T) {
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "slack-messages", Federate: true}})
+	defer setupTestEnvironment()
+	forwarded := make(chan federatedEvent, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event federatedEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		forwarded <- event
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer upstream.Close()
+	withFederation(t, upstream.URL+federationPath, "federation-secret")
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(`{"type":"event_callback","event":{"type":"message","text":"hi"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	slackHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	select {
+	case event := <-forwarded:
+		if event.EventType != "message" || event.Channel != "slack-messages" {
+			t.Errorf("unexpected federated event %+v", event)
+		}
+	default:
+		t.Error("expected the event to be forwarded upstream")
+	}
+}
+
+func TestFederationHandler(t *testing.T) {
+	post := func(body string, timestamp string, signature string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, federationPath, strings.NewReader(body))
+		req.Header.Set(federationTimestampHeader, timestamp)
+		req.Header.Set(federationSignatureHeader, signature)
+		federationHandler(rr, req)
+		return rr.Code
+	}
+	body := `{"event_type":"message","channel":"slack-messages","payload":{"type":"event_callback"}}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	withFederation(t, "", "")
+	if code := post(body, now, ""); code != http.StatusNotFound {
+		t.Errorf("expected 404 without a federation secret, got %d", code)
+	}
+
+	federationSecret = []byte("federation-secret")
+	if code := post(body, now, "v0=forged"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a forged signature, got %d", code)
+	}
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if code := post(body, stale, computeSlackSignature([]byte(body), stale, federationSecret)); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a stale timestamp, got %d", code)
+	}
+	invalid := `{"channel":"slack-messages"}`
+	if code := post(invalid, now, computeSlackSignature([]byte(invalid), now, federationSecret)); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an event without a type, got %d", code)
+	}
+	// Without Redis the publish fails, so the downstream relay is asked to retry
+	if code := post(body, now, computeSlackSignature([]byte(body), now, federationSecret)); code != http.StatusInternalServerError {
+		t.Errorf("expected 500 without Redis, got %d", code)
+	}
+}
+
+// recordingRedis starts a minimal Redis server recording the commands it
+// receives, and points the default Redis client at it for a test
+func recordingRedis(t *testing.T) <-chan []string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	commands := make(chan []string, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveRecordingRedis(conn, commands)
+		}
+	}()
+
+	original := redisClient
+	redisClient = redis.NewClient(&redis.Options{Addr: listener.Addr().String(), Protocol: 2, DisableIdentity: true})
+	t.Cleanup(func() {
+		redisClient.Close()
+		redisClient = original
+	})
+	return commands
+}
+
+// serveRecordingRedis reads RESP commands from conn, records them and replies
+// with an integer, rejecting the RESP3 handshake
+func serveRecordingRedis(conn net.Conn, commands chan<- []string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		var count int
+		if _, err := fmt.Fscanf(reader, "*%d\r\n", &count); err != nil {
+			return
+		}
+		command := make([]string, count)
+		for i := range command {
+			var size int
+			if _, err := fmt.Fscanf(reader, "$%d\r\n", &size); err != nil {
+				return
+			}
+			arg := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, arg); err != nil {
+				return
+			}
+			command[i] = string(arg[:size])
+		}
+		if strings.EqualFold(command[0], "hello") {
+			// Clients fall back to RESP2 without the handshake
+			conn.Write([]byte("-ERR unknown command 'HELLO'\r\n"))
+			continue
+		}
+		commands <- command
+		conn.Write([]byte(":1\r\n"))
+	}
+}
+
+func TestFederatedListOutput(t *testing.T) {
+	commands := recordingRedis(t)
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "slack-messages", Federate: true, Output: outputList, ListKey: "jobs:messages"}})
+	defer setupTestEnvironment()
+	upstream := httptest.NewServer(http.HandlerFunc(federationHandler))
+	defer upstream.Close()
+	withFederation(t, upstream.URL+federationPath, "federation-secret")
+
+	payload := `{"type":"event_callback","event":{"type":"message","text":"hi"}}`
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	slackHandler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	select {
+	case command := <-commands:
+		if len(command) != 3 || strings.ToLower(command[0]) != "rpush" || command[1] != "jobs:messages" || command[2] != payload {
+			t.Errorf("expected the upstream relay to push the event onto the route's list, got %q", command)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the upstream relay to write the event to Redis")
+	}
+}
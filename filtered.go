@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// defaultFilteredEventsTTL is how long filtered events are retained
+	defaultFilteredEventsTTL = time.Hour
+	// filteredEventsTimeout bounds adding a filtered event to the stream
+	filteredEventsTimeout = 5 * time.Second
+)
+
+var metricFilteredEventsRetained = newCounterVec("slack_relay_filtered_events_retained_total",
+	"Filtered events added to the filtered events stream, by event type and reason.", "event_type", "reason")
+var metricFilteredEventsErrors = newCounterVec("slack_relay_filtered_events_errors_total",
+	"Filtered events that could not be added to the filtered events stream.")
+
+// filteredEventStream retains the events the relay acknowledges without
+// publishing in a Redis stream for a short time, so consumers missing an event
+// can check whether the relay filtered it
+type filteredEventStream struct {
+	key string
+	ttl time.Duration
+}
+
+// filteredEvents is the filtered events stream; nil when filtered events are
+// not retained
+var filteredEvents *filteredEventStream
+
+// filteredEventsFromEnv returns the stream configured by FILTERED_EVENTS_STREAM
+// and FILTERED_EVENTS_TTL, or nil when no stream is set
+func filteredEventsFromEnv() *filteredEventStream {
+	key := os.Getenv("FILTERED_EVENTS_STREAM")
+	if key == "" {
+		return nil
+	}
+	ttl := getEnvDuration("FILTERED_EVENTS_TTL", defaultFilteredEventsTTL)
+	if ttl <= 0 {
+		ttl = defaultFilteredEventsTTL
+	}
+	return &filteredEventStream{key: key, ttl: ttl}
+}
+
+// retainsSkip reports whether events skipped for reason are retained. Events
+// that failed encryption or have no data region must not be stored in the clear
+// or outside their region, so they are never retained.
+func retainsSkip(reason string) bool {
+	return reason != "" && reason != skipEncryptionFailed && reason != skipNoRegion
+}
+
+// retain adds a filtered event to the stream of its region's Redis and trims
+// the entries older than the TTL. The key expires with its newest entry, so the
+// stream is removed once nothing is filtered for a TTL.
+func (s *filteredEventStream) retain(routed routedEvent) error {
+	client := regionClient(routed.Region)
+	if client == nil {
+		return errRedisUnavailable
+	}
+	now := clock.Now()
+	values := map[string]interface{}{
+		"event_type": routed.EventType,
+		"reason":     routed.Skip,
+		"payload":    routed.Payload,
+	}
+	if routed.TeamID != "" {
+		values["team_id"] = routed.TeamID
+	}
+	if routed.Config.EventType != "" {
+		values["route"] = routed.Config.routeKey()
+	}
+	if instanceID != "" {
+		values["instance"] = instanceID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), filteredEventsTimeout)
+	defer cancel()
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: s.key,
+			MinID:  strconv.FormatInt(now.Add(-s.ttl).UnixMilli(), 10),
+			Approx: true,
+			Values: values,
+		})
+		pipe.PExpire(ctx, s.key, s.ttl)
+		return nil
+	})
+	return err
+}
+
+// retainFiltered adds a skipped event to the filtered events stream, if one is
+// configured. Events of encrypted routes are skipped before their payload is
+// encrypted, such as stale events, so they are only retained once encrypted.
+// routed.Payload must not share the pooled request body buffer.
+func retainFiltered(routed routedEvent) {
+	if filteredEvents == nil || !retainsSkip(routed.Skip) {
+		return
+	}
+	if routed.Config.Encryption.enabled() && !routed.Encrypted {
+		return
+	}
+	if err := filteredEvents.retain(routed); err != nil {
+		logWarn("Error retaining filtered event type '%s' in stream '%s'%s: %v", routed.EventType, filteredEvents.key, formatRegion(routed.Region), err)
+		metricFilteredEventsErrors.Inc()
+		return
+	}
+	metricFilteredEventsRetained.Inc(eventTypeLabel(routed.EventType), routed.Skip)
+}
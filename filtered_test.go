@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilteredEventsFromEnv(t *testing.T) {
+	if stream := filteredEventsFromEnv(); stream != nil {
+		t.Errorf("expected no stream by default, got %+v", stream)
+	}
+
+	t.Setenv("FILTERED_EVENTS_STREAM", "slack-relay:filtered")
+	stream := filteredEventsFromEnv()
+	if stream == nil || stream.key != "slack-relay:filtered" || stream.ttl != defaultFilteredEventsTTL {
+		t.Errorf("expected the stream with the default TTL, got %+v", stream)
+	}
+
+	t.Setenv("FILTERED_EVENTS_TTL", "15m")
+	if stream := filteredEventsFromEnv(); stream.ttl != 15*time.Minute {
+		t.Errorf("expected a 15m TTL, got %s", stream.ttl)
+	}
+}
+
+func TestRetainsSkip(t *testing.T) {
+	for _, reason := range []string{skipNotConfigured, skipNoRouteMatch, skipStale, skipOutsideHours, skipTeamDisabled} {
+		if !retainsSkip(reason) {
+			t.Errorf("expected events skipped as %q to be retained", reason)
+		}
+	}
+	for _, reason := range []string{"", skipEncryptionFailed, skipNoRegion} {
+		if retainsSkip(reason) {
+			t.Errorf("expected events skipped as %q not to be retained", reason)
+		}
+	}
+}
+
+func TestRetainFilteredWithoutRedis(t *testing.T) {
+	filteredEvents = &filteredEventStream{key: "slack-relay:filtered", ttl: time.Hour}
+	defer func() { filteredEvents = nil }()
+
+	before := metricFilteredEventsErrors.values[""]
+	retainFiltered(routedEvent{EventType: "message", Skip: skipNoRouteMatch, Payload: []byte(`{}`)})
+	if got := metricFilteredEventsErrors.values[""] - before; got != 1 {
+		t.Errorf("expected 1 error counted without Redis, got %v", got)
+	}
+
+	before = metricFilteredEventsErrors.values[""]
+	retainFiltered(routedEvent{EventType: "message", Skip: skipEncryptionFailed, Payload: []byte(`{}`)})
+	if got := metricFilteredEventsErrors.values[""] - before; got != 0 {
+		t.Errorf("expected events that failed encryption not to be retained, got %v errors", got)
+	}
+}
+
+func TestRetainFilteredEncryptedRoutes(t *testing.T) {
+	commands := recordingRedis(t)
+	filteredEvents = &filteredEventStream{key: "slack-relay:filtered", ttl: time.Hour}
+	defer func() { filteredEvents = nil }()
+	route := EventConfig{EventType: "message", Channel: "slack-messages", Encryption: EncryptionPolicy{KeyID: "pii"}}
+
+	// Stale events of encrypted routes are dropped before encryption
+	retainFiltered(routedEvent{EventType: "message", Config: route, Skip: skipStale, Payload: []byte(`{"text":"secret"}`)})
+	select {
+	case command := <-commands:
+		t.Fatalf("expected the plaintext payload not to be retained, got %q", command)
+	default:
+	}
+
+	retainFiltered(routedEvent{EventType: "message", Config: route, Skip: skipShed, Payload: []byte(`{"ciphertext":"..."}`), Encrypted: true})
+	// The entry is added in a transaction, after MULTI
+	for {
+		select {
+		case command := <-commands:
+			if !strings.EqualFold(command[0], "xadd") {
+				continue
+			}
+			if !strings.Contains(strings.Join(command, " "), `{"ciphertext":"..."}`) {
+				t.Errorf("expected the encrypted payload to be retained, got %q", command)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the shed event to be retained")
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// slackLinkPattern matches the angle bracket markup of Slack text: links,
+// user and channel mentions and special mentions, with their optional label
+var slackLinkPattern = regexp.MustCompile(`<([^<>|]+)(?:\|([^<>]*))?>`)
+
+// flattenMrkdwn renders the angle bracket markup of Slack text as plain text:
+// links as their label, or URL when they have none, and mentions as @name or
+// #name. Mentions without a label are named from the cached directory, if any.
+func flattenMrkdwn(text string) string {
+	return slackLinkPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := slackLinkPattern.FindStringSubmatch(match)
+		target, label := parts[1], parts[2]
+		switch {
+		case strings.HasPrefix(target, "@"):
+			if label != "" {
+				return "@" + label
+			}
+			return "@" + directoryUserName(target[1:])
+		case strings.HasPrefix(target, "#"):
+			if label != "" {
+				return "#" + label
+			}
+			return "#" + directoryChannelName(target[1:])
+		case strings.HasPrefix(target, "!subteam^"):
+			if label != "" {
+				return label
+			}
+			return "@" + strings.TrimPrefix(target, "!subteam^")
+		case strings.HasPrefix(target, "!"):
+			if label != "" {
+				return label
+			}
+			return "@" + strings.TrimPrefix(target, "!")
+		case label != "":
+			return label
+		default:
+			return strings.TrimPrefix(target, "mailto:")
+		}
+	})
+}
+
+// textObjectText returns the text of a Block Kit text object
+func textObjectText(value interface{}) string {
+	object, _ := value.(map[string]interface{})
+	text, _ := object["text"].(string)
+	if object["type"] == "mrkdwn" {
+		return flattenMrkdwn(text)
+	}
+	return text
+}
+
+// flattenRichTextElements renders the inline elements of a rich text section
+func flattenRichTextElements(elements []interface{}) string {
+	var b strings.Builder
+	for _, value := range elements {
+		element, _ := value.(map[string]interface{})
+		switch element["type"] {
+		case "text":
+			text, _ := element["text"].(string)
+			b.WriteString(text)
+		case "link":
+			text, _ := element["text"].(string)
+			if text == "" {
+				text, _ = element["url"].(string)
+			}
+			b.WriteString(text)
+		case "user":
+			id, _ := element["user_id"].(string)
+			b.WriteString("@" + directoryUserName(id))
+		case "usergroup":
+			id, _ := element["usergroup_id"].(string)
+			b.WriteString("@" + id)
+		case "channel":
+			id, _ := element["channel_id"].(string)
+			b.WriteString("#" + directoryChannelName(id))
+		case "broadcast":
+			scope, _ := element["range"].(string)
+			b.WriteString("@" + scope)
+		case "emoji":
+			name, _ := element["name"].(string)
+			b.WriteString(":" + name + ":")
+		case "date":
+			fallback, _ := element["fallback"].(string)
+			b.WriteString(fallback)
+		}
+	}
+	return b.String()
+}
+
+// flattenRichText renders the elements of a rich_text block, one line per
+// section, list item, quote or preformatted block
+func flattenRichText(elements []interface{}) []string {
+	var lines []string
+	for _, value := range elements {
+		element, _ := value.(map[string]interface{})
+		children, _ := element["elements"].([]interface{})
+		switch element["type"] {
+		case "rich_text_section":
+			lines = append(lines, flattenRichTextElements(children))
+		case "rich_text_preformatted":
+			lines = append(lines, flattenRichTextElements(children))
+		case "rich_text_quote":
+			for _, line := range strings.Split(flattenRichTextElements(children), "\n") {
+				lines = append(lines, "> "+line)
+			}
+		case "rich_text_list":
+			for _, item := range flattenRichText(children) {
+				lines = append(lines, "• "+item)
+			}
+		}
+	}
+	return lines
+}
+
+// flattenBlocks renders the text of Block Kit blocks, one line per block or
+// field. Interactive elements and dividers are left out.
+func flattenBlocks(blocks []interface{}) []string {
+	var lines []string
+	for _, value := range blocks {
+		block, _ := value.(map[string]interface{})
+		switch block["type"] {
+		case "header", "section":
+			if text := textObjectText(block["text"]); text != "" {
+				lines = append(lines, text)
+			}
+			fields, _ := block["fields"].([]interface{})
+			for _, field := range fields {
+				if text := textObjectText(field); text != "" {
+					lines = append(lines, text)
+				}
+			}
+		case "context":
+			var parts []string
+			elements, _ := block["elements"].([]interface{})
+			for _, element := range elements {
+				if text := textObjectText(element); text != "" {
+					parts = append(parts, text)
+				} else if alt, _ := element.(map[string]interface{})["alt_text"].(string); alt != "" {
+					parts = append(parts, alt)
+				}
+			}
+			if len(parts) > 0 {
+				lines = append(lines, strings.Join(parts, " "))
+			}
+		case "image":
+			if title := textObjectText(block["title"]); title != "" {
+				lines = append(lines, title)
+			} else if alt, _ := block["alt_text"].(string); alt != "" {
+				lines = append(lines, alt)
+			}
+		case "rich_text":
+			elements, _ := block["elements"].([]interface{})
+			lines = append(lines, flattenRichText(elements)...)
+		}
+	}
+	return lines
+}
+
+// flattenAttachments renders the text of legacy message attachments: their
+// pretext, title, text and fields, or their fallback when they have none
+func flattenAttachments(attachments []interface{}) []string {
+	var lines []string
+	for _, value := range attachments {
+		attachment, _ := value.(map[string]interface{})
+		var attachmentLines []string
+		if blocks, ok := attachment["blocks"].([]interface{}); ok {
+			attachmentLines = append(attachmentLines, flattenBlocks(blocks)...)
+		}
+		for _, key := range []string{"pretext", "title", "text"} {
+			if text, _ := attachment[key].(string); text != "" {
+				attachmentLines = append(attachmentLines, flattenMrkdwn(text))
+			}
+		}
+		fields, _ := attachment["fields"].([]interface{})
+		for _, value := range fields {
+			field, _ := value.(map[string]interface{})
+			title, _ := field["title"].(string)
+			text, _ := field["value"].(string)
+			switch {
+			case title != "" && text != "":
+				attachmentLines = append(attachmentLines, title+": "+flattenMrkdwn(text))
+			case title != "" || text != "":
+				attachmentLines = append(attachmentLines, title+flattenMrkdwn(text))
+			}
+		}
+		if len(attachmentLines) == 0 {
+			if fallback, _ := attachment["fallback"].(string); fallback != "" {
+				attachmentLines = append(attachmentLines, flattenMrkdwn(fallback))
+			}
+		}
+		lines = append(lines, attachmentLines...)
+	}
+	return lines
+}
+
+// flattenMessage renders a message's blocks and attachments as plain text.
+// Messages without blocks fall back to their text, which Slack duplicates in
+// the blocks of messages that have both.
+func flattenMessage(message map[string]interface{}) string {
+	var lines []string
+	if blocks, ok := message["blocks"].([]interface{}); ok && len(blocks) > 0 {
+		lines = flattenBlocks(blocks)
+	} else if text, _ := message["text"].(string); text != "" {
+		lines = []string{flattenMrkdwn(text)}
+	}
+	if attachments, ok := message["attachments"].([]interface{}); ok {
+		lines = append(lines, flattenAttachments(attachments)...)
+	}
+
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// payloadPlainText returns the plain text rendering of an event callback's
+// message, or of the message of an interactive payload. Edited messages are
+// rendered from their new version. It reports false for payloads without a
+// message.
+func payloadPlainText(payload map[string]interface{}) (string, bool) {
+	message, ok := payload["event"].(map[string]interface{})
+	if !ok {
+		message, ok = payload["message"].(map[string]interface{})
+	} else if edited, isEdit := message["message"].(map[string]interface{}); isEdit {
+		message = edited
+	}
+	if !ok {
+		return "", false
+	}
+	_, hasText := message["text"]
+	_, hasBlocks := message["blocks"]
+	_, hasAttachments := message["attachments"]
+	if !hasText && !hasBlocks && !hasAttachments {
+		return "", false
+	}
+	return flattenMessage(message), true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlattenMrkdwn(t *testing.T) {
+	for _, tt := range []struct {
+		text     string
+		expected string
+	}{
+		{"see <https://example.com/logs|the logs>", "see the logs"},
+		{"<https://example.com>", "https://example.com"},
+		{"<mailto:ops@example.com|ops@example.com>", "ops@example.com"},
+		{"ping <@U0LAN0Z89> in <#C024BE7LR|general>", "ping @U0LAN0Z89 in #general"},
+		{"<!here> <!subteam^S0614TZR7|@oncall>", "@here @oncall"},
+	} {
+		if got := flattenMrkdwn(tt.text); got != tt.expected {
+			t.Errorf("flattenMrkdwn(%q) = %q, want %q", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestPayloadPlainText(t *testing.T) {
+	var payload map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"type": "event_callback",
+		"event": {
+			"type": "message",
+			"text": "Deploy failed",
+			"blocks": [
+				{"type": "header", "text": {"type": "plain_text", "text": "Deploy failed"}},
+				{"type": "section", "fields": [{"type": "mrkdwn", "text": "*Service:* api"}]},
+				{"type": "divider"},
+				{"type": "actions", "elements": [{"type": "button", "text": {"type": "plain_text", "text": "Retry"}}]},
+				{"type": "rich_text", "elements": [
+					{"type": "rich_text_quote", "elements": [{"type": "text", "text": "see "}, {"type": "link", "url": "https://example.com", "text": "the logs"}]},
+					{"type": "rich_text_list", "elements": [{"type": "rich_text_section", "elements": [{"type": "text", "text": "ask "}, {"type": "user", "user_id": "U1"}]}]}
+				]}
+			],
+			"attachments": [
+				{"fallback": "Build #42 failed", "title": "Build #42", "fields": [{"title": "Branch", "value": "main"}]},
+				{"fallback": "Coverage report"}
+			]
+		}
+	}`), &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Deploy failed\n*Service:* api\n> see the logs\n• ask @U1\nBuild #42\nBranch: main\nCoverage report"
+	if text, ok := payloadPlainText(payload); !ok || text != expected {
+		t.Errorf("expected %q, got %q (%v)", expected, text, ok)
+	}
+
+	// Messages without blocks are rendered from their text
+	edited := map[string]interface{}{"event": map[string]interface{}{
+		"type":    "message",
+		"subtype": "message_changed",
+		"message": map[string]interface{}{"text": "fixed in <https://example.com/pr/1|PR 1>"},
+	}}
+	if text, _ := payloadPlainText(edited); text != "fixed in PR 1" {
+		t.Errorf("expected the edited message's text, got %q", text)
+	}
+
+	if _, ok := payloadPlainText(map[string]interface{}{"event": map[string]interface{}{"type": "reaction_added"}}); ok {
+		t.Error("expected no plain text for an event without a message")
+	}
+}
+
+func TestRouteFlattensText(t *testing.T) {
+	defer setupTestEnvironment()
+
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "tickets", FlattenText: true}})
+	payload := map[string]interface{}{
+		"type":  "event_callback",
+		"event": map[string]interface{}{"type": "message", "text": "hello <@U1|alice>"},
+	}
+	raw, _ := json.Marshal(payload)
+	routed := routeEvent(payload, raw)
+
+	var published map[string]interface{}
+	json.Unmarshal(routed.Payload, &published)
+	metadata, _ := published[relayMetadataKey].(map[string]interface{})
+	if metadata["plain_text"] != "hello @alice" {
+		t.Errorf("expected plain text metadata, got %v", published)
+	}
+}
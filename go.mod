@@ -2,7 +2,10 @@ module github.com/its-the-vibe/SlackRelay
 
 go 1.26.4
 
-require github.com/redis/go-redis/v9 v9.21.0
+require (
+	github.com/redis/go-redis/v9 v9.21.0
+	golang.org/x/text v0.40.0
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
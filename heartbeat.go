@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// heartbeatType is the type of the relay's synthetic heartbeat events
+	heartbeatType = "slack_relay_heartbeat"
+	// heartbeatCheckInterval is how often routes are checked for due heartbeats
+	heartbeatCheckInterval = 10 * time.Second
+)
+
+var metricHeartbeatsSent = newCounterVec("slack_relay_heartbeats_sent_total",
+	"Synthetic heartbeat events published to route channels, by event type and result.", "event_type", "result")
+
+// heartbeatSchedule tracks when each route last received a heartbeat
+type heartbeatSchedule struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// heartbeats is the heartbeat schedule of the active routes
+var heartbeats = &heartbeatSchedule{last: make(map[string]time.Time)}
+
+// due returns the routes of configs whose heartbeat is due at now, and records
+// them as sent. Routes get their first heartbeat as soon as they are seen.
+func (s *heartbeatSchedule) due(configs []EventConfig, now time.Time) []EventConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []EventConfig
+	active := make(map[string]bool)
+	for _, config := range configs {
+		if config.Heartbeat <= 0 {
+			continue
+		}
+		key := config.routeKey()
+		active[key] = true
+		if last, ok := s.last[key]; ok && now.Sub(last) < time.Duration(config.Heartbeat) {
+			continue
+		}
+		s.last[key] = now
+		due = append(due, config)
+	}
+	// Forget routes removed or without heartbeats since the last reload
+	for key := range s.last {
+		if !active[key] {
+			delete(s.last, key)
+		}
+	}
+	return due
+}
+
+// buildHeartbeat returns the heartbeat event of a route sent at now. It is
+// flagged by its type and relay metadata, so consumers can tell it from Slack
+// events.
+func buildHeartbeat(config EventConfig, now time.Time) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":             heartbeatType,
+		"event_type":       config.EventType,
+		"channel":          config.Channel,
+		"sent_at":          now.UTC().Format(time.RFC3339),
+		"interval_seconds": int64(time.Duration(config.Heartbeat).Seconds()),
+		"instance_id":      instanceID,
+		relayMetadataKey:   map[string]interface{}{"heartbeat": true},
+	})
+}
+
+// sendHeartbeat publishes a heartbeat to a route's channel, encrypted like the
+// route's events, in the default Redis and the Redis of every data residency
+// region. It returns the first publish error.
+func sendHeartbeat(config EventConfig, now time.Time) error {
+	payload, err := buildHeartbeat(config, now)
+	if err != nil {
+		return err
+	}
+	if config.Encryption.enabled() {
+		if payload, err = encryptPayload(config.EventType, payload, config.Encryption); err != nil {
+			return err
+		}
+	}
+	target := config.publishTarget(config.Channel)
+	err = publishRegionTarget("", target, payload)
+	for _, region := range residency.regionNames() {
+		if regionErr := publishRegionTarget(region, target, payload); regionErr != nil && err == nil {
+			err = regionErr
+		}
+	}
+	return err
+}
+
+// watchHeartbeats publishes the heartbeats of the active routes as they fall due
+func watchHeartbeats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, config := range heartbeats.due(currentEventConfigs(), now) {
+				if err := sendHeartbeat(config, now); err != nil {
+					logWarn("Error publishing heartbeat of route '%s' to channel '%s': %v", config.routeKey(), config.Channel, err)
+					metricHeartbeatsSent.Inc(eventTypeLabel(config.EventType), "failure")
+					continue
+				}
+				metricHeartbeatsSent.Inc(eventTypeLabel(config.EventType), "success")
+			}
+		}
+	}
+}
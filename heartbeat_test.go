@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatScheduleDue(t *testing.T) {
+	schedule := &heartbeatSchedule{last: make(map[string]time.Time)}
+	configs := []EventConfig{
+		{EventType: "message", Channel: "slack-messages", Heartbeat: Duration(5 * time.Minute)},
+		{EventType: "reaction_added", Channel: "slack-reactions"},
+	}
+	start := time.Date(2030, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	if due := schedule.due(configs, start); len(due) != 1 || due[0].EventType != "message" {
+		t.Fatalf("expected the message route's first heartbeat right away, got %v", due)
+	}
+	if due := schedule.due(configs, start.Add(4*time.Minute)); len(due) != 0 {
+		t.Errorf("expected no heartbeat before the interval, got %v", due)
+	}
+	if due := schedule.due(configs, start.Add(5*time.Minute)); len(due) != 1 {
+		t.Errorf("expected a heartbeat after the interval, got %v", due)
+	}
+
+	schedule.due(configs[1:], start.Add(6*time.Minute))
+	if len(schedule.last) != 0 {
+		t.Errorf("expected routes without heartbeats to be forgotten, got %v", schedule.last)
+	}
+}
+
+func TestBuildHeartbeat(t *testing.T) {
+	config := EventConfig{EventType: "message", Channel: "slack-messages", Heartbeat: Duration(5 * time.Minute)}
+	data, err := buildHeartbeat(config, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var heartbeat map[string]interface{}
+	json.Unmarshal(data, &heartbeat)
+	metadata, _ := heartbeat[relayMetadataKey].(map[string]interface{})
+	if heartbeat["type"] != heartbeatType || heartbeat["event_type"] != "message" || heartbeat["channel"] != "slack-messages" ||
+		heartbeat["sent_at"] != "2030-01-02T03:04:05Z" || heartbeat["interval_seconds"] != float64(300) || metadata["heartbeat"] != true {
+		t.Errorf("unexpected heartbeat %s", data)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Identity changes reported in the identity metadata of user events
+const (
+	identityJoined      = "joined"
+	identityUpdated     = "updated"
+	identityDeactivated = "deactivated"
+)
+
+// profileFieldsCacheTTL is how long the workspace's custom profile field
+// definitions are reused before they are fetched again
+const profileFieldsCacheTTL = time.Hour
+
+// profileFieldLabels caches the labels of the workspace's custom profile fields by field ID
+var profileFieldLabels map[string]string
+var profileFieldLabelsExpires time.Time
+var profileFieldLabelsMu sync.Mutex
+
+// teamProfileResponse is the team.profile.get response
+type teamProfileResponse struct {
+	slackAPIResponse
+	Profile struct {
+		Fields []struct {
+			ID    string `json:"id"`
+			Label string `json:"label"`
+		} `json:"fields"`
+	} `json:"profile"`
+}
+
+// identityMetadata builds the identity metadata of a team_join or user_change
+// event: the user's directory fields in a flat form, the kind of change, and
+// custom profile fields keyed by their label. It returns nil for payloads
+// without a user object.
+func identityMetadata(ctx context.Context, eventType string, payload map[string]interface{}) map[string]interface{} {
+	event, _ := payload["event"].(map[string]interface{})
+	user, ok := event["user"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	profile, _ := user["profile"].(map[string]interface{})
+
+	deleted, _ := user["deleted"].(bool)
+	change := identityUpdated
+	switch {
+	case deleted:
+		change = identityDeactivated
+	case eventType == "team_join":
+		change = identityJoined
+	}
+	status := "active"
+	if deleted {
+		status = "deactivated"
+	}
+
+	identity := map[string]interface{}{
+		"change":  change,
+		"status":  status,
+		"user_id": user["id"],
+		"team_id": user["team_id"],
+	}
+	for _, field := range []string{"is_admin", "is_owner", "is_bot", "is_restricted", "is_ultra_restricted", "tz"} {
+		if value, ok := user[field]; ok {
+			identity[field] = value
+		}
+	}
+	for _, field := range []string{"email", "real_name", "display_name", "first_name", "last_name", "title", "phone"} {
+		if value, ok := profile[field]; ok {
+			identity[field] = value
+		}
+	}
+
+	if fields, ok := profile["fields"].(map[string]interface{}); ok && len(fields) > 0 {
+		labels, err := loadProfileFieldLabels(ctx)
+		if err != nil {
+			logWarn("Could not load custom profile field labels: %v", err)
+		}
+		custom := make(map[string]interface{}, len(fields))
+		for id, field := range fields {
+			value := field
+			if field, ok := field.(map[string]interface{}); ok {
+				value = field["value"]
+			}
+			name := id
+			if label := labels[id]; label != "" {
+				name = label
+			}
+			custom[name] = value
+		}
+		identity["custom_fields"] = custom
+	}
+	return identity
+}
+
+// loadProfileFieldLabels returns the labels of the workspace's custom profile
+// fields, fetching them with team.profile.get when the cache has expired
+func loadProfileFieldLabels(ctx context.Context) (map[string]string, error) {
+	profileFieldLabelsMu.Lock()
+	defer profileFieldLabelsMu.Unlock()
+	if profileFieldLabels != nil && clock.Now().Before(profileFieldLabelsExpires) {
+		return profileFieldLabels, nil
+	}
+
+	token := getSlackBotToken()
+	if token == "" {
+		return nil, errors.New("SLACK_BOT_TOKEN is not configured")
+	}
+	var result teamProfileResponse
+	if err := callSlackAPI(ctx, "team.profile.get", token, url.Values{}, &result); err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string, len(result.Profile.Fields))
+	for _, field := range result.Profile.Fields {
+		labels[field.ID] = field.Label
+	}
+	profileFieldLabels = labels
+	profileFieldLabelsExpires = clock.Now().Add(profileFieldsCacheTTL)
+	return labels, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdentityMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/team.profile.get" {
+			http.Error(w, "unexpected method", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"ok":true,"profile":{"fields":[{"id":"Xf01","label":"Employee ID"}]}}`))
+	}))
+	defer server.Close()
+	originalURL := slackAPIBaseURL
+	slackAPIBaseURL = server.URL + "/"
+	defer func() { slackAPIBaseURL = originalURL }()
+	slackBotToken = "xoxb-test"
+	defer func() { slackBotToken = "" }()
+	profileFieldLabels, profileFieldLabelsExpires = nil, time.Time{}
+
+	payload := map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{
+		"type": "user_change",
+		"user": map[string]interface{}{
+			"id":      "U1",
+			"team_id": "T1",
+			"deleted": true,
+			"profile": map[string]interface{}{
+				"email":     "ada@example.com",
+				"real_name": "Ada Lovelace",
+				"fields":    map[string]interface{}{"Xf01": map[string]interface{}{"value": "1815", "alt": ""}, "Xf02": map[string]interface{}{"value": "x"}},
+			},
+		},
+	}}
+
+	identity := identityMetadata(context.Background(), "user_change", payload)
+	if identity["change"] != identityDeactivated || identity["status"] != "deactivated" {
+		t.Errorf("expected a deactivation, got %v", identity)
+	}
+	if identity["user_id"] != "U1" || identity["email"] != "ada@example.com" || identity["real_name"] != "Ada Lovelace" {
+		t.Errorf("unexpected directory fields %v", identity)
+	}
+	custom := identity["custom_fields"].(map[string]interface{})
+	if custom["Employee ID"] != "1815" || custom["Xf02"] != "x" {
+		t.Errorf("unexpected custom fields %v", custom)
+	}
+}
+
+func TestIdentityMetadataChange(t *testing.T) {
+	join := map[string]interface{}{"event": map[string]interface{}{"type": "team_join", "user": map[string]interface{}{"id": "U1"}}}
+	if identity := identityMetadata(context.Background(), "team_join", join); identity["change"] != identityJoined || identity["status"] != "active" {
+		t.Errorf("expected a join, got %v", identity)
+	}
+
+	update := map[string]interface{}{"event": map[string]interface{}{"type": "user_change", "user": map[string]interface{}{"id": "U1"}}}
+	if identity := identityMetadata(context.Background(), "user_change", update); identity["change"] != identityUpdated {
+		t.Errorf("expected an update, got %v", identity)
+	}
+
+	noUser := map[string]interface{}{"event": map[string]interface{}{"type": "user_change", "user": "U1"}}
+	if identity := identityMetadata(context.Background(), "user_change", noUser); identity != nil {
+		t.Errorf("expected no metadata without a user object, got %v", identity)
+	}
+}
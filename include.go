@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxConfigIncludeDepth bounds how deeply included files may include other
+// files, which also stops include cycles
+const maxConfigIncludeDepth = 8
+
+// configIncludeClient is the HTTP client used to fetch included route files
+var configIncludeClient = &http.Client{Timeout: 10 * time.Second}
+
+// configInclude is an "include" directive of the configuration file. It is
+// either a path string, or an object with a "path" or "url" and an optional
+// "sha256" checksum of the included file. Checksums are required for URLs.
+type configInclude struct {
+	Path   string `json:"path,omitempty"`
+	URL    string `json:"url,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// UnmarshalJSON accepts a plain path string or an include object
+func (i *configInclude) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*i = configInclude{Path: path}
+		return nil
+	}
+
+	type plain configInclude
+	var include plain
+	if err := json.Unmarshal(data, &include); err != nil {
+		return err
+	}
+	*i = configInclude(include)
+	return nil
+}
+
+// String returns the path or URL of the include
+func (i configInclude) String() string {
+	if i.URL != "" {
+		return i.URL
+	}
+	return i.Path
+}
+
+// parsedConfig is the content of configuration data
+type parsedConfig struct {
+	Routes []EventConfig
+	// Templates are the named message templates, see configFile
+	Templates map[string]map[string]interface{}
+	// Endpoints are the custom endpoints, see configFile
+	Endpoints []endpointConfig
+}
+
+// parseConfigFrom parses configuration data holding one or more JSON documents,
+// each an array of routes or a configFile object. Includes are loaded before the
+// routes of the document naming them, so a shared base can be overlaid: a later
+// route replaces an earlier one with the same event type and filters, and a later
+// template one with the same name.
+// Relative include paths are resolved from dir; an empty dir disallows them.
+func parseConfigFrom(dir string, data []byte, depth int) (parsedConfig, error) {
+	documents, err := decodeConfigDocuments(data)
+	if err != nil {
+		return parsedConfig{}, err
+	}
+
+	var parsed parsedConfig
+	for _, file := range documents {
+		for _, include := range file.Include {
+			included, err := loadConfigInclude(dir, include, depth+1)
+			if err != nil {
+				return parsedConfig{}, fmt.Errorf("include %s: %w", include, err)
+			}
+			parsed.Routes = mergeEventConfigs(parsed.Routes, included.Routes)
+			parsed.Templates = mergeMessageTemplates(parsed.Templates, included.Templates)
+			parsed.Endpoints = mergeEndpoints(parsed.Endpoints, included.Endpoints)
+		}
+		parsed.Routes = mergeEventConfigs(parsed.Routes, file.Routes)
+		parsed.Templates = mergeMessageTemplates(parsed.Templates, file.Templates)
+		parsed.Endpoints = mergeEndpoints(parsed.Endpoints, file.Endpoints)
+	}
+
+	if len(documents) == 0 {
+		return parsedConfig{}, errors.New("configuration is empty")
+	}
+	if err := validateEventTypePatterns(parsed.Routes); err != nil {
+		return parsedConfig{}, err
+	}
+	if err := validateRouteFilters(parsed.Routes); err != nil {
+		return parsedConfig{}, err
+	}
+	if err := validateActiveHours(parsed.Routes); err != nil {
+		return parsedConfig{}, err
+	}
+	if err := validateStalePolicies(parsed.Routes); err != nil {
+		return parsedConfig{}, err
+	}
+	if err := validatePublishModes(parsed.Routes); err != nil {
+		return parsedConfig{}, err
+	}
+	if err := validateAckStatuses(parsed.Routes); err != nil {
+		return parsedConfig{}, err
+	}
+	if err := validateOversizeActions(parsed.Routes); err != nil {
+		return parsedConfig{}, err
+	}
+	if err := validateTextNormalization(parsed.Routes); err != nil {
+		return parsedConfig{}, err
+	}
+	if err := validateSensitivePolicies(parsed.Routes); err != nil {
+		return parsedConfig{}, err
+	}
+	if err := validateEndpoints(parsed.Endpoints); err != nil {
+		return parsedConfig{}, err
+	}
+	// Templates may be defined in another file than the routes using them, so
+	// references are checked once everything is loaded
+	if depth == 0 {
+		if err := validateResponseTemplates(parsed.Routes, parsed.Templates); err != nil {
+			return parsedConfig{}, err
+		}
+	}
+	return parsed, nil
+}
+
+// decodeConfigDocuments decodes the JSON documents of configuration data, each
+// an array of routes or a configFile object
+func decodeConfigDocuments(data []byte) ([]configFile, error) {
+	var documents []configFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var document json.RawMessage
+		if err := decoder.Decode(&document); err == io.EOF {
+			return documents, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		var file configFile
+		if trimmed := bytes.TrimSpace(document); len(trimmed) > 0 && trimmed[0] == '{' {
+			if err := json.Unmarshal(trimmed, &file); err != nil {
+				return nil, err
+			}
+		} else if err := json.Unmarshal(document, &file.Routes); err != nil {
+			return nil, err
+		}
+		if file.Version > currentConfigVersion {
+			return nil, fmt.Errorf("configuration version %d is newer than this relay supports (%d)", file.Version, currentConfigVersion)
+		}
+		documents = append(documents, file)
+	}
+}
+
+// loadConfigInclude reads, verifies and parses an included route file
+func loadConfigInclude(dir string, include configInclude, depth int) (parsedConfig, error) {
+	if depth > maxConfigIncludeDepth {
+		return parsedConfig{}, fmt.Errorf("includes nested more than %d levels deep", maxConfigIncludeDepth)
+	}
+
+	var data []byte
+	var err error
+	path := ""
+	includeDir := ""
+	switch {
+	case include.URL != "":
+		if include.SHA256 == "" {
+			return parsedConfig{}, errors.New("url includes require a sha256 checksum")
+		}
+		data, err = fetchConfigInclude(include.URL)
+	case include.Path != "":
+		path = include.Path
+		if !filepath.IsAbs(path) {
+			if dir == "" {
+				return parsedConfig{}, errors.New("relative path includes are not allowed in remote files")
+			}
+			path = filepath.Join(dir, path)
+		}
+		includeDir = filepath.Dir(path)
+		data, err = os.ReadFile(path)
+	default:
+		return parsedConfig{}, errors.New("include needs a path or url")
+	}
+	if err != nil {
+		return parsedConfig{}, err
+	}
+
+	if include.SHA256 != "" {
+		if err := verifyConfigChecksum(data, include.SHA256); err != nil {
+			return parsedConfig{}, err
+		}
+	}
+	if path != "" {
+		if data, err = decryptConfigIfNeeded(path, data); err != nil {
+			return parsedConfig{}, err
+		}
+	}
+
+	return parseConfigFrom(includeDir, data, depth)
+}
+
+// fetchConfigInclude downloads an included route file
+func fetchConfigInclude(url string) ([]byte, error) {
+	resp, err := configIncludeClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s returned status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifyConfigChecksum checks data against a hex SHA-256 checksum, optionally
+// prefixed with "sha256:"
+func verifyConfigChecksum(data []byte, checksum string) error {
+	expected := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(checksum), "sha256:"))
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// mergeEventConfigs overlays routes on base. A route replaces the base route with
+// the same event type and filters in place; other routes are appended.
+func mergeEventConfigs(base []EventConfig, overlay []EventConfig) []EventConfig {
+	index := make(map[string]int, len(base))
+	for i, config := range base {
+		index[config.routeKey()] = i
+	}
+
+	result := make([]EventConfig, len(base), len(base)+len(overlay))
+	copy(result, base)
+	for _, config := range overlay {
+		if i, ok := index[config.routeKey()]; ok {
+			result[i] = config
+			continue
+		}
+		result = append(result, config)
+	}
+	return result
+}
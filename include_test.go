@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEventConfigMultipleDocuments(t *testing.T) {
+	data := []byte(`
+[{"slack-event-type":"message","channel":"base-messages"}]
+{"routes":[{"slack-event-type":"message","channel":"prod-messages"},{"slack-event-type":"app_mention","channel":"mentions"}]}
+`)
+	configs, err := parseEventConfig(data)
+	if err != nil {
+		t.Fatalf("parseEventConfig returned error: %v", err)
+	}
+	if len(configs) != 2 || configs[0].Channel != "prod-messages" || configs[1].EventType != "app_mention" {
+		t.Errorf("expected later document to overlay earlier one, got %+v", configs)
+	}
+}
+
+func TestParseEventConfigEmpty(t *testing.T) {
+	if _, err := parseEventConfig([]byte("  \n")); err == nil {
+		t.Error("expected error for empty configuration, got nil")
+	}
+}
+
+func TestLoadEventConfigIncludePath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "shared"), 0700); err != nil {
+		t.Fatalf("failed to create shared directory: %v", err)
+	}
+	writeTestFile(t, filepath.Join(dir, "shared"), "base.json", `[
+		{"slack-event-type":"message","channel":"base-messages"},
+		{"slack-event-type":"team_join","channel":"joins"}
+	]`)
+	configPath := writeTestFile(t, dir, "config.json", `{
+		"include": ["shared/base.json"],
+		"routes": [{"slack-event-type":"message","channel":"prod-messages"}]
+	}`)
+
+	if err := loadEventConfig(configPath); err != nil {
+		t.Fatalf("loadEventConfig returned error: %v", err)
+	}
+	if currentConfig().byEventType["message"].Channel != "prod-messages" {
+		t.Errorf("expected overlay channel for 'message', got %v", currentConfig().byEventType["message"].Channel)
+	}
+	if currentConfig().byEventType["team_join"].Channel != "joins" {
+		t.Errorf("expected included channel for 'team_join', got %v", currentConfig().byEventType["team_join"].Channel)
+	}
+}
+
+func TestLoadEventConfigIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	configPath := writeTestFile(t, dir, "config.json", `{"include": ["config.json"], "routes": []}`)
+
+	err := loadEventConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "nested") {
+		t.Errorf("expected nesting error for include cycle, got %v", err)
+	}
+}
+
+func TestLoadEventConfigIncludeURL(t *testing.T) {
+	base := `[{"slack-event-type":"team_join","channel":"joins"}]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(base))
+	}))
+	defer server.Close()
+	sum := sha256.Sum256([]byte(base))
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		include string
+		wantErr string
+	}{
+		{"valid checksum", `{"url":"` + server.URL + `","sha256":"sha256:` + checksum + `"}`, ""},
+		{"missing checksum", `{"url":"` + server.URL + `"}`, "require a sha256"},
+		{"wrong checksum", `{"url":"` + server.URL + `","sha256":"` + strings.Repeat("0", 64) + `"}`, "checksum mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := writeTestFile(t, t.TempDir(), "config.json", `{"include":[`+tt.include+`],"routes":[]}`)
+			err := loadEventConfig(configPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("loadEventConfig returned error: %v", err)
+				}
+				if currentConfig().byEventType["team_join"].Channel != "joins" {
+					t.Errorf("expected included channel for 'team_join', got %v", currentConfig().byEventType["team_join"].Channel)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
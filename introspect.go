@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// routeFilters returns the filters limiting a route, by option name
+func routeFilters(config EventConfig) map[string]interface{} {
+	filters := make(map[string]interface{})
+	if len(config.ChannelTypes) > 0 {
+		filters["channel-types"] = config.ChannelTypes
+	}
+	if len(config.Commands) > 0 {
+		filters["commands"] = config.Commands
+	}
+	if len(config.Domains) > 0 {
+		filters["domains"] = config.Domains
+	}
+	if len(config.Languages) > 0 {
+		filters["languages"] = config.Languages
+	}
+	if config.External != "" {
+		filters["external"] = config.External
+	}
+	if len(config.ActionIDs) > 0 {
+		filters["action-ids"] = config.ActionIDs
+	}
+	if len(config.ContainerTypes) > 0 {
+		filters["container-types"] = config.ContainerTypes
+	}
+	if len(config.CallbackIDs) > 0 {
+		filters["callback-ids"] = config.CallbackIDs
+	}
+	if len(config.ChannelIDs) > 0 {
+		filters["slack-channel-id"] = config.ChannelIDs
+	}
+	if len(config.TeamIDs) > 0 {
+		filters["team-id"] = config.TeamIDs
+	}
+	if len(config.UserIDs) > 0 {
+		filters["user-id"] = config.UserIDs
+	}
+	return filters
+}
+
+// routeDestinations returns where a route's events can be delivered: its
+// channel, plus the channels and URLs of its diverting policies
+func routeDestinations(config EventConfig) map[string]string {
+	destinations := map[string]string{"channel": config.Channel}
+	if config.OversizeChannel != "" {
+		destinations["oversize"] = config.OversizeChannel
+	}
+	if config.Stale.enabled() && config.Stale.Channel != "" {
+		destinations["stale"] = config.Stale.Channel
+	}
+	if config.ActiveHours.enabled() && config.ActiveHours.Channel != "" {
+		destinations["outside-hours"] = config.ActiveHours.Channel
+	}
+	if config.Sensitive.enabled() && config.Sensitive.Channel != "" {
+		destinations["quarantine"] = config.Sensitive.Channel
+	}
+	if config.ForwardURL != "" {
+		destinations["forward-url"] = config.ForwardURL
+	}
+	if federates(config) {
+		destinations["federation"] = federationUpstream
+	}
+	return destinations
+}
+
+// describeRoutes returns the annotated routing table, in configuration order
+func describeRoutes(configs []EventConfig) []map[string]interface{} {
+	routes := make([]map[string]interface{}, 0, len(configs))
+	for _, config := range configs {
+		key := config.routeKey()
+		route := map[string]interface{}{
+			"route":        key,
+			"event_type":   config.EventType,
+			"filters":      routeFilters(config),
+			"destinations": routeDestinations(config),
+			"config":       config,
+		}
+		if config.Description != "" {
+			route["description"] = config.Description
+		}
+		if config.Owner != "" {
+			route["owner"] = config.Owner
+		}
+		if hit, ok := routeHits.lastHit(key); ok {
+			route["last_hit"] = hit.UTC().Format(time.RFC3339)
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// routesHandler serves the annotated routing table on GET /admin/routes. With
+// ?idle=<duration>, only the routes without a hit in that long are listed.
+func routesHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	configs := currentEventConfigs()
+	if value := r.URL.Query().Get("idle"); value != "" {
+		idle, err := time.ParseDuration(value)
+		if err != nil {
+			http.Error(w, "Invalid idle duration", http.StatusBadRequest)
+			return
+		}
+		configs = routeHits.idleRoutes(configs, clock.Now().Add(-idle))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"routes": describeRoutes(configs)}); err != nil {
+		logError("Error writing response: %v", err)
+	}
+}
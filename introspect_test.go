@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRoutesHandler(t *testing.T) {
+	adminToken = "admin-secret"
+	defer func() { adminToken = "" }()
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "slack-dms", ChannelTypes: []string{"im"}, Description: "Direct messages to the bot", Owner: "support-team"},
+		{EventType: "message", Channel: "slack-messages", Stale: StalePolicy{MaxAge: Duration(time.Minute), Action: staleDivert, Channel: "slack-backfill"}},
+	})
+	defer setupTestEnvironment()
+	original := routeHits
+	routeHits = newRouteHitTracker()
+	defer func() { routeHits = original }()
+
+	payload := map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{"type": "message", "channel_type": "im"}}
+	if routed := routeEvent(payload, []byte(`{}`)); routed.Config.Channel != "slack-dms" {
+		t.Fatalf("expected the DM route to match, got %q", routed.Config.Channel)
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/routes", nil)
+	request.Header.Set("Authorization", "Bearer admin-secret")
+	routesHandler(recorder, request)
+
+	var response struct {
+		Routes []struct {
+			Route        string                 `json:"route"`
+			Description  string                 `json:"description"`
+			Owner        string                 `json:"owner"`
+			Filters      map[string]interface{} `json:"filters"`
+			Destinations map[string]string      `json:"destinations"`
+			LastHit      string                 `json:"last_hit"`
+			Config       EventConfig            `json:"config"`
+		} `json:"routes"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(response.Routes) != 2 {
+		t.Fatalf("expected 2 routes, got %+v", response)
+	}
+	dms, messages := response.Routes[0], response.Routes[1]
+	if dms.Route != "message[channel-types=im]" || dms.Description != "Direct messages to the bot" || dms.Owner != "support-team" || dms.Filters["channel-types"] == nil {
+		t.Errorf("unexpected DM route %+v", dms)
+	}
+	if dms.LastHit == "" || messages.LastHit != "" {
+		t.Errorf("expected only the DM route to have a last hit, got %q and %q", dms.LastHit, messages.LastHit)
+	}
+	if messages.Destinations["channel"] != "slack-messages" || messages.Destinations["stale"] != "slack-backfill" || messages.Config.Channel != "slack-messages" {
+		t.Errorf("unexpected message route %+v", messages)
+	}
+
+	recorder = httptest.NewRecorder()
+	routesHandler(recorder, httptest.NewRequest(http.MethodGet, "/admin/routes", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin token, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// undeterminedLanguage is the ISO 639 code of text whose language could not be detected
+const undeterminedLanguage = "und"
+
+const (
+	// minLanguageLetters is the number of letters below which text is too short
+	// to detect its language
+	minLanguageLetters = 8
+	// minStopwordHits is the number of stopwords Latin script text needs to be
+	// attributed to a language
+	minStopwordHits = 2
+)
+
+// slackMarkupPattern matches Slack mentions, links, emoji shortcodes and code,
+// which say nothing about the language of a message
+var slackMarkupPattern = regexp.MustCompile("<[^>]*>|:[a-z0-9_+'-]+:|```[^`]*```|`[^`]*`")
+
+// languageStopwords are frequent words of the Latin script languages the
+// detector recognizes, by ISO 639-1 code
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "to", "of", "in", "it", "you", "that", "this", "for", "with", "have", "not", "what", "can", "please", "thanks", "was"},
+	"es": {"el", "la", "los", "las", "es", "que", "y", "de", "en", "por", "para", "con", "no", "una", "gracias", "hola", "pero", "como", "está", "tengo"},
+	"fr": {"le", "la", "les", "est", "et", "de", "des", "je", "vous", "pas", "une", "pour", "que", "merci", "bonjour", "avec", "dans", "sur", "il", "ce"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "sie", "ein", "eine", "mit", "zu", "auf", "für", "danke", "bitte", "wir", "auch", "es", "den"},
+	"pt": {"o", "a", "os", "as", "é", "e", "de", "que", "não", "um", "uma", "para", "com", "obrigado", "olá", "você", "em", "do", "da", "está"},
+	"it": {"il", "lo", "la", "gli", "è", "e", "di", "che", "non", "un", "una", "per", "con", "grazie", "ciao", "sono", "ho", "del", "della", "questo"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "ik", "je", "van", "dat", "op", "met", "voor", "zijn", "bedankt", "hallo", "wij", "ook", "maar", "er"},
+}
+
+// stopwordLanguages maps each stopword to the languages it belongs to
+var stopwordLanguages = func() map[string][]string {
+	languages := make(map[string][]string)
+	for language, words := range languageStopwords {
+		for _, word := range words {
+			languages[word] = append(languages[word], language)
+		}
+	}
+	return languages
+}()
+
+// scriptLanguages attributes text in a non-Latin script to a language
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// detectableLanguages are the languages detectLanguage returns
+var detectableLanguages = func() map[string]bool {
+	languages := map[string]bool{undeterminedLanguage: true, "uk": true}
+	for language := range languageStopwords {
+		languages[language] = true
+	}
+	for _, script := range scriptLanguages {
+		languages[script.language] = true
+	}
+	return languages
+}()
+
+// detectLanguage returns the ISO 639-1 code of the language text is written in,
+// or undeterminedLanguage when it is too short or ambiguous. It is a lightweight
+// heuristic: non-Latin scripts are attributed to their main language, and Latin
+// script text to the language with the most stopwords among English, Spanish,
+// French, German, Portuguese, Italian and Dutch.
+func detectLanguage(text string) string {
+	text = slackMarkupPattern.ReplaceAllString(text, " ")
+
+	letters, latin := 0, 0
+	scripts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, script := range scriptLanguages {
+			if unicode.Is(script.script, r) {
+				scripts[script.language]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return undeterminedLanguage
+	}
+
+	// Japanese mixes kana with Han characters, so any kana makes Han text Japanese
+	if scripts["ja"] > 0 {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+	best, bestCount := "", 0
+	for language, count := range scripts {
+		if count > bestCount {
+			best, bestCount = language, count
+		}
+	}
+	if bestCount > latin {
+		// CJK characters are words of their own, so short text is enough
+		if bestCount*2 >= letters || letters >= minLanguageLetters {
+			return refineCyrillic(best, text)
+		}
+		return undeterminedLanguage
+	}
+	if letters < minLanguageLetters {
+		return undeterminedLanguage
+	}
+	return detectLatinLanguage(text)
+}
+
+// refineCyrillic tells Ukrainian from Russian by its distinct letters
+func refineCyrillic(language string, text string) string {
+	if language == "ru" && strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+		return "uk"
+	}
+	return language
+}
+
+// detectLatinLanguage returns the language with the most stopwords in text, or
+// undeterminedLanguage when none has enough or two languages tie
+func detectLatinLanguage(text string) string {
+	hits := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, word := range words {
+		for _, language := range stopwordLanguages[word] {
+			hits[language]++
+		}
+	}
+
+	best, bestHits, tied := "", 0, false
+	for language, count := range hits {
+		switch {
+		case count > bestHits:
+			best, bestHits, tied = language, count, false
+		case count == bestHits:
+			tied = true
+		}
+	}
+	if bestHits < minStopwordHits || tied {
+		return undeterminedLanguage
+	}
+	return best
+}
+
+// payloadLanguage returns the detected language of an event callback's text,
+// or an empty string for payloads without text
+func payloadLanguage(payload map[string]interface{}) string {
+	event, _ := payload["event"].(map[string]interface{})
+	text, _ := event["text"].(string)
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	return detectLanguage(text)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	for _, tt := range []struct {
+		text     string
+		expected string
+	}{
+		{"Hi team, the deploy is failing and I can't see what changed", "en"},
+		{"Hola, tengo un problema con la factura de este mes", "es"},
+		{"Bonjour, je ne trouve pas la facture dans mon compte", "fr"},
+		{"Hallo, ich kann mich nicht mit dem VPN verbinden, bitte helfen", "de"},
+		{"Olá, não consigo acessar a minha conta desde ontem", "pt"},
+		{"Здравствуйте, не могу войти в систему", "ru"},
+		{"Привіт, не можу увійти в систему", "uk"},
+		{"ログインできません", "ja"},
+		{"无法登录系统", "zh"},
+		{"로그인할 수 없습니다", "ko"},
+		{"<@U0LAN0Z89> :wave: `make deploy`", undeterminedLanguage},
+		{"ok", undeterminedLanguage},
+	} {
+		if got := detectLanguage(tt.text); got != tt.expected {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestRouteByLanguage(t *testing.T) {
+	defer setupTestEnvironment()
+
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "support-es", Languages: []string{"es", "pt"}},
+		{EventType: "message", Channel: "support", DetectLanguage: true},
+	})
+	message := func(text string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":  "event_callback",
+			"event": map[string]interface{}{"type": "message", "text": text},
+		}
+	}
+
+	for _, tt := range []struct {
+		text     string
+		channel  string
+		language string
+	}{
+		{"Hola, tengo un problema con la factura de este mes", "support-es", "es"},
+		{"Hi, I have a problem with this month's invoice", "support", "en"},
+		{"ok", "support", undeterminedLanguage},
+	} {
+		payload := message(tt.text)
+		raw, _ := json.Marshal(payload)
+		routed := routeEvent(payload, raw)
+		if routed.Config.Channel != tt.channel {
+			t.Errorf("%q: expected channel %q, got %q", tt.text, tt.channel, routed.Config.Channel)
+		}
+		var published map[string]interface{}
+		json.Unmarshal(routed.Payload, &published)
+		metadata, _ := published[relayMetadataKey].(map[string]interface{})
+		if metadata["language"] != tt.language {
+			t.Errorf("%q: expected language %q, got %v", tt.text, tt.language, metadata)
+		}
+	}
+}
+
+func TestValidateRouteLanguages(t *testing.T) {
+	if err := validateRouteFilters([]EventConfig{{EventType: "message", Languages: []string{"english"}}}); err == nil {
+		t.Error("expected an unknown language to be rejected")
+	}
+	if err := validateRouteFilters([]EventConfig{{EventType: "message", Languages: []string{"es", undeterminedLanguage}}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
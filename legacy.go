@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// legacyForwardTimeout bounds each forward to a legacy endpoint
+const legacyForwardTimeout = 10 * time.Second
+
+// legacyClient is the HTTP client used to forward events to legacy endpoints
+var legacyClient = &http.Client{Timeout: legacyForwardTimeout}
+
+var metricLegacyForwards = newCounterVec("slack_relay_legacy_forwards_total",
+	"Events forwarded to a route's legacy endpoint, by event type and result.", "event_type", "result")
+
+// forwardToLegacy sends the original signed request to a route's legacy
+// endpoint. It runs independently of the publish, whose outcome it does not affect.
+func forwardToLegacy(eventType string, header http.Header, body []byte, target string) {
+	ctx, cancel := context.WithTimeout(context.Background(), legacyForwardTimeout)
+	defer cancel()
+
+	err := func() error {
+		req, err := newForwardedRequest(ctx, header, body, target)
+		if err != nil {
+			return err
+		}
+		resp, err := legacyClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}()
+	if err != nil {
+		logWarn("Error forwarding event type '%s' to legacy endpoint %s: %v", eventType, target, err)
+		metricLegacyForwards.Inc(eventTypeLabel(eventType), "failure")
+		return
+	}
+	metricLegacyForwards.Inc(eventTypeLabel(eventType), "success")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestForwardToLegacy(t *testing.T) {
+	var received *http.Request
+	var receivedBody string
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ := io.ReadAll(r.Body)
+		receivedBody = string(body)
+		if r.URL.Path == "/broken" {
+			http.Error(w, "broken", http.StatusInternalServerError)
+		}
+	}))
+	defer legacy.Close()
+
+	header := http.Header{}
+	header.Set("X-Slack-Signature", "v0=abc")
+	header.Set("X-Slack-Request-Timestamp", "1700000000")
+	body := []byte(`{"type":"event_callback"}`)
+
+	forwardToLegacy("legacy_test", header, body, legacy.URL+"/events")
+	if receivedBody != string(body) || received.Header.Get("X-Slack-Signature") != "v0=abc" || received.Header.Get("X-Slack-Request-Timestamp") != "1700000000" {
+		t.Errorf("expected the original request to be forwarded, got %q with %v", receivedBody, received.Header)
+	}
+
+	forwardToLegacy("legacy_test", header, body, legacy.URL+"/broken")
+
+	recorder := httptest.NewRecorder()
+	metricsHandler(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, expected := range []string{
+		`slack_relay_legacy_forwards_total{event_type="legacy_test",result="success"} 1`,
+		`slack_relay_legacy_forwards_total{event_type="legacy_test",result="failure"} 1`,
+	} {
+		if !strings.Contains(recorder.Body.String(), expected) {
+			t.Errorf("expected %q in metrics output", expected)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// teamIDPlaceholder is replaced with the team ID in TOKEN_KEY_PATTERN
+	teamIDPlaceholder = "{team_id}"
+)
+
+// tokenKeyPattern is the Redis key holding stored tokens for a team, e.g.
+// "slack-tokens:{team_id}". Empty disables token deletion.
+var tokenKeyPattern string
+
+// disabledTeams holds the teams that uninstalled the app. Their events are
+// acknowledged but no longer published.
+var disabledTeams = make(map[string]time.Time)
+var disabledTeamsMu sync.RWMutex
+
+// isLifecycleEvent reports whether eventType is an app lifecycle event that
+// needs special handling
+func isLifecycleEvent(eventType string) bool {
+	return eventType == "app_uninstalled" || eventType == "tokens_revoked"
+}
+
+// isTeamDisabled reports whether events for teamID should be ignored because
+// the app was uninstalled from that team
+func isTeamDisabled(teamID string) bool {
+	if teamID == "" {
+		return false
+	}
+	disabledTeamsMu.RLock()
+	defer disabledTeamsMu.RUnlock()
+	_, ok := disabledTeams[teamID]
+	return ok
+}
+
+// disableTeam stops publishing events for teamID
+func disableTeam(teamID string) {
+	disabledTeamsMu.Lock()
+	defer disabledTeamsMu.Unlock()
+	disabledTeams[teamID] = clock.Now()
+}
+
+// handleLifecycleEvent deletes stored tokens, disables the team's routes,
+// emits an audit event and notifies the control channel for app_uninstalled
+// and tokens_revoked events
+func handleLifecycleEvent(eventType string, teamID string, payload map[string]interface{}) {
+	if teamID == "" {
+		logWarn("Lifecycle event '%s' has no team_id, skipping cleanup", eventType)
+		return
+	}
+
+	uninstalled := eventType == "app_uninstalled"
+	botRevoked := eventType == "tokens_revoked" && botTokensRevoked(payload)
+
+	tokensDeleted := false
+	if uninstalled || botRevoked {
+		tokensDeleted = deleteTeamTokens(teamID)
+	}
+	if uninstalled {
+		disableTeam(teamID)
+		logInfo("Team '%s' uninstalled the app, its events will no longer be published", teamID)
+	}
+
+	record := map[string]interface{}{
+		"type":           eventType,
+		"team_id":        teamID,
+		"tokens_deleted": tokensDeleted,
+		"team_disabled":  uninstalled,
+		"timestamp":      clock.Now().UTC().Format(time.RFC3339),
+	}
+	if event, ok := payload["event"].(map[string]interface{}); ok {
+		if tokens, ok := event["tokens"]; ok {
+			record["tokens"] = tokens
+		}
+	}
+
+	logAudit(record)
+	publishControlEvent(record)
+}
+
+// botTokensRevoked reports whether a tokens_revoked payload lists bot tokens
+func botTokensRevoked(payload map[string]interface{}) bool {
+	event, ok := payload["event"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	tokens, ok := event["tokens"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	bot, ok := tokens["bot"].([]interface{})
+	return ok && len(bot) > 0
+}
+
+// deleteTeamTokens removes the stored tokens for teamID from Redis. It reports
+// whether a key was deleted.
+func deleteTeamTokens(teamID string) bool {
+	if tokenKeyPattern == "" || redisClient == nil {
+		return false
+	}
+
+	key := strings.ReplaceAll(tokenKeyPattern, teamIDPlaceholder, teamID)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := redisClient.Del(ctx, key).Result()
+	if err != nil {
+		logError("Error deleting tokens for team '%s' (key '%s'): %v", teamID, key, err)
+		return false
+	}
+	if deleted > 0 {
+		logInfo("Deleted stored tokens for team '%s' (key '%s')", teamID, key)
+	}
+	return deleted > 0
+}
+
+// logAudit writes a structured audit record to the log
+func logAudit(record map[string]interface{}) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		logError("Error formatting audit record: %v", err)
+		return
+	}
+	logInfo("AUDIT %s", string(data))
+}
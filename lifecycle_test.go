@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsLifecycleEvent(t *testing.T) {
+	tests := []struct {
+		eventType string
+		expected  bool
+	}{
+		{"app_uninstalled", true},
+		{"tokens_revoked", true},
+		{"message", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isLifecycleEvent(tt.eventType); got != tt.expected {
+			t.Errorf("isLifecycleEvent(%q) = %v, want %v", tt.eventType, got, tt.expected)
+		}
+	}
+}
+
+func TestBotTokensRevoked(t *testing.T) {
+	withBot := map[string]interface{}{
+		"event": map[string]interface{}{
+			"type":   "tokens_revoked",
+			"tokens": map[string]interface{}{"bot": []interface{}{"U123"}},
+		},
+	}
+	if !botTokensRevoked(withBot) {
+		t.Error("expected bot tokens to be detected")
+	}
+
+	userOnly := map[string]interface{}{
+		"event": map[string]interface{}{
+			"type":   "tokens_revoked",
+			"tokens": map[string]interface{}{"oauth": []interface{}{"U123"}},
+		},
+	}
+	if botTokensRevoked(userOnly) {
+		t.Error("expected no bot tokens for user-only revocation")
+	}
+}
+
+func TestSlackHandlerAppUninstalledDisablesTeam(t *testing.T) {
+	setupTestEnvironment()
+	defer func() {
+		disabledTeamsMu.Lock()
+		delete(disabledTeams, "T-UNINSTALLED")
+		disabledTeamsMu.Unlock()
+	}()
+
+	uninstall := []byte(`{"type":"event_callback","team_id":"T-UNINSTALLED","event":{"type":"app_uninstalled"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(uninstall))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	slackHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if !isTeamDisabled("T-UNINSTALLED") {
+		t.Fatal("expected team to be disabled after app_uninstalled")
+	}
+
+	message := []byte(`{"type":"event_callback","team_id":"T-UNINSTALLED","event":{"type":"message","text":"hi"}}`)
+	req = httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(message))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	slackHandler(rr, req)
+
+	if body := rr.Body.String(); body != "Event received but team is uninstalled" {
+		t.Errorf("handler returned wrong body: got %v", body)
+	}
+	if isTeamDisabled("T-OTHER") {
+		t.Error("expected other teams to remain enabled")
+	}
+}
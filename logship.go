@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// logShipQueueSize is how many log lines wait for each destination before
+	// new ones are dropped
+	logShipQueueSize = 1000
+	// logShipDialTimeout bounds connecting to a log destination
+	logShipDialTimeout = 5 * time.Second
+	// defaultSyslogFacility is local0
+	defaultSyslogFacility = 16
+	// logShipAppName identifies the relay in shipped logs
+	logShipAppName = "slack-relay"
+	// gelfChunkSize is the payload size of GELF UDP chunks, below common MTUs
+	gelfChunkSize = 1420
+	// gelfMaxChunks is the most chunks a GELF UDP message may be split into
+	gelfMaxChunks = 128
+)
+
+var metricLogShipDropped = newCounterVec("slack_relay_log_shipping_dropped_total",
+	"Log lines dropped because a log destination was full or unreachable, by destination.", "destination")
+
+// logEntry is one log line shipped to the log destinations
+type logEntry struct {
+	Time    time.Time
+	Level   LogLevel
+	Message string
+}
+
+// logShipper sends log lines to a syslog or GELF endpoint in the background, so
+// a slow or unreachable destination never blocks the relay
+type logShipper struct {
+	// name is the destination's metric label, "syslog" or "gelf"
+	name    string
+	network string
+	addr    string
+	// frames renders an entry as the messages written to the connection
+	frames func(entry logEntry) ([][]byte, error)
+	queue  chan logEntry
+	conn   net.Conn
+}
+
+// logShippers are the configured log destinations
+var logShippers []*logShipper
+
+// shipLog queues a log line for every log destination, dropping it for
+// destinations whose queue is full
+func shipLog(level LogLevel, format string, v ...interface{}) {
+	if len(logShippers) == 0 {
+		return
+	}
+	entry := logEntry{Time: clock.Now(), Level: level, Message: fmt.Sprintf(format, v...)}
+	for _, shipper := range logShippers {
+		select {
+		case shipper.queue <- entry:
+		default:
+			metricLogShipDropped.Inc(shipper.name)
+		}
+	}
+}
+
+// logLevelName returns the name of a log level as used in LOG_LEVEL
+func logLevelName(level LogLevel) string {
+	switch level {
+	case DEBUG:
+		return "DEBUG"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	default:
+		return "INFO"
+	}
+}
+
+// syslogSeverity returns the syslog severity of a log level, also used by GELF
+func syslogSeverity(level LogLevel) int {
+	switch level {
+	case DEBUG:
+		return 7
+	case WARN:
+		return 4
+	case ERROR:
+		return 3
+	default:
+		return 6
+	}
+}
+
+// parseLogAddr splits a log destination such as "tcp://graylog:12201" into its
+// network and address. Destinations without a scheme use UDP.
+func parseLogAddr(value string) (string, string, error) {
+	network, addr, ok := strings.Cut(value, "://")
+	if !ok {
+		network, addr = "udp", value
+	}
+	if network != "udp" && network != "tcp" {
+		return "", "", fmt.Errorf("unsupported network '%s' in %q, expected udp or tcp", network, value)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", fmt.Errorf("invalid address %q: %w", value, err)
+	}
+	return network, addr, nil
+}
+
+// syslogFrames renders an entry as an RFC 5424 syslog message, newline-terminated
+// over TCP
+func syslogFrames(network string, hostname string, facility int) func(entry logEntry) ([][]byte, error) {
+	return func(entry logEntry) ([][]byte, error) {
+		message := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", facility*8+syslogSeverity(entry.Level),
+			entry.Time.UTC().Format(time.RFC3339Nano), hostname, logShipAppName, os.Getpid(), entry.Message)
+		if network == "tcp" {
+			message += "\n"
+		}
+		return [][]byte{[]byte(message)}, nil
+	}
+}
+
+// gelfMessage is a GELF 1.1 message
+type gelfMessage struct {
+	Version      string  `json:"version"`
+	Host         string  `json:"host"`
+	ShortMessage string  `json:"short_message"`
+	Timestamp    float64 `json:"timestamp"`
+	Level        int     `json:"level"`
+	App          string  `json:"_app"`
+	LevelName    string  `json:"_level_name"`
+}
+
+// gelfFrames renders an entry as a GELF message, null-terminated over TCP and
+// chunked over UDP when it is too large for one datagram
+func gelfFrames(network string, hostname string) func(entry logEntry) ([][]byte, error) {
+	return func(entry logEntry) ([][]byte, error) {
+		data, err := json.Marshal(gelfMessage{
+			Version:      "1.1",
+			Host:         hostname,
+			ShortMessage: entry.Message,
+			Timestamp:    float64(entry.Time.UnixMicro()) / 1e6,
+			Level:        syslogSeverity(entry.Level),
+			App:          logShipAppName,
+			LevelName:    logLevelName(entry.Level),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if network == "tcp" {
+			return [][]byte{append(data, 0)}, nil
+		}
+		return gelfChunks(data)
+	}
+}
+
+// gelfChunks splits a GELF message into UDP chunks, or returns it whole when it
+// fits in one
+func gelfChunks(data []byte) ([][]byte, error) {
+	if len(data) <= gelfChunkSize {
+		return [][]byte{data}, nil
+	}
+	count := (len(data) + gelfChunkSize - 1) / gelfChunkSize
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("GELF message of %d bytes needs more than %d chunks", len(data), gelfMaxChunks)
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := min((i+1)*gelfChunkSize, len(data))
+		chunk := append([]byte{0x1e, 0x0f}, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, data[i*gelfChunkSize:end]...))
+	}
+	return chunks, nil
+}
+
+// run writes queued log lines to the destination, reconnecting after failures.
+// Its own errors go to the standard logger only, so they are never shipped.
+func (s *logShipper) run() {
+	for entry := range s.queue {
+		frames, err := s.frames(entry)
+		if err != nil {
+			metricLogShipDropped.Inc(s.name)
+			continue
+		}
+		if err := s.write(frames); err != nil {
+			log.Printf("[WARN] Error shipping logs to %s at %s://%s: %v", s.name, s.network, s.addr, err)
+			metricLogShipDropped.Inc(s.name)
+		}
+	}
+}
+
+// write sends frames over the shipper's connection, dialing it if needed
+func (s *logShipper) write(frames [][]byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.addr, logShipDialTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	for _, frame := range frames {
+		s.conn.SetWriteDeadline(time.Now().Add(logShipDialTimeout))
+		if _, err := s.conn.Write(frame); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// loadLogShippers returns the log destinations configured by LOG_SYSLOG_ADDR,
+// LOG_SYSLOG_FACILITY and LOG_GELF_ADDR
+func loadLogShippers() ([]*logShipper, error) {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = logShipAppName
+	}
+	var shippers []*logShipper
+	if value := os.Getenv("LOG_SYSLOG_ADDR"); value != "" {
+		network, addr, err := parseLogAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("LOG_SYSLOG_ADDR: %w", err)
+		}
+		facility := getEnvInt("LOG_SYSLOG_FACILITY", defaultSyslogFacility)
+		if facility < 0 || facility > 23 {
+			return nil, fmt.Errorf("LOG_SYSLOG_FACILITY must be between 0 and 23, got %d", facility)
+		}
+		shippers = append(shippers, &logShipper{name: "syslog", network: network, addr: addr,
+			frames: syslogFrames(network, hostname, facility), queue: make(chan logEntry, logShipQueueSize)})
+	}
+	if value := os.Getenv("LOG_GELF_ADDR"); value != "" {
+		network, addr, err := parseLogAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("LOG_GELF_ADDR: %w", err)
+		}
+		shippers = append(shippers, &logShipper{name: "gelf", network: network, addr: addr,
+			frames: gelfFrames(network, hostname), queue: make(chan logEntry, logShipQueueSize)})
+	}
+	return shippers, nil
+}
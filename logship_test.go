@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogAddr(t *testing.T) {
+	cases := []struct {
+		value   string
+		network string
+		addr    string
+		wantErr bool
+	}{
+		{value: "graylog:12201", network: "udp", addr: "graylog:12201"},
+		{value: "tcp://syslog.internal:514", network: "tcp", addr: "syslog.internal:514"},
+		{value: "http://graylog:12201", wantErr: true},
+		{value: "udp://graylog", wantErr: true},
+	}
+	for _, c := range cases {
+		network, addr, err := parseLogAddr(c.value)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: unexpected error %v", c.value, err)
+			continue
+		}
+		if network != c.network || addr != c.addr {
+			t.Errorf("%s: expected %s %s, got %s %s", c.value, c.network, c.addr, network, addr)
+		}
+	}
+}
+
+func TestSyslogFrames(t *testing.T) {
+	entry := logEntry{Time: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), Level: WARN, Message: "Redis is slow"}
+	frames, err := syslogFrames("tcp", "relay-0", defaultSyslogFacility)(entry)
+	if err != nil || len(frames) != 1 {
+		t.Fatalf("unexpected frames %q, %v", frames, err)
+	}
+	message := string(frames[0])
+	if !strings.HasPrefix(message, "<132>1 2030-01-02T03:04:05Z relay-0 slack-relay ") || !strings.HasSuffix(message, " - - Redis is slow\n") {
+		t.Errorf("unexpected syslog message %q", message)
+	}
+}
+
+func TestGelfFrames(t *testing.T) {
+	entry := logEntry{Time: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), Level: ERROR, Message: "Error publishing event"}
+	frames, err := gelfFrames("tcp", "relay-0")(entry)
+	if err != nil || len(frames) != 1 || frames[0][len(frames[0])-1] != 0 {
+		t.Fatalf("expected one null-terminated frame, got %q, %v", frames, err)
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(frames[0][:len(frames[0])-1], &message); err != nil {
+		t.Fatalf("invalid GELF message: %v", err)
+	}
+	if message["version"] != "1.1" || message["host"] != "relay-0" || message["level"] != float64(3) || message["_level_name"] != "ERROR" || message["timestamp"] != float64(1893553445) {
+		t.Errorf("unexpected GELF message %v", message)
+	}
+
+	// Large messages are chunked over UDP
+	entry.Message = strings.Repeat("x", 3*gelfChunkSize)
+	frames, err = gelfFrames("udp", "relay-0")(entry)
+	if err != nil || len(frames) != 4 {
+		t.Fatalf("expected 4 chunks, got %d, %v", len(frames), err)
+	}
+	var joined []byte
+	for i, frame := range frames {
+		if frame[0] != 0x1e || frame[1] != 0x0f || frame[10] != byte(i) || frame[11] != 4 || !bytes.Equal(frame[2:10], frames[0][2:10]) {
+			t.Errorf("unexpected header of chunk %d: %x", i, frame[:12])
+		}
+		joined = append(joined, frame[12:]...)
+	}
+	if !json.Valid(joined) {
+		t.Error("expected the chunks to join into the message")
+	}
+}
+
+func TestLogShipperTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	t.Setenv("LOG_SYSLOG_ADDR", "tcp://"+listener.Addr().String())
+	t.Setenv("LOG_GELF_ADDR", "")
+	shippers, err := loadLogShippers()
+	if err != nil || len(shippers) != 1 {
+		t.Fatalf("unexpected shippers %v, %v", shippers, err)
+	}
+	go shippers[0].run()
+	logShippers = shippers
+	defer func() { logShippers = nil }()
+
+	shipLog(INFO, "Received Slack event: %s", "message")
+	select {
+	case line := <-received:
+		if !strings.HasSuffix(line, "Received Slack event: message\n") || !strings.HasPrefix(line, "<134>1 ") {
+			t.Errorf("unexpected syslog line %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the log line to be shipped")
+	}
+}
+
+func TestLoadLogShippers(t *testing.T) {
+	t.Setenv("LOG_SYSLOG_ADDR", "")
+	t.Setenv("LOG_GELF_ADDR", "")
+	if shippers, err := loadLogShippers(); err != nil || len(shippers) != 0 {
+		t.Errorf("expected no log shipping, got %v, %v", shippers, err)
+	}
+	t.Setenv("LOG_GELF_ADDR", "ftp://graylog:12201")
+	if _, err := loadLogShippers(); err == nil || !strings.Contains(err.Error(), "LOG_GELF_ADDR") {
+		t.Errorf("expected an invalid address error, got %v", err)
+	}
+	t.Setenv("LOG_GELF_ADDR", "")
+	t.Setenv("LOG_SYSLOG_ADDR", "syslog:514")
+	t.Setenv("LOG_SYSLOG_FACILITY", "24")
+	if _, err := loadLogShippers(); err == nil {
+		t.Error("expected an invalid facility to be rejected")
+	}
+}
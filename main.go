@@ -1,17 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -33,21 +34,219 @@ const (
 	// slackTimestampToleranceSeconds is the maximum age of a Slack request timestamp
 	// Slack recommends rejecting requests older than 5 minutes to prevent replay attacks
 	slackTimestampToleranceSeconds = 300
+
+	// defaultAdminAddr is where the metrics and admin endpoints listen unless
+	// ADMIN_ADDR is set
+	defaultAdminAddr = "127.0.0.1:9090"
+
+	// relayMetadataKey is the top-level key under which the relay attaches its own
+	// metadata to a published payload
+	relayMetadataKey = "slack_relay"
 )
 
+// errRedisUnavailable is returned when an event cannot be published because
+// the Redis client is not configured
+var errRedisUnavailable = errors.New("redis is not available")
+
 // EventConfig represents the configuration for a Slack event type
 type EventConfig struct {
 	EventType string                 `json:"slack-event-type"`
 	Channel   string                 `json:"channel"`
 	Response  map[string]interface{} `json:"response,omitempty"`
+	// Description explains what the route is for, shown by /admin/routes
+	Description string `json:"description,omitempty"`
+	// Owner is the team or person responsible for the route's consumers
+	Owner string `json:"owner,omitempty"`
+	// ResponseTemplate names the message template returned to Slack as the
+	// response, instead of Response
+	ResponseTemplate string `json:"response-template,omitempty"`
+	// AckStatus is the HTTP status returned to Slack once the event is handled (default 200)
+	AckStatus int `json:"ack-status,omitempty"`
+	// AckBody is the plain text body returned to Slack when no response is configured.
+	// A nil value returns the default "Event received"; an empty string returns an empty body.
+	AckBody *string `json:"ack-body,omitempty"`
+	// RetryOnPublishFailure makes the relay return 500 when the event could not be
+	// published, so Slack retries the delivery
+	RetryOnPublishFailure bool `json:"retry-on-publish-failure,omitempty"`
+	// ExpandAuthorizations attaches the full list of event authorizations to the
+	// published payload (requires SLACK_APP_TOKEN)
+	ExpandAuthorizations bool `json:"expand-authorizations,omitempty"`
+	// Tags are free-form labels such as owning team, service or severity. They
+	// are attached to the published payload, log lines and the route info metric.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Identity attaches the user's directory fields, the kind of change and
+	// labelled custom profile fields to team_join and user_change events
+	Identity bool `json:"identity,omitempty"`
+	// ExpandMembers attaches the full member list of the user group to subteam
+	// events (requires SLACK_BOT_TOKEN with usergroups:read)
+	ExpandMembers bool `json:"expand-members,omitempty"`
+	// ForwardURL also receives the original signed request, for migrating
+	// consumers of a legacy endpoint to Redis gradually
+	ForwardURL string `json:"forward-url,omitempty"`
+	// Federate forwards this route's events to the upstream relay set by
+	// FEDERATION_UPSTREAM instead of publishing them
+	Federate bool `json:"federate,omitempty"`
+	// Retry configures retries when publishing to this route's channel fails
+	Retry RetryPolicy `json:"retry,omitempty"`
+	// Shedding drops a share of this route's events while its publish queue
+	// backlog is too deep
+	Shedding SheddingPolicy `json:"shedding,omitempty"`
+	// Batch coalesces this route's events into batched publishes
+	Batch BatchPolicy `json:"batch,omitempty"`
+	// Encryption encrypts this route's payloads before they are published
+	Encryption EncryptionPolicy `json:"encryption,omitempty"`
+	// MaxPayloadSize caps the published payload size in bytes (default unlimited)
+	MaxPayloadSize int `json:"max-payload-size,omitempty"`
+	// OversizeAction handles payloads above MaxPayloadSize: summarize (default),
+	// truncate or route
+	OversizeAction string `json:"oversize-action,omitempty"`
+	// OversizeChannel receives oversize payloads with the route action (default "large-events")
+	OversizeChannel string `json:"oversize-channel,omitempty"`
+	// IdleAlertAfter raises an alert when no event of this type is received for
+	// this long (default IDLE_ALERT_AFTER)
+	IdleAlertAfter Duration `json:"idle-alert-after,omitempty"`
+	// ChannelTypes limits the route to events from these channel types (channel,
+	// group, im, mpim or app_home). An event type can have several such routes.
+	ChannelTypes []string `json:"channel-types,omitempty"`
+	// ParseCommand attaches the command parsed from app_mention text
+	ParseCommand bool `json:"parse-command,omitempty"`
+	// Commands limits an app_mention route to these command keywords, or a
+	// slash_command route to these commands, without the slash
+	Commands []string `json:"commands,omitempty"`
+	// Domains limits a link_shared route to links of these domains and their subdomains
+	Domains []string `json:"domains,omitempty"`
+	// UnfurlTemplate names the message template link_shared links are unfurled
+	// with through chat.unfurl (requires SLACK_BOT_TOKEN with links:write)
+	UnfurlTemplate string `json:"unfurl-template,omitempty"`
+	// EphemeralAck is posted as an ephemeral message to the response_url of
+	// interactive payloads when they are received, e.g. "Working on it…". It may
+	// use templates.
+	EphemeralAck string `json:"ephemeral-ack,omitempty"`
+	// State reads and writes the interaction state store, keyed by the modal's
+	// view or the trigger_id
+	State StatePolicy `json:"state,omitempty"`
+	// ActiveHours limits the route to a daily time window, dropping, buffering or
+	// diverting its events outside the window
+	ActiveHours ActiveHoursPolicy `json:"active-hours,omitempty"`
+	// Stale drops, flags or diverts events received long after their event_time,
+	// e.g. when Slack delivers them late after an outage
+	Stale StalePolicy `json:"stale,omitempty"`
+	// Heartbeat publishes a synthetic heartbeat event to the route's channel at
+	// this interval, so consumers can alert when no data arrives
+	Heartbeat Duration `json:"heartbeat,omitempty"`
+	// NormalizeText normalizes event.text before publishing: Unicode NFC, emoji
+	// shortcode expansion or stripping and control character removal
+	NormalizeText TextNormalization `json:"normalize-text,omitempty"`
+	// DetectLanguage attaches the detected language of event.text
+	DetectLanguage bool `json:"detect-language,omitempty"`
+	// Languages limits the route to events whose text is detected in one of these
+	// languages, by ISO 639-1 code, or "und" when undetermined
+	Languages []string `json:"languages,omitempty"`
+	// FlattenText attaches a plain text rendering of the message's blocks and
+	// attachments, for consumers without Block Kit parsing
+	FlattenText bool `json:"flatten-text,omitempty"`
+	// Sensitive detects secrets such as API keys in messages, and tags them or
+	// quarantines them to a security channel
+	Sensitive SensitivePolicy `json:"sensitive,omitempty"`
+	// External limits the route to events from Slack Connect channels and
+	// external users (only) or to internal events (exclude)
+	External string `json:"external,omitempty"`
+	// ExternalInfo attaches the external organizations involved in Slack Connect
+	// events. Routes with an external filter always attach it.
+	ExternalInfo bool `json:"external-info,omitempty"`
+	// ActionIDs limits a block_actions route to payloads with an action of one of
+	// these action_ids
+	ActionIDs []string `json:"action-ids,omitempty"`
+	// ContainerTypes limits a block_actions route to actions in these containers:
+	// message, message_attachment, modal or home
+	ContainerTypes []string `json:"container-types,omitempty"`
+	// CallbackIDs limits an interactive route to payloads whose view or shortcut
+	// has one of these callback_ids
+	CallbackIDs []string `json:"callback-ids,omitempty"`
+	// ChannelIDs limits the route to events from these channels, e.g. "C0123ABCD"
+	ChannelIDs stringList `json:"slack-channel-id,omitempty"`
+	// TeamIDs limits the route to events from these workspaces
+	TeamIDs stringList `json:"team-id,omitempty"`
+	// UserIDs limits the route to events from these users
+	UserIDs stringList `json:"user-id,omitempty"`
+	// PublishMode is how events are written to Redis: pubsub (default) publishes
+	// them to the channel, stream adds them to a Redis stream named after the
+	// channel, which keeps them for consumers that are not connected
+	PublishMode string `json:"publish-mode,omitempty"`
+	// StreamMaxLen is the approximate number of entries the stream is trimmed to
+	// (default 10000)
+	StreamMaxLen int64 `json:"stream-maxlen,omitempty"`
+	// Output is list to push events onto a Redis list with RPUSH instead of
+	// publishing them, for worker pools taking jobs with BLPOP
+	Output string `json:"output,omitempty"`
+	// ListKey is the list the route's events are pushed onto (default the channel)
+	ListKey string `json:"list-key,omitempty"`
+}
+
+// stringList is a list of strings read from JSON as a list, or as a single string
+type stringList []string
+
+// UnmarshalJSON accepts a string or a list of strings
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*l = stringList{value}
+		return nil
+	}
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %s", string(data))
+	}
+	*l = values
+	return nil
 }
 
+// Duration is a time.Duration read from JSON as a string such as "250ms"
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string, or a number of nanoseconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case float64:
+		*d = Duration(v)
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	return nil
+}
+
+// MarshalJSON writes the duration as a string such as "250ms"
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// defaultConfigData is the event configuration compiled into the binary. It is
+// used when no config file is present so minimal deployments need no external files.
+//
+//go:embed default_config.json
+var defaultConfigData []byte
+
+// eventChannelEnvPrefix is the prefix of environment variables that override the
+// channel for a single event type, e.g. EVENT_CHANNEL_APP_MENTION=my-channel
+const eventChannelEnvPrefix = "EVENT_CHANNEL_"
+
 var signingSecret []byte
 var redisClient *redis.Client
 var currentLogLevel LogLevel = INFO
-var eventConfigs []EventConfig
-var eventChannelMap map[string]string
-var eventResponseMap map[string]map[string]interface{}
+
+// controlChannel is the Redis channel receiving relay notifications such as
+// app uninstalls. Empty disables control notifications.
+var controlChannel string
 
 // parseLogLevel converts a string to LogLevel
 func parseLogLevel(level string) LogLevel {
@@ -69,6 +268,7 @@ func parseLogLevel(level string) LogLevel {
 func logDebug(format string, v ...interface{}) {
 	if currentLogLevel <= DEBUG {
 		log.Printf("[DEBUG] "+format, v...)
+		shipLog(DEBUG, format, v...)
 	}
 }
 
@@ -76,6 +276,7 @@ func logDebug(format string, v ...interface{}) {
 func logInfo(format string, v ...interface{}) {
 	if currentLogLevel <= INFO {
 		log.Printf("[INFO] "+format, v...)
+		shipLog(INFO, format, v...)
 	}
 }
 
@@ -83,6 +284,7 @@ func logInfo(format string, v ...interface{}) {
 func logWarn(format string, v ...interface{}) {
 	if currentLogLevel <= WARN {
 		log.Printf("[WARN] "+format, v...)
+		shipLog(WARN, format, v...)
 	}
 }
 
@@ -90,7 +292,125 @@ func logWarn(format string, v ...interface{}) {
 func logError(format string, v ...interface{}) {
 	if currentLogLevel <= ERROR {
 		log.Printf("[ERROR] "+format, v...)
+		shipLog(ERROR, format, v...)
+	}
+}
+
+// getEnvInt returns the integer value of the named environment variable, or
+// defaultValue if it is unset or invalid
+func getEnvInt(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
 	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		logWarn("Invalid value for %s: %q, using default %d", name, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration returns the duration value (e.g. "30s") of the named environment
+// variable, or defaultValue if it is unset or invalid
+func getEnvDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		logWarn("Invalid value for %s: %q, using default %v", name, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvBool returns the boolean value of the named environment variable, or
+// defaultValue if it is unset or invalid
+func getEnvBool(name string, defaultValue bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logWarn("Invalid value for %s: %q, using default %v", name, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// configFile is the object form of the configuration file. Besides a plain JSON
+// array of event configurations, the file may be an object with a "routes" key,
+// which leaves room for metadata such as the "sops" block of encrypted files and
+// for "include" directives pulling in other route files.
+type configFile struct {
+	// Version is the schema version of the document, see currentConfigVersion
+	Version int             `json:"version,omitempty"`
+	Include []configInclude `json:"include,omitempty"`
+	Routes  []EventConfig   `json:"routes"`
+	// Templates are named message templates, such as Block Kit layouts, used by
+	// routes' response-template and by outbound messages
+	Templates map[string]map[string]interface{} `json:"templates,omitempty"`
+	// Endpoints are custom endpoints publishing JSON from internal tools
+	Endpoints []endpointConfig `json:"endpoints,omitempty"`
+}
+
+// parseEventConfig parses a JSON array of event configurations, or an object
+// holding them under "routes". Relative includes are resolved from the working
+// directory.
+func parseEventConfig(data []byte) ([]EventConfig, error) {
+	parsed, err := parseConfigFrom(".", data, 0)
+	return parsed.Routes, err
+}
+
+// setEventConfigs replaces the routes of the active configuration
+func setEventConfigs(configs []EventConfig) {
+	warnDeprecatedRoutes(configs)
+	updateConfig(func(next *configSnapshot) {
+		next.setRoutes(configs)
+	})
+	allowRouteLabels(configs)
+}
+
+// currentEventConfigs returns the active event configuration
+func currentEventConfigs() []EventConfig {
+	return currentConfig().routes
+}
+
+// lookupEventConfig returns the configuration for eventType, if it is routed
+// by its name or a pattern
+func lookupEventConfig(eventType string) (EventConfig, bool) {
+	return currentConfig().lookup(eventType)
+}
+
+// reloadEventConfig replaces the active event configuration with data while the
+// server is running, and audits the change. The active configuration is kept if
+// data is invalid. Relative includes are resolved from dir.
+func reloadEventConfig(actor string, source string, dir string, data []byte) error {
+	parsed, err := parseConfigFrom(dir, data, 0)
+	if err != nil {
+		return err
+	}
+	configs := applyEnvOverrides(parsed.Routes, os.Environ())
+
+	before := currentEventConfigs()
+	activateConfig(configs, parsed.Templates, parsed.Endpoints)
+	logInfo("Reloaded %d event configuration(s) from %s", len(configs), source)
+	auditConfigChange(actor, source, before, configs)
+	return nil
 }
 
 // loadEventConfig loads the event configuration from a JSON file
@@ -100,25 +420,101 @@ func loadEventConfig(filename string) error {
 		return err
 	}
 
-	err = json.Unmarshal(data, &eventConfigs)
+	data, err = decryptConfigIfNeeded(filename, data)
 	if err != nil {
 		return err
 	}
 
-	// Build a map for quick lookup
-	eventChannelMap = make(map[string]string)
-	eventResponseMap = make(map[string]map[string]interface{})
-	for _, config := range eventConfigs {
-		eventChannelMap[config.EventType] = config.Channel
-		if config.Response != nil {
-			eventResponseMap[config.EventType] = config.Response
-		}
+	parsed, err := parseConfigFrom(filepath.Dir(filename), data, 0)
+	if err != nil {
+		return err
 	}
 
+	activateConfig(parsed.Routes, parsed.Templates, parsed.Endpoints)
 	return nil
 }
 
+// loadEventConfigWithDefaults loads the event configuration from filename, falling
+// back to the embedded defaults when the file does not exist and is not required.
+// Environment overrides are layered on top of whichever configuration was loaded.
+// It returns a description of where the configuration came from.
+func loadEventConfigWithDefaults(filename string, required bool) (string, error) {
+	source, _, err := loadEventConfigFile(filename, required)
+	return source, err
+}
+
+// loadEventConfigFile loads the event configuration like
+// loadEventConfigWithDefaults, and also returns the content of filename as
+// read, or nil when the embedded defaults were loaded
+func loadEventConfigFile(filename string, required bool) (string, []byte, error) {
+	source := filename
+	dir := filepath.Dir(filename)
+	content, err := os.ReadFile(filename)
+	data := content
+	if err != nil {
+		if required || !os.IsNotExist(err) {
+			return "", nil, err
+		}
+		data = defaultConfigData
+		source = "embedded defaults"
+		dir = "."
+	} else if data, err = decryptConfigIfNeeded(filename, data); err != nil {
+		return "", nil, err
+	}
+
+	parsed, err := parseConfigFrom(dir, data, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	activateConfig(applyEnvOverrides(parsed.Routes, os.Environ()), parsed.Templates, parsed.Endpoints)
+	return source, content, nil
+}
+
+// applyEnvOverrides layers EVENT_CHANNEL_<EVENT_TYPE> environment variables on top
+// of configs. The event type is the lowercased suffix of the variable name. A
+// non-empty value sets the channel for that event type, adding the event type if
+// it is not configured yet; an empty value removes the event type.
+func applyEnvOverrides(configs []EventConfig, environ []string) []EventConfig {
+	result := make([]EventConfig, len(configs))
+	copy(result, configs)
+
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(name, eventChannelEnvPrefix) {
+			continue
+		}
+		eventType := strings.ToLower(strings.TrimPrefix(name, eventChannelEnvPrefix))
+		if eventType == "" {
+			continue
+		}
+
+		index := -1
+		for i, config := range result {
+			if config.EventType == eventType {
+				index = i
+				break
+			}
+		}
+
+		switch {
+		case value == "" && index >= 0:
+			logInfo("Event type '%s' removed by %s", eventType, name)
+			result = append(result[:index], result[index+1:]...)
+		case value != "" && index >= 0:
+			logInfo("Event type '%s' channel overridden by %s", eventType, name)
+			result[index].Channel = value
+		case value != "":
+			logInfo("Event type '%s' added by %s", eventType, name)
+			result = append(result, EventConfig{EventType: eventType, Channel: value})
+		}
+	}
+
+	return result
+}
+
 func verifySlackSignature(body []byte, timestamp string, signature string) bool {
+	signingSecret := getSigningSecret()
 	if len(signingSecret) == 0 {
 		// No secret configured, skip verification
 		return true
@@ -134,7 +530,7 @@ func verifySlackSignature(body []byte, timestamp string, signature string) bool
 		return false
 	}
 
-	now := time.Now().Unix()
+	now := clock.Now().Unix()
 	if absInt64(now-ts) > slackTimestampToleranceSeconds {
 		logWarn("Request timestamp too old or too far in the future")
 		return false
@@ -145,16 +541,18 @@ func verifySlackSignature(body []byte, timestamp string, signature string) bool
 		return false
 	}
 
-	signatureHash := strings.TrimPrefix(signature, "v0=")
-
-	// Compute expected signature: v0:<timestamp>:<body>
-	baseString := fmt.Sprintf("v0:%s:%s", timestamp, string(body))
-	mac := hmac.New(sha256.New, signingSecret)
-	mac.Write([]byte(baseString))
-	expectedMAC := mac.Sum(nil)
-	expectedSignature := hex.EncodeToString(expectedMAC)
+	mac, pool := slackMACs.get(signingSecret)
+	defer pool.Put(mac)
+	expected := mac.signedSum("v0", []byte(timestamp), body)
+	return hmac.Equal([]byte(signature[len("v0="):]), expected)
+}
 
-	return hmac.Equal([]byte(signatureHash), []byte(expectedSignature))
+// computeSlackSignature returns the Slack signature header value ("v0=<hash>")
+// for body sent at timestamp
+func computeSlackSignature(body []byte, timestamp string, secret []byte) string {
+	mac, pool := slackMACs.get(secret)
+	defer pool.Put(mac)
+	return "v0=" + string(mac.signedSum("v0", []byte(timestamp), body))
 }
 
 func absInt64(x int64) int64 {
@@ -172,155 +570,498 @@ func slackHandler(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
-	body, err := io.ReadAll(r.Body)
+	// Turn away requests that can never pass signature verification before
+	// reading their body
+	if reason := screenRequest(r); reason != "" {
+		rejectScreened(w, r, reason)
+		return
+	}
+
+	body, release, err := readRequestBody(w, r)
+	if err == errBodyTooLarge {
+		logWarn("Rejecting request body larger than %d bytes from %s", maxRequestBodyBytes, clientIP(r))
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error reading request body", http.StatusBadRequest)
 		return
 	}
+	defer release()
+
+	if recordingEnabled() {
+		recordRequest(r, body)
+	}
+
+	// Answer Slack's certificate probe of slash command URLs. It carries no
+	// command and has no effect, so its signature is not checked.
+	if isSSLCheck(r.Header.Get("Content-Type"), body) {
+		logDebug("Responding to ssl_check from %s", clientIP(r))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
 
 	// Verify Slack request signature
 	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
 	signature := r.Header.Get("X-Slack-Signature")
 	if !verifySlackSignature(body, timestamp, signature) {
-		logWarn("Invalid Slack signature")
+		logWarn("Invalid Slack signature from %s", clientIP(r))
+		recordAbuse(r, abuseInvalidSignature)
+		if verificationTestMode {
+			logWarn("Verification test mode: check that the signing secret matches the Slack app's and that the server clock is accurate")
+		}
 		http.Error(w, "Invalid signature", http.StatusUnauthorized)
 		return
 	}
 
 	// Parse the payload based on Content-Type
-	var payload map[string]interface{}
-	var jsonPayload []byte
+	parsed, err := parseSlackPayload(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payload, jsonPayload := parsed.Fields(), parsed.Raw
 
-	contentType := r.Header.Get("Content-Type")
-	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
-		// Parse URL-encoded form data
-		formValues, err := url.ParseQuery(string(body))
-		if err != nil {
-			http.Error(w, "Error parsing form data", http.StatusBadRequest)
+	// Handle URL verification challenge
+	if parsed.Type == "url_verification" {
+		if parsed.Challenge == "" {
+			http.Error(w, "Invalid challenge", http.StatusBadRequest)
 			return
 		}
+		answerURLVerification(w, r, parsed.Challenge)
+		return
+	}
+
+	// Acknowledge verified requests without relaying them while testing the app's URLs
+	if verificationTestMode {
+		acknowledgeVerificationTest(w, r, parsed)
+		return
+	}
+
+	// Ask Slack to retry events later while in maintenance
+	if enabled, _, _ := maintenance.status(); enabled {
+		rejectMaintenance(w)
+		return
+	}
 
-		// Extract the payload parameter
-		payloadStr := formValues.Get("payload")
-		if payloadStr == "" {
-			http.Error(w, "Missing payload parameter", http.StatusBadRequest)
+	// Hand events of teams assigned to another replica to their shard
+	if handleOtherShard(w, r, body, &parsed) {
+		return
+	}
+
+	// Break Slack retry feedback loops by acknowledging events before processing
+	if w = handleRetryStorm(w, r, parsed); w == nil {
+		return
+	}
+
+	// Drop Slack's redeliveries of events already relayed. Replays are always relayed.
+	replayed := isReplayed(r, body)
+	if !replayed {
+		if w = handleDuplicate(w, parsed); w == nil {
 			return
 		}
+	}
 
-		// Parse the payload as JSON
-		err = json.Unmarshal([]byte(payloadStr), &payload)
-		if err != nil {
-			http.Error(w, "Error parsing JSON from payload parameter", http.StatusBadRequest)
-			return
+	// Approval request buttons are handled by the relay itself
+	if handleApprovalAction(w, payload) {
+		return
+	}
+
+	routed := routeDelivery(payload, jsonPayload, replayed)
+	if routed.EventType == "" {
+		logWarn("Could not determine event type from payload")
+		writeSkipped(w, routed.Skip)
+		return
+	}
+
+	logInfo("Received Slack event: %s%s", routed.EventType, formatRouteTags(routed.Config.Tags))
+	if currentLogLevel <= DEBUG {
+		logDebug("Event '%s' received from %s over %s", routed.EventType, clientIP(r), requestScheme(r))
+	}
+	metricEventsReceived.Inc(eventTypeLabel(routed.EventType), teamLabel(routed.TeamID))
+	// Events routed by a pattern count towards the pattern's routes
+	watchdog.received(routed.ConfiguredType, clock.Now())
+	rateAnomalies.record(routed.ConfiguredType)
+
+	if isLifecycleEvent(routed.EventType) {
+		handleLifecycleEvent(routed.EventType, routed.TeamID, payload)
+	}
+
+	if replayed && routed.Skip == "" {
+		metricReplayedEvents.Inc(eventTypeLabel(routed.EventType))
+	}
+	if routed.Stale != "" {
+		metricStaleEvents.Inc(eventTypeLabel(routed.EventType), routed.Stale)
+	}
+	if routed.Sensitive != "" {
+		metricSensitiveEvents.Inc(eventTypeLabel(routed.EventType), routed.Sensitive)
+	}
+	if routed.OutsideHours != "" {
+		metricOutsideActiveHours.Inc(eventTypeLabel(routed.EventType), routed.OutsideHours)
+	}
+	if residency.enabled() && routed.Skip == "" {
+		metricRegionEvents.Inc(regionLabel(routed.Region))
+	}
+	if usage != nil && routed.Skip == "" {
+		usage.record(payloadShardKey(payload), routed.EventType)
+	}
+	if routed.Skip == "" {
+		warnDeprecatedEvent(routed.EventType)
+	}
+	if routed.Skip == skipEncryptionFailed && routed.Config.RetryOnPublishFailure {
+		logWarn("Returning error to Slack so event type '%s' is retried", routed.EventType)
+		http.Error(w, "Error publishing event", http.StatusInternalServerError)
+		return
+	}
+	if routed.Skip != "" {
+		logInfo("Ignoring event type '%s': %s", routed.EventType, routed.Skip)
+		if filteredEvents != nil {
+			// The payload may share the pooled request body buffer
+			routed.Payload = bytes.Clone(routed.Payload)
+			go retainFiltered(routed)
 		}
-		jsonPayload = []byte(payloadStr)
-	} else {
-		// Default to application/json
-		err = json.Unmarshal(body, &payload)
-		if err != nil {
-			http.Error(w, "Error parsing JSON", http.StatusBadRequest)
-			return
+		writeSkipped(w, routed.Skip)
+		return
+	}
+
+	eventType, config, channel, region := routed.EventType, routed.Config, routed.Config.Channel, routed.Region
+
+	if config.ForwardURL != "" {
+		go forwardToLegacy(eventType, r.Header.Clone(), bytes.Clone(body), config.ForwardURL)
+	}
+	if config.EphemeralAck != "" {
+		if responseURL := payloadResponseURL(payload); responseURL != "" {
+			go postEphemeralAck(eventType, responseURL, renderTemplateString(config.EphemeralAck, payload))
 		}
-		jsonPayload = body
 	}
+	if config.UnfurlTemplate != "" && eventType == linkSharedEventType {
+		go unfurlLinks(config, payload)
+	}
+	// The payload may still share the pooled request body buffer, so copy it
+	// before handing it to the batcher or the publish queue
+	jsonPayload = routed.Payload
 
-	// Handle URL verification challenge
-	if payload["type"] == "url_verification" {
-		challenge, ok := payload["challenge"].(string)
-		if !ok {
-			http.Error(w, "Invalid challenge", http.StatusBadRequest)
+	// Only log payload at DEBUG level
+	if currentLogLevel <= DEBUG {
+		logDebug("Slack event payload:\n%s", indentedJSON(parsed.Raw))
+	}
+
+	// Hand events of federated routes to the upstream relay that owns the sinks
+	if federates(config) {
+		err := federate(newFederatedEvent(eventType, region, channel, config, jsonPayload), config.Retry)
+		if err != nil && config.RetryOnPublishFailure {
+			logWarn("Returning error to Slack so event type '%s' is retried", eventType)
+			http.Error(w, "Error publishing event", http.StatusInternalServerError)
 			return
 		}
-		logInfo("Responding to URL verification challenge")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-
-		response := map[string]string{"challenge": challenge}
-		if err := json.NewEncoder(w).Encode(response); err != nil {
-			logError("Error writing response: %v", err)
+		if err == nil {
+			markRetryStormDelivered(parsed.EventID)
 		}
+		writeAcknowledgement(w, config, routeResponse(config, payload))
+		return
+	}
+
+	// Hold events outside their route's active hours until the window opens
+	if routed.OutsideHours == outsideHoursBuffer {
+		holdEvent(eventType, region, config.publishTarget(channel), bytes.Clone(jsonPayload), config, clock.Now())
+		markRetryStormDelivered(parsed.EventID)
+		writeAcknowledgement(w, config, routeResponse(config, payload))
+		return
+	}
+
+	// Coalesce the event into its route's batch if enabled. Routes that report
+	// publish failures to Slack are never batched.
+	if config.Batch.enabled() && !config.RetryOnPublishFailure {
+		addToBatch(eventType, region, config.publishTarget(channel), bytes.Clone(jsonPayload), config.Batch, config.Retry)
+		markRetryStormDelivered(parsed.EventID)
+		writeAcknowledgement(w, config, routeResponse(config, payload))
 		return
 	}
 
-	// Get the Slack event type
-	var eventType string
-	if payload["type"] == "event_callback" {
-		// Extract event type from nested event object
-		if event, ok := payload["event"].(map[string]interface{}); ok {
-			if et, ok := event["type"].(string); ok {
-				eventType = et
+	// Hand the event to the publish queue if enabled. Routes that report publish
+	// failures to Slack are always published synchronously.
+	if publishQueue != nil && !config.RetryOnPublishFailure {
+		if shouldShed(eventType, config.Shedding) {
+			metricShedEvents.Inc(eventTypeLabel(eventType))
+			logDebug("Shedding event type '%s', %d event(s) already queued", eventType, queuedEvents.depth(eventType))
+			if filteredEvents != nil {
+				shed := routed
+				shed.Skip, shed.Payload = skipShed, bytes.Clone(jsonPayload)
+				go retainFiltered(shed)
 			}
+			writeAcknowledgement(w, config, routeResponse(config, payload))
+			return
 		}
-	} else {
-		// For other types, use the top-level type
-		if et, ok := payload["type"].(string); ok {
-			eventType = et
+		if !enqueuePublish(publishJob{eventType: eventType, region: region, target: config.publishTarget(channel), payload: bytes.Clone(jsonPayload), retry: config.Retry}) {
+			metricQueueFull.Inc(eventTypeLabel(eventType), queueFullPolicy)
+			if queueFullPolicy == queueFullPolicyReject {
+				logWarn("Publish queue full, asking Slack to retry event type '%s'", eventType)
+				rejectQueueFull(w)
+				return
+			}
+			logWarn("Publish queue full, dropping event type '%s'", eventType)
+		} else {
+			markRetryStormDelivered(parsed.EventID)
 		}
+		writeAcknowledgement(w, config, routeResponse(config, payload))
+		return
 	}
 
-	if eventType == "" {
-		logWarn("Could not determine event type from payload")
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("Event received but type unknown")); err != nil {
-			logError("Error writing response: %v", err)
-		}
+	// Publish to Redis if client is configured
+	publishErr := publishAndRecord(eventType, region, config.publishTarget(channel), jsonPayload, config.Retry)
+
+	if publishErr != nil && config.RetryOnPublishFailure {
+		logWarn("Returning error to Slack so event type '%s' is retried", eventType)
+		http.Error(w, "Error publishing event", http.StatusInternalServerError)
 		return
 	}
+	if publishErr == nil {
+		markRetryStormDelivered(parsed.EventID)
+	}
+
+	writeAcknowledgement(w, config, routeResponse(config, payload))
+}
+
+// writeSkipped acknowledges an event that is not published
+func writeSkipped(w http.ResponseWriter, reason string) {
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("Event received but " + reason)); err != nil {
+		logError("Error writing response: %v", err)
+	}
+}
 
-	logInfo("Received Slack event: %s", eventType)
+// withRelayMetadata returns payload encoded as JSON with metadata attached under
+// the relayMetadataKey top-level key. The payload map itself is not modified.
+func withRelayMetadata(payload map[string]interface{}, metadata map[string]interface{}) ([]byte, error) {
+	enriched := make(map[string]interface{}, len(payload)+1)
+	for key, value := range payload {
+		enriched[key] = value
+	}
+	enriched[relayMetadataKey] = metadata
+	return json.Marshal(enriched)
+}
 
-	// Check if event is configured
-	channel, ok := eventChannelMap[eventType]
-	if !ok {
-		logInfo("Event type '%s' not configured, ignoring", eventType)
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("Event received but event type not configured")); err != nil {
-			logError("Error writing response: %v", err)
-		}
+// publishAndRecord publishes an event to the Redis of its region, retrying
+// according to the route's retry policy, and records the outcome in metrics
+func publishAndRecord(eventType string, region string, target publishTarget, payload []byte, retry RetryPolicy) error {
+	err := retry.withRetry(func() error {
+		return publishRegionTarget(region, target, payload)
+	}, func(attempt int, err error) {
+		logWarn("Retrying publish of event type '%s' to %s after attempt %d: %v", eventType, target, attempt, err)
+		metricPublishRetries.Inc(eventTypeLabel(eventType))
+	})
+	if err != nil {
+		metricPublishErrors.Inc(eventTypeLabel(eventType))
+	} else {
+		metricEventsPublished.Inc(eventTypeLabel(eventType))
+	}
+	return err
+}
+
+// publishEvent publishes payload to the given Redis channel. It returns an error
+// when Redis is not configured or the publish fails.
+func publishEvent(channel string, payload []byte) error {
+	return publishRegionEvent("", channel, payload)
+}
+
+// publishRegionEvent publishes payload to the given channel of a data residency
+// region's Redis, or of the default Redis for the empty region
+func publishRegionEvent(region string, channel string, payload []byte) error {
+	return publishRegionTarget(region, pubsubTarget(channel), payload)
+}
+
+// publishRegionTarget writes payload to the target in a data residency region's
+// Redis, or in the default Redis for the empty region
+func publishRegionTarget(region string, target publishTarget, payload []byte) error {
+	client := regionClient(region)
+	if client == nil {
+		return errRedisUnavailable
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := target.send(ctx, client, signPayload(payload)).Err()
+	if err != nil {
+		logError("Error publishing to %s%s: %v", target, formatRegion(region), err)
+		return err
+	}
+	logInfo("Published event to %s%s", target, formatRegion(region))
+	return nil
+}
+
+// publishControlEvent publishes a relay notification to the control channel, if configured
+func publishControlEvent(record map[string]interface{}) {
+	if controlChannel == "" || redisClient == nil {
 		return
 	}
+	if instanceID != "" {
+		record["instance"] = instanceID
+	}
 
-	// Only log payload at DEBUG level
-	if currentLogLevel <= DEBUG {
-		jsonOutput, err := json.MarshalIndent(payload, "", "  ")
-		if err != nil {
-			logError("Error formatting JSON: %v", err)
-			logDebug("Raw payload: %s", string(jsonPayload))
-		} else {
-			logDebug("Slack event payload:\n%s", string(jsonOutput))
-		}
+	data, err := json.Marshal(record)
+	if err != nil {
+		logError("Error formatting control event: %v", err)
+		return
 	}
 
-	// Publish to Redis if client is configured
-	if redisClient != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-		err = redisClient.Publish(ctx, channel, jsonPayload).Err()
-		if err != nil {
-			logError("Error publishing to Redis channel '%s': %v", channel, err)
-			// Don't fail the request if Redis publish fails
-		} else {
-			logInfo("Published event to Redis channel: %s", channel)
+	if err := redisClient.Publish(ctx, controlChannel, data).Err(); err != nil {
+		logError("Error publishing to control channel '%s': %v", controlChannel, err)
+	}
+}
+
+// validateAckStatuses checks that every route acknowledges events with a 2xx
+// status, which is the only kind Slack accepts as delivered
+func validateAckStatuses(configs []EventConfig) error {
+	for _, config := range configs {
+		if config.AckStatus != 0 && (config.AckStatus < 200 || config.AckStatus > 299) {
+			return fmt.Errorf("route '%s' has invalid ack-status %d, expected a 2xx status", config.EventType, config.AckStatus)
 		}
 	}
+	return nil
+}
+
+// writeAcknowledgement writes the response Slack receives for a handled event.
+// A configured JSON response takes precedence over the plain text body.
+func writeAcknowledgement(w http.ResponseWriter, config EventConfig, response map[string]interface{}) {
+	status := http.StatusOK
+	if config.AckStatus != 0 {
+		status = config.AckStatus
+	}
 
 	// Check if there's a configured response for this event type
-	if response, ok := eventResponseMap[eventType]; ok {
+	if response != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(status)
 		if err := json.NewEncoder(w).Encode(response); err != nil {
 			logError("Error writing response: %v", err)
 		}
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte("Event received")); err != nil {
+	body := "Event received"
+	if config.EventType == slashCommandType {
+		// Slack shows the body of a slash command's response to the user
+		body = ""
+	}
+	if config.AckBody != nil {
+		body = *config.AckBody
+	}
+
+	w.WriteHeader(status)
+	if _, err := io.WriteString(w, body); err != nil {
 		logError("Error writing response: %v", err)
 	}
 }
 
+// configFileFromEnv returns the config file named by CONFIG_FILE and whether it is
+// required. An explicitly configured file must exist; the default config.json
+// falls back to the embedded defaults when missing.
+func configFileFromEnv() (string, bool) {
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		return "config.json", false
+	}
+	return configFile, true
+}
+
+// listenAddrFromEnv returns the server listen address from the PORT environment
+// variable (default 8080)
+func listenAddrFromEnv() string {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	// Ensure port has colon prefix
+	if !strings.HasPrefix(port, ":") {
+		port = ":" + port
+	}
+	return port
+}
+
+// adminAddrFromEnv returns the listen address of the metrics and admin endpoints
+// from the ADMIN_ADDR environment variable, only reachable from the host by
+// default. A bare port listens on localhost.
+func adminAddrFromEnv() string {
+	addr := os.Getenv("ADMIN_ADDR")
+	if addr == "" {
+		return defaultAdminAddr
+	}
+	if !strings.Contains(addr, ":") {
+		addr = "127.0.0.1:" + addr
+	}
+	return addr
+}
+
+// newRedisClientFromEnv creates a Redis client configured by the REDIS_HOST,
+// REDIS_PORT and REDIS_PASSWORD environment variables
+func newRedisClientFromEnv() *redis.Client {
+	redisHost := os.Getenv("REDIS_HOST")
+	redisPort := os.Getenv("REDIS_PORT")
+
+	// Set defaults
+	if redisHost == "" {
+		redisHost = "localhost"
+	}
+	if redisPort == "" {
+		redisPort = "6379"
+	}
+
+	// Load the optional password from the secret provider
+	password, err := loadSecret(secretRedisPassword)
+	if err != nil {
+		logWarn("Error loading Redis password: %v", err)
+	}
+	secretsMu.Lock()
+	redisPassword = password
+	secretsMu.Unlock()
+
+	// Initialize Redis client. The password is read for every new connection so
+	// a refreshed secret takes effect without a restart. Zero pool settings keep
+	// the go-redis defaults.
+	redisOptions := &redis.Options{
+		Addr: fmt.Sprintf("%s:%s", redisHost, redisPort),
+		CredentialsProvider: func() (string, string) {
+			secretsMu.RLock()
+			defer secretsMu.RUnlock()
+			return "", redisPassword
+		},
+		PoolSize:        getEnvInt("REDIS_POOL_SIZE", 0),
+		MinIdleConns:    getEnvInt("REDIS_MIN_IDLE_CONNS", 0),
+		MaxIdleConns:    getEnvInt("REDIS_MAX_IDLE_CONNS", 0),
+		ConnMaxIdleTime: getEnvDuration("REDIS_CONN_MAX_IDLE_TIME", 0),
+		PoolTimeout:     getEnvDuration("REDIS_POOL_TIMEOUT", 0),
+	}
+	return redis.NewClient(redisOptions)
+}
+
+// runSubcommand runs the named command-line subcommand. It returns false if
+// name is not a known subcommand.
+func runSubcommand(name string, args []string) (int, bool) {
+	switch name {
+	case "replay":
+		return runReplayCommand(args), true
+	case "test-route":
+		return runTestRouteCommand(args, os.Stdout), true
+	case "explain":
+		return runExplainCommand(args, os.Stdout), true
+	case "manifest":
+		return runManifestCommand(args, os.Stdout), true
+	case "echo":
+		return runEchoCommand(args, os.Stdout), true
+	case "doctor":
+		return runDoctorCommand(args, os.Stdout), true
+	case "migrate-config":
+		return runMigrateConfigCommand(args, os.Stdout), true
+	default:
+		return 0, false
+	}
+}
+
 func main() {
 	// Set log level from environment variable
 	logLevelStr := os.Getenv("LOG_LEVEL")
@@ -328,54 +1069,198 @@ func main() {
 		logLevelStr = "INFO"
 	}
 	currentLogLevel = parseLogLevel(logLevelStr)
+
+	// Run a subcommand instead of the server if one was given
+	if len(os.Args) > 1 {
+		code, ok := runSubcommand(os.Args[1], os.Args[2:])
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
+			os.Exit(2)
+		}
+		os.Exit(code)
+	}
+
+	// Ship logs to syslog or GELF endpoints, for environments without a log sidecar
+	shippers, err := loadLogShippers()
+	if err != nil {
+		logError("Invalid log shipping configuration: %v", err)
+		os.Exit(1)
+	}
+	logShippers = shippers
+	for _, shipper := range logShippers {
+		go shipper.run()
+	}
+
 	logInfo("Log level set to: %s", strings.ToUpper(logLevelStr))
+	for _, shipper := range logShippers {
+		logInfo("Shipping logs to %s at %s://%s", shipper.name, shipper.network, shipper.addr)
+	}
 
-	// Load event configuration
-	configFile := os.Getenv("CONFIG_FILE")
-	if configFile == "" {
-		configFile = "config.json"
+	// Load event configuration from a remote config source, or the config file
+	remoteConfig, err := newConfigSourceFromEnv()
+	if err != nil {
+		logError("Error configuring config source: %v", err)
+		os.Exit(1)
+	}
+	var configSource string
+	// configContent is the configuration file as loaded, which the file watcher
+	// compares changes with
+	var configContent []byte
+	if remoteConfig != nil {
+		configSource = remoteConfig.String()
+		if err := loadRemoteEventConfig(remoteConfig); err != nil {
+			logError("Error loading configuration from %s: %v", configSource, err)
+			os.Exit(1)
+		}
+	} else {
+		configFile, configRequired := configFileFromEnv()
+		configSource, configContent, err = loadEventConfigFile(configFile, configRequired)
+		if err != nil {
+			logError("Error loading configuration file '%s': %v", configFile, err)
+			logError("Please create a configuration file with event-to-channel mappings")
+			os.Exit(1)
+		}
 	}
+	logInfo("Loaded %d event configuration(s) from %s", len(currentEventConfigs()), configSource)
 
-	err := loadEventConfig(configFile)
+	// Configure the secret provider chain
+	secretProvider, err = newSecretProviderFromEnv()
 	if err != nil {
-		logError("Error loading configuration file '%s': %v", configFile, err)
-		logError("Please create a configuration file with event-to-channel mappings")
+		logError("Error configuring secret providers: %v", err)
 		os.Exit(1)
 	}
-	logInfo("Loaded %d event configuration(s) from %s", len(eventConfigs), configFile)
 
-	// Load Slack signing secret from .secret file
-	secretData, err := os.ReadFile(".secret")
+	// Load Slack signing secret (from the .secret file by default)
+	secret, err := loadSecret(secretSigningSecret)
 	if err != nil {
-		logWarn(".secret file not found. Slack signature verification will be skipped.")
+		logError("Error loading Slack signing secret: %v", err)
+		os.Exit(1)
+	}
+	if secret == "" {
+		logWarn("Slack signing secret not found. Slack signature verification will be skipped.")
 		logWarn("To enable verification, create a .secret file with your Slack signing secret.")
 	} else {
-		signingSecret = []byte(strings.TrimSpace(string(secretData)))
+		signingSecret = []byte(secret)
 		logInfo("Slack signing secret loaded. Signature verification enabled.")
 	}
+	urlVerifications.rate = getEnvInt("URL_VERIFICATION_RATE", defaultURLVerificationRate)
+	verificationTestMode = getEnvBool("SLACK_VERIFICATION_TEST_MODE", false)
+	if verificationTestMode {
+		logWarn("Verification test mode enabled: verified requests are acknowledged but not relayed")
+	}
 
-	// Configure Redis connection
-	redisHost := os.Getenv("REDIS_HOST")
-	redisPort := os.Getenv("REDIS_PORT")
-	redisPassword := os.Getenv("REDIS_PASSWORD")
+	// Configure which reverse proxies may set forwarding headers
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies, err = parseTrustedProxies(proxies)
+		if err != nil {
+			logError("Invalid TRUSTED_PROXIES value '%s': %v", proxies, err)
+			os.Exit(1)
+		}
+		logInfo("Trusting forwarding headers from %d proxy network(s)", len(trustedProxies))
+	}
 
-	// Set defaults
-	if redisHost == "" {
-		redisHost = "localhost"
+	// Configure where replayed events are published
+	replayChannelSuffix = os.Getenv("REPLAY_CHANNEL_SUFFIX")
+
+	// Configure raw request recording
+	recordDir = os.Getenv("RECORD_DIR")
+	recordRedisKey = os.Getenv("RECORD_REDIS_KEY")
+	if recordDir != "" {
+		if err := os.MkdirAll(recordDir, 0700); err != nil {
+			logError("Error creating RECORD_DIR '%s': %v", recordDir, err)
+			os.Exit(1)
+		}
+		logInfo("Recording raw requests to directory %s", recordDir)
 	}
-	if redisPort == "" {
-		redisPort = "6379"
+	if recordRedisKey != "" {
+		logInfo("Recording raw requests to Redis list %s", recordRedisKey)
 	}
 
-	// Initialize Redis client with optional password
-	redisAddr := fmt.Sprintf("%s:%s", redisHost, redisPort)
-	redisOptions := &redis.Options{
-		Addr: redisAddr,
+	// Configure this replica's identity and shard
+	instanceID = loadInstanceID()
+	shards, err = loadShardConfig()
+	if err != nil {
+		logError("Invalid shard configuration: %v", err)
+		os.Exit(1)
+	}
+	if shards.Count > 1 {
+		logInfo("Instance %s processing shard %d of %d, policy for other shards: %s", instanceID, shards.Index, shards.Count, shards.Policy)
+	}
+
+	// Configure app lifecycle handling
+	controlChannel = os.Getenv("CONTROL_CHANNEL")
+	tokenKeyPattern = os.Getenv("TOKEN_KEY_PATTERN")
+
+	// Load the Slack tokens used for Web API calls
+	if slackAppToken, err = loadSecret(secretSlackAppToken); err != nil {
+		logWarn("Error loading Slack app token: %v", err)
+	}
+	if slackBotToken, err = loadSecret(secretSlackBotToken); err != nil {
+		logWarn("Error loading Slack bot token: %v", err)
+	}
+	if slackConfigToken, err = loadSecret(secretSlackConfigToken); err != nil {
+		logWarn("Error loading Slack app configuration token: %v", err)
+	}
+	if slackAuditToken, err = loadSecret(secretSlackAuditToken); err != nil {
+		logWarn("Error loading Slack audit logs token: %v", err)
+	}
+	if adminToken, err = loadSecret(secretAdminToken); err != nil {
+		logWarn("Error loading admin token: %v", err)
+	}
+	slackAppID = os.Getenv("SLACK_APP_ID")
+
+	// Load the key published envelopes are signed with
+	envelopeKey, err := loadSecret(secretEnvelopeKey)
+	if err != nil {
+		logWarn("Error loading envelope signing key: %v", err)
+	}
+	envelopeSigningKey = []byte(envelopeKey)
+	envelopeKeyID = os.Getenv("ENVELOPE_KEY_ID")
+	if envelopeKey != "" {
+		logInfo("Signing published envelopes (key ID: %q)", envelopeKeyID)
+	}
+
+	// Forward federated routes upstream, and accept events federated by other relays
+	federationKey, err := loadSecret(secretFederationSecret)
+	if err != nil {
+		logWarn("Error loading federation secret: %v", err)
+	}
+	federationSecret = []byte(federationKey)
+	if federationUpstream = os.Getenv("FEDERATION_UPSTREAM"); federationUpstream != "" {
+		if federationKey == "" {
+			logError("FEDERATION_UPSTREAM requires a federation secret")
+			os.Exit(1)
+		}
+		logInfo("Forwarding federated routes to upstream relay %s", federationUpstream)
+	}
+	if federationKey != "" {
+		logInfo("Accepting events federated by other relays on %s", federationPath)
+	}
+
+	// Configure Redis connection
+	redisClient = newRedisClientFromEnv()
+	redisAddr := redisClient.Options().Addr
+
+	// Connect the Redis of each data residency region
+	residency, err = loadResidencyConfig()
+	if err != nil {
+		logError("Invalid data residency configuration: %v", err)
+		os.Exit(1)
 	}
-	if redisPassword != "" {
-		redisOptions.Password = redisPassword
+	if residency.enabled() {
+		regionClients = connectRegions(redisClient.Options(), residency.Regions)
+		logInfo("Routing %d team(s) to data residency regions %s (strict: %v)", len(residency.Teams), strings.Join(residency.regionNames(), ", "), residency.Strict)
+	}
+
+	// Optionally verify Slack tokens and Redis writes now rather than on the first event
+	if getEnvBool("PREFLIGHT_CHECKS", false) {
+		if failures := runPreflightChecks(context.Background(), redisClient); len(failures) > 0 {
+			for _, failure := range failures {
+				logError("Pre-flight check failed: %v", failure)
+			}
+			os.Exit(1)
+		}
 	}
-	redisClient = redis.NewClient(redisOptions)
 
 	// Test Redis connection with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -389,19 +1274,256 @@ func main() {
 		logInfo("Connected to Redis at %s", redisAddr)
 	}
 
-	http.HandleFunc("/slack", slackHandler)
+	// Record the loaded routes on the configuration audit channel
+	configAuditChannel = os.Getenv("CONFIG_AUDIT_CHANNEL")
+	auditConfigChange("startup", configSource, nil, currentEventConfigs())
 
-	// Get port from environment variable, default to 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Reload routes when they change in the remote config source or the config file
+	if remoteConfig != nil {
+		go watchRemoteEventConfig(context.Background(), remoteConfig)
+	} else if interval := getEnvDuration("CONFIG_FILE_WATCH_INTERVAL", defaultConfigFileWatchInterval); interval > 0 {
+		configFile, _ := configFileFromEnv()
+		go watchConfigFile(context.Background(), configFile, configContent, interval)
+		logInfo("Reloading '%s' when it changes, checking every %s", configFile, interval)
 	}
 
-	// Ensure port has colon prefix
-	if !strings.HasPrefix(port, ":") {
-		port = ":" + port
+	// Configure the optional publish queue
+	if queueSize := getEnvInt("PUBLISH_QUEUE_SIZE", 0); queueSize > 0 {
+		queueFullPolicy = os.Getenv("QUEUE_FULL_POLICY")
+		if queueFullPolicy == "" {
+			queueFullPolicy = queueFullPolicyDrop
+		}
+		if queueFullPolicy != queueFullPolicyDrop && queueFullPolicy != queueFullPolicyReject {
+			logError("Invalid QUEUE_FULL_POLICY '%s', expected '%s' or '%s'", queueFullPolicy, queueFullPolicyDrop, queueFullPolicyReject)
+			os.Exit(1)
+		}
+		queueRetryAfterSeconds = getEnvInt("QUEUE_RETRY_AFTER_SECONDS", queueRetryAfterSeconds)
+		workers := getEnvInt("PUBLISH_WORKERS", 4)
+		pipelineSize = getEnvInt("PUBLISH_PIPELINE_SIZE", pipelineSize)
+		pipelineWindow = getEnvDuration("PUBLISH_PIPELINE_WINDOW", pipelineWindow)
+		startPublishWorkers(queueSize, workers)
+		logInfo("Publishing through a queue of %d event(s) with %d worker(s), policy when full: %s", queueSize, workers, queueFullPolicy)
+	}
+
+	// Configure response template Redis lookups
+	responseRedisTimeout = getEnvDuration("RESPONSE_REDIS_TIMEOUT", defaultResponseRedisTimeout)
+
+	// Configure the interaction state store
+	if prefix := os.Getenv("STATE_KEY_PREFIX"); prefix != "" {
+		stateKeyPrefix = prefix
+	}
+	stateTTL = getEnvDuration("STATE_TTL", defaultStateTTL)
+
+	// Release events held until their route's active hours begin
+	heldEvents.maxSize = getEnvInt("ACTIVE_HOURS_BUFFER_SIZE", defaultHeldEventsSize)
+	go watchHeldEvents(context.Background(), heldEventsCheckInterval)
+
+	// Refresh secrets when they change in the secret provider
+	watchSecrets(context.Background())
+
+	// Optionally echo the relay's own output channels to the log and a Slack debug channel
+	if echoChannels := splitList(os.Getenv("ECHO_CHANNELS")); len(echoChannels) > 0 {
+		echoSlackChannel := os.Getenv("ECHO_SLACK_CHANNEL")
+		go func() {
+			err := runEchoConsumer(context.Background(), echoChannels, echoSlackChannel, func(message string) {
+				logInfo("ECHO %s", message)
+			})
+			if err != nil {
+				logWarn("Echo consumer stopped: %v", err)
+			}
+		}()
+		logInfo("Echoing %d output channel(s)", len(echoChannels))
+	}
+
+	// Act on Slack with the bot token for messages received on a Redis channel
+	if outboundChannel := os.Getenv("OUTBOUND_CHANNEL"); outboundChannel != "" {
+		scheduler = newMessageScheduler(getEnvInt("SCHEDULE_QUEUE_SIZE", defaultScheduleQueueSize))
+		uploadMaxBytes = int64(getEnvInt("UPLOAD_MAX_BYTES", defaultUploadMaxBytes))
+		go watchScheduledMessages(context.Background(), scheduler, getEnvDuration("SCHEDULE_CHECK_INTERVAL", defaultScheduleCheckInterval))
+		if channel := os.Getenv("APPROVAL_CHANNEL"); channel != "" {
+			approvalChannel = channel
+		}
+		outbound = newOutboundDispatcher(getEnvInt("OUTBOUND_QUEUE_SIZE", defaultOutboundQueueSize), scheduler)
+		go func() {
+			if err := runOutboundConsumer(context.Background(), outboundChannel, outbound); err != nil {
+				logWarn("Outbound consumer stopped: %v", err)
+			}
+		}()
+		logInfo("Relaying outbound messages received on '%s' to Slack", outboundChannel)
+	}
+
+	// Alert when a normally chatty event type goes quiet
+	defaultIdleAlertAfter = getEnvDuration("IDLE_ALERT_AFTER", 0)
+	watchdog = newIdleWatchdog(clock.Now())
+	go watchIdleRoutes(context.Background(), getEnvDuration("IDLE_CHECK_INTERVAL", defaultIdleCheckInterval))
+
+	// Warn about abnormal spikes or drops in each route's event rate
+	if getEnvBool("ANOMALY_DETECTION", false) {
+		settings := defaultAnomalySettings
+		settings.Interval = getEnvDuration("ANOMALY_WINDOW", settings.Interval)
+		settings.SpikeFactor = getEnvInt("ANOMALY_SPIKE_FACTOR", settings.SpikeFactor)
+		settings.DropFactor = getEnvInt("ANOMALY_DROP_FACTOR", settings.DropFactor)
+		settings.MinEvents = getEnvInt("ANOMALY_MIN_EVENTS", settings.MinEvents)
+		settings.Warmup = getEnvInt("ANOMALY_WARMUP_WINDOWS", settings.Warmup)
+		rateAnomalies = newRateMonitor(settings)
+		go watchRateAnomalies(context.Background())
+	}
+
+	// Acknowledge events before processing while Slack retries aggressively
+	if getEnvBool("RETRY_STORM_PROTECTION", false) {
+		settings := defaultRetryStormSettings
+		settings.Window = getEnvDuration("RETRY_STORM_WINDOW", settings.Window)
+		settings.MinRetries = getEnvInt("RETRY_STORM_MIN_RETRIES", settings.MinRetries)
+		settings.Percent = getEnvInt("RETRY_STORM_PERCENT", settings.Percent)
+		settings.Cooldown = getEnvDuration("RETRY_STORM_COOLDOWN", settings.Cooldown)
+		retryStorms = newRetryStormDetector(settings, clock.Now())
+	}
+
+	// Ban client IPs probing the endpoint or failing signature verification
+	if getEnvBool("ABUSE_PROTECTION", false) {
+		settings := defaultAbuseSettings
+		settings.Window = getEnvDuration("ABUSE_WINDOW", settings.Window)
+		settings.Strikes = getEnvInt("ABUSE_STRIKES", settings.Strikes)
+		settings.BanDuration = getEnvDuration("ABUSE_BAN_DURATION", settings.BanDuration)
+		settings.MaxTracked = getEnvInt("ABUSE_MAX_TRACKED_IPS", settings.MaxTracked)
+		abuse = newAbuseDetector(settings)
+		logInfo("Banning client IPs for %s after %d suspicious requests within %s", settings.BanDuration, settings.Strikes, settings.Window)
+	}
+
+	// Publish the heartbeats of routes that have them
+	go watchHeartbeats(context.Background(), heartbeatCheckInterval)
+
+	// Track the downstream consumers registered with heartbeat keys
+	if interval := getEnvDuration("CONSUMER_CHECK_INTERVAL", 0); interval > 0 {
+		if prefix := os.Getenv("CONSUMER_KEY_PREFIX"); prefix != "" {
+			consumerKeyPrefix = prefix
+		}
+		go watchConsumers(context.Background(), interval)
+		logInfo("Checking registered consumers every %s", interval)
+	}
+
+	// Mirror the last hit of each route to Redis, shared by every replica
+	if key := os.Getenv("ROUTE_HITS_KEY"); key != "" {
+		interval := getEnvDuration("ROUTE_HITS_SYNC_INTERVAL", defaultRouteHitsSyncInterval)
+		go watchRouteHits(context.Background(), key, interval)
+		logInfo("Mirroring route last hits to Redis key '%s' every %s", key, interval)
+	}
+
+	// Send synthetic canary events through the full HTTP, routing and publish path
+	if interval := getEnvDuration("CANARY_INTERVAL", 0); interval > 0 {
+		target := canaryURLFromEnv()
+		go watchCanary(context.Background(), target, interval)
+		if config, ok := lookupEventConfig(canaryEventType); ok && getEnvBool("CANARY_CONSUMER", true) {
+			go func() {
+				if err := runCanaryConsumer(context.Background(), config.Channel); err != nil {
+					logWarn("Canary consumer stopped: %v", err)
+				}
+			}()
+		}
+		logInfo("Sending canary events to %s every %s", target, interval)
+	}
+
+	// Periodically compare the routes against the Slack app's subscriptions and scopes
+	if interval := getEnvDuration("DRIFT_CHECK_INTERVAL", defaultDriftCheckInterval); interval > 0 && (slackBotToken != "" || (slackConfigToken != "" && slackAppID != "")) {
+		go watchConfigDrift(context.Background(), interval)
+	}
+
+	// Optionally start in maintenance mode
+	maintenance.retryAfter = getEnvInt("MAINTENANCE_RETRY_AFTER_SECONDS", defaultMaintenanceRetryAfterSeconds)
+	if getEnvBool("MAINTENANCE_MODE", false) {
+		setMaintenance(true, "MAINTENANCE_MODE is set", "startup", clock.Now())
+	}
+
+	// Poll the Enterprise Grid Audit Logs API and route its entries like events
+	if interval := getEnvDuration("AUDIT_LOGS_INTERVAL", defaultAuditLogsInterval); interval > 0 && slackAuditToken != "" {
+		poller := &auditLogPoller{
+			actions:  os.Getenv("AUDIT_LOGS_ACTIONS"),
+			stateKey: os.Getenv("AUDIT_LOGS_STATE_KEY"),
+		}
+		if poller.stateKey == "" {
+			poller.stateKey = defaultAuditLogsStateKey
+		}
+		go watchAuditLogs(context.Background(), poller, interval)
+		logInfo("Polling the Slack Audit Logs API every %s", interval)
+	}
+
+	// Cache the workspace's user and channel directories for enrichment
+	if getEnvBool("DIRECTORY_CACHE", false) {
+		interval := getEnvDuration("DIRECTORY_REFRESH_INTERVAL", defaultDirectoryRefreshInterval)
+		if interval <= 0 {
+			interval = defaultDirectoryRefreshInterval
+		}
+		directory = &slackDirectory{}
+		go watchDirectory(context.Background(), directory, interval)
+		logInfo("Caching the Slack user and channel directories, refreshed every %s", interval)
+	}
+
+	// Configure metrics label cardinality limits
+	eventTypeLabels.max = getEnvInt("METRICS_MAX_EVENT_TYPES", defaultMetricsMaxEventTypes)
+	teamLabels.max = getEnvInt("METRICS_MAX_TEAMS", defaultMetricsMaxTeams)
+	if teamIDs := os.Getenv("METRICS_TEAM_IDS"); teamIDs != "" {
+		teamLabels.setAllowed(strings.Split(teamIDs, ","))
+	}
+
+	// Restore the counters saved before the last restart, and keep saving them
+	snapshots, err := snapshotStoreFromEnv()
+	if err != nil {
+		logError("Invalid metrics snapshot configuration: %v", err)
+		os.Exit(1)
+	}
+	if snapshots != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := loadMetricsSnapshot(ctx, snapshots); err != nil {
+			logWarn("Error restoring the metrics snapshot from %s: %v", snapshots, err)
+			metricSnapshotErrors.Inc("restore")
+		}
+		cancel()
+		interval := getEnvDuration("METRICS_SNAPSHOT_INTERVAL", defaultMetricsSnapshotInterval)
+		go watchMetricsSnapshot(context.Background(), snapshots, interval)
+		logInfo("Saving the metrics snapshot to %s every %s", snapshots, interval)
+	}
+
+	// Remember delivered event IDs to drop Slack's redeliveries
+	store, err := dedupStoreFromEnv()
+	if err != nil {
+		logError("Invalid dedup configuration: %v", err)
+		os.Exit(1)
+	}
+	if dedup = store; dedup != (noopDedupStore{}) {
+		logInfo("Dropping redelivered events with the dedup %s", dedup)
 	}
 
+	// Retain filtered events briefly so consumers can check what was filtered
+	if filteredEvents = filteredEventsFromEnv(); filteredEvents != nil {
+		logInfo("Retaining filtered events in Redis stream %s for %s", filteredEvents.key, filteredEvents.ttl)
+	}
+
+	// Aggregate relayed events into daily and monthly usage summaries
+	usage, err = usageReporterFromEnv()
+	if err != nil {
+		logError("Invalid usage reporting configuration: %v", err)
+		os.Exit(1)
+	}
+	if usage != nil {
+		go watchUsage(context.Background(), usage)
+		logInfo("Reporting daily and monthly usage per team")
+	}
+
+	// Get port from environment variable, default to 8080
+	port := listenAddrFromEnv()
+	serverSettings := loadServerConfig()
+	maxRequestBodyBytes = serverSettings.MaxBodyBytes
+	requestLimit = newRequestLimiter(serverSettings.MaxConcurrentRequests, serverSettings.RequestQueueTimeout)
+	if requestLimit != nil {
+		logInfo("Limiting Slack requests to %d concurrent, queueing up to %s", serverSettings.MaxConcurrentRequests, serverSettings.RequestQueueTimeout)
+	}
+	adminAddr := adminAddrFromEnv()
+	adminServer := newHTTPServer(adminAddr, newAdminMux(), serverSettings)
+	go func() {
+		logInfo("Starting admin server on %s", adminAddr)
+		log.Fatal(adminServer.ListenAndServe())
+	}()
+	server := newHTTPServer(port, refuseBanned(newIngestMux()), serverSettings)
 	logInfo("Starting Slack event server on port %s", port)
-	log.Fatal(http.ListenAndServe(port, nil))
+	log.Fatal(server.ListenAndServe())
 }
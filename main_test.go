@@ -12,36 +12,18 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
 
 func setupTestEnvironment() {
-	eventConfigs = []EventConfig{
+	setEventConfigs([]EventConfig{
 		{EventType: "message", Channel: "test-channel"},
-	}
-	eventChannelMap = make(map[string]string)
-	eventResponseMap = make(map[string]map[string]interface{})
-	for _, config := range eventConfigs {
-		eventChannelMap[config.EventType] = config.Channel
-		if config.Response != nil {
-			eventResponseMap[config.EventType] = config.Response
-		}
-	}
+	})
 	signingSecret = []byte{} // Disable signature verification for tests
 }
 
-func buildEventMaps() {
-	eventChannelMap = make(map[string]string)
-	eventResponseMap = make(map[string]map[string]interface{})
-	for _, config := range eventConfigs {
-		eventChannelMap[config.EventType] = config.Channel
-		if config.Response != nil {
-			eventResponseMap[config.EventType] = config.Response
-		}
-	}
-}
-
 // computeTestSignature builds a valid Slack HMAC-SHA256 signature for testing.
 func computeTestSignature(body []byte, timestamp string, secret []byte) string {
 	baseString := fmt.Sprintf("v0:%s:%s", timestamp, string(body))
@@ -238,14 +220,13 @@ func TestSlackHandlerMissingPayloadParameter(t *testing.T) {
 
 func TestSlackHandlerWithOptionalResponse(t *testing.T) {
 	// Setup test environment with a response configured
-	eventConfigs = []EventConfig{
+	setEventConfigs([]EventConfig{
 		{
 			EventType: "view_submission",
 			Channel:   "test-channel",
 			Response:  map[string]interface{}{"response_action": "clear"},
 		},
-	}
-	buildEventMaps()
+	})
 	signingSecret = []byte{} // Disable signature verification for tests
 
 	// Create test payload
@@ -287,13 +268,12 @@ func TestSlackHandlerWithOptionalResponse(t *testing.T) {
 
 func TestSlackHandlerWithoutOptionalResponse(t *testing.T) {
 	// Setup test environment without a response configured
-	eventConfigs = []EventConfig{
+	setEventConfigs([]EventConfig{
 		{
 			EventType: "message",
 			Channel:   "test-channel",
 		},
-	}
-	buildEventMaps()
+	})
 	signingSecret = []byte{} // Disable signature verification for tests
 
 	// Create test payload
@@ -333,6 +313,59 @@ func TestSlackHandlerWithoutOptionalResponse(t *testing.T) {
 	}
 }
 
+func TestSlackHandlerCustomAcknowledgement(t *testing.T) {
+	emptyBody := ""
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "test-channel", AckStatus: http.StatusAccepted, AckBody: &emptyBody},
+	})
+	signingSecret = []byte{} // Disable signature verification for tests
+
+	payloadBytes := []byte(`{"type":"event_callback","event":{"type":"message","text":"Hello world"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	slackHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusAccepted {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusAccepted)
+	}
+	if body := rr.Body.String(); body != "" {
+		t.Errorf("handler returned wrong body: got %q want empty body", body)
+	}
+}
+
+func TestParseEventConfigAckStatus(t *testing.T) {
+	if _, err := parseEventConfig([]byte(`[{"slack-event-type": "message", "channel": "c", "ack-status": 204}]`)); err != nil {
+		t.Errorf("expected a 2xx ack-status to be accepted, got %v", err)
+	}
+	for _, status := range []string{"42", "404", "1000"} {
+		data := `[{"slack-event-type": "message", "channel": "c", "ack-status": ` + status + `}]`
+		if _, err := parseEventConfig([]byte(data)); err == nil || !strings.Contains(err.Error(), "invalid ack-status") {
+			t.Errorf("expected ack-status %s to be rejected, got %v", status, err)
+		}
+	}
+}
+
+func TestSlackHandlerRetryOnPublishFailure(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "test-channel", RetryOnPublishFailure: true},
+	})
+	signingSecret = []byte{} // Disable signature verification for tests
+	redisClient = nil        // Publishing fails without Redis
+
+	payloadBytes := []byte(`{"type":"event_callback","event":{"type":"message","text":"Hello world"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	slackHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusInternalServerError)
+	}
+}
+
 func TestSlackHandlerMethodNotAllowed(t *testing.T) {
 	setupTestEnvironment()
 
@@ -403,28 +436,27 @@ func TestSlackHandlerUnconfiguredEventType(t *testing.T) {
 func TestSlackHandlerUnknownEventType(t *testing.T) {
 	setupTestEnvironment()
 
-	// Payload with no type field
-	payload := map[string]interface{}{
-		"text": "hello",
-	}
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		t.Fatalf("failed to marshal test payload: %v", err)
+	payloads := map[string]string{
+		"no type":         `{"text":"hello"}`,
+		"non-string type": `{"type":5,"text":"hello"}`,
 	}
+	for name, payload := range payloads {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
 
-	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(payloadBytes))
-	req.Header.Set("Content-Type", "application/json")
-
-	rr := httptest.NewRecorder()
-	slackHandler(rr, req)
+			rr := httptest.NewRecorder()
+			slackHandler(rr, req)
 
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
-	}
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			}
 
-	body := rr.Body.String()
-	if body != "Event received but type unknown" {
-		t.Errorf("handler returned wrong body: got %v", body)
+			body := rr.Body.String()
+			if body != "Event received but type unknown" {
+				t.Errorf("handler returned wrong body: got %v", body)
+			}
+		})
 	}
 }
 
@@ -502,14 +534,14 @@ func TestLoadEventConfig(t *testing.T) {
 		t.Fatalf("loadEventConfig returned error: %v", err)
 	}
 
-	if eventChannelMap["message"] != "test-channel" {
-		t.Errorf("expected channel 'test-channel' for 'message', got %v", eventChannelMap["message"])
+	if currentConfig().byEventType["message"].Channel != "test-channel" {
+		t.Errorf("expected channel 'test-channel' for 'message', got %v", currentConfig().byEventType["message"].Channel)
 	}
-	if eventChannelMap["view_submission"] != "test-view-channel" {
-		t.Errorf("expected channel 'test-view-channel' for 'view_submission', got %v", eventChannelMap["view_submission"])
+	if currentConfig().byEventType["view_submission"].Channel != "test-view-channel" {
+		t.Errorf("expected channel 'test-view-channel' for 'view_submission', got %v", currentConfig().byEventType["view_submission"].Channel)
 	}
-	if eventResponseMap["view_submission"]["response_action"] != "clear" {
-		t.Errorf("expected response_action 'clear', got %v", eventResponseMap["view_submission"]["response_action"])
+	if currentConfig().byEventType["view_submission"].Response["response_action"] != "clear" {
+		t.Errorf("expected response_action 'clear', got %v", currentConfig().byEventType["view_submission"].Response["response_action"])
 	}
 }
 
@@ -538,6 +570,91 @@ func TestLoadEventConfigInvalidJSON(t *testing.T) {
 	}
 }
 
+func TestLoadEventConfigWithDefaultsFallsBackToEmbedded(t *testing.T) {
+	source, err := loadEventConfigWithDefaults(filepath.Join(t.TempDir(), "config.json"), false)
+	if err != nil {
+		t.Fatalf("loadEventConfigWithDefaults returned error: %v", err)
+	}
+	if source != "embedded defaults" {
+		t.Errorf("expected source 'embedded defaults', got %v", source)
+	}
+	if currentConfig().byEventType["message"].Channel != "slack-relay-message" {
+		t.Errorf("expected embedded channel for 'message', got %v", currentConfig().byEventType["message"].Channel)
+	}
+	if currentConfig().byEventType["view_submission"].Response["response_action"] != "clear" {
+		t.Errorf("expected embedded response for 'view_submission', got %v", currentConfig().byEventType["view_submission"].Response)
+	}
+}
+
+func TestLoadEventConfigWithDefaultsRequiredFile(t *testing.T) {
+	_, err := loadEventConfigWithDefaults(filepath.Join(t.TempDir(), "config.json"), true)
+	if err == nil {
+		t.Error("expected error for missing required file, got nil")
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	configs := []EventConfig{
+		{EventType: "message", Channel: "message-channel"},
+		{EventType: "app_mention", Channel: "mention-channel"},
+	}
+	environ := []string{
+		"PATH=/usr/bin",
+		"EVENT_CHANNEL_MESSAGE=overridden-channel",
+		"EVENT_CHANNEL_APP_MENTION=",
+		"EVENT_CHANNEL_REACTION_ADDED=reaction-channel",
+	}
+
+	got := applyEnvOverrides(configs, environ)
+
+	channels := make(map[string]string)
+	for _, config := range got {
+		channels[config.EventType] = config.Channel
+	}
+	if len(got) != 2 {
+		t.Errorf("expected 2 event configs, got %d", len(got))
+	}
+	if channels["message"] != "overridden-channel" {
+		t.Errorf("expected overridden channel for 'message', got %v", channels["message"])
+	}
+	if _, ok := channels["app_mention"]; ok {
+		t.Error("expected 'app_mention' to be removed by empty override")
+	}
+	if channels["reaction_added"] != "reaction-channel" {
+		t.Errorf("expected added channel for 'reaction_added', got %v", channels["reaction_added"])
+	}
+	if configs[0].Channel != "message-channel" {
+		t.Error("expected input configs to be left unchanged")
+	}
+}
+
+func TestParseEventConfigObjectForm(t *testing.T) {
+	configs, err := parseEventConfig([]byte(`{"routes":[{"slack-event-type":"message","channel":"c"}]}`))
+	if err != nil {
+		t.Fatalf("parseEventConfig returned error: %v", err)
+	}
+	if len(configs) != 1 || configs[0].Channel != "c" {
+		t.Errorf("unexpected configs: %+v", configs)
+	}
+}
+
+func TestDurationUnmarshalJSON(t *testing.T) {
+	var policy RetryPolicy
+	if err := json.Unmarshal([]byte(`{"base-delay":"250ms","max-delay":1000000000}`), &policy); err != nil {
+		t.Fatalf("failed to unmarshal durations: %v", err)
+	}
+	if time.Duration(policy.BaseDelay) != 250*time.Millisecond {
+		t.Errorf("expected base-delay 250ms, got %v", time.Duration(policy.BaseDelay))
+	}
+	if time.Duration(policy.MaxDelay) != time.Second {
+		t.Errorf("expected max-delay 1s, got %v", time.Duration(policy.MaxDelay))
+	}
+
+	if err := json.Unmarshal([]byte(`{"base-delay":"soon"}`), &policy); err == nil {
+		t.Error("expected error for invalid duration, got nil")
+	}
+}
+
 func TestVerifySlackSignature(t *testing.T) {
 	secret := []byte("test-signing-secret")
 	body := []byte(`{"type":"event_callback"}`)
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaintenanceRetryAfterSeconds is the Retry-After sent to Slack while
+// the relay is in maintenance mode
+const defaultMaintenanceRetryAfterSeconds = 60
+
+// adminToken is the current admin bearer token. Empty disables the admin endpoints.
+var adminToken string
+
+// getAdminToken returns the current admin bearer token
+func getAdminToken() string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return adminToken
+}
+
+// maintenanceState is the relay's maintenance mode
+type maintenanceState struct {
+	mu         sync.Mutex
+	enabled    bool
+	reason     string
+	since      time.Time
+	retryAfter int
+}
+
+// maintenance holds whether the relay is in maintenance mode
+var maintenance = &maintenanceState{retryAfter: defaultMaintenanceRetryAfterSeconds}
+
+func init() {
+	newGaugeFunc("slack_relay_maintenance_mode", "1 while the relay is in maintenance mode and asks Slack to retry events.", func() float64 {
+		if enabled, _, _ := maintenance.status(); enabled {
+			return 1
+		}
+		return 0
+	})
+}
+
+// status returns whether maintenance mode is on, why, and since when
+func (m *maintenanceState) status() (bool, string, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.enabled, m.reason, m.since
+}
+
+// set turns maintenance mode on or off, reporting whether it changed
+func (m *maintenanceState) set(enabled bool, reason string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.enabled == enabled {
+		m.reason = reason
+		return false
+	}
+	m.enabled, m.reason, m.since = enabled, reason, now
+	return true
+}
+
+// rejectMaintenance asks Slack to retry the event once maintenance is over
+func rejectMaintenance(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(maintenance.retryAfter))
+	http.Error(w, "Relay is in maintenance, retry later", http.StatusServiceUnavailable)
+}
+
+// authorizeAdmin checks the request's bearer token against the admin token,
+// writing an error response when it does not match
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := getAdminToken()
+	if token == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// maintenanceHandler serves /admin/maintenance: GET returns the current state,
+// POST turns maintenance mode on and DELETE turns it off
+func maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		var request struct {
+			Reason string `json:"reason"`
+			Actor  string `json:"actor"`
+		}
+		if r.Method == http.MethodPost && r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "Error parsing JSON", http.StatusBadRequest)
+				return
+			}
+		}
+		setMaintenance(r.Method == http.MethodPost, request.Reason, request.Actor, clock.Now())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	enabled, reason, since := maintenance.status()
+	response := map[string]interface{}{
+		"maintenance": enabled,
+		"queue_depth": len(publishQueue),
+	}
+	if enabled {
+		response["reason"] = reason
+		response["since"] = since.UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logError("Error writing response: %v", err)
+	}
+}
+
+// setMaintenance turns maintenance mode on or off, and logs and publishes the change
+func setMaintenance(enabled bool, reason string, actor string, now time.Time) {
+	if !maintenance.set(enabled, reason, now) {
+		return
+	}
+
+	record := map[string]interface{}{
+		"type":      "maintenance_ended",
+		"actor":     actor,
+		"timestamp": now.UTC().Format(time.RFC3339),
+	}
+	if enabled {
+		record["type"] = "maintenance_started"
+		record["reason"] = reason
+		logWarn("Entering maintenance mode, asking Slack to retry events: %s", reason)
+	} else {
+		logInfo("Leaving maintenance mode")
+	}
+	logAudit(record)
+	publishControlEvent(record)
+}
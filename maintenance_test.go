@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceHandler(t *testing.T) {
+	setupTestEnvironment()
+	adminToken = "admin-secret"
+	defer func() {
+		adminToken = ""
+		maintenance.set(false, "", maintenance.since)
+	}()
+
+	admin := func(method string, token string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/maintenance", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		maintenanceHandler(recorder, req)
+		return recorder
+	}
+
+	if recorder := admin(http.MethodPost, "wrong", ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with the wrong token, got %d", recorder.Code)
+	}
+
+	recorder := admin(http.MethodPost, "admin-secret", `{"reason":"sink migration","actor":"ops"}`)
+	var status map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("unexpected error decoding response: %v", err)
+	}
+	if status["maintenance"] != true || status["reason"] != "sink migration" {
+		t.Errorf("expected maintenance mode to be on, got %v", status)
+	}
+
+	event := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(`{"type":"event_callback","event":{"type":"message"}}`))
+	event.Header.Set("Content-Type", "application/json")
+	eventRecorder := httptest.NewRecorder()
+	slackHandler(eventRecorder, event)
+	if eventRecorder.Code != http.StatusServiceUnavailable || eventRecorder.Header().Get("Retry-After") == "" {
+		t.Errorf("expected events to be rejected with Retry-After, got %d", eventRecorder.Code)
+	}
+
+	verification := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(`{"type":"url_verification","challenge":"abc"}`))
+	verificationRecorder := httptest.NewRecorder()
+	slackHandler(verificationRecorder, verification)
+	if verificationRecorder.Code != http.StatusOK {
+		t.Errorf("expected URL verification to be answered in maintenance, got %d", verificationRecorder.Code)
+	}
+
+	recorder = admin(http.MethodDelete, "admin-secret", "")
+	if !strings.Contains(recorder.Body.String(), `"maintenance":false`) {
+		t.Errorf("expected maintenance mode to be off, got %s", recorder.Body.String())
+	}
+}
+
+func TestMaintenanceHandlerDisabledWithoutToken(t *testing.T) {
+	adminToken = ""
+	recorder := httptest.NewRecorder()
+	maintenanceHandler(recorder, httptest.NewRequest(http.MethodGet, "/admin/maintenance", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without an admin token, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// eventSubscription is the Events API subscriptions and bot scopes needed to
+// receive a routed event type
+type eventSubscription struct {
+	events []string
+	scopes []string
+}
+
+// eventSubscriptions maps routed event types to their subscriptions. Event types
+// not listed are subscribed to under their own name without extra scopes.
+var eventSubscriptions = map[string]eventSubscription{
+	"message": {
+		events: []string{"message.channels", "message.groups", "message.im", "message.mpim"},
+		scopes: []string{"channels:history", "groups:history", "im:history", "mpim:history"},
+	},
+	"app_mention":             {scopes: []string{"app_mentions:read"}},
+	"reaction_added":          {scopes: []string{"reactions:read"}},
+	"reaction_removed":        {scopes: []string{"reactions:read"}},
+	"channel_created":         {scopes: []string{"channels:read"}},
+	"channel_deleted":         {scopes: []string{"channels:read"}},
+	"channel_rename":          {scopes: []string{"channels:read"}},
+	"channel_archive":         {scopes: []string{"channels:read"}},
+	"channel_unarchive":       {scopes: []string{"channels:read"}},
+	"member_joined_channel":   {scopes: []string{"channels:read", "groups:read"}},
+	"member_left_channel":     {scopes: []string{"channels:read", "groups:read"}},
+	"team_join":               {scopes: []string{"users:read"}},
+	"user_change":             {scopes: []string{"users:read"}},
+	"pin_added":               {scopes: []string{"pins:read"}},
+	"pin_removed":             {scopes: []string{"pins:read"}},
+	"file_shared":             {scopes: []string{"files:read"}},
+	"emoji_changed":           {scopes: []string{"emoji:read"}},
+	"subteam_created":         {scopes: []string{"usergroups:read"}},
+	"subteam_updated":         {scopes: []string{"usergroups:read"}},
+	"subteam_members_changed": {scopes: []string{"usergroups:read"}},
+	"subteam_self_added":      {scopes: []string{"usergroups:read"}},
+	"subteam_self_removed":    {scopes: []string{"usergroups:read"}},
+	linkSharedEventType:       {scopes: []string{"links:read", "links:write"}},
+}
+
+// interactivityTypes are payload types delivered to the interactivity request
+// URL rather than through event subscriptions
+var interactivityTypes = map[string]bool{
+	"block_actions":       true,
+	"block_suggestion":    true,
+	"view_submission":     true,
+	"view_closed":         true,
+	"shortcut":            true,
+	"message_action":      true,
+	"interactive_message": true,
+	"dialog_submission":   true,
+}
+
+// appManifest is the subset of the Slack App Manifest generated from the route configuration
+type appManifest struct {
+	DisplayInformation struct {
+		Name string `json:"name"`
+	} `json:"display_information"`
+	Features struct {
+		BotUser struct {
+			DisplayName  string `json:"display_name"`
+			AlwaysOnline bool   `json:"always_online"`
+		} `json:"bot_user"`
+		UnfurlDomains []string               `json:"unfurl_domains,omitempty"`
+		SlashCommands []manifestSlashCommand `json:"slash_commands,omitempty"`
+	} `json:"features"`
+	OAuthConfig struct {
+		Scopes struct {
+			Bot []string `json:"bot"`
+		} `json:"scopes"`
+	} `json:"oauth_config"`
+	Settings struct {
+		EventSubscriptions *manifestEventSubscriptions `json:"event_subscriptions,omitempty"`
+		Interactivity      *manifestInteractivity      `json:"interactivity,omitempty"`
+		OrgDeployEnabled   bool                        `json:"org_deploy_enabled"`
+		SocketModeEnabled  bool                        `json:"socket_mode_enabled"`
+	} `json:"settings"`
+}
+
+// manifestEventSubscriptions is the event subscription settings of the app manifest
+type manifestEventSubscriptions struct {
+	RequestURL string   `json:"request_url"`
+	BotEvents  []string `json:"bot_events"`
+}
+
+// manifestSlashCommand is a slash command of the app manifest
+type manifestSlashCommand struct {
+	Command      string `json:"command"`
+	URL          string `json:"url"`
+	Description  string `json:"description"`
+	ShouldEscape bool   `json:"should_escape"`
+}
+
+// manifestInteractivity is the interactivity settings of the app manifest
+type manifestInteractivity struct {
+	IsEnabled             bool   `json:"is_enabled"`
+	RequestURL            string `json:"request_url"`
+	MessageMenuOptionsURL string `json:"message_menu_options_url,omitempty"`
+}
+
+// buildAppManifest generates an app manifest whose event subscriptions,
+// interactivity, slash commands and scopes match configs. All requests are
+// sent to requestURL. Slash commands are taken from the commands of
+// slash_command routes, described by the route's description.
+func buildAppManifest(name string, requestURL string, configs []EventConfig) appManifest {
+	var manifest appManifest
+	manifest.DisplayInformation.Name = name
+	manifest.Features.BotUser.DisplayName = name
+
+	events := make(map[string]bool)
+	scopes := make(map[string]bool)
+	unfurlDomains := make(map[string]bool)
+	interactive := false
+	menuOptions := false
+	commands := make(map[string]bool)
+	descriptions := make(map[string]string)
+	for _, config := range expandEventTypePatterns(configs) {
+		if config.EventType == auditLogEventType || config.EventType == canaryEventType {
+			// Audit log entries are polled from the Audit Logs API and canaries are
+			// sent by the relay itself; neither is subscribed to
+			continue
+		}
+		if config.EventType == slashCommandType {
+			scopes["commands"] = true
+			for _, command := range config.Commands {
+				commands[command] = true
+				if config.Description != "" {
+					descriptions[command] = config.Description
+				}
+			}
+			continue
+		}
+		if interactivityTypes[config.EventType] {
+			interactive = true
+			menuOptions = menuOptions || config.EventType == "block_suggestion"
+			continue
+		}
+		subscription, ok := eventSubscriptions[config.EventType]
+		if !ok || len(subscription.events) == 0 {
+			subscription.events = []string{config.EventType}
+		}
+		for _, event := range subscription.events {
+			events[event] = true
+		}
+		for _, scope := range subscription.scopes {
+			scopes[scope] = true
+		}
+		if config.Identity {
+			// Emails and custom profile field labels for the identity metadata
+			scopes["users:read.email"] = true
+			scopes["users.profile:read"] = true
+		}
+		for _, domain := range config.Domains {
+			unfurlDomains[strings.ToLower(domain)] = true
+		}
+	}
+
+	if len(events) > 0 {
+		manifest.Settings.EventSubscriptions = &manifestEventSubscriptions{RequestURL: requestURL, BotEvents: sortedKeys(events)}
+	}
+	if interactive {
+		manifest.Settings.Interactivity = &manifestInteractivity{IsEnabled: true, RequestURL: requestURL}
+		if menuOptions {
+			manifest.Settings.Interactivity.MessageMenuOptionsURL = requestURL
+		}
+	}
+	for _, command := range sortedKeys(commands) {
+		description := descriptions[command]
+		if description == "" {
+			description = "Run /" + command
+		}
+		manifest.Features.SlashCommands = append(manifest.Features.SlashCommands,
+			manifestSlashCommand{Command: "/" + command, URL: requestURL, Description: description})
+	}
+	manifest.Features.UnfurlDomains = sortedKeys(unfurlDomains)
+	manifest.OAuthConfig.Scopes.Bot = sortedKeys(scopes)
+	if manifest.OAuthConfig.Scopes.Bot == nil {
+		manifest.OAuthConfig.Scopes.Bot = []string{}
+	}
+	return manifest
+}
+
+// sortedKeys returns the keys of set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runManifestCommand implements the "manifest" subcommand, which prints a Slack
+// App Manifest generated from the route configuration
+func runManifestCommand(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("manifest", flag.ContinueOnError)
+	requestURL := flags.String("url", "", "public URL of the relay's /slack endpoint")
+	name := flags.String("name", "Slack Relay", "app and bot user display name")
+	configPath := flags.String("config", "", "config file to read (default: CONFIG_FILE or config.json)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *requestURL == "" {
+		fmt.Fprintln(os.Stderr, "usage: slack-relay manifest -url https://relay.example.com/slack [-name NAME] [-config config.json]")
+		return 2
+	}
+
+	configFile, required := configFileFromEnv()
+	if *configPath != "" {
+		configFile, required = *configPath, true
+	}
+	if _, err := loadEventConfigWithDefaults(configFile, required); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration file '%s': %v\n", configFile, err)
+		return 1
+	}
+
+	manifest := buildAppManifest(*name, *requestURL, currentEventConfigs())
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestBuildAppManifest(t *testing.T) {
+	configs := []EventConfig{
+		{EventType: "message", Channel: "messages"},
+		{EventType: "reaction_added", Channel: "reactions"},
+		{EventType: "reaction_removed", Channel: "reactions"},
+		{EventType: "app_home_opened", Channel: "home"},
+		{EventType: "view_submission", Channel: "views"},
+	}
+
+	manifest := buildAppManifest("Relay", "https://relay.example.com/slack", configs)
+
+	subscriptions := manifest.Settings.EventSubscriptions
+	if subscriptions == nil || subscriptions.RequestURL != "https://relay.example.com/slack" {
+		t.Fatalf("expected event subscriptions to the relay URL, got %+v", subscriptions)
+	}
+	wantEvents := []string{"app_home_opened", "message.channels", "message.groups", "message.im", "message.mpim", "reaction_added", "reaction_removed"}
+	if !reflect.DeepEqual(subscriptions.BotEvents, wantEvents) {
+		t.Errorf("bot events = %v, want %v", subscriptions.BotEvents, wantEvents)
+	}
+
+	wantScopes := []string{"channels:history", "groups:history", "im:history", "mpim:history", "reactions:read"}
+	if !reflect.DeepEqual(manifest.OAuthConfig.Scopes.Bot, wantScopes) {
+		t.Errorf("bot scopes = %v, want %v", manifest.OAuthConfig.Scopes.Bot, wantScopes)
+	}
+
+	if manifest.Settings.Interactivity == nil || !manifest.Settings.Interactivity.IsEnabled {
+		t.Error("expected interactivity to be enabled for view_submission")
+	}
+}
+
+func TestBuildAppManifestUnfurlDomains(t *testing.T) {
+	configs := []EventConfig{
+		{EventType: "link_shared", Channel: "jira-links", Domains: []string{"Jira.example.com"}},
+		{EventType: "link_shared", Channel: "docs-links", Domains: []string{"docs.example.com"}},
+	}
+
+	manifest := buildAppManifest("Relay", "https://relay.example.com/slack", configs)
+
+	if want := []string{"docs.example.com", "jira.example.com"}; !reflect.DeepEqual(manifest.Features.UnfurlDomains, want) {
+		t.Errorf("unfurl domains = %v, want %v", manifest.Features.UnfurlDomains, want)
+	}
+	if want := []string{"links:read", "links:write"}; !reflect.DeepEqual(manifest.OAuthConfig.Scopes.Bot, want) {
+		t.Errorf("bot scopes = %v, want %v", manifest.OAuthConfig.Scopes.Bot, want)
+	}
+}
+
+func TestBuildAppManifestNoInteractivity(t *testing.T) {
+	manifest := buildAppManifest("Relay", "https://relay.example.com/slack", []EventConfig{{EventType: "app_mention"}})
+	if manifest.Settings.Interactivity != nil {
+		t.Errorf("expected no interactivity settings, got %+v", manifest.Settings.Interactivity)
+	}
+	if !reflect.DeepEqual(manifest.OAuthConfig.Scopes.Bot, []string{"app_mentions:read"}) {
+		t.Errorf("unexpected bot scopes: %v", manifest.OAuthConfig.Scopes.Bot)
+	}
+}
+
+func TestRunManifestCommand(t *testing.T) {
+	config := writeTestFile(t, t.TempDir(), "config.json", `[{"slack-event-type":"app_mention","channel":"mentions"}]`)
+
+	var stdout bytes.Buffer
+	if code := runManifestCommand([]string{"-url", "https://relay.example.com/slack", "-config", config}, &stdout); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+
+	var manifest appManifest
+	if err := json.Unmarshal(stdout.Bytes(), &manifest); err != nil {
+		t.Fatalf("manifest is not valid JSON: %v\n%s", err, stdout.String())
+	}
+	if manifest.Settings.EventSubscriptions == nil || !reflect.DeepEqual(manifest.Settings.EventSubscriptions.BotEvents, []string{"app_mention"}) {
+		t.Errorf("unexpected event subscriptions: %+v", manifest.Settings.EventSubscriptions)
+	}
+
+	if code := runManifestCommand([]string{"-config", config}, &stdout); code != 2 {
+		t.Errorf("expected exit code 2 without -url, got %d", code)
+	}
+}
+
+func TestBuildAppManifestSlashCommands(t *testing.T) {
+	configs := []EventConfig{
+		{EventType: "slash_command", Channel: "slack-deploys", Commands: []string{"deploy", "rollback"}, Description: "Deploy a service"},
+		{EventType: "slash_command", Channel: "slack-commands", Commands: []string{"oncall"}},
+	}
+
+	manifest := buildAppManifest("Relay", "https://relay.example.com/slack", configs)
+
+	want := []manifestSlashCommand{
+		{Command: "/deploy", URL: "https://relay.example.com/slack", Description: "Deploy a service"},
+		{Command: "/oncall", URL: "https://relay.example.com/slack", Description: "Run /oncall"},
+		{Command: "/rollback", URL: "https://relay.example.com/slack", Description: "Deploy a service"},
+	}
+	if !reflect.DeepEqual(manifest.Features.SlashCommands, want) {
+		t.Errorf("slash commands = %+v, want %+v", manifest.Features.SlashCommands, want)
+	}
+	if manifest.Settings.EventSubscriptions != nil {
+		t.Errorf("expected no event subscriptions, got %+v", manifest.Settings.EventSubscriptions)
+	}
+	if !reflect.DeepEqual(manifest.OAuthConfig.Scopes.Bot, []string{"commands"}) {
+		t.Errorf("unexpected bot scopes: %v", manifest.OAuthConfig.Scopes.Bot)
+	}
+}
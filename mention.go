@@ -0,0 +1,65 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// userMentionPattern matches a user mention in message text, e.g. <@U0LAN0Z89>
+// or <@U0LAN0Z89|bot>
+var userMentionPattern = regexp.MustCompile(`<@([A-Z0-9]+)(?:\|[^>]*)?>`)
+
+// mentionCommand is the command parsed from the text of an app mention
+type mentionCommand struct {
+	// Name is the first word after the bot mention, lowercased, e.g. "deploy"
+	Name string `json:"name"`
+	// Args are the remaining words
+	Args []string `json:"args"`
+	// Text is the text after the bot mention
+	Text string `json:"text"`
+}
+
+// payloadBotUserID returns the bot user the event was delivered to, from the
+// event's authorizations
+func payloadBotUserID(payload map[string]interface{}) string {
+	authorizations, _ := payload["authorizations"].([]interface{})
+	for _, authorization := range authorizations {
+		authorization, _ := authorization.(map[string]interface{})
+		if isBot, _ := authorization["is_bot"].(bool); isBot {
+			userID, _ := authorization["user_id"].(string)
+			return userID
+		}
+	}
+	return ""
+}
+
+// parseMentionCommand parses the text of an app_mention event into a command
+// keyword and arguments, e.g. "<@U0LAN0Z89> deploy prod" into "deploy" and
+// ["prod"]. Text before the bot mention is ignored. It returns nil when no
+// command follows the mention.
+func parseMentionCommand(payload map[string]interface{}) *mentionCommand {
+	event, _ := payload["event"].(map[string]interface{})
+	text, _ := event["text"].(string)
+
+	// Drop everything up to the bot's mention, or the first mention when the
+	// bot user is unknown
+	botUserID := payloadBotUserID(payload)
+	for _, match := range userMentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		if botUserID == "" || text[match[2]:match[3]] == botUserID {
+			text = text[match[1]:]
+			break
+		}
+	}
+
+	// Allow "@bot: deploy" and "@bot, deploy"
+	text = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(text), ":,"))
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil
+	}
+	return &mentionCommand{
+		Name: strings.ToLower(strings.TrimRight(fields[0], ":,")),
+		Args: append([]string{}, fields[1:]...),
+		Text: text,
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseMentionCommand(t *testing.T) {
+	mention := func(text string, botUserID string) map[string]interface{} {
+		payload := map[string]interface{}{"event": map[string]interface{}{"type": "app_mention", "text": text}}
+		if botUserID != "" {
+			payload["authorizations"] = []interface{}{map[string]interface{}{"user_id": botUserID, "is_bot": true}}
+		}
+		return payload
+	}
+
+	tests := []struct {
+		text     string
+		bot      string
+		expected *mentionCommand
+	}{
+		{"<@UBOT> deploy prod", "", &mentionCommand{Name: "deploy", Args: []string{"prod"}, Text: "deploy prod"}},
+		{"<@UBOT|relay> Status", "UBOT", &mentionCommand{Name: "status", Args: []string{}, Text: "Status"}},
+		{"hey <@UBOT>: deploy  prod  --force", "UBOT", &mentionCommand{Name: "deploy", Args: []string{"prod", "--force"}, Text: "deploy  prod  --force"}},
+		{"<@UALICE> <@UBOT> rollback api", "UBOT", &mentionCommand{Name: "rollback", Args: []string{"api"}, Text: "rollback api"}},
+		{"<@UBOT>", "UBOT", nil},
+	}
+	for _, tt := range tests {
+		got := parseMentionCommand(mention(tt.text, tt.bot))
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("parseMentionCommand(%q) = %+v, want %+v", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestRouteEventByCommand(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "app_mention", Channel: "deploys", Commands: []string{"deploy", "rollback"}},
+		{EventType: "app_mention", Channel: "mentions", ParseCommand: true},
+	})
+	defer setupTestEnvironment()
+
+	route := func(text string) routedEvent {
+		payload := map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{"type": "app_mention", "text": text}}
+		return routeEvent(payload, nil)
+	}
+
+	routed := route("<@UBOT> deploy prod")
+	if routed.Config.Channel != "deploys" {
+		t.Errorf("expected deploy commands to reach the deploys route, got %q", routed.Config.Channel)
+	}
+	var published map[string]interface{}
+	if err := json.Unmarshal(routed.Payload, &published); err != nil {
+		t.Fatalf("unexpected error decoding payload: %v", err)
+	}
+	metadata, _ := published[relayMetadataKey].(map[string]interface{})
+	command, _ := metadata["command"].(map[string]interface{})
+	if command["name"] != "deploy" {
+		t.Errorf("expected the parsed command to be attached, got %v", published)
+	}
+
+	if routed := route("<@UBOT> status"); routed.Config.Channel != "mentions" {
+		t.Errorf("expected other commands to reach the catch-all route, got %q", routed.Config.Channel)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// otherLabelValue is the label value used once a label's cardinality cap is reached
+	otherLabelValue = "other"
+
+	// defaultMetricsMaxEventTypes is the default number of distinct unconfigured
+	// event types tracked before falling back to otherLabelValue
+	defaultMetricsMaxEventTypes = 20
+
+	// defaultMetricsMaxTeams is the default number of distinct teams tracked
+	// before falling back to otherLabelValue
+	defaultMetricsMaxTeams = 20
+)
+
+// metricsCollector is implemented by every metric exposed on /metrics
+type metricsCollector interface {
+	writeMetrics(w io.Writer)
+}
+
+// metricsRegistry holds the collectors exposed on /metrics, in registration order
+var metricsRegistry []metricsCollector
+
+// labelLimiter caps the number of distinct values a metric label can take.
+// Allowed values are always kept; other values are admitted first come, first
+// served until max is reached, after which they are reported as "other".
+type labelLimiter struct {
+	mu      sync.Mutex
+	max     int
+	allowed map[string]bool
+	seen    map[string]bool
+}
+
+// newLabelLimiter creates a labelLimiter admitting up to max values beyond allowed
+func newLabelLimiter(max int, allowed []string) *labelLimiter {
+	limiter := &labelLimiter{max: max, seen: make(map[string]bool)}
+	limiter.setAllowed(allowed)
+	return limiter
+}
+
+// setAllowed replaces the values that are always kept
+func (l *labelLimiter) setAllowed(allowed []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.allowed = make(map[string]bool, len(allowed))
+	for _, value := range allowed {
+		l.allowed[value] = true
+	}
+}
+
+// value returns the label value to record for v
+func (l *labelLimiter) value(v string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.allowed[v] || l.seen[v] {
+		return v
+	}
+	if len(l.seen) >= l.max {
+		return otherLabelValue
+	}
+	l.seen[v] = true
+	return v
+}
+
+// eventTypeLabels caps the event_type label. Configured event types are always kept.
+var eventTypeLabels = newLabelLimiter(defaultMetricsMaxEventTypes, nil)
+
+// teamLabels caps the team_id label
+var teamLabels = newLabelLimiter(defaultMetricsMaxTeams, nil)
+
+// counterVec is a Prometheus counter partitioned by labels
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+	// keys interns the series keys of values, so recording an existing series
+	// does not allocate its key
+	keys map[string]string
+}
+
+// newCounterVec creates a counterVec and registers it on /metrics
+func newCounterVec(name string, help string, labels ...string) *counterVec {
+	counter := &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	metricsRegistry = append(metricsRegistry, counter)
+	return counter
+}
+
+// Add increases the counter for the given label values by delta
+func (c *counterVec) Add(delta float64, labelValues ...string) {
+	var buf [128]byte
+	raw := buf[:0]
+	for i, value := range labelValues {
+		if i > 0 {
+			raw = append(raw, '\xff')
+		}
+		raw = append(raw, value...)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, ok := c.keys[string(raw)]
+	if !ok {
+		if c.keys == nil {
+			c.keys = make(map[string]string)
+		}
+		key = string(raw)
+		c.keys[key] = key
+	}
+	c.values[key] += delta
+}
+
+// Inc increments the counter for the given label values
+func (c *counterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// writeMetrics writes the counter in Prometheus text exposition format
+func (c *counterVec) writeMetrics(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %v\n", c.name, formatLabels(c.labels, strings.Split(key, "\xff")), c.values[key])
+	}
+}
+
+// gaugeFunc is a Prometheus gauge whose value is read when metrics are scraped
+type gaugeFunc struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+// newGaugeFunc creates a gaugeFunc and registers it on /metrics
+func newGaugeFunc(name string, help string, value func() float64) *gaugeFunc {
+	gauge := &gaugeFunc{name: name, help: help, value: value}
+	metricsRegistry = append(metricsRegistry, gauge)
+	return gauge
+}
+
+// writeMetrics writes the gauge in Prometheus text exposition format
+func (g *gaugeFunc) writeMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", g.name, g.help, g.name, g.name, g.value())
+}
+
+// histogram is a Prometheus histogram without labels
+type histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// newHistogram creates a histogram with the given upper bucket bounds, in
+// increasing order, and registers it on /metrics
+func newHistogram(name string, help string, buckets []float64) *histogram {
+	h := &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	metricsRegistry = append(metricsRegistry, h)
+	return h
+}
+
+// Observe records a value
+func (h *histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// writeMetrics writes the histogram in Prometheus text exposition format
+func (h *histogram) writeMetrics(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%v\"} %d\n", h.name, bound, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %v\n%s_count %d\n", h.name, h.count, h.name, h.sum, h.name, h.count)
+}
+
+// labelValueEscaper escapes label values as the Prometheus text format requires:
+// backslash, double quote and line feed. Everything else is written as is.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders label names and values as {name="value",...}
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + labelValueEscaper.Replace(value) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var metricEventsReceived = newCounterVec("slack_relay_events_received_total",
+	"Slack events received, by event type and team.", "event_type", "team_id")
+var metricEventsPublished = newCounterVec("slack_relay_events_published_total",
+	"Events published to Redis, by event type.", "event_type")
+var metricPublishErrors = newCounterVec("slack_relay_publish_errors_total",
+	"Events that could not be published, by event type.", "event_type")
+
+// redisPoolStat reads a field of the Redis connection pool statistics, or 0
+// when Redis is not configured
+func redisPoolStat(field func(*redis.PoolStats) uint32) func() float64 {
+	return func() float64 {
+		if redisClient == nil {
+			return 0
+		}
+		return float64(field(redisClient.PoolStats()))
+	}
+}
+
+func init() {
+	newGaugeFunc("slack_relay_redis_pool_hits", "Times a free connection was found in the Redis pool.",
+		redisPoolStat(func(s *redis.PoolStats) uint32 { return s.Hits }))
+	newGaugeFunc("slack_relay_redis_pool_misses", "Times a free connection was not found in the Redis pool.",
+		redisPoolStat(func(s *redis.PoolStats) uint32 { return s.Misses }))
+	newGaugeFunc("slack_relay_redis_pool_timeouts", "Times a wait for a Redis pool connection timed out.",
+		redisPoolStat(func(s *redis.PoolStats) uint32 { return s.Timeouts }))
+	newGaugeFunc("slack_relay_redis_pool_total_conns", "Connections in the Redis pool.",
+		redisPoolStat(func(s *redis.PoolStats) uint32 { return s.TotalConns }))
+	newGaugeFunc("slack_relay_redis_pool_idle_conns", "Idle connections in the Redis pool.",
+		redisPoolStat(func(s *redis.PoolStats) uint32 { return s.IdleConns }))
+	newGaugeFunc("slack_relay_redis_pool_stale_conns", "Stale connections removed from the Redis pool.",
+		redisPoolStat(func(s *redis.PoolStats) uint32 { return s.StaleConns }))
+}
+
+// eventTypeLabel returns the capped event_type label value for eventType
+func eventTypeLabel(eventType string) string {
+	return eventTypeLabels.value(eventType)
+}
+
+// teamLabel returns the capped team_id label value for teamID
+func teamLabel(teamID string) string {
+	if teamID == "" {
+		return "none"
+	}
+	return teamLabels.value(teamID)
+}
+
+// metricsHandler serves all registered metrics in Prometheus text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, collector := range metricsRegistry {
+		collector.writeMetrics(w)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLabelLimiter(t *testing.T) {
+	limiter := newLabelLimiter(2, []string{"message"})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"message", "message"},
+		{"app_mention", "app_mention"},
+		{"reaction_added", "reaction_added"},
+		{"new_event_type", otherLabelValue},
+		{"app_mention", "app_mention"},
+		{"message", "message"},
+	}
+	for _, tt := range tests {
+		if got := limiter.value(tt.input); got != tt.expected {
+			t.Errorf("value(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestTeamLabelEmpty(t *testing.T) {
+	if got := teamLabel(""); got != "none" {
+		t.Errorf("teamLabel(\"\") = %q, want %q", got, "none")
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"message", `{event_type="message"}`},
+		{`say "hi"`, `{event_type="say \"hi\""}`},
+		{`C:\temp`, `{event_type="C:\\temp"}`},
+		{"two\nlines", `{event_type="two\nlines"}`},
+		{"tab\tand é", "{event_type=\"tab\tand é\"}"},
+	}
+	for _, tt := range tests {
+		if got := formatLabels([]string{"event_type"}, []string{tt.value}); got != tt.want {
+			t.Errorf("formatLabels(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCounterVecWriteMetrics(t *testing.T) {
+	counter := &counterVec{name: "test_total", help: "Test counter.", labels: []string{"event_type"}, values: make(map[string]float64)}
+	counter.Inc("message")
+	counter.Inc("message")
+	counter.Inc("app_mention")
+
+	var sb strings.Builder
+	counter.writeMetrics(&sb)
+	output := sb.String()
+
+	for _, expected := range []string{
+		"# TYPE test_total counter",
+		`test_total{event_type="message"} 2`,
+		`test_total{event_type="app_mention"} 1`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestHistogramWriteMetrics(t *testing.T) {
+	h := &histogram{name: "test_seconds", help: "Test histogram.", buckets: []float64{0.1, 1}, counts: make([]uint64, 2)}
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	var sb strings.Builder
+	h.writeMetrics(&sb)
+	output := sb.String()
+
+	for _, expected := range []string{
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{le="0.1"} 1`,
+		`test_seconds_bucket{le="1"} 2`,
+		`test_seconds_bucket{le="+Inf"} 3`,
+		"test_seconds_sum 5.55",
+		"test_seconds_count 3",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+	metricsHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "slack_relay_events_received_total") {
+		t.Errorf("expected events received metric in output, got:\n%s", rr.Body.String())
+	}
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// currentConfigVersion is the schema version of configuration documents.
+// Version 1 is the original bare array of routes; version 2 is the object form
+// with a "version" key and durations written as strings.
+const currentConfigVersion = 2
+
+// diffContextLines is the number of unchanged lines shown around each change
+const diffContextLines = 3
+
+// durationRouteKeys are the route options holding a duration, and
+// durationPolicyKeys those of the route's policies, by policy
+var (
+	durationRouteKeys  = []string{"idle-alert-after", "heartbeat"}
+	durationPolicyKeys = map[string][]string{
+		"retry": {"base-delay", "max-delay"},
+		"batch": {"max-latency"},
+		"stale": {"max-age"},
+		"state": {"ttl"},
+	}
+)
+
+// jsonField is a member of a jsonObject
+type jsonField struct {
+	Key   string
+	Value interface{}
+}
+
+// jsonObject is a JSON object that keeps its members in order, so a migrated
+// file only differs from the original where it was changed
+type jsonObject []jsonField
+
+// get returns the value of key
+func (o jsonObject) get(key string) (interface{}, bool) {
+	for _, field := range o {
+		if field.Key == key {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+// set replaces the value of key, or adds it at the end
+func (o jsonObject) set(key string, value interface{}) jsonObject {
+	for i, field := range o {
+		if field.Key == key {
+			o[i].Value = value
+			return o
+		}
+	}
+	return append(o, jsonField{Key: key, Value: value})
+}
+
+// configMigration upgrades a configuration document from one schema version to
+// the next, returning the document and a description of each change
+type configMigration struct {
+	From  int
+	Apply func(document interface{}) (interface{}, []string)
+}
+
+// configMigrations are applied in order to bring documents to currentConfigVersion
+var configMigrations = []configMigration{
+	{From: 1, Apply: migrateConfigV1},
+}
+
+// migrateConfigV1 wraps a bare route array in the object form, stamps the
+// version and rewrites durations given as nanoseconds as duration strings
+func migrateConfigV1(document interface{}) (interface{}, []string) {
+	var changes []string
+	object, ok := document.(jsonObject)
+	if !ok {
+		object = jsonObject{{Key: "routes", Value: document}}
+		changes = append(changes, `wrapped the route array in an object under "routes"`)
+	}
+	if _, ok := object.get("version"); ok {
+		object = object.set("version", json.Number("2"))
+	} else {
+		object = append(jsonObject{{Key: "version", Value: json.Number("2")}}, object...)
+	}
+	changes = append(changes, "set version to 2")
+
+	routes, _ := object.get("routes")
+	routeList, _ := routes.([]interface{})
+	for i, route := range routeList {
+		route, ok := route.(jsonObject)
+		if !ok {
+			continue
+		}
+		name := fmt.Sprintf("route %d", i+1)
+		if eventType, ok := route.get("slack-event-type"); ok {
+			name = fmt.Sprintf("route %d (%v)", i+1, eventType)
+		}
+		changes = append(changes, migrateDurations(route, durationRouteKeys, name)...)
+		for _, field := range route {
+			keys, isPolicy := durationPolicyKeys[field.Key]
+			if policy, ok := field.Value.(jsonObject); ok && isPolicy {
+				changes = append(changes, migrateDurations(policy, keys, name+" "+field.Key)...)
+			}
+		}
+	}
+	return object, changes
+}
+
+// migrateDurations rewrites the numeric durations of keys in object as strings
+func migrateDurations(object jsonObject, keys []string, name string) []string {
+	var changes []string
+	for _, key := range keys {
+		value, ok := object.get(key)
+		number, isNumber := value.(json.Number)
+		if !ok || !isNumber {
+			continue
+		}
+		nanoseconds, err := number.Float64()
+		if err != nil {
+			continue
+		}
+		duration := formatConfigDuration(time.Duration(nanoseconds))
+		object.set(key, duration)
+		changes = append(changes, fmt.Sprintf("%s: %s %s -> %q", name, key, number, duration))
+	}
+	return changes
+}
+
+// formatConfigDuration formats d like time.Duration.String without zero
+// trailing units, e.g. "5m" rather than "5m0s"
+func formatConfigDuration(d time.Duration) string {
+	formatted := d.String()
+	if strings.HasSuffix(formatted, "m0s") {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if strings.HasSuffix(formatted, "h0m") {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
+
+// configDocumentVersion returns the schema version of a document
+func configDocumentVersion(document interface{}) (int, error) {
+	object, ok := document.(jsonObject)
+	if !ok {
+		return 1, nil
+	}
+	value, ok := object.get("version")
+	if !ok {
+		return 1, nil
+	}
+	number, ok := value.(json.Number)
+	version, err := strconv.Atoi(string(number))
+	if !ok || err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid version %v", value)
+	}
+	return version, nil
+}
+
+// migrateConfig upgrades every document of a configuration file to
+// currentConfigVersion. It returns the migrated file and the changes made,
+// which are empty when the file is already current.
+func migrateConfig(data []byte) ([]byte, []string, error) {
+	documents, err := decodeOrderedDocuments(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(documents) == 0 {
+		return nil, nil, errors.New("configuration is empty")
+	}
+
+	var changes []string
+	for i, document := range documents {
+		if object, ok := document.(jsonObject); ok {
+			if _, encrypted := object.get("sops"); encrypted {
+				return nil, nil, errors.New("the file is SOPS-encrypted; decrypt it, migrate it and encrypt it again")
+			}
+		}
+		version, err := configDocumentVersion(document)
+		if err != nil {
+			return nil, nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+		if version > currentConfigVersion {
+			return nil, nil, fmt.Errorf("document %d has version %d, newer than this relay supports (%d)", i+1, version, currentConfigVersion)
+		}
+		for _, migration := range configMigrations {
+			if migration.From != version {
+				continue
+			}
+			var applied []string
+			document, applied = migration.Apply(document)
+			for _, change := range applied {
+				if len(documents) > 1 {
+					change = fmt.Sprintf("document %d: %s", i+1, change)
+				}
+				changes = append(changes, change)
+			}
+			version++
+		}
+		documents[i] = document
+	}
+	if len(changes) == 0 {
+		return data, nil, nil
+	}
+
+	var migrated bytes.Buffer
+	for _, document := range documents {
+		writeOrderedJSON(&migrated, document, "")
+		migrated.WriteByte('\n')
+	}
+	return migrated.Bytes(), changes, nil
+}
+
+// decodeOrderedDocuments decodes the JSON documents of data, keeping the order
+// of object members
+func decodeOrderedDocuments(data []byte) ([]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var documents []interface{}
+	for {
+		document, err := decodeOrderedJSON(decoder)
+		if err == io.EOF {
+			return documents, nil
+		} else if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+}
+
+// decodeOrderedJSON decodes the next JSON value, with objects as jsonObject
+// and numbers as json.Number
+func decodeOrderedJSON(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		object := jsonObject{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, jsonField{Key: key.(string), Value: value})
+		}
+		_, err = decoder.Token()
+		return object, err
+	case '[':
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := decodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err = decoder.Token()
+		return array, err
+	}
+	return nil, fmt.Errorf("unexpected %v", delim)
+}
+
+// writeOrderedJSON writes value indented by two spaces per level
+func writeOrderedJSON(b *bytes.Buffer, value interface{}, indent string) {
+	switch v := value.(type) {
+	case jsonObject:
+		if len(v) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteString("{\n")
+		for i, field := range v {
+			b.WriteString(indent + "  ")
+			writeJSONString(b, field.Key)
+			b.WriteString(": ")
+			writeOrderedJSON(b, field.Value, indent+"  ")
+			if i < len(v)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(indent + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[\n")
+		for i, item := range v {
+			b.WriteString(indent + "  ")
+			writeOrderedJSON(b, item, indent+"  ")
+			if i < len(v)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(indent + "]")
+	case string:
+		writeJSONString(b, v)
+	case json.Number:
+		b.WriteString(v.String())
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	default:
+		b.WriteString("null")
+	}
+}
+
+// writeJSONString writes s as a JSON string without escaping HTML characters,
+// which are common in templates
+func writeJSONString(b *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	b.Truncate(b.Len() - 1) // Encode appends a newline
+}
+
+// sameRoutes checks that two configuration files define the same routes and
+// templates, ignoring includes, which are migrated separately
+func sameRoutes(before []byte, after []byte) error {
+	decode := func(data []byte) ([]configFile, error) {
+		documents, err := decodeConfigDocuments(data)
+		for i := range documents {
+			documents[i].Version = 0
+		}
+		return documents, err
+	}
+	beforeDocuments, err := decode(before)
+	if err != nil {
+		return err
+	}
+	afterDocuments, err := decode(after)
+	if err != nil {
+		return fmt.Errorf("migrated configuration is invalid: %w", err)
+	}
+	if !reflect.DeepEqual(beforeDocuments, afterDocuments) {
+		return errors.New("migrated configuration defines different routes")
+	}
+	return nil
+}
+
+// diffOp is a line of a diff: ' ' unchanged, '-' removed or '+' added
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// diffLines returns the shortest edit turning lines a into lines b
+func diffLines(a []string, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{kind: ' ', text: line})
+	}
+
+	// lcs[i][j] is the longest common subsequence of changedA[i:] and changedB[j:]
+	changedA, changedB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	lcs := make([][]int, len(changedA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(changedB)+1)
+	}
+	for i := len(changedA) - 1; i >= 0; i-- {
+		for j := len(changedB) - 1; j >= 0; j-- {
+			if changedA[i] == changedB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(changedA) && j < len(changedB) {
+		switch {
+		case changedA[i] == changedB[j]:
+			ops = append(ops, diffOp{kind: ' ', text: changedA[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{kind: '-', text: changedA[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', text: changedB[j]})
+			j++
+		}
+	}
+	for ; i < len(changedA); i++ {
+		ops = append(ops, diffOp{kind: '-', text: changedA[i]})
+	}
+	for ; j < len(changedB); j++ {
+		ops = append(ops, diffOp{kind: '+', text: changedB[j]})
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{kind: ' ', text: line})
+	}
+	return ops
+}
+
+// unifiedDiff renders the changes from before to after as a unified diff, or
+// an empty string when they are equal
+func unifiedDiff(beforeName string, afterName string, before []byte, after []byte) string {
+	ops := diffLines(splitLines(before), splitLines(after))
+
+	// lineA[k] and lineB[k] are the lines of before and after preceding ops[k]
+	lineA, lineB := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for k, op := range ops {
+		lineA[k+1], lineB[k+1] = lineA[k], lineB[k]
+		if op.kind != '+' {
+			lineA[k+1]++
+		}
+		if op.kind != '-' {
+			lineB[k+1]++
+		}
+	}
+
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		// Changes closer than twice the context share a hunk
+		last := first
+		for k := first; k < len(ops) && k-last <= 2*diffContextLines; k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			}
+		}
+		hunkStart, hunkEnd := max(first-diffContextLines, start), min(last+diffContextLines+1, len(ops))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", beforeName, afterName)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(lineA[hunkStart], lineA[hunkEnd]), hunkRange(lineB[hunkStart], lineB[hunkEnd]))
+		for _, op := range ops[hunkStart:hunkEnd] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			out.WriteByte('\n')
+		}
+		start = hunkEnd
+	}
+	return out.String()
+}
+
+// hunkRange formats the lines from (exclusive) and to (inclusive) of a hunk header
+func hunkRange(from int, to int) string {
+	if to-from == 1 {
+		return strconv.Itoa(from + 1)
+	}
+	if to == from {
+		return fmt.Sprintf("%d,0", from)
+	}
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
+
+// splitLines splits data into lines without their line endings
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// runMigrateConfigCommand upgrades a configuration file to the newest schema,
+// printing the changes and a diff, and rewriting the file with -write
+func runMigrateConfigCommand(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("migrate-config", flag.ContinueOnError)
+	configPath := flags.String("config", "", "config file to migrate (default: CONFIG_FILE or config.json)")
+	write := flags.Bool("write", false, "rewrite the file instead of only printing the diff")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	path, _ := configFileFromEnv()
+	if *configPath != "" {
+		path = *configPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading configuration file '%s': %v\n", path, err)
+		return 1
+	}
+	migrated, changes, err := migrateConfig(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error migrating configuration file '%s': %v\n", path, err)
+		return 1
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(stdout, "%s is already at version %d\n", path, currentConfigVersion)
+		return 0
+	}
+	if err := sameRoutes(data, migrated); err != nil {
+		fmt.Fprintf(os.Stderr, "Error migrating configuration file '%s': %v\n", path, err)
+		return 1
+	}
+
+	for _, change := range changes {
+		fmt.Fprintf(os.Stderr, "- %s\n", change)
+	}
+	fmt.Fprint(stdout, unifiedDiff(path, path+" (migrated)", data, migrated))
+	if !*write {
+		return 0
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing configuration file '%s': %v\n", path, err)
+		return 1
+	}
+	if err := os.WriteFile(path, migrated, info.Mode().Perm()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing configuration file '%s': %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Migrated %s to version %d\n", path, currentConfigVersion)
+	return 0
+}
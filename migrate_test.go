@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	data := []byte(`[
+  {"slack-event-type": "message", "channel": "slack-messages", "heartbeat": 300000000000, "stale": {"max-age": 5400000000000, "action": "drop"}},
+  {"slack-event-type": "app_mention", "channel": "<mentions>"}
+]
+`)
+	migrated, changes, err := migrateConfig(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{
+  "version": 2,
+  "routes": [
+    {
+      "slack-event-type": "message",
+      "channel": "slack-messages",
+      "heartbeat": "5m",
+      "stale": {
+        "max-age": "1h30m",
+        "action": "drop"
+      }
+    },
+    {
+      "slack-event-type": "app_mention",
+      "channel": "<mentions>"
+    }
+  ]
+}
+`
+	if string(migrated) != expected {
+		t.Errorf("unexpected migrated config:\n%s", migrated)
+	}
+	if len(changes) != 4 || changes[2] != `route 1 (message): heartbeat 300000000000 -> "5m"` {
+		t.Errorf("unexpected changes %q", changes)
+	}
+	if err := sameRoutes(data, migrated); err != nil {
+		t.Errorf("expected the migrated config to define the same routes: %v", err)
+	}
+
+	// Current files are left alone
+	again, changes, err := migrateConfig(migrated)
+	if err != nil || len(changes) != 0 || string(again) != string(migrated) {
+		t.Errorf("expected a current config to be unchanged, got %q, %v", changes, err)
+	}
+}
+
+func TestMigrateConfigRejects(t *testing.T) {
+	cases := map[string]string{
+		"newer version": `{"version": 3, "routes": []}`,
+		"encrypted":     `{"routes": "ENC[AES256_GCM,data:abc]", "sops": {"version": "3.8.1"}}`,
+		"empty":         ``,
+		"invalid":       `[{"slack-event-type": }]`,
+	}
+	for name, data := range cases {
+		if _, _, err := migrateConfig([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseConfigRejectsNewerVersion(t *testing.T) {
+	if _, err := parseEventConfig([]byte(`{"version": 99, "routes": []}`)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("expected a newer version to be rejected, got %v", err)
+	}
+	if routes, err := parseEventConfig([]byte(`{"version": 2, "routes": [{"slack-event-type": "message", "channel": "c"}]}`)); err != nil || len(routes) != 1 {
+		t.Errorf("expected a current config to load, got %v, %v", routes, err)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	before := []byte("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n")
+	after := []byte("a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n")
+	expected := "--- old\n+++ new\n" +
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+		"@@ -8,3 +8,4 @@\n h\n i\n j\n+k\n"
+	if diff := unifiedDiff("old", "new", before, after); diff != expected {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+	if diff := unifiedDiff("old", "new", before, before); diff != "" {
+		t.Errorf("expected no diff for equal files, got %q", diff)
+	}
+}
+
+func TestRunMigrateConfigCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`[{"slack-event-type": "message", "channel": "slack-messages"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if code := runMigrateConfigCommand([]string{"-config", path}, &out); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if !strings.Contains(out.String(), `+  "version": 2,`) {
+		t.Errorf("expected a diff, got:\n%s", out.String())
+	}
+	if data, _ := os.ReadFile(path); !strings.HasPrefix(string(data), "[") {
+		t.Error("expected the file to be left alone without -write")
+	}
+
+	out.Reset()
+	if code := runMigrateConfigCommand([]string{"-config", path, "-write"}, &out); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	data, _ := os.ReadFile(path)
+	if routes, err := parseEventConfig(data); err != nil || len(routes) != 1 || !strings.Contains(string(data), `"version": 2`) {
+		t.Errorf("expected the migrated file to load, got %v, %v", routes, err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Emoji shortcode handling of text normalization
+const (
+	emojiExpand = "expand"
+	emojiStrip  = "strip"
+)
+
+// emojiShortcodePattern matches Slack emoji shortcodes such as :tada: or
+// :skin-tone-2:, with the space before them
+var emojiShortcodePattern = regexp.MustCompile(` ?:[a-z0-9_+'-]+:`)
+
+// emojiShortcodes maps the most common Slack emoji shortcodes to their Unicode
+// characters. Other shortcodes, including custom emoji, are left as they are
+// when expanding.
+var emojiShortcodes = map[string]string{
+	"+1": "👍", "thumbsup": "👍", "-1": "👎", "thumbsdown": "👎",
+	"smile": "😄", "smiley": "😃", "grinning": "😀", "grin": "😁", "joy": "😂",
+	"laughing": "😆", "sweat_smile": "😅", "slightly_smiling_face": "🙂", "wink": "😉",
+	"blush": "😊", "heart_eyes": "😍", "thinking_face": "🤔", "neutral_face": "😐",
+	"confused": "😕", "cry": "😢", "sob": "😭", "scream": "😱", "rage": "😡",
+	"sunglasses": "😎", "upside_down_face": "🙃", "face_palm": "🤦", "shrug": "🤷",
+	"wave": "👋", "clap": "👏", "pray": "🙏", "raised_hands": "🙌", "muscle": "💪",
+	"ok_hand": "👌", "point_up": "☝️", "point_right": "👉", "eyes": "👀",
+	"heart": "❤️", "broken_heart": "💔", "sparkles": "✨", "star": "⭐", "fire": "🔥",
+	"tada": "🎉", "rocket": "🚀", "100": "💯", "boom": "💥", "zap": "⚡",
+	"white_check_mark": "✅", "heavy_check_mark": "✔️", "x": "❌", "warning": "⚠️",
+	"no_entry": "⛔", "question": "❓", "exclamation": "❗", "bulb": "💡",
+	"memo": "📝", "pushpin": "📌", "link": "🔗", "lock": "🔒", "key": "🔑",
+	"bell": "🔔", "calendar": "📆", "hourglass": "⌛", "stopwatch": "⏱️",
+	"bug": "🐛", "wrench": "🔧", "hammer": "🔨", "gear": "⚙️", "package": "📦",
+	"chart_with_upwards_trend": "📈", "chart_with_downwards_trend": "📉",
+	"coffee": "☕", "beers": "🍻", "pizza": "🍕", "cake": "🍰",
+	"red_circle": "🔴", "large_green_circle": "🟢", "large_yellow_circle": "🟡",
+	"skin-tone-2": "\U0001F3FB", "skin-tone-3": "\U0001F3FC", "skin-tone-4": "\U0001F3FD",
+	"skin-tone-5": "\U0001F3FE", "skin-tone-6": "\U0001F3FF",
+}
+
+// TextNormalization configures the normalization of event.text before a
+// route's events are published, for consumers such as search indexers that
+// cannot handle raw Slack text variants
+type TextNormalization struct {
+	// NFC normalizes the text to Unicode Normalization Form C
+	NFC bool `json:"nfc,omitempty"`
+	// Emoji expands emoji shortcodes to Unicode characters (expand) or removes
+	// them (strip)
+	Emoji string `json:"emoji,omitempty"`
+	// StripControl removes control characters other than newlines and tabs
+	StripControl bool `json:"strip-control,omitempty"`
+}
+
+// enabled reports whether the route normalizes text
+func (n TextNormalization) enabled() bool {
+	return n.NFC || n.Emoji != "" || n.StripControl
+}
+
+// validateTextNormalization checks the emoji option of every route's text normalization
+func validateTextNormalization(configs []EventConfig) error {
+	for _, config := range configs {
+		if emoji := config.NormalizeText.Emoji; emoji != "" && emoji != emojiExpand && emoji != emojiStrip {
+			return fmt.Errorf("route '%s' has invalid emoji normalization '%s', expected expand or strip", config.EventType, emoji)
+		}
+	}
+	return nil
+}
+
+// normalize returns text normalized: control characters are removed first, then
+// emoji shortcodes are expanded or stripped, and the result is put in NFC
+func (n TextNormalization) normalize(text string) string {
+	if n.StripControl {
+		text = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) && r != '\n' && r != '\t' {
+				return -1
+			}
+			return r
+		}, text)
+	}
+	switch n.Emoji {
+	case emojiExpand:
+		text = emojiShortcodePattern.ReplaceAllStringFunc(text, func(match string) string {
+			name := strings.Trim(match, " :")
+			if emoji, ok := emojiShortcodes[name]; ok {
+				return strings.TrimSuffix(match, ":"+name+":") + emoji
+			}
+			return match
+		})
+	case emojiStrip:
+		text = strings.TrimSpace(emojiShortcodePattern.ReplaceAllString(text, ""))
+	}
+	if n.NFC {
+		text = norm.NFC.String(text)
+	}
+	return text
+}
+
+// normalizedPayload returns a copy of payload with its event's text normalized.
+// It reports false, returning payload itself, when the payload has no event
+// text or normalizing leaves it unchanged.
+func normalizedPayload(payload map[string]interface{}, normalization TextNormalization) (map[string]interface{}, bool) {
+	event, ok := payload["event"].(map[string]interface{})
+	if !ok {
+		return payload, false
+	}
+	text, ok := event["text"].(string)
+	if !ok {
+		return payload, false
+	}
+	normalized := normalization.normalize(text)
+	if normalized == text {
+		return payload, false
+	}
+
+	eventCopy := make(map[string]interface{}, len(event))
+	for key, value := range event {
+		eventCopy[key] = value
+	}
+	eventCopy["text"] = normalized
+	payloadCopy := make(map[string]interface{}, len(payload))
+	for key, value := range payload {
+		payloadCopy[key] = value
+	}
+	payloadCopy["event"] = eventCopy
+	return payloadCopy, true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTextNormalization(t *testing.T) {
+	for _, tt := range []struct {
+		normalization TextNormalization
+		text          string
+		expected      string
+	}{
+		{TextNormalization{NFC: true}, "café", "café"},
+		{TextNormalization{Emoji: emojiExpand}, "shipped :tada: :thumbsup::skin-tone-3: :party-parrot:", "shipped 🎉 👍\U0001F3FC :party-parrot:"},
+		{TextNormalization{Emoji: emojiStrip}, ":wave: hello :party-parrot: there", "hello there"},
+		{TextNormalization{StripControl: true}, "line\u0000 one\nline\ttwo\u001b", "line one\nline\ttwo"},
+		{TextNormalization{}, "café :tada:", "café :tada:"},
+		// Times are not shortcodes
+		{TextNormalization{Emoji: emojiStrip}, "at 10:30", "at 10:30"},
+	} {
+		if got := tt.normalization.normalize(tt.text); got != tt.expected {
+			t.Errorf("%+v: expected %q, got %q", tt.normalization, tt.expected, got)
+		}
+	}
+}
+
+func TestRouteNormalizesText(t *testing.T) {
+	defer setupTestEnvironment()
+
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "search", NormalizeText: TextNormalization{NFC: true, Emoji: emojiStrip}}})
+	payload := map[string]interface{}{
+		"type":  "event_callback",
+		"event": map[string]interface{}{"type": "message", "text": "café :coffee:", "user": "U1"},
+	}
+	raw, _ := json.Marshal(payload)
+	routed := routeEvent(payload, raw)
+
+	var published map[string]interface{}
+	if err := json.Unmarshal(routed.Payload, &published); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	event := published["event"].(map[string]interface{})
+	if event["text"] != "café" || event["user"] != "U1" {
+		t.Errorf("expected normalized text, got %v", event)
+	}
+	if payload["event"].(map[string]interface{})["text"] != "café :coffee:" {
+		t.Error("expected the received payload to be left unchanged")
+	}
+}
+
+func TestValidateTextNormalization(t *testing.T) {
+	if err := validateTextNormalization([]EventConfig{{EventType: "message", NormalizeText: TextNormalization{Emoji: "remove"}}}); err == nil {
+		t.Error("expected an invalid emoji option to be rejected")
+	}
+	if err := validateTextNormalization([]EventConfig{{EventType: "message", NormalizeText: TextNormalization{Emoji: emojiExpand}}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
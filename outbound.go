@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations of outbound messages, selected with their op field
+const (
+	outboundOpSchedule = "schedule"
+	outboundOpUpdate   = "update"
+	outboundOpDelete   = "delete"
+	outboundOpReact    = "react"
+	outboundOpUnreact  = "unreact"
+	outboundOpPin      = "pin"
+	outboundOpUnpin    = "unpin"
+	outboundOpUpload   = "upload"
+	outboundOpApproval = "approval"
+	outboundOpUnfurl   = "unfurl"
+)
+
+// Outcomes of outbound messages shared by every operation
+const (
+	outboundResultFailed  = "failed"
+	outboundResultDropped = "dropped"
+	outboundResultInvalid = "invalid"
+)
+
+const (
+	// outboundTimeout bounds performing an outbound message other than an upload,
+	// including waits for Slack's rate limits
+	outboundTimeout = time.Minute
+	// defaultOutboundQueueSize caps the messages queued per workspace and operation
+	defaultOutboundQueueSize = 1000
+	// outboundQueueMetric is the name of the outbound queue depth gauge
+	outboundQueueMetric = "slack_relay_outbound_queue_depth"
+)
+
+var metricOutboundMessages = newCounterVec("slack_relay_outbound_messages_total",
+	"Messages received on the outbound channel, by operation and result.", "op", "result")
+
+// outboundOperation is an outbound operation performed with a single Slack API call
+type outboundOperation struct {
+	// Method is the Slack Web API method called
+	Method string
+	// Required are the arguments the method needs
+	Required []string
+	// Result is the outcome reported when the call succeeds
+	Result string
+	// AlreadyDone are the Slack errors meaning the operation had already been
+	// performed, which are reported as successes so retries are harmless
+	AlreadyDone []string
+}
+
+// outboundOperations are the outbound operations other than schedule, by op
+var outboundOperations = map[string]outboundOperation{
+	outboundOpUpdate:  {Method: "chat.update", Required: []string{"channel", "ts"}, Result: "updated"},
+	outboundOpDelete:  {Method: "chat.delete", Required: []string{"channel", "ts"}, Result: "deleted"},
+	outboundOpReact:   {Method: "reactions.add", Required: []string{"channel", "timestamp", "name"}, Result: "reacted", AlreadyDone: []string{"already_reacted"}},
+	outboundOpUnreact: {Method: "reactions.remove", Required: []string{"channel", "timestamp", "name"}, Result: "unreacted", AlreadyDone: []string{"no_reaction"}},
+	outboundOpPin:     {Method: "pins.add", Required: []string{"channel", "timestamp"}, Result: "pinned", AlreadyDone: []string{"already_pinned"}},
+	outboundOpUnpin:   {Method: "pins.remove", Required: []string{"channel", "timestamp"}, Result: "unpinned", AlreadyDone: []string{"no_pin"}},
+	outboundOpUnfurl:  {Method: "chat.unfurl", Required: []string{"unfurls"}, Result: "unfurled"},
+}
+
+// outboundMessage is a message received on the outbound channel, asking the
+// relay to act on Slack with its bot token
+type outboundMessage struct {
+	// Op is the operation, schedule by default
+	Op string
+	// PostAt is when a scheduled message is posted
+	PostAt time.Time
+	// Params are the Slack API arguments, e.g. channel, ts, text and blocks
+	Params url.Values
+}
+
+// parseOutboundMessage decodes a message received on the outbound channel: an
+// optional op plus the Slack API arguments of the operation, optionally filled
+// in from a message template. Scheduled messages also have post_at, as Unix
+// seconds or an RFC 3339 time. Values that are not strings, such as blocks, are
+// passed to Slack JSON encoded.
+func parseOutboundMessage(data []byte) (outboundMessage, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return outboundMessage{}, err
+	}
+
+	message := outboundMessage{Op: outboundOpSchedule}
+	if op, ok := fields["op"].(string); ok {
+		message.Op = op
+	}
+	delete(fields, "op")
+
+	// Fill in the fields of a named message template rendered with data. Fields
+	// of the message itself take precedence.
+	if name, ok := fields["template"].(string); ok {
+		rendered, err := renderMessageTemplate(name, fields["data"])
+		if err != nil {
+			return message, err
+		}
+		for key, value := range rendered {
+			if _, ok := fields[key]; !ok {
+				fields[key] = value
+			}
+		}
+	}
+	delete(fields, "template")
+	delete(fields, "data")
+
+	var required []string
+	if message.Op == outboundOpSchedule {
+		postAt, err := parsePostAt(fields["post_at"])
+		if err != nil {
+			return message, err
+		}
+		message.PostAt = postAt
+		delete(fields, "post_at")
+		required = []string{"channel"}
+	} else if _, ok := fields["post_at"]; ok {
+		return message, fmt.Errorf("post_at does not apply to op %s", message.Op)
+	} else if message.Op == outboundOpUpload {
+		required = []string{"channel", "filename"}
+	} else if message.Op == outboundOpApproval {
+		required = []string{"channel", "request_id"}
+	} else if operation, ok := outboundOperations[message.Op]; ok {
+		required = operation.Required
+	} else {
+		return message, fmt.Errorf("unknown op %q", message.Op)
+	}
+
+	params := url.Values{}
+	for key, value := range fields {
+		switch v := value.(type) {
+		case string:
+			params.Set(key, v)
+		case nil:
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return message, err
+			}
+			params.Set(key, string(encoded))
+		}
+	}
+	for _, name := range required {
+		if params.Get(name) == "" {
+			return message, fmt.Errorf("%s is required for op %s", name, message.Op)
+		}
+	}
+	if message.Op == outboundOpUpload {
+		if err := validateUploadSource(params); err != nil {
+			return message, err
+		}
+	}
+	if message.Op == outboundOpApproval && params.Get("text") == "" && params.Get("blocks") == "" {
+		return message, errors.New("text or blocks is required for op approval")
+	}
+	if message.Op == outboundOpUnfurl && (params.Get("channel") == "" || params.Get("ts") == "") &&
+		(params.Get("unfurl_id") == "" || params.Get("source") == "") {
+		return message, errors.New("channel and ts, or unfurl_id and source, are required for op unfurl")
+	}
+	message.Params = params
+	return message, nil
+}
+
+// parsePostAt reads post_at as Unix seconds, a string of Unix seconds or an RFC 3339 time
+func parsePostAt(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case float64:
+		return time.Unix(int64(v), 0), nil
+	case string:
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(seconds, 0), nil
+		}
+		postAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid post_at %q: expected Unix seconds or an RFC 3339 time", v)
+		}
+		return postAt, nil
+	case nil:
+		return time.Time{}, errors.New("post_at is required")
+	}
+	return time.Time{}, fmt.Errorf("invalid post_at %v", value)
+}
+
+// handleOutboundMessage performs an outbound message's operation, handing
+// scheduled messages to s. It returns the outcome.
+func handleOutboundMessage(ctx context.Context, s *messageScheduler, message outboundMessage, now time.Time) string {
+	switch message.Op {
+	case outboundOpSchedule:
+		return s.submit(ctx, scheduledMessage{PostAt: message.PostAt, Params: message.Params}, now)
+	case outboundOpUpload:
+		return uploadFile(ctx, message.Params)
+	case outboundOpApproval:
+		return requestApproval(ctx, message.Params)
+	}
+
+	operation := outboundOperations[message.Op]
+	channel, ts := message.Params.Get("channel"), message.Params.Get("ts")
+	if ts == "" {
+		ts = message.Params.Get("timestamp")
+	}
+	err := callSlackBotAPI(ctx, operation.Method, message.Params, nil)
+	if err != nil && !operation.alreadyDone(err) {
+		logWarn("Error calling %s for message %s in '%s': %v", operation.Method, ts, channel, err)
+		return outboundResultFailed
+	}
+	logInfo("Called %s for message %s in '%s'", operation.Method, ts, channel)
+	return operation.Result
+}
+
+// alreadyDone reports whether err is a Slack error meaning the operation had
+// already been performed
+func (o outboundOperation) alreadyDone(err error) bool {
+	for _, code := range o.AlreadyDone {
+		if strings.HasSuffix(err.Error(), " error: "+code) {
+			return true
+		}
+	}
+	return false
+}
+
+// outboundLane is the queue of one operation's messages for one workspace
+type outboundLane struct {
+	team  string
+	op    string
+	queue chan outboundMessage
+}
+
+// outboundDispatcher queues outbound messages by workspace and operation, so a
+// rate limited operation only delays its own messages. Each queue is worked in
+// order by its own goroutine.
+type outboundDispatcher struct {
+	mu        sync.Mutex
+	lanes     map[string]*outboundLane
+	queueSize int
+	scheduler *messageScheduler
+}
+
+// outbound dispatches messages received on the outbound channel; nil unless OUTBOUND_CHANNEL is set
+var outbound *outboundDispatcher
+
+func init() {
+	metricsRegistry = append(metricsRegistry, outboundQueueCollector{})
+}
+
+// newOutboundDispatcher returns a dispatcher queueing up to queueSize messages
+// per workspace and operation, handing scheduled messages to s
+func newOutboundDispatcher(queueSize int, s *messageScheduler) *outboundDispatcher {
+	return &outboundDispatcher{lanes: make(map[string]*outboundLane), queueSize: queueSize, scheduler: s}
+}
+
+// dispatch queues message for its workspace and operation, starting the queue's
+// worker on first use. It reports false when the queue is full.
+func (d *outboundDispatcher) dispatch(ctx context.Context, message outboundMessage) bool {
+	team := message.Params.Get("team_id")
+	key := team + "/" + message.Op
+
+	d.mu.Lock()
+	lane, ok := d.lanes[key]
+	if !ok {
+		lane = &outboundLane{team: team, op: message.Op, queue: make(chan outboundMessage, d.queueSize)}
+		d.lanes[key] = lane
+		go d.work(ctx, lane)
+	}
+	d.mu.Unlock()
+
+	select {
+	case lane.queue <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// work performs the messages queued in lane until ctx is cancelled
+func (d *outboundDispatcher) work(ctx context.Context, lane *outboundLane) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message := <-lane.queue:
+			timeout := outboundTimeout
+			if message.Op == outboundOpUpload {
+				timeout = uploadTimeout
+			}
+			handleCtx, cancel := context.WithTimeout(ctx, timeout)
+			metricOutboundMessages.Inc(message.Op, handleOutboundMessage(handleCtx, d.scheduler, message, clock.Now()))
+			cancel()
+		}
+	}
+}
+
+// outboundQueueCollector exports the depth of every outbound queue
+type outboundQueueCollector struct{}
+
+// writeMetrics writes one series per outbound queue
+func (outboundQueueCollector) writeMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", outboundQueueMetric,
+		"Outbound messages waiting to be performed, by workspace and operation.", outboundQueueMetric)
+	if outbound == nil {
+		return
+	}
+	outbound.mu.Lock()
+	keys := make([]string, 0, len(outbound.lanes))
+	for key := range outbound.lanes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lanes := make([]*outboundLane, len(keys))
+	for i, key := range keys {
+		lanes[i] = outbound.lanes[key]
+	}
+	outbound.mu.Unlock()
+
+	for _, lane := range lanes {
+		fmt.Fprintf(w, "%s%s %d\n", outboundQueueMetric, formatLabels([]string{"team_id", "op"}, []string{teamLabel(lane.team), lane.op}), len(lane.queue))
+	}
+}
+
+// runOutboundConsumer subscribes to the outbound channel and dispatches every
+// message received until ctx is cancelled
+func runOutboundConsumer(ctx context.Context, channel string, d *outboundDispatcher) error {
+	if redisClient == nil {
+		return errRedisUnavailable
+	}
+
+	pubsub := redisClient.Subscribe(ctx, channel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case received, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			message, err := parseOutboundMessage([]byte(received.Payload))
+			if err != nil {
+				logWarn("Ignoring invalid message on outbound channel '%s': %v", channel, err)
+				metricOutboundMessages.Inc(outboundOpLabel(message.Op), outboundResultInvalid)
+				continue
+			}
+			if !d.dispatch(ctx, message) {
+				logWarn("Outbound queue for op %s full, dropping message to '%s'", message.Op, message.Params.Get("channel"))
+				metricOutboundMessages.Inc(message.Op, outboundResultDropped)
+			}
+		}
+	}
+}
+
+// outboundOpLabel bounds the op label of invalid messages to the known operations
+func outboundOpLabel(op string) string {
+	switch op {
+	case outboundOpSchedule, outboundOpUpload, outboundOpApproval:
+		return op
+	}
+	if _, ok := outboundOperations[op]; ok {
+		return op
+	}
+	return "unknown"
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseOutboundMessage(t *testing.T) {
+	message, err := parseOutboundMessage([]byte(`{"channel":"C123","text":"Standup in 5","post_at":1700000000,"blocks":[{"type":"section"}],"unfurl_links":false}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if message.Op != outboundOpSchedule || !message.PostAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("expected a message scheduled at 1700000000, got %s at %v", message.Op, message.PostAt)
+	}
+	if message.Params.Get("channel") != "C123" || message.Params.Get("text") != "Standup in 5" {
+		t.Errorf("expected channel and text params, got %v", message.Params)
+	}
+	if message.Params.Get("blocks") != `[{"type":"section"}]` || message.Params.Get("unfurl_links") != "false" {
+		t.Errorf("expected JSON encoded params, got %v", message.Params)
+	}
+	if message.Params.Has("post_at") {
+		t.Error("expected post_at not to be passed as a param")
+	}
+
+	message, err = parseOutboundMessage([]byte(`{"channel":"C123","text":"hi","post_at":"2030-01-02T15:04:05Z"}`))
+	if err != nil || !message.PostAt.Equal(time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("expected an RFC 3339 post_at, got %v, %v", message.PostAt, err)
+	}
+
+	message, err = parseOutboundMessage([]byte(`{"op":"update","channel":"C123","ts":"1700000000.000100","text":"Deploy 60%"}`))
+	if err != nil || message.Op != outboundOpUpdate || message.Params.Get("ts") != "1700000000.000100" || message.Params.Has("op") {
+		t.Errorf("expected an update of the message, got %+v, %v", message, err)
+	}
+
+	for _, data := range []string{
+		`{"channel":"C123","text":"hi"}`,
+		`{"channel":"C123","text":"hi","post_at":"tomorrow"}`,
+		`{"text":"hi","post_at":1700000000}`,
+		`{"op":"update","channel":"C123","text":"hi"}`,
+		`{"op":"delete","channel":"C123","ts":"1700000000.000100","post_at":1700000000}`,
+		`{"op":"archive","channel":"C123"}`,
+		`not json`,
+	} {
+		if _, err := parseOutboundMessage([]byte(data)); err == nil {
+			t.Errorf("expected %s to be invalid", data)
+		}
+	}
+}
+
+func TestHandleOutboundMessage(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		calls = append(calls, r.URL.Path+" "+r.Form.Get("channel")+" "+r.Form.Get("ts"))
+		if r.Form.Get("ts") == "1.000002" {
+			w.Write([]byte(`{"ok":false,"error":"message_not_found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+	originalURL := slackAPIBaseURL
+	slackAPIBaseURL = server.URL + "/"
+	defer func() { slackAPIBaseURL = originalURL }()
+	slackBotToken = "xoxb-test"
+	defer func() { slackBotToken = "" }()
+	unlimitedSlackCalls(t)
+
+	s := newMessageScheduler(10)
+	for _, test := range []struct {
+		data     string
+		expected string
+	}{
+		{`{"op":"update","channel":"C1","ts":"1.000001","text":"Deploy done"}`, "updated"},
+		{`{"op":"delete","channel":"C1","ts":"1.000001"}`, "deleted"},
+		{`{"op":"delete","channel":"C1","ts":"1.000002"}`, outboundResultFailed},
+		{`{"channel":"C1","text":"now","post_at":0}`, scheduleResultPosted},
+	} {
+		message, err := parseOutboundMessage([]byte(test.data))
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s: %v", test.data, err)
+		}
+		if result := handleOutboundMessage(context.Background(), s, message, time.Now()); result != test.expected {
+			t.Errorf("expected %s for %s, got %s", test.expected, test.data, result)
+		}
+	}
+
+	expected := []string{"/chat.update C1 1.000001", "/chat.delete C1 1.000001", "/chat.delete C1 1.000002", "/chat.postMessage C1 "}
+	if len(calls) != len(expected) {
+		t.Fatalf("expected calls %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("expected call %q, got %q", expected[i], calls[i])
+		}
+	}
+}
+
+func TestHandleOutboundReactionsAndPins(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		calls = append(calls, r.URL.Path+" "+r.Form.Get("timestamp")+" "+r.Form.Get("name"))
+		switch r.Form.Get("timestamp") {
+		case "1.000002":
+			w.Write([]byte(`{"ok":false,"error":"already_reacted"}`))
+		case "1.000003":
+			w.Write([]byte(`{"ok":false,"error":"not_pinnable"}`))
+		default:
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer server.Close()
+	originalURL := slackAPIBaseURL
+	slackAPIBaseURL = server.URL + "/"
+	defer func() { slackAPIBaseURL = originalURL }()
+	slackBotToken = "xoxb-test"
+	defer func() { slackBotToken = "" }()
+	unlimitedSlackCalls(t)
+
+	for _, test := range []struct {
+		data     string
+		expected string
+		call     string
+	}{
+		{`{"op":"react","channel":"C1","timestamp":"1.000001","name":"eyes"}`, "reacted", "/reactions.add 1.000001 eyes"},
+		{`{"op":"react","channel":"C1","timestamp":"1.000002","name":"eyes"}`, "reacted", "/reactions.add 1.000002 eyes"},
+		{`{"op":"unreact","channel":"C1","timestamp":"1.000001","name":"eyes"}`, "unreacted", "/reactions.remove 1.000001 eyes"},
+		{`{"op":"pin","channel":"C1","timestamp":"1.000001"}`, "pinned", "/pins.add 1.000001 "},
+		{`{"op":"pin","channel":"C1","timestamp":"1.000003"}`, outboundResultFailed, "/pins.add 1.000003 "},
+		{`{"op":"unpin","channel":"C1","timestamp":"1.000001"}`, "unpinned", "/pins.remove 1.000001 "},
+	} {
+		calls = nil
+		message, err := parseOutboundMessage([]byte(test.data))
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s: %v", test.data, err)
+		}
+		if result := handleOutboundMessage(context.Background(), newMessageScheduler(10), message, time.Now()); result != test.expected {
+			t.Errorf("expected %s for %s, got %s", test.expected, test.data, result)
+		}
+		if len(calls) != 1 || calls[0] != test.call {
+			t.Errorf("expected call %q for %s, got %v", test.call, test.data, calls)
+		}
+	}
+
+	if _, err := parseOutboundMessage([]byte(`{"op":"react","channel":"C1","timestamp":"1.000001"}`)); err == nil {
+		t.Error("expected a reaction without a name to be invalid")
+	}
+}
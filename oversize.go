@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Actions taken when a payload exceeds its route's max-payload-size
+const (
+	oversizeSummarize = "summarize"
+	oversizeTruncate  = "truncate"
+	oversizeRoute     = "route"
+)
+
+// defaultOversizeChannel is the channel receiving oversize events with the route action
+const defaultOversizeChannel = "large-events"
+
+// summaryEventFields are the event fields kept in the summary of an oversize
+// event, and never removed when truncating one
+var summaryEventFields = []string{"type", "subtype", "channel", "channel_type", "user", "ts", "thread_ts", "event_ts"}
+
+// summaryPayloadFields are the top-level fields kept in the summary of an
+// oversize event
+var summaryPayloadFields = []string{"type", "team_id", "api_app_id", "event_id", "event_time", "enterprise_id", "is_ext_shared_channel"}
+
+var metricOversizeEvents = newCounterVec("slack_relay_oversize_events_total",
+	"Events larger than their route's max-payload-size, by event type and action.", "event_type", "action")
+
+// validateOversizeActions checks the payload size limit and oversize action of
+// every route
+func validateOversizeActions(configs []EventConfig) error {
+	for _, config := range configs {
+		if config.MaxPayloadSize < 0 {
+			return fmt.Errorf("route '%s' has negative max-payload-size %d", config.EventType, config.MaxPayloadSize)
+		}
+		switch config.OversizeAction {
+		case "", oversizeSummarize, oversizeTruncate, oversizeRoute:
+		default:
+			return fmt.Errorf("route '%s' has invalid oversize-action '%s', expected summarize, truncate or route", config.EventType, config.OversizeAction)
+		}
+		if config.OversizeChannel != "" && config.OversizeAction != oversizeRoute {
+			return fmt.Errorf("route '%s' has oversize-channel, which only applies to the route oversize-action", config.EventType)
+		}
+	}
+	return nil
+}
+
+// limitPayloadSize applies the route's oversize action when the routed payload
+// is larger than its max-payload-size. relayMetadata holds the metadata already
+// attached to the payload.
+func limitPayloadSize(routed *routedEvent, payload map[string]interface{}, relayMetadata map[string]interface{}) {
+	config := routed.Config
+	size := len(routed.Payload)
+	if config.MaxPayloadSize <= 0 || size <= config.MaxPayloadSize {
+		return
+	}
+
+	action := config.OversizeAction
+	if action == "" {
+		action = oversizeSummarize
+	}
+	metricOversizeEvents.Inc(eventTypeLabel(routed.EventType), action)
+	logWarn("Event type '%s' payload is %d bytes, above the route limit of %d; applying action '%s'",
+		routed.EventType, size, config.MaxPayloadSize, action)
+
+	oversize := map[string]interface{}{
+		"original_size": size,
+		"max_size":      config.MaxPayloadSize,
+		"action":        action,
+	}
+	metadata := make(map[string]interface{}, len(relayMetadata)+1)
+	for key, value := range relayMetadata {
+		metadata[key] = value
+	}
+	metadata["oversize"] = oversize
+
+	var limited []byte
+	var err error
+	switch action {
+	case oversizeRoute:
+		routed.Config.Channel = config.OversizeChannel
+		if routed.Config.Channel == "" {
+			routed.Config.Channel = defaultOversizeChannel
+		}
+		return
+	case oversizeTruncate:
+		limited, err = truncatePayload(payload, metadata, oversize, config.MaxPayloadSize)
+	default:
+		limited, err = summarizePayload(payload, metadata, oversize)
+	}
+	if err != nil {
+		logError("Error limiting oversize payload: %v", err)
+		return
+	}
+	routed.Payload = limited
+}
+
+// truncatePayload removes the largest fields of the event (or of the payload
+// itself for payloads without an event) until the encoded payload fits in max
+// bytes. The removed fields are listed in the oversize metadata.
+func truncatePayload(payload map[string]interface{}, metadata map[string]interface{}, oversize map[string]interface{}, max int) ([]byte, error) {
+	truncated := make(map[string]interface{}, len(payload))
+	for key, value := range payload {
+		truncated[key] = value
+	}
+	target := truncated
+	protected := map[string]bool{"type": true}
+	if event, ok := payload["event"].(map[string]interface{}); ok {
+		target = make(map[string]interface{}, len(event))
+		for key, value := range event {
+			target[key] = value
+		}
+		truncated["event"] = target
+		for _, field := range summaryEventFields {
+			protected[field] = true
+		}
+	} else {
+		for _, field := range summaryPayloadFields {
+			protected[field] = true
+		}
+	}
+
+	removed := []string{}
+	for {
+		oversize["removed_fields"] = removed
+		data, err := withRelayMetadata(truncated, metadata)
+		if err != nil || len(data) <= max {
+			return data, err
+		}
+
+		largest, largestSize := "", 0
+		for key, size := range fieldSizes(target) {
+			if !protected[key] && (size > largestSize || (size == largestSize && key < largest)) {
+				largest, largestSize = key, size
+			}
+		}
+		if largest == "" {
+			// Nothing left to remove; publish the smallest payload we could build
+			return data, nil
+		}
+		delete(target, largest)
+		removed = append(removed, largest)
+	}
+}
+
+// summarizePayload replaces the payload with a summary holding its type, IDs and
+// the sizes of its fields
+func summarizePayload(payload map[string]interface{}, metadata map[string]interface{}, oversize map[string]interface{}) ([]byte, error) {
+	summary := make(map[string]interface{})
+	for _, field := range summaryPayloadFields {
+		if value, ok := payload[field]; ok {
+			summary[field] = value
+		}
+	}
+
+	if event, ok := payload["event"].(map[string]interface{}); ok {
+		eventSummary := make(map[string]interface{})
+		for _, field := range summaryEventFields {
+			if value, ok := event[field]; ok {
+				eventSummary[field] = value
+			}
+		}
+		summary["event"] = eventSummary
+		oversize["field_sizes"] = fieldSizes(event)
+	} else {
+		oversize["field_sizes"] = fieldSizes(payload)
+	}
+	oversize["summarized"] = true
+
+	return withRelayMetadata(summary, metadata)
+}
+
+// fieldSizes returns the encoded size in bytes of every field of object
+func fieldSizes(object map[string]interface{}) map[string]int {
+	sizes := make(map[string]int, len(object))
+	for key, value := range object {
+		data, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		sizes[key] = len(data)
+	}
+	return sizes
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// oversizePayload returns a message event whose text and blocks make it large
+func oversizePayload() (map[string]interface{}, []byte) {
+	raw := []byte(`{"type":"event_callback","team_id":"T1","event_id":"Ev1","event":{"type":"message","channel":"C1","user":"U1","ts":"1.0","text":"` +
+		strings.Repeat("a", 500) + `","blocks":[{"type":"section","text":"` + strings.Repeat("b", 1000) + `"}]}}`)
+	var payload map[string]interface{}
+	json.Unmarshal(raw, &payload)
+	return payload, raw
+}
+
+func TestLimitPayloadSizeSummarize(t *testing.T) {
+	payload, raw := oversizePayload()
+	routed := routedEvent{EventType: "message", Payload: raw, Config: EventConfig{Channel: "messages", MaxPayloadSize: 1000}}
+
+	limitPayloadSize(&routed, payload, map[string]interface{}{})
+
+	var summary map[string]interface{}
+	if err := json.Unmarshal(routed.Payload, &summary); err != nil {
+		t.Fatalf("summary is not valid JSON: %v", err)
+	}
+	event := summary["event"].(map[string]interface{})
+	if summary["event_id"] != "Ev1" || event["channel"] != "C1" || event["text"] != nil {
+		t.Errorf("unexpected summary: %s", routed.Payload)
+	}
+	oversize := summary[relayMetadataKey].(map[string]interface{})["oversize"].(map[string]interface{})
+	if oversize["original_size"] != float64(len(raw)) || oversize["action"] != oversizeSummarize {
+		t.Errorf("unexpected oversize metadata: %v", oversize)
+	}
+	if sizes := oversize["field_sizes"].(map[string]interface{}); sizes["text"] != float64(502) {
+		t.Errorf("expected text field size 502, got %v", sizes["text"])
+	}
+}
+
+func TestLimitPayloadSizeTruncate(t *testing.T) {
+	payload, raw := oversizePayload()
+	routed := routedEvent{EventType: "message", Payload: raw, Config: EventConfig{MaxPayloadSize: 1000, OversizeAction: oversizeTruncate}}
+
+	limitPayloadSize(&routed, payload, map[string]interface{}{})
+
+	if len(routed.Payload) > 1000 {
+		t.Errorf("expected truncated payload to fit in 1000 bytes, got %d", len(routed.Payload))
+	}
+	var truncated map[string]interface{}
+	if err := json.Unmarshal(routed.Payload, &truncated); err != nil {
+		t.Fatalf("truncated payload is not valid JSON: %v", err)
+	}
+	event := truncated["event"].(map[string]interface{})
+	if event["blocks"] != nil || event["text"] == nil {
+		t.Errorf("expected only the largest field to be removed, got %s", routed.Payload)
+	}
+	oversize := truncated[relayMetadataKey].(map[string]interface{})["oversize"].(map[string]interface{})
+	if removed := oversize["removed_fields"].([]interface{}); len(removed) != 1 || removed[0] != "blocks" {
+		t.Errorf("unexpected removed fields: %v", removed)
+	}
+	if _, ok := payload["event"].(map[string]interface{})["blocks"]; !ok {
+		t.Error("expected the original payload to be left unchanged")
+	}
+}
+
+func TestLimitPayloadSizeRoute(t *testing.T) {
+	payload, raw := oversizePayload()
+	routed := routedEvent{EventType: "message", Payload: raw, Config: EventConfig{Channel: "messages", MaxPayloadSize: 1000, OversizeAction: oversizeRoute}}
+
+	limitPayloadSize(&routed, payload, map[string]interface{}{})
+
+	if routed.Config.Channel != defaultOversizeChannel {
+		t.Errorf("expected channel %s, got %s", defaultOversizeChannel, routed.Config.Channel)
+	}
+	if string(routed.Payload) != string(raw) {
+		t.Error("expected routed payload to be published unchanged")
+	}
+}
+
+func TestLimitPayloadSizeWithinLimit(t *testing.T) {
+	payload, raw := oversizePayload()
+	routed := routedEvent{EventType: "message", Payload: raw, Config: EventConfig{Channel: "messages", MaxPayloadSize: 10000}}
+
+	limitPayloadSize(&routed, payload, map[string]interface{}{})
+
+	if routed.Config.Channel != "messages" || string(routed.Payload) != string(raw) {
+		t.Error("expected payload within the limit to be left unchanged")
+	}
+}
+
+func TestParseEventConfigOversizeAction(t *testing.T) {
+	if _, err := parseEventConfig([]byte(`[{"slack-event-type": "message", "channel": "c", "max-payload-size": 1000, "oversize-action": "route", "oversize-channel": "big"}]`)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := map[string]string{
+		`[{"slack-event-type": "message", "channel": "c", "max-payload-size": 1000, "oversize-action": "summarise"}]`: "invalid oversize-action",
+		`[{"slack-event-type": "message", "channel": "c", "max-payload-size": -1}]`:                                   "negative max-payload-size",
+		`[{"slack-event-type": "message", "channel": "c", "oversize-channel": "big"}]`:                                "only applies to the route oversize-action",
+	}
+	for data, want := range invalid {
+		if _, err := parseEventConfig([]byte(data)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q for %s, got %v", want, data, err)
+		}
+	}
+}
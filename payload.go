@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Errors returned by parseSlackPayload, written to Slack as the 400 response body
+var (
+	errInvalidForm     = errors.New("Error parsing form data")
+	errMissingPayload  = errors.New("Missing payload parameter")
+	errInvalidFormJSON = errors.New("Error parsing JSON from payload parameter")
+	errInvalidJSON     = errors.New("Error parsing JSON")
+)
+
+// slashCommandType is the payload type given to slash command requests, which
+// Slack sends as plain form fields without a type
+const slashCommandType = "slash_command"
+
+// slackEnvelope holds the fields of a Slack payload the handler dispatches on
+// before an event is routed. Fields of another JSON type are left empty.
+type slackEnvelope struct {
+	// Type is the top-level payload type, e.g. event_callback or block_actions
+	Type string
+	// EventID is the event_id of event callbacks
+	EventID string
+	// Challenge is the challenge of url_verification requests
+	Challenge string
+	// Command is the command of slash commands
+	Command string
+}
+
+// slackPayload is a Slack request payload. It is decoded once; the envelope the
+// handler dispatches on is read from the decoded fields, and the raw JSON is
+// kept so the payload is published as received.
+type slackPayload struct {
+	slackEnvelope
+	// Raw is the payload JSON as received
+	Raw []byte
+	// fields is the decoded payload
+	fields map[string]interface{}
+}
+
+// Fields returns the decoded payload, used by routing, filters and templates
+func (p *slackPayload) Fields() map[string]interface{} {
+	if p.fields == nil {
+		p.fields = make(map[string]interface{})
+	}
+	return p.fields
+}
+
+// parseSlackPayload decodes the payload of a Slack request: the body itself,
+// the payload parameter of form-encoded interactive requests, or the form
+// fields of slash commands
+func parseSlackPayload(contentType string, body []byte) (slackPayload, error) {
+	parsed := slackPayload{Raw: body}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		formValues, err := url.ParseQuery(string(body))
+		if err != nil {
+			return parsed, errInvalidForm
+		}
+		payloadStr := formValues.Get("payload")
+		if payloadStr == "" && formValues.Get("command") != "" {
+			return parseSlashCommand(parsed, formValues)
+		}
+		if payloadStr == "" {
+			return parsed, errMissingPayload
+		}
+		parsed.Raw = []byte(payloadStr)
+		if err := json.Unmarshal(parsed.Raw, &parsed.fields); err != nil {
+			return parsed, errInvalidFormJSON
+		}
+	} else if err := json.Unmarshal(body, &parsed.fields); err != nil {
+		return parsed, errInvalidJSON
+	}
+
+	parsed.Type, _ = parsed.fields["type"].(string)
+	parsed.EventID, _ = parsed.fields["event_id"].(string)
+	parsed.Challenge, _ = parsed.fields["challenge"].(string)
+	parsed.Command, _ = parsed.fields["command"].(string)
+	return parsed, nil
+}
+
+// parseSlashCommand turns the form fields of a slash command into a payload of
+// type slash_command, published as a JSON object of the fields
+func parseSlashCommand(parsed slackPayload, formValues url.Values) (slackPayload, error) {
+	parsed.fields = make(map[string]interface{}, len(formValues)+1)
+	for name := range formValues {
+		parsed.fields[name] = formValues.Get(name)
+	}
+	parsed.fields["type"] = slashCommandType
+	parsed.Type = slashCommandType
+	parsed.Command = formValues.Get("command")
+	raw, err := json.Marshal(parsed.fields)
+	if err != nil {
+		return parsed, errInvalidForm
+	}
+	parsed.Raw = raw
+	return parsed, nil
+}
+
+// isSSLCheck reports whether a request is Slack's ssl_check probe, which Slack
+// sends to slash command URLs to verify their certificate
+func isSSLCheck(contentType string, body []byte) bool {
+	if !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") || !bytes.Contains(body, []byte("ssl_check=")) {
+		return false
+	}
+	formValues, err := url.ParseQuery(string(body))
+	return err == nil && formValues.Get("ssl_check") == "1"
+}
+
+// indentedJSON returns data indented for logging, or data itself when it is not valid JSON
+func indentedJSON(data []byte) string {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return string(data)
+	}
+	return indented.String()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseSlackPayload(t *testing.T) {
+	form := "payload=" + url.QueryEscape(`{"type":"block_actions"}`)
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expectType  string
+		expectErr   error
+	}{
+		{"json", "application/json", `{"type":"event_callback","event_id":"Ev1"}`, "event_callback", nil},
+		{"form", "application/x-www-form-urlencoded", form, "block_actions", nil},
+		{"non-string type", "application/json", `{"type":5}`, "", nil},
+		{"invalid json", "application/json", `{`, "", errInvalidJSON},
+		{"missing form payload", "application/x-www-form-urlencoded", "token=abc", "", errMissingPayload},
+		{"invalid form json", "application/x-www-form-urlencoded", "payload=%7B", "", errInvalidFormJSON},
+		{"slash command", "application/x-www-form-urlencoded", "command=%2Fdeploy&text=api", slashCommandType, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseSlackPayload(tt.contentType, []byte(tt.body))
+			if err != tt.expectErr {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+			if parsed.Type != tt.expectType {
+				t.Errorf("expected type %q, got %q", tt.expectType, parsed.Type)
+			}
+		})
+	}
+
+	parsed, _ := parseSlackPayload("application/json", []byte(`{"type":"event_callback","event_id":"Ev1"}`))
+	if parsed.EventID != "Ev1" || string(parsed.Raw) != `{"type":"event_callback","event_id":"Ev1"}` {
+		t.Errorf("unexpected parsed payload %+v", parsed)
+	}
+	if fields := parsed.Fields(); fields["event_id"] != "Ev1" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	parsed, _ = parseSlackPayload("application/x-www-form-urlencoded", []byte(form))
+	if string(parsed.Raw) != `{"type":"block_actions"}` {
+		t.Errorf("expected the form payload parameter as raw JSON, got %s", parsed.Raw)
+	}
+}
+
+func TestIndentedJSON(t *testing.T) {
+	if got := indentedJSON([]byte(`{"a":1}`)); got != "{\n  \"a\": 1\n}" {
+		t.Errorf("unexpected indented JSON %q", got)
+	}
+	if got := indentedJSON([]byte("not json")); got != "not json" {
+		t.Errorf("expected invalid JSON to be returned as is, got %q", got)
+	}
+}
+
+func TestParseSlashCommand(t *testing.T) {
+	parsed, err := parseSlackPayload("application/x-www-form-urlencoded", []byte("command=%2Fdeploy&text=api+prod&user_id=U1&team_id=T1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fields := parsed.Fields(); fields["command"] != "/deploy" || fields["text"] != "api prod" || fields["team_id"] != "T1" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if string(parsed.Raw) != `{"command":"/deploy","team_id":"T1","text":"api prod","type":"slash_command","user_id":"U1"}` {
+		t.Errorf("unexpected raw payload %s", parsed.Raw)
+	}
+}
+
+func TestIsSSLCheck(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		want        bool
+	}{
+		{"application/x-www-form-urlencoded", "ssl_check=1&token=abc", true},
+		{"application/x-www-form-urlencoded", "ssl_check=0", false},
+		{"application/x-www-form-urlencoded", "command=%2Fdeploy", false},
+		{"application/json", `{"ssl_check=1": true}`, false},
+	}
+	for _, tt := range tests {
+		if got := isSSLCheck(tt.contentType, []byte(tt.body)); got != tt.want {
+			t.Errorf("isSSLCheck(%q, %q) = %v, want %v", tt.contentType, tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// preflightProbeTTL is how long the Redis probe key lives if it cannot be deleted
+const preflightProbeTTL = 30 * time.Second
+
+// slackTokenCheck is a configured Slack token verified before startup
+type slackTokenCheck struct {
+	Name  string
+	Env   string
+	Token string
+}
+
+// configuredSlackTokens returns the Slack tokens that can be verified with auth.test
+func configuredSlackTokens() []slackTokenCheck {
+	var tokens []slackTokenCheck
+	if token := getSlackBotToken(); token != "" {
+		tokens = append(tokens, slackTokenCheck{Name: "bot token", Env: "SLACK_BOT_TOKEN", Token: token})
+	}
+	if token := getSlackAuditToken(); token != "" {
+		tokens = append(tokens, slackTokenCheck{Name: "audit logs token", Env: "SLACK_AUDIT_TOKEN", Token: token})
+	}
+	return tokens
+}
+
+// slackAuthTest verifies token with auth.test, returning the user and team it
+// belongs to
+func slackAuthTest(ctx context.Context, token string) (string, string, error) {
+	var result struct {
+		slackAPIResponse
+		Team string `json:"team"`
+		User string `json:"user"`
+	}
+	if err := callSlackAPI(ctx, "auth.test", token, url.Values{}, &result); err != nil {
+		return "", "", err
+	}
+	return result.User, result.Team, nil
+}
+
+// slackTokenHint suggests how to fix an auth.test failure of the token read from env
+func slackTokenHint(err error, env string) string {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "invalid_auth"), strings.Contains(message, "not_authed"):
+		return fmt.Sprintf("the token is malformed or belongs to another app; check %s", env)
+	case strings.Contains(message, "token_revoked"), strings.Contains(message, "account_inactive"), strings.Contains(message, "token_expired"):
+		return fmt.Sprintf("the token was revoked or the app uninstalled; reinstall the app and update %s", env)
+	case strings.Contains(message, "ratelimited"):
+		return "Slack is rate limiting this app; retry in a minute"
+	}
+	return "check network access to " + slackAPIBaseURL
+}
+
+// probeRedis writes a key to Redis, reads it back and deletes it, so missing
+// write permissions (e.g. ACLs or a read-only replica) are found before publishing
+func probeRedis(ctx context.Context, client *redis.Client) error {
+	key := "slack-relay:preflight:" + instanceID
+	value := strconv.FormatInt(clock.Now().UnixNano(), 10)
+	if err := client.Set(ctx, key, value, preflightProbeTTL).Err(); err != nil {
+		return fmt.Errorf("writing %s: %w", key, err)
+	}
+	read, err := client.Get(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", key, err)
+	}
+	if read != value {
+		return fmt.Errorf("reading %s: got %q, expected %q", key, read, value)
+	}
+	return client.Del(ctx, key).Err()
+}
+
+// redisHint suggests how to fix a failed Redis probe
+func redisHint(err error, addr string) string {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "NOAUTH"), strings.Contains(message, "WRONGPASS"), strings.Contains(message, "invalid password"):
+		return "authentication failed; check REDIS_PASSWORD"
+	case strings.Contains(message, "NOPERM"):
+		return "the Redis user lacks permissions; allow SET, GET, DEL and PUBLISH"
+	case strings.Contains(message, "READONLY"):
+		return fmt.Sprintf("%s is a read-only replica; point REDIS_HOST at the primary", addr)
+	}
+	return fmt.Sprintf("check that Redis is reachable at %s (REDIS_HOST, REDIS_PORT)", addr)
+}
+
+// runPreflightChecks verifies every configured Slack token and that Redis can be
+// written to, returning an actionable error for each failure
+func runPreflightChecks(ctx context.Context, client *redis.Client) []error {
+	var failures []error
+
+	for _, token := range configuredSlackTokens() {
+		checkCtx, cancel := context.WithTimeout(ctx, slackAPITimeout)
+		user, team, err := slackAuthTest(checkCtx, token.Token)
+		cancel()
+		if err != nil {
+			failures = append(failures, fmt.Errorf("slack %s failed auth.test: %v: %s", token.Name, err, slackTokenHint(err, token.Env)))
+			continue
+		}
+		logInfo("Pre-flight: Slack %s authenticated as %s in %s", token.Name, user, team)
+	}
+
+	addr := client.Options().Addr
+	checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	err := probeRedis(checkCtx, client)
+	cancel()
+	if err != nil {
+		failures = append(failures, fmt.Errorf("redis write/read probe failed: %v: %s", err, redisHint(err, addr)))
+	} else {
+		logInfo("Pre-flight: Redis at %s accepts writes", addr)
+	}
+	return failures
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRunPreflightChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"token_revoked"}`))
+	}))
+	defer server.Close()
+
+	originalURL, originalToken := slackAPIBaseURL, slackBotToken
+	slackAPIBaseURL, slackBotToken = server.URL+"/", "xoxb-test"
+	defer func() { slackAPIBaseURL, slackBotToken = originalURL, originalToken }()
+
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+
+	failures := runPreflightChecks(context.Background(), client)
+	if len(failures) != 2 {
+		t.Fatalf("expected a Slack and a Redis failure, got %v", failures)
+	}
+	if !strings.Contains(failures[0].Error(), "reinstall the app and update SLACK_BOT_TOKEN") {
+		t.Errorf("expected an actionable Slack error, got %v", failures[0])
+	}
+	if !strings.Contains(failures[1].Error(), "check that Redis is reachable at 127.0.0.1:1") {
+		t.Errorf("expected an actionable Redis error, got %v", failures[1])
+	}
+}
+
+func TestRedisHint(t *testing.T) {
+	tests := []struct {
+		err      string
+		expected string
+	}{
+		{"WRONGPASS invalid username-password pair", "REDIS_PASSWORD"},
+		{"NOPERM this user has no permissions", "lacks permissions"},
+		{"READONLY You can't write against a read only replica.", "read-only replica"},
+		{"dial tcp: connection refused", "REDIS_HOST"},
+	}
+	for _, tt := range tests {
+		if hint := redisHint(errors.New(tt.err), "redis:6379"); !strings.Contains(hint, tt.expected) {
+			t.Errorf("redisHint(%q) = %q, expected it to mention %q", tt.err, hint, tt.expected)
+		}
+	}
+}
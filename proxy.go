@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// trustedProxies holds the networks whose X-Forwarded-For, X-Real-IP and
+// X-Forwarded-Proto headers are honored. Empty means the relay is directly
+// exposed and forwarding headers are ignored.
+var trustedProxies []netip.Prefix
+
+// parseTrustedProxies parses a comma-separated list of IP addresses and CIDR ranges
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// isTrustedProxy reports whether ip belongs to a trusted proxy network
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP address of the direct peer of the request
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientIP returns the IP address of the client that sent the request. Forwarding
+// headers are only honored when the direct peer is a trusted proxy; X-Forwarded-For
+// is walked from the right, skipping trusted proxies, so clients cannot spoof it.
+func clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		hops := strings.Split(forwardedFor, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			ip = hop
+			if !isTrustedProxy(hop) {
+				return hop
+			}
+		}
+		return ip
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return ip
+}
+
+// requestScheme returns the scheme the client used, honoring X-Forwarded-Proto
+// only when the direct peer is a trusted proxy
+func requestScheme(r *http.Request) string {
+	if isTrustedProxy(remoteIP(r)) {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			return strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.10,")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies returned error: %v", err)
+	}
+	if len(prefixes) != 2 {
+		t.Fatalf("expected 2 prefixes, got %d", len(prefixes))
+	}
+	if prefixes[1].String() != "192.168.1.10/32" {
+		t.Errorf("expected single IP to become /32, got %v", prefixes[1])
+	}
+
+	if _, err := parseTrustedProxies("not-an-ip"); err == nil {
+		t.Error("expected error for invalid entry, got nil")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	var err error
+	trustedProxies, err = parseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies returned error: %v", err)
+	}
+	defer func() { trustedProxies = nil }()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"direct client ignores headers", "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.5"},
+		{"trusted proxy forwarded for", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"skips trusted hops", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{"trusted proxy real ip", "10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.8"}, "198.51.100.8"},
+		{"trusted proxy without headers", "10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/slack", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if got := clientIP(req); got != tt.expected {
+				t.Errorf("clientIP() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRequestScheme(t *testing.T) {
+	var err error
+	trustedProxies, err = parseTrustedProxies("10.0.0.1")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies returned error: %v", err)
+	}
+	defer func() { trustedProxies = nil }()
+
+	req := httptest.NewRequest(http.MethodPost, "/slack", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-Proto", "HTTPS")
+	if got := requestScheme(req); got != "https" {
+		t.Errorf("requestScheme() = %q, want %q", got, "https")
+	}
+
+	req.RemoteAddr = "203.0.113.5:1234"
+	if got := requestScheme(req); got != "http" {
+		t.Errorf("requestScheme() for untrusted peer = %q, want %q", got, "http")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// queueFullPolicyDrop acknowledges events that do not fit in the queue and drops them
+	queueFullPolicyDrop = "drop"
+	// queueFullPolicyReject responds 503 with Retry-After so Slack redelivers the event later
+	queueFullPolicyReject = "reject"
+)
+
+// publishJob is an event waiting in the publish queue
+type publishJob struct {
+	eventType string
+	region    string
+	target    publishTarget
+	payload   []byte
+	retry     RetryPolicy
+}
+
+// publishQueue buffers events between the HTTP handler and the publish workers.
+// It is nil when events are published synchronously.
+var publishQueue chan publishJob
+
+// queueFullPolicy decides what happens to an event when the publish queue is full
+var queueFullPolicy = queueFullPolicyDrop
+
+// pipelineSize is the maximum number of queued events published in one Redis
+// pipeline; 1 disables pipelining
+var pipelineSize = 1
+
+// pipelineWindow is how long a worker waits for more events to fill a pipeline
+var pipelineWindow = 2 * time.Millisecond
+
+// queueRetryAfterSeconds is the Retry-After value sent with 503 responses
+var queueRetryAfterSeconds = 5
+
+var metricQueueFull = newCounterVec("slack_relay_queue_full_total",
+	"Events that did not fit in the publish queue, by event type and policy.", "event_type", "policy")
+
+var metricPipelinedBatches = newCounterVec("slack_relay_pipelined_batches_total",
+	"Redis pipelines sent by the publish workers.")
+
+func init() {
+	newGaugeFunc("slack_relay_queue_depth", "Events waiting in the publish queue.", func() float64 {
+		return float64(len(publishQueue))
+	})
+}
+
+// startPublishWorkers creates the publish queue and starts workers draining it
+func startPublishWorkers(size int, workers int) {
+	publishQueue = make(chan publishJob, size)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range publishQueue {
+				batch := collectBatch(job, publishQueue)
+				for _, job := range batch {
+					queuedEvents.add(job.eventType, -1)
+				}
+				publishBatch(batch)
+			}
+		}()
+	}
+}
+
+// collectBatch gathers up to pipelineSize jobs, starting with first, waiting at
+// most pipelineWindow for more jobs to arrive
+func collectBatch(first publishJob, queue <-chan publishJob) []publishJob {
+	batch := []publishJob{first}
+	if pipelineSize <= 1 {
+		return batch
+	}
+
+	timer := time.NewTimer(pipelineWindow)
+	defer timer.Stop()
+	for len(batch) < pipelineSize {
+		select {
+		case job, ok := <-queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, job)
+		case <-timer.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+// publishBatch publishes jobs in a single Redis pipeline. Jobs whose publish
+// fails in the pipeline are published again individually with their retry
+// policy, as are batches spanning several data residency regions.
+func publishBatch(jobs []publishJob) {
+	client := regionClient(jobs[0].region)
+	if len(jobs) == 1 || client == nil || !sameRegion(jobs) {
+		for _, job := range jobs {
+			publishAndRecord(job.eventType, job.region, job.target, job.payload, job.retry)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cmds, _ := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, job := range jobs {
+			job.target.send(ctx, pipe, signPayload(job.payload))
+		}
+		return nil
+	})
+	metricPipelinedBatches.Inc()
+
+	for i, job := range jobs {
+		if i < len(cmds) && cmds[i].Err() == nil {
+			metricEventsPublished.Inc(eventTypeLabel(job.eventType))
+			logInfo("Published event to %s%s", job.target, formatRegion(job.region))
+			continue
+		}
+		publishAndRecord(job.eventType, job.region, job.target, job.payload, job.retry)
+	}
+}
+
+// sameRegion reports whether jobs are all published to the same region
+func sameRegion(jobs []publishJob) bool {
+	for _, job := range jobs[1:] {
+		if job.region != jobs[0].region {
+			return false
+		}
+	}
+	return true
+}
+
+// enqueuePublish adds a job to the publish queue without blocking. It reports
+// whether the job was queued.
+func enqueuePublish(job publishJob) bool {
+	queuedEvents.add(job.eventType, 1)
+	select {
+	case publishQueue <- job:
+		return true
+	default:
+		queuedEvents.add(job.eventType, -1)
+		return false
+	}
+}
+
+// rejectQueueFull tells Slack to retry later because the publish queue is full
+func rejectQueueFull(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(queueRetryAfterSeconds))
+	http.Error(w, "Relay is busy, retry later", http.StatusServiceUnavailable)
+}
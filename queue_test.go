@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEnqueuePublishFull(t *testing.T) {
+	publishQueue = make(chan publishJob, 1)
+	defer func() { publishQueue = nil }()
+
+	if !enqueuePublish(publishJob{eventType: "message"}) {
+		t.Fatal("expected first job to be queued")
+	}
+	if enqueuePublish(publishJob{eventType: "message"}) {
+		t.Error("expected second job to be rejected by a full queue")
+	}
+}
+
+func TestSlackHandlerQueueFullReject(t *testing.T) {
+	setupTestEnvironment()
+	publishQueue = make(chan publishJob) // Unbuffered with no workers: always full
+	queueFullPolicy = queueFullPolicyReject
+	defer func() {
+		publishQueue = nil
+		queueFullPolicy = queueFullPolicyDrop
+	}()
+
+	payloadBytes := []byte(`{"type":"event_callback","event":{"type":"message","text":"Hello world"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	slackHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "5" {
+		t.Errorf("expected Retry-After 5, got %q", retryAfter)
+	}
+}
+
+func TestSlackHandlerQueueFullDrop(t *testing.T) {
+	setupTestEnvironment()
+	publishQueue = make(chan publishJob)
+	defer func() { publishQueue = nil }()
+
+	payloadBytes := []byte(`{"type":"event_callback","event":{"type":"message","text":"Hello world"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	slackHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+}
+
+func TestSlackHandlerQueued(t *testing.T) {
+	setupTestEnvironment()
+	publishQueue = make(chan publishJob, 1)
+	defer func() { publishQueue = nil }()
+
+	payloadBytes := []byte(`{"type":"event_callback","event":{"type":"message","text":"Hello world"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	slackHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	job := <-publishQueue
+	if job.target != pubsubTarget("test-channel") || !bytes.Equal(job.payload, payloadBytes) {
+		t.Errorf("unexpected queued job: %+v", job)
+	}
+}
+
+func TestCollectBatch(t *testing.T) {
+	defer func(size int, window time.Duration) { pipelineSize, pipelineWindow = size, window }(pipelineSize, pipelineWindow)
+
+	queue := make(chan publishJob, 5)
+	for i := 0; i < 3; i++ {
+		queue <- publishJob{eventType: "message"}
+	}
+
+	pipelineSize = 1
+	if batch := collectBatch(publishJob{}, queue); len(batch) != 1 {
+		t.Errorf("expected pipelining disabled to return 1 job, got %d", len(batch))
+	}
+
+	pipelineSize = 3
+	pipelineWindow = time.Millisecond
+	if batch := collectBatch(publishJob{}, queue); len(batch) != 3 {
+		t.Errorf("expected batch capped at 3 jobs, got %d", len(batch))
+	}
+
+	// One job remains; the window expires before the batch is full
+	if batch := collectBatch(publishJob{}, queue); len(batch) != 2 {
+		t.Errorf("expected window to end a partial batch of 2 jobs, got %d", len(batch))
+	}
+}
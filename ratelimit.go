@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultSlackMethodRate is the calls per minute allowed for methods missing
+	// from slackMethodRates, Slack's Tier 2
+	defaultSlackMethodRate = 20
+	// maxRateLimitedAttempts bounds the calls made to a method Slack keeps rate limiting
+	maxRateLimitedAttempts = 3
+)
+
+// slackMethodRates are the calls per minute per workspace the relay makes to the
+// Slack API methods it calls with the bot token, following Slack's rate limit tiers
+var slackMethodRates = map[string]int{
+	"chat.postMessage":             60,
+	"chat.scheduleMessage":         50,
+	"chat.update":                  50,
+	"chat.delete":                  50,
+	"chat.unfurl":                  50,
+	"reactions.add":                50,
+	"reactions.remove":             20,
+	"pins.add":                     20,
+	"pins.remove":                  20,
+	"files.getUploadURLExternal":   100,
+	"files.completeUploadExternal": 100,
+}
+
+var metricSlackRateLimited = newCounterVec("slack_relay_slack_rate_limited_total",
+	"Slack API calls rejected with 429 Too Many Requests, by method.", "method")
+
+// slackRateLimiter spaces calls to each Slack API method per workspace, and
+// pauses a method while Slack asks to retry it later
+type slackRateLimiter struct {
+	mu sync.Mutex
+	// rates are the calls per minute by method, defaultRate for other methods
+	rates       map[string]int
+	defaultRate int
+	// next is the earliest time of the next call, by workspace and method
+	next map[string]time.Time
+}
+
+// newSlackRateLimiter returns a limiter allowing rates calls per minute by
+// method, and defaultRate calls per minute to other methods
+func newSlackRateLimiter(rates map[string]int, defaultRate int) *slackRateLimiter {
+	return &slackRateLimiter{rates: rates, defaultRate: defaultRate, next: make(map[string]time.Time)}
+}
+
+// slackLimiter limits the relay's Slack API calls made with the bot token
+var slackLimiter = newSlackRateLimiter(slackMethodRates, defaultSlackMethodRate)
+
+// reserve books the next call to method in team's workspace and returns how
+// long to wait before making it
+func (l *slackRateLimiter) reserve(team string, method string, now time.Time) time.Duration {
+	rate, ok := l.rates[method]
+	if !ok {
+		rate = l.defaultRate
+	}
+	key := team + "/" + method
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	at := l.next[key]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[key] = at.Add(time.Minute / time.Duration(rate))
+	return at.Sub(now)
+}
+
+// pause holds calls to method in team's workspace until until
+func (l *slackRateLimiter) pause(team string, method string, until time.Time) {
+	key := team + "/" + method
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next[key].Before(until) {
+		l.next[key] = until
+	}
+}
+
+// callSlackBotAPI calls a Slack Web API method with the bot token, decoding the
+// response into result. Calls are spaced to stay within the method's rate limit
+// in the workspace of the params' team_id, and retried after the Retry-After
+// delay when Slack rate limits them anyway.
+func callSlackBotAPI(ctx context.Context, method string, params url.Values, result interface{}) error {
+	token := getSlackBotToken()
+	if token == "" {
+		return errors.New("SLACK_BOT_TOKEN is not configured")
+	}
+	team := params.Get("team_id")
+
+	for attempt := 1; ; attempt++ {
+		if wait := slackLimiter.reserve(team, method, clock.Now()); wait > 0 {
+			sleepContext(ctx, wait)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		err := callSlackAPI(ctx, method, token, params, result)
+		var limited *slackRateLimitedError
+		if !errors.As(err, &limited) {
+			return err
+		}
+		metricSlackRateLimited.Inc(method)
+		if attempt >= maxRateLimitedAttempts {
+			return err
+		}
+		logWarn("Slack rate limited %s, retrying in %s", method, limited.RetryAfter)
+		slackLimiter.pause(team, method, clock.Now().Add(limited.RetryAfter))
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// unlimitedSlackCalls lifts the outbound Slack API rate limits for the test
+func unlimitedSlackCalls(t *testing.T) {
+	original := slackLimiter
+	slackLimiter = newSlackRateLimiter(nil, 1<<20)
+	t.Cleanup(func() { slackLimiter = original })
+}
+
+func TestSlackRateLimiterReserve(t *testing.T) {
+	limiter := newSlackRateLimiter(map[string]int{"chat.update": 60}, 20)
+	now := time.Unix(1700000000, 0)
+
+	if wait := limiter.reserve("T1", "chat.update", now); wait != 0 {
+		t.Errorf("expected the first call not to wait, got %s", wait)
+	}
+	if wait := limiter.reserve("T1", "chat.update", now); wait != time.Second {
+		t.Errorf("expected calls to chat.update to be a second apart, got %s", wait)
+	}
+	if wait := limiter.reserve("T2", "chat.update", now); wait != 0 {
+		t.Errorf("expected workspaces to be limited separately, got %s", wait)
+	}
+	limiter.reserve("T1", "pins.add", now)
+	if wait := limiter.reserve("T1", "pins.add", now); wait != 3*time.Second {
+		t.Errorf("expected the default rate for other methods, got %s", wait)
+	}
+
+	limiter.pause("T1", "chat.update", now.Add(30*time.Second))
+	if wait := limiter.reserve("T1", "chat.update", now.Add(5*time.Second)); wait != 25*time.Second {
+		t.Errorf("expected calls to wait out Retry-After, got %s", wait)
+	}
+}
+
+func TestCallSlackBotAPIRetriesWhenRateLimited(t *testing.T) {
+	unlimitedSlackCalls(t)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 || r.URL.Path == "/pins.add" {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+	originalURL := slackAPIBaseURL
+	slackAPIBaseURL = server.URL + "/"
+	defer func() { slackAPIBaseURL = originalURL }()
+	slackBotToken = "xoxb-test"
+	defer func() { slackBotToken = "" }()
+
+	if err := callSlackBotAPI(context.Background(), "chat.update", url.Values{"channel": {"C1"}}, nil); err != nil || calls != 2 {
+		t.Errorf("expected the call to succeed on retry, got %v after %d call(s)", err, calls)
+	}
+
+	calls = 0
+	err := callSlackBotAPI(context.Background(), "pins.add", url.Values{"channel": {"C1"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "rate limited") || calls != maxRateLimitedAttempts {
+		t.Errorf("expected to give up after %d attempts, got %v after %d call(s)", maxRateLimitedAttempts, err, calls)
+	}
+
+	recorder := httptest.NewRecorder()
+	metricsHandler(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(recorder.Body.String(), `slack_relay_slack_rate_limited_total{method="pins.add"} 3`) {
+		t.Error("expected rate limited calls to be counted")
+	}
+}
+
+func TestOutboundDispatcherQueues(t *testing.T) {
+	unlimitedSlackCalls(t)
+	release := make(chan struct{})
+	var served atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		served.Add(1)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+	originalURL := slackAPIBaseURL
+	slackAPIBaseURL = server.URL + "/"
+	defer func() { slackAPIBaseURL = originalURL }()
+	slackBotToken = "xoxb-test"
+	defer func() { slackBotToken = "" }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	original := outbound
+	outbound = newOutboundDispatcher(1, newMessageScheduler(10))
+	defer func() { outbound = original }()
+
+	update := func(ts string) outboundMessage {
+		message, _ := parseOutboundMessage([]byte(`{"op":"update","team_id":"T1","channel":"C1","ts":"` + ts + `","text":"hi"}`))
+		return message
+	}
+	if !outbound.dispatch(ctx, update("1.000001")) {
+		t.Fatal("expected the first message to be queued")
+	}
+	// Wait for the worker to take the first message, blocking on Slack
+	deadline := time.Now().Add(5 * time.Second)
+	for len(outbound.lanes["T1/update"].queue) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !outbound.dispatch(ctx, update("1.000002")) {
+		t.Fatal("expected the second message to be queued")
+	}
+	if outbound.dispatch(ctx, update("1.000003")) {
+		t.Error("expected a message to be dropped when the queue is full")
+	}
+
+	recorder := httptest.NewRecorder()
+	metricsHandler(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(recorder.Body.String(), `slack_relay_outbound_queue_depth{team_id="T1",op="update"} 1`) {
+		t.Errorf("expected the queue depth in metrics output, got:\n%s", recorder.Body.String())
+	}
+	close(release)
+	// Let the worker send the queued message before the Slack API is restored
+	deadline = time.Now().Add(5 * time.Second)
+	for served.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+}
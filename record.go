@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// recordDir is the directory raw requests are recorded to. Empty disables recording to disk.
+var recordDir string
+
+// recordRedisKey is the Redis list raw requests are recorded to. Empty disables recording to Redis.
+var recordRedisKey string
+
+// recordSequence distinguishes recordings made within the same nanosecond
+var recordSequence atomic.Uint64
+
+// recordedRequest is a byte-exact copy of an inbound request. The body is kept as
+// bytes (base64 in JSON) so signatures can be re-verified against the original payload.
+type recordedRequest struct {
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	Headers    http.Header `json:"headers"`
+	Body       []byte      `json:"body"`
+	RemoteIP   string      `json:"remote_ip"`
+	ReceivedAt time.Time   `json:"received_at"`
+}
+
+// recordingEnabled reports whether inbound requests should be recorded
+func recordingEnabled() bool {
+	return recordDir != "" || recordRedisKey != ""
+}
+
+// recordRequest stores the raw request to disk and/or Redis. It is called before
+// signature verification so requests that fail verification are recorded too.
+func recordRequest(r *http.Request, body []byte) {
+	record := recordedRequest{
+		Method:     r.Method,
+		Path:       r.URL.RequestURI(),
+		Headers:    r.Header.Clone(),
+		Body:       body,
+		RemoteIP:   clientIP(r),
+		ReceivedAt: clock.Now().UTC(),
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		logError("Error encoding recorded request: %v", err)
+		return
+	}
+
+	if recordDir != "" {
+		name := fmt.Sprintf("%d-%06d.json", record.ReceivedAt.UnixNano(), recordSequence.Add(1))
+		if err := os.WriteFile(filepath.Join(recordDir, name), data, 0600); err != nil {
+			logError("Error recording request to %s: %v", recordDir, err)
+		}
+	}
+
+	if recordRedisKey != "" && redisClient != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := redisClient.RPush(ctx, recordRedisKey, data).Err(); err != nil {
+			logError("Error recording request to Redis list '%s': %v", recordRedisKey, err)
+		}
+	}
+}
+
+// loadRecordings reads recorded requests from a directory, oldest first
+func loadRecordings(dir string) ([]recordedRequest, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	recordings := make([]recordedRequest, 0, len(matches))
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			return nil, err
+		}
+		var record recordedRequest
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("%s: %w", match, err)
+		}
+		recordings = append(recordings, record)
+	}
+	return recordings, nil
+}
+
+// loadRedisRecordings reads recorded requests from a Redis list, oldest first
+func loadRedisRecordings(ctx context.Context, key string) ([]recordedRequest, error) {
+	if redisClient == nil {
+		return nil, errRedisUnavailable
+	}
+	entries, err := redisClient.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	recordings := make([]recordedRequest, 0, len(entries))
+	for i, entry := range entries {
+		var record recordedRequest
+		if err := json.Unmarshal([]byte(entry), &record); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		recordings = append(recordings, record)
+	}
+	return recordings, nil
+}
+
+// replayHeader marks requests replayed from recordings, so the relay flags
+// their events as replayed and publishes them to the replay channels. It is not
+// covered by Slack's signature, so it carries a credential made with the admin
+// token; see replayCredential.
+const replayHeader = "X-Slack-Relay-Replay"
+
+// replayCredentialVersion prefixes replay credentials, keeping them apart from
+// Slack and envelope signatures made over the same request
+const replayCredentialVersion = "replay"
+
+// replayCredential computes the replayHeader value of a request body sent at
+// timestamp: replay=hex(HMAC-SHA256(admin token, "replay:<timestamp>:<body>"))
+func replayCredential(token []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, token)
+	mac.Write([]byte(replayCredentialVersion + ":" + timestamp + ":"))
+	mac.Write(body)
+	return replayCredentialVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// isReplayed reports whether a request carries a valid replayHeader credential
+// for its body. Requests with an invalid credential, or any credential while no
+// admin token is configured, are handled as live deliveries.
+func isReplayed(r *http.Request, body []byte) bool {
+	credential := r.Header.Get(replayHeader)
+	if credential == "" {
+		return false
+	}
+	token := getAdminToken()
+	if token == "" || !hmac.Equal([]byte(credential), []byte(replayCredential([]byte(token), r.Header.Get("X-Slack-Request-Timestamp"), body))) {
+		logWarn("Ignoring unauthenticated %s header from %s", replayHeader, clientIP(r))
+		return false
+	}
+	return true
+}
+
+// replayIDSuffix is appended to the event_id of replayed events with -rewrite-ids
+const replayIDSuffix = "-replay"
+
+// replayOptions control how recorded requests are replayed
+type replayOptions struct {
+	// ResignSecret replaces the Slack signature with a fresh one
+	ResignSecret []byte
+	// ReplayToken is the target's admin token. When set, replayHeader is sent
+	// with a credential made with it and Slack's retry headers are dropped, so
+	// the target flags the events as replayed instead of treating them as retries.
+	ReplayToken []byte
+	// RewriteIDs appends replayIDSuffix to the event_id of event callbacks, so
+	// consumers deduplicating by event_id keep replayed events apart from live
+	// ones. It needs ResignSecret, as the body changes.
+	RewriteIDs bool
+}
+
+// rewriteEventID appends replayIDSuffix to the event_id of a JSON body. Bodies
+// without an event_id, such as form-encoded interactive payloads, are returned
+// unchanged.
+func rewriteEventID(body []byte) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	var eventID string
+	if err := json.Unmarshal(fields["event_id"], &eventID); err != nil || eventID == "" {
+		return body
+	}
+	fields["event_id"], _ = json.Marshal(eventID + replayIDSuffix)
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// replayRequest re-issues a recorded request against target, which is the base URL
+// of another relay instance. With a resign secret, the Slack signature headers are
+// replaced with a fresh signature so the target accepts the old request.
+func replayRequest(client *http.Client, target string, record recordedRequest, options replayOptions) (int, error) {
+	body := record.Body
+	if options.RewriteIDs {
+		body = rewriteEventID(body)
+	}
+	req, err := http.NewRequest(record.Method, target+record.Path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for name, values := range record.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	if len(options.ResignSecret) > 0 {
+		timestamp := strconv.FormatInt(clock.Now().Unix(), 10)
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", computeSlackSignature(body, timestamp, options.ResignSecret))
+	}
+	if len(options.ReplayToken) > 0 {
+		req.Header.Set(replayHeader, replayCredential(options.ReplayToken, req.Header.Get("X-Slack-Request-Timestamp"), body))
+		req.Header.Del("X-Slack-Retry-Num")
+		req.Header.Del("X-Slack-Retry-Reason")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// runReplayCommand implements the "replay" subcommand
+func runReplayCommand(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	dir := flags.String("dir", "", "directory of recorded requests")
+	redisKey := flags.String("redis-key", "", "Redis list of recorded requests (uses REDIS_HOST/REDIS_PORT/REDIS_PASSWORD)")
+	target := flags.String("target", "", "base URL of the relay to replay against, e.g. http://localhost:8080")
+	resignFile := flags.String("resign-secret-file", "", "re-sign requests with the signing secret in this file")
+	rate := flags.Float64("rate", 0, "maximum requests per second (default unlimited)")
+	markReplayed := flags.Bool("mark-replayed", false, "flag events as replayed so the target publishes them to its replay channels (requires -admin-token-file)")
+	adminTokenFile := flags.String("admin-token-file", "", "authenticate -mark-replayed with the target's admin token in this file")
+	rewriteIDs := flags.Bool("rewrite-ids", false, "append "+replayIDSuffix+" to event IDs (requires -resign-secret-file)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *target == "" || (*dir == "") == (*redisKey == "") || (*rewriteIDs && *resignFile == "") || *markReplayed != (*adminTokenFile != "") || *rate < 0 {
+		fmt.Fprintln(os.Stderr, "usage: slack-relay replay -target URL (-dir DIR | -redis-key KEY) [-resign-secret-file FILE] [-rate N] [-mark-replayed -admin-token-file FILE] [-rewrite-ids]")
+		return 2
+	}
+
+	options := replayOptions{RewriteIDs: *rewriteIDs}
+	if *resignFile != "" {
+		secret, err := os.ReadFile(*resignFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading signing secret: %v\n", err)
+			return 1
+		}
+		options.ResignSecret = bytes.TrimSpace(secret)
+	}
+	if *adminTokenFile != "" {
+		token, err := os.ReadFile(*adminTokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading admin token: %v\n", err)
+			return 1
+		}
+		options.ReplayToken = bytes.TrimSpace(token)
+	}
+
+	var recordings []recordedRequest
+	var err error
+	if *dir != "" {
+		recordings, err = loadRecordings(*dir)
+	} else {
+		redisClient = newRedisClientFromEnv()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		recordings, err = loadRedisRecordings(ctx, *redisKey)
+		cancel()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading recordings: %v\n", err)
+		return 1
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	var pace <-chan time.Time
+	if *rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+	failures := 0
+	for i, record := range recordings {
+		if pace != nil && i > 0 {
+			<-pace
+		}
+		status, err := replayRequest(client, *target, record, options)
+		if err != nil || status >= 300 {
+			failures++
+		}
+		fmt.Printf("%s %s (recorded %s) -> status=%d err=%v\n", record.Method, record.Path, record.ReceivedAt.Format(time.RFC3339), status, err)
+	}
+	fmt.Printf("Replayed %d request(s), %d failure(s)\n", len(recordings), failures)
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+// replayChannelSuffix is appended to the channel of replayed events, so live
+// consumers are not confused by historical traffic. Empty publishes replayed
+// events to the route's own channel.
+var replayChannelSuffix string
+
+var metricReplayedEvents = newCounterVec("slack_relay_replayed_events_total",
+	"Replayed events routed, by event type.", "event_type")
+
+// replayChannel returns the channel replayed events of a route's channel are published to
+func replayChannel(channel string) string {
+	return channel + replayChannelSuffix
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndLoadRecordings(t *testing.T) {
+	recordDir = t.TempDir()
+	defer func() { recordDir = "" }()
+
+	body := []byte(`{"type":"event_callback","event":{"type":"message"}}`)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/slack?retry=1", bytes.NewReader(body))
+		req.Header.Set("X-Slack-Signature", "v0=original")
+		recordRequest(req, body)
+	}
+
+	recordings, err := loadRecordings(recordDir)
+	if err != nil {
+		t.Fatalf("loadRecordings returned error: %v", err)
+	}
+	if len(recordings) != 2 {
+		t.Fatalf("expected 2 recordings, got %d", len(recordings))
+	}
+	if !bytes.Equal(recordings[0].Body, body) {
+		t.Errorf("expected byte-exact body, got %s", recordings[0].Body)
+	}
+	if recordings[0].Path != "/slack?retry=1" {
+		t.Errorf("expected path with query, got %s", recordings[0].Path)
+	}
+	if recordings[0].Headers.Get("X-Slack-Signature") != "v0=original" {
+		t.Errorf("expected recorded signature header, got %v", recordings[0].Headers)
+	}
+}
+
+func TestReplayRequestResigns(t *testing.T) {
+	secret := []byte("replay-secret")
+	body := []byte(`{"type":"event_callback"}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := io.ReadAll(r.Body)
+		if !bytes.Equal(received, body) {
+			t.Errorf("expected byte-exact body, got %s", received)
+		}
+		timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+		ts, _ := strconv.ParseInt(timestamp, 10, 64)
+		if time.Now().Unix()-ts > 5 {
+			t.Errorf("expected fresh timestamp, got %s", timestamp)
+		}
+		if r.Header.Get("X-Slack-Signature") != computeSlackSignature(body, timestamp, secret) {
+			t.Error("expected request to be re-signed")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	record := recordedRequest{
+		Method:  http.MethodPost,
+		Path:    "/slack",
+		Headers: http.Header{"X-Slack-Signature": []string{"v0=stale"}, "X-Slack-Request-Timestamp": []string{"1000000000"}},
+		Body:    body,
+	}
+	status, err := replayRequest(server.Client(), server.URL, record, replayOptions{ResignSecret: secret})
+	if err != nil {
+		t.Fatalf("replayRequest returned error: %v", err)
+	}
+	if status != http.StatusOK {
+		t.Errorf("expected status 200, got %d", status)
+	}
+}
+
+func TestRunReplayCommandUsage(t *testing.T) {
+	if code := runReplayCommand([]string{"-dir", t.TempDir()}); code != 2 {
+		t.Errorf("expected usage exit code 2 without -target, got %d", code)
+	}
+}
+
+func TestReplayRequestMarksReplayed(t *testing.T) {
+	secret := []byte("replay-secret")
+	var received *http.Request
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	record := recordedRequest{
+		Method:  http.MethodPost,
+		Path:    "/slack",
+		Headers: http.Header{"X-Slack-Retry-Num": []string{"1"}, "X-Slack-Retry-Reason": []string{"http_timeout"}},
+		Body:    []byte(`{"type":"event_callback","event_id":"Ev1","event":{"type":"message"}}`),
+	}
+	token := []byte("admin-token")
+	if _, err := replayRequest(server.Client(), server.URL, record, replayOptions{ResignSecret: secret, ReplayToken: token, RewriteIDs: true}); err != nil {
+		t.Fatalf("replayRequest returned error: %v", err)
+	}
+	credential := replayCredential(token, received.Header.Get("X-Slack-Request-Timestamp"), receivedBody)
+	if received.Header.Get(replayHeader) != credential || received.Header.Get("X-Slack-Retry-Num") != "" {
+		t.Errorf("expected the request to be marked as replayed without retry headers, got %v", received.Header)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(receivedBody, &fields)
+	if fields["event_id"] != "Ev1-replay" {
+		t.Errorf("expected the event ID to be rewritten, got %s", receivedBody)
+	}
+	if received.Header.Get("X-Slack-Signature") != computeSlackSignature(receivedBody, received.Header.Get("X-Slack-Request-Timestamp"), secret) {
+		t.Error("expected the rewritten body to be signed")
+	}
+
+	if form := []byte("payload=%7B%7D"); !bytes.Equal(rewriteEventID(form), form) {
+		t.Error("expected bodies without an event_id to be unchanged")
+	}
+}
+
+func TestSlackHandlerAuthenticatesReplayHeader(t *testing.T) {
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "slack-messages"}})
+	defer setupTestEnvironment()
+	signingSecret = []byte{}
+	dedup = newMemoryDedupStore(time.Minute, 10)
+	defer func() { dedup = noopDedupStore{} }()
+	defer func() { adminToken = "" }()
+
+	event := `{"type":"event_callback","event_id":"Ev1","event":{"type":"message"}}`
+	deliver := func(credential string) string {
+		req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(event))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Slack-Request-Timestamp", "1712345678")
+		if credential != "" {
+			req.Header.Set(replayHeader, credential)
+		}
+		rr := httptest.NewRecorder()
+		slackHandler(rr, req)
+		return rr.Body.String()
+	}
+	deliver("")
+
+	valid := replayCredential([]byte("admin-token"), "1712345678", []byte(event))
+	if body := deliver(valid); !strings.Contains(body, "already delivered") {
+		t.Errorf("expected the replay header to be ignored without an admin token, got %q", body)
+	}
+	adminToken = "admin-token"
+	if body := deliver("true"); !strings.Contains(body, "already delivered") {
+		t.Errorf("expected a replay header without a valid credential to be ignored, got %q", body)
+	}
+	if body := deliver(replayCredential([]byte("other-token"), "1712345678", []byte(event))); !strings.Contains(body, "already delivered") {
+		t.Errorf("expected a replay credential of another token to be ignored, got %q", body)
+	}
+	if body := deliver(valid); strings.Contains(body, "already delivered") {
+		t.Errorf("expected an authenticated replay to be relayed, got %q", body)
+	}
+}
+
+func TestRouteReplayedEvent(t *testing.T) {
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "slack-messages", Stale: StalePolicy{MaxAge: Duration(time.Minute)}}})
+	defer setupTestEnvironment()
+	replayChannelSuffix = "-replay"
+	defer func() { replayChannelSuffix = "" }()
+
+	payload := map[string]interface{}{"type": "event_callback", "event_time": float64(1355517523), "event": map[string]interface{}{"type": "message"}}
+	if routed := routeEvent(payload, nil); routed.Skip != skipStale {
+		t.Fatalf("expected the live delivery of an old event to be stale, got %+v", routed)
+	}
+
+	routed := routeDelivery(payload, nil, true)
+	if routed.Skip != "" || routed.Config.Channel != "slack-messages-replay" {
+		t.Errorf("expected the replayed event to be published to slack-messages-replay, got %+v", routed)
+	}
+	var published map[string]interface{}
+	json.Unmarshal(routed.Payload, &published)
+	if metadata, _ := published[relayMetadataKey].(map[string]interface{}); metadata["replayed"] != true {
+		t.Errorf("expected the payload to be flagged as replayed, got %v", published)
+	}
+}
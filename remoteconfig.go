@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultConfigWatchInterval is how often polled config sources are checked
+	// for changes, and how long to wait before retrying a failed watch
+	defaultConfigWatchInterval = 30 * time.Second
+
+	// consulWatchWait is the longest a Consul blocking query waits for a change
+	consulWatchWait = 5 * time.Minute
+)
+
+// errConfigNotFound is returned by a ConfigSource whose key does not exist
+var errConfigNotFound = errors.New("configuration key not found")
+
+// ConfigSource loads the route table from a remote configuration store
+type ConfigSource interface {
+	// Fetch returns the current configuration data and a version that changes
+	// whenever the data does
+	Fetch(ctx context.Context) (data []byte, version string, err error)
+	// Watch calls onChange with the new configuration data whenever it changes,
+	// until ctx is cancelled
+	Watch(ctx context.Context, onChange func(data []byte))
+	// String describes the source for logs and audit records
+	String() string
+}
+
+// consulConfigSource reads the route table from a Consul KV key and watches it
+// with blocking queries
+type consulConfigSource struct {
+	addr     string
+	key      string
+	token    string
+	client   *http.Client
+	interval time.Duration
+}
+
+// get reads the key. With a non-empty index the request is a blocking query that
+// returns once the key's modify index moves past index, or after wait.
+func (s *consulConfigSource) get(ctx context.Context, index string, wait time.Duration) ([]byte, string, error) {
+	query := url.Values{}
+	query.Set("raw", "")
+	if index != "" {
+		query.Set("index", index)
+		query.Set("wait", wait.String())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(s.addr, "/")+"/v1/kv/"+strings.TrimPrefix(s.key, "/")+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, resp.Header.Get("X-Consul-Index"), errConfigNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("consul returned status %d", resp.StatusCode)
+	}
+	return body, resp.Header.Get("X-Consul-Index"), nil
+}
+
+// Fetch reads the key
+func (s *consulConfigSource) Fetch(ctx context.Context) ([]byte, string, error) {
+	return s.get(ctx, "", 0)
+}
+
+// Watch runs blocking queries against the key, calling onChange when its value changes
+func (s *consulConfigSource) Watch(ctx context.Context, onChange func([]byte)) {
+	current, index, _ := s.Fetch(ctx)
+	for ctx.Err() == nil {
+		requestCtx, cancel := context.WithTimeout(ctx, consulWatchWait+30*time.Second)
+		data, newIndex, err := s.get(requestCtx, index, consulWatchWait)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, errConfigNotFound) {
+				logWarn("Error watching %s: %v", s, err)
+			}
+			sleepContext(ctx, s.interval)
+			continue
+		}
+
+		index = newIndex
+		if !bytes.Equal(data, current) {
+			current = data
+			onChange(data)
+		}
+	}
+}
+
+// String describes the Consul key
+func (s *consulConfigSource) String() string {
+	return "consul key " + s.key
+}
+
+// etcdConfigSource reads the route table from an etcd key through the etcd v3
+// JSON gateway and polls it for changes
+type etcdConfigSource struct {
+	endpoint string
+	key      string
+	token    string
+	client   *http.Client
+	interval time.Duration
+}
+
+// Fetch reads the key and returns its value and mod revision
+func (s *etcdConfigSource) Fetch(ctx context.Context) ([]byte, string, error) {
+	request, err := json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(s.key))})
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.endpoint, "/")+"/v3/kv/range", bytes.NewReader(request))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("etcd returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		KVs []struct {
+			Value       string `json:"value"`
+			ModRevision string `json:"mod_revision"`
+		} `json:"kvs"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, "", fmt.Errorf("etcd returned invalid JSON: %w", err)
+	}
+	if len(result.KVs) == 0 {
+		return nil, "", errConfigNotFound
+	}
+	value, err := base64.StdEncoding.DecodeString(result.KVs[0].Value)
+	if err != nil {
+		return nil, "", fmt.Errorf("etcd returned invalid value: %w", err)
+	}
+	return value, result.KVs[0].ModRevision, nil
+}
+
+// Watch polls the key's mod revision, calling onChange when it changes
+func (s *etcdConfigSource) Watch(ctx context.Context, onChange func([]byte)) {
+	_, current, _ := s.Fetch(ctx)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, revision, err := s.Fetch(ctx)
+			if err != nil {
+				if !errors.Is(err, errConfigNotFound) {
+					logWarn("Error watching %s: %v", s, err)
+				}
+				continue
+			}
+			if revision != current {
+				current = revision
+				onChange(data)
+			}
+		}
+	}
+}
+
+// String describes the etcd key
+func (s *etcdConfigSource) String() string {
+	return "etcd key " + s.key
+}
+
+// sleepContext waits for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// newConfigSourceFromEnv builds the remote config source named by CONFIG_SOURCE.
+// It returns nil when routes are read from the config file (the default).
+func newConfigSourceFromEnv() (ConfigSource, error) {
+	interval := getEnvDuration("CONFIG_WATCH_INTERVAL", defaultConfigWatchInterval)
+	switch source := os.Getenv("CONFIG_SOURCE"); source {
+	case "", "file":
+		return nil, nil
+	case "consul":
+		addr := os.Getenv("CONSUL_HTTP_ADDR")
+		if addr == "" {
+			addr = "http://127.0.0.1:8500"
+		} else if !strings.Contains(addr, "://") {
+			addr = "http://" + addr
+		}
+		key := os.Getenv("CONFIG_KEY")
+		if key == "" {
+			return nil, errors.New("consul config source requires CONFIG_KEY")
+		}
+		return &consulConfigSource{
+			addr:     addr,
+			key:      key,
+			token:    os.Getenv("CONSUL_HTTP_TOKEN"),
+			client:   &http.Client{},
+			interval: interval,
+		}, nil
+	case "etcd":
+		endpoint := os.Getenv("ETCD_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "http://127.0.0.1:2379"
+		}
+		key := os.Getenv("CONFIG_KEY")
+		if key == "" {
+			return nil, errors.New("etcd config source requires CONFIG_KEY")
+		}
+		return &etcdConfigSource{
+			endpoint: endpoint,
+			key:      key,
+			token:    os.Getenv("ETCD_TOKEN"),
+			client:   &http.Client{Timeout: 10 * time.Second},
+			interval: interval,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown config source '%s'", source)
+	}
+}
+
+// loadRemoteEventConfig loads the route table from source at startup. Relative
+// path includes are not allowed in remote configuration.
+func loadRemoteEventConfig(source ConfigSource) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	data, _, err := source.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseConfigFrom("", data, 0)
+	if err != nil {
+		return err
+	}
+	activateConfig(applyEnvOverrides(parsed.Routes, os.Environ()), parsed.Templates, parsed.Endpoints)
+	return nil
+}
+
+// watchRemoteEventConfig reloads the route table whenever it changes in source,
+// until ctx is cancelled. Invalid configuration is logged and ignored.
+func watchRemoteEventConfig(ctx context.Context, source ConfigSource) {
+	source.Watch(ctx, func(data []byte) {
+		if err := reloadEventConfig("config-source", source.String(), "", data); err != nil {
+			logError("Ignoring invalid configuration from %s: %v", source, err)
+		}
+	})
+}
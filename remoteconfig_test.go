@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConsulConfigSourceWatch(t *testing.T) {
+	var version atomic.Int32
+	version.Store(1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/slack-relay/routes" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Consul-Token") != "consul-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("index") == "1" {
+			// Blocking query: the key changes while the watch waits
+			version.Store(2)
+		}
+		w.Header().Set("X-Consul-Index", "1")
+		if version.Load() == 2 {
+			w.Header().Set("X-Consul-Index", "2")
+			w.Write([]byte(`[{"slack-event-type":"message","channel":"v2"}]`))
+			return
+		}
+		w.Write([]byte(`[{"slack-event-type":"message","channel":"v1"}]`))
+	}))
+	defer server.Close()
+
+	source := &consulConfigSource{addr: server.URL, key: "slack-relay/routes", token: "consul-token", client: server.Client(), interval: time.Millisecond}
+	data, index, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch returned error: %v", err)
+	}
+	if index != "1" || string(data) != `[{"slack-event-type":"message","channel":"v1"}]` {
+		t.Errorf("unexpected Fetch result: %s (index %s)", data, index)
+	}
+
+	changes := make(chan []byte, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go source.Watch(ctx, func(data []byte) {
+		select {
+		case changes <- data:
+		default:
+		}
+	})
+
+	select {
+	case data := <-changes:
+		if string(data) != `[{"slack-event-type":"message","channel":"v2"}]` {
+			t.Errorf("unexpected watched value: %s", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for configuration change")
+	}
+}
+
+func TestEtcdConfigSourceWatch(t *testing.T) {
+	var revision atomic.Int32
+	revision.Store(5)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/kv/range" {
+			http.NotFound(w, r)
+			return
+		}
+		rev := revision.Add(1) - 1
+		value := base64.StdEncoding.EncodeToString([]byte(`{"routes":[{"slack-event-type":"message","channel":"etcd"}]}`))
+		w.Write([]byte(`{"kvs":[{"value":"` + value + `","mod_revision":"` + strconv.Itoa(int(rev)) + `"}]}`))
+	}))
+	defer server.Close()
+
+	source := &etcdConfigSource{endpoint: server.URL, key: "/slack-relay/routes", client: server.Client(), interval: 10 * time.Millisecond}
+	data, revisionID, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch returned error: %v", err)
+	}
+	if revisionID != "5" || string(data) != `{"routes":[{"slack-event-type":"message","channel":"etcd"}]}` {
+		t.Errorf("unexpected Fetch result: %s (revision %s)", data, revisionID)
+	}
+
+	changes := make(chan []byte, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go source.Watch(ctx, func(data []byte) {
+		select {
+		case changes <- data:
+		default:
+		}
+	})
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for configuration change")
+	}
+}
+
+func TestEtcdConfigSourceNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"header":{}}`))
+	}))
+	defer server.Close()
+
+	source := &etcdConfigSource{endpoint: server.URL, key: "missing", client: server.Client()}
+	if _, _, err := source.Fetch(context.Background()); err != errConfigNotFound {
+		t.Errorf("expected errConfigNotFound, got %v", err)
+	}
+}
+
+func TestReloadEventConfig(t *testing.T) {
+	setupTestEnvironment()
+
+	if err := reloadEventConfig("test", "test data", "", []byte(`[{"slack-event-type":"message","channel":"reloaded"}]`)); err != nil {
+		t.Fatalf("reloadEventConfig returned error: %v", err)
+	}
+	if config, ok := lookupEventConfig("message"); !ok || config.Channel != "reloaded" {
+		t.Errorf("expected reloaded channel for 'message', got %+v", config)
+	}
+
+	if err := reloadEventConfig("test", "test data", "", []byte(`not json`)); err == nil {
+		t.Error("expected error for invalid configuration, got nil")
+	}
+	if config, _ := lookupEventConfig("message"); config.Channel != "reloaded" {
+		t.Errorf("expected invalid configuration to keep active routes, got %+v", config)
+	}
+}
+
+func TestNewConfigSourceFromEnv(t *testing.T) {
+	t.Setenv("CONFIG_SOURCE", "")
+	if source, err := newConfigSourceFromEnv(); source != nil || err != nil {
+		t.Errorf("expected no remote source by default, got %v, %v", source, err)
+	}
+
+	t.Setenv("CONFIG_SOURCE", "consul")
+	t.Setenv("CONFIG_KEY", "")
+	if _, err := newConfigSourceFromEnv(); err == nil {
+		t.Error("expected error for consul source without CONFIG_KEY")
+	}
+
+	t.Setenv("CONFIG_KEY", "slack-relay/routes")
+	t.Setenv("CONSUL_HTTP_ADDR", "consul.service:8500")
+	source, err := newConfigSourceFromEnv()
+	if err != nil {
+		t.Fatalf("newConfigSourceFromEnv returned error: %v", err)
+	}
+	if consul, ok := source.(*consulConfigSource); !ok || consul.addr != "http://consul.service:8500" {
+		t.Errorf("unexpected consul source: %+v", source)
+	}
+
+	t.Setenv("CONFIG_SOURCE", "zookeeper")
+	if _, err := newConfigSourceFromEnv(); err == nil {
+		t.Error("expected error for unknown config source")
+	}
+}
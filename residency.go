@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// skipNoRegion is the skip reason for events of teams without a data region
+// when residency is strict
+const skipNoRegion = "team has no data region"
+
+// defaultRegionLabel is the region label of events published to the default Redis
+const defaultRegionLabel = "default"
+
+// residencyConfig assigns teams to data residency regions, each with its own Redis
+type residencyConfig struct {
+	// Regions are the Redis addresses of the regions, by name
+	Regions map[string]string
+	// Teams are the regions of team and enterprise IDs
+	Teams map[string]string
+	// Strict drops events of teams without a region instead of publishing them
+	// to the default Redis
+	Strict bool
+}
+
+// residency is the relay's data residency configuration
+var residency residencyConfig
+
+// regionClients are the Redis clients of the regions, by name
+var regionClients = make(map[string]*redis.Client)
+
+var metricRegionEvents = newCounterVec("slack_relay_region_events_total",
+	"Events routed to each data residency region, by region.", "region")
+
+// parseAssignments parses a comma-separated list of key=value pairs
+func parseAssignments(value string) (map[string]string, error) {
+	assignments := make(map[string]string)
+	for _, item := range splitList(value) {
+		key, val, ok := strings.Cut(item, "=")
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if !ok || key == "" || val == "" {
+			return nil, fmt.Errorf("invalid assignment %q, expected key=value", item)
+		}
+		assignments[key] = val
+	}
+	return assignments, nil
+}
+
+// loadResidencyConfig reads the data residency configuration from
+// REDIS_REGIONS, TEAM_REGIONS and RESIDENCY_STRICT
+func loadResidencyConfig() (residencyConfig, error) {
+	regions, err := parseAssignments(os.Getenv("REDIS_REGIONS"))
+	if err != nil {
+		return residencyConfig{}, fmt.Errorf("REDIS_REGIONS: %w", err)
+	}
+	teams, err := parseAssignments(os.Getenv("TEAM_REGIONS"))
+	if err != nil {
+		return residencyConfig{}, fmt.Errorf("TEAM_REGIONS: %w", err)
+	}
+	for team, region := range teams {
+		if _, ok := regions[region]; !ok {
+			return residencyConfig{}, fmt.Errorf("TEAM_REGIONS assigns '%s' to region '%s', which is not in REDIS_REGIONS", team, region)
+		}
+	}
+	config := residencyConfig{Regions: regions, Teams: teams, Strict: getEnvBool("RESIDENCY_STRICT", false)}
+	if config.Strict && len(regions) == 0 {
+		return residencyConfig{}, fmt.Errorf("RESIDENCY_STRICT needs regions in REDIS_REGIONS")
+	}
+	return config, nil
+}
+
+// enabled reports whether events are routed to regions
+func (c residencyConfig) enabled() bool {
+	return len(c.Regions) > 0
+}
+
+// regionNames returns the names of the regions in alphabetical order
+func (c residencyConfig) regionNames() []string {
+	names := make([]string, 0, len(c.Regions))
+	for name := range c.Regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// payloadRegion returns the region of a payload's team, or of its enterprise
+// when the team has none. It reports false when neither has a region.
+func (c residencyConfig) payloadRegion(payload map[string]interface{}) (string, bool) {
+	if teamID := payloadShardKey(payload); teamID != "" {
+		if region, ok := c.Teams[teamID]; ok {
+			return region, true
+		}
+	}
+	if enterpriseID, _ := payload["enterprise_id"].(string); enterpriseID != "" {
+		if region, ok := c.Teams[enterpriseID]; ok {
+			return region, true
+		}
+	}
+	return "", false
+}
+
+// connectRegions creates the Redis clients of the regions with the connection
+// settings of base, and checks that each can be reached
+func connectRegions(base *redis.Options, regions map[string]string) map[string]*redis.Client {
+	clients := make(map[string]*redis.Client, len(regions))
+	for name, addr := range regions {
+		options := *base
+		options.Addr = addr
+		client := redis.NewClient(&options)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := client.Ping(ctx).Err(); err != nil {
+			// Region events are never sent to another region, so the client is
+			// kept and publishes fail until the region's Redis is reachable
+			logWarn("Could not connect to Redis of region '%s' at %s: %v", name, addr, err)
+		} else {
+			logInfo("Connected to Redis of region '%s' at %s", name, addr)
+		}
+		cancel()
+		clients[name] = client
+	}
+	return clients
+}
+
+// regionClient returns the Redis client of a region, or the default client for
+// the empty region. It returns nil when the client is unavailable.
+func regionClient(region string) *redis.Client {
+	if region == "" {
+		return redisClient
+	}
+	return regionClients[region]
+}
+
+// formatRegion renders a region for log lines as " (region eu)", or an empty
+// string for the default Redis
+func formatRegion(region string) string {
+	if region == "" {
+		return ""
+	}
+	return " (region " + region + ")"
+}
+
+// regionLabel returns the metric label of a region
+func regionLabel(region string) string {
+	if region == "" {
+		return defaultRegionLabel
+	}
+	return region
+}
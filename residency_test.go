@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLoadResidencyConfig(t *testing.T) {
+	t.Setenv("REDIS_REGIONS", "eu=redis-eu:6379, us=redis-us:6379")
+	t.Setenv("TEAM_REGIONS", "T0EU=eu,E0ACME=us")
+	t.Setenv("RESIDENCY_STRICT", "true")
+	config, err := loadResidencyConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Regions["us"] != "redis-us:6379" || config.Teams["T0EU"] != "eu" || !config.Strict {
+		t.Errorf("unexpected configuration %+v", config)
+	}
+
+	t.Setenv("TEAM_REGIONS", "T0EU=apac")
+	if _, err := loadResidencyConfig(); err == nil {
+		t.Error("expected a team assigned to an unknown region to be rejected")
+	}
+	t.Setenv("TEAM_REGIONS", "T0EU")
+	if _, err := loadResidencyConfig(); err == nil {
+		t.Error("expected an invalid assignment to be rejected")
+	}
+}
+
+func TestRouteRegions(t *testing.T) {
+	defer setupTestEnvironment()
+	defer func() { residency = residencyConfig{} }()
+
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "messages"}})
+	residency = residencyConfig{
+		Regions: map[string]string{"eu": "redis-eu:6379", "us": "redis-us:6379"},
+		Teams:   map[string]string{"T0EU": "eu", "E0ACME": "us"},
+	}
+
+	for _, tt := range []struct {
+		payload map[string]interface{}
+		strict  bool
+		region  string
+		skip    string
+	}{
+		{map[string]interface{}{"team_id": "T0EU"}, false, "eu", ""},
+		{map[string]interface{}{"team_id": "T0ACME", "enterprise_id": "E0ACME"}, false, "us", ""},
+		{map[string]interface{}{"team_id": "T0OTHER"}, false, "", ""},
+		{map[string]interface{}{"team_id": "T0OTHER"}, true, "", skipNoRegion},
+	} {
+		residency.Strict = tt.strict
+		tt.payload["type"] = "event_callback"
+		tt.payload["event"] = map[string]interface{}{"type": "message"}
+		raw, _ := json.Marshal(tt.payload)
+		routed := routeEvent(tt.payload, raw)
+		if routed.Region != tt.region || routed.Skip != tt.skip {
+			t.Errorf("%v (strict %v): expected region %q and skip %q, got %q and %q", tt.payload, tt.strict, tt.region, tt.skip, routed.Region, routed.Skip)
+		}
+	}
+}
+
+func TestPublishRegionEventUnavailable(t *testing.T) {
+	if err := publishRegionEvent("eu", "messages", []byte(`{}`)); err != errRedisUnavailable {
+		t.Errorf("expected an unknown region to be unavailable, got %v", err)
+	}
+}
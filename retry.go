@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Error classes a retry policy can retry on
+const (
+	retryClassTimeout    = "timeout"
+	retryClassConnection = "connection"
+	retryClassServer     = "server"
+)
+
+// defaultRetryOn is the set of error classes retried when a policy does not list any
+var defaultRetryOn = []string{retryClassTimeout, retryClassConnection, retryClassServer}
+
+// retryableServerErrors are Redis error reply prefixes that indicate a transient
+// server condition, as opposed to a permanent error such as WRONGTYPE
+var retryableServerErrors = []string{"LOADING", "READONLY", "MASTERDOWN", "TRYAGAIN", "CLUSTERDOWN", "BUSY"}
+
+// RetryPolicy configures how publishing to a route's sink is retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of publish attempts (default 1, no retries)
+	MaxAttempts int `json:"max-attempts,omitempty"`
+	// BaseDelay is the delay before the first retry; it doubles on each retry
+	BaseDelay Duration `json:"base-delay,omitempty"`
+	// MaxDelay caps the delay between retries
+	MaxDelay Duration `json:"max-delay,omitempty"`
+	// Jitter randomizes each delay by up to this fraction (0 to 1)
+	Jitter float64 `json:"jitter,omitempty"`
+	// RetryOn lists the error classes to retry: timeout, connection, server
+	RetryOn []string `json:"retry-on,omitempty"`
+}
+
+var metricPublishRetries = newCounterVec("slack_relay_publish_retries_total",
+	"Publish attempts retried after a retryable error, by event type.", "event_type")
+
+// classifyPublishError returns the retry class of a publish error, or an empty
+// string if the error is not retryable
+func classifyPublishError(err error) string {
+	if err == nil || errors.Is(err, errRedisUnavailable) {
+		return ""
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return retryClassTimeout
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, redis.ErrClosed) {
+		return retryClassConnection
+	}
+
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		for _, prefix := range retryableServerErrors {
+			if strings.HasPrefix(redisErr.Error(), prefix) {
+				return retryClassServer
+			}
+		}
+	}
+	return ""
+}
+
+// isRetryable reports whether err belongs to an error class the policy retries
+func (p RetryPolicy) isRetryable(err error) bool {
+	class := classifyPublishError(err)
+	if class == "" {
+		return false
+	}
+	retryOn := p.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = defaultRetryOn
+	}
+	for _, allowed := range retryOn {
+		if allowed == class {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the backoff before retry number retry (starting at 1)
+func (p RetryPolicy) delay(retry int) time.Duration {
+	delay := time.Duration(p.BaseDelay)
+	for i := 1; i < retry && (p.MaxDelay == 0 || delay < time.Duration(p.MaxDelay)); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > time.Duration(p.MaxDelay) {
+		delay = time.Duration(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration(float64(delay) * p.Jitter * (rand.Float64()*2 - 1))
+	}
+	return delay
+}
+
+// withRetry calls publish until it succeeds, returns a non-retryable error or
+// the policy's attempts are exhausted. onRetry is called before each retry.
+func (p RetryPolicy) withRetry(publish func() error, onRetry func(attempt int, err error)) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = publish()
+		if err == nil || attempt == attempts || !p.isRetryable(err) {
+			return err
+		}
+		onRetry(attempt, err)
+		time.Sleep(p.delay(attempt))
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// testRedisError mimics an error reply from the Redis server
+type testRedisError string
+
+func (e testRedisError) Error() string { return string(e) }
+func (e testRedisError) RedisError()   {}
+
+func TestClassifyPublishError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"timeout", context.DeadlineExceeded, retryClassTimeout},
+		{"connection", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, retryClassConnection},
+		{"eof", io.EOF, retryClassConnection},
+		{"loading", testRedisError("LOADING Redis is loading the dataset in memory"), retryClassServer},
+		{"wrongtype", testRedisError("WRONGTYPE Operation against a key holding the wrong kind of value"), ""},
+		{"unavailable", errRedisUnavailable, ""},
+	}
+	for _, tt := range tests {
+		if got := classifyPublishError(tt.err); got != tt.expected {
+			t.Errorf("%s: classifyPublishError() = %q, want %q", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: Duration(100 * time.Millisecond), MaxDelay: Duration(300 * time.Millisecond)}
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	for i, want := range expected {
+		if got := policy.delay(i + 1); got != want {
+			t.Errorf("delay(%d) = %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestRetryPolicyWithRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, RetryOn: []string{retryClassConnection}}
+
+	calls, retries := 0, 0
+	err := policy.withRetry(func() error {
+		calls++
+		if calls < 3 {
+			return io.EOF
+		}
+		return nil
+	}, func(int, error) { retries++ })
+
+	if err != nil {
+		t.Errorf("expected success on third attempt, got %v", err)
+	}
+	if calls != 3 || retries != 2 {
+		t.Errorf("expected 3 calls and 2 retries, got %d and %d", calls, retries)
+	}
+}
+
+func TestRetryPolicyStopsOnNonRetryable(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, RetryOn: []string{retryClassTimeout}}
+
+	calls := 0
+	err := policy.withRetry(func() error {
+		calls++
+		return io.EOF
+	}, func(int, error) {})
+
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected a single attempt for a non-retryable class, got %d", calls)
+	}
+}
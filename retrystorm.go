@@ -0,0 +1,206 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// retryStormEventTTL is how long delivered event IDs are remembered to drop
+// duplicate retries during a retry storm
+const retryStormEventTTL = 10 * time.Minute
+
+// retryStormMaxEvents caps the number of remembered event IDs
+const retryStormMaxEvents = 100000
+
+// retryStormSettings tunes retry storm detection
+type retryStormSettings struct {
+	// Window is the period retries are counted over
+	Window time.Duration
+	// MinRetries is the number of retries in a window needed to detect a storm
+	MinRetries int
+	// Percent is the share of requests in a window, in percent, that must be
+	// retries to detect a storm
+	Percent int
+	// Cooldown is how long fast-ack mode lasts after the last stormy window
+	Cooldown time.Duration
+}
+
+// defaultRetryStormSettings are the detector settings used unless overridden
+var defaultRetryStormSettings = retryStormSettings{
+	Window:     time.Minute,
+	MinRetries: 20,
+	Percent:    20,
+	Cooldown:   5 * time.Minute,
+}
+
+// retryStormDetector watches the share of Slack deliveries that are retries and
+// switches the relay to fast-ack mode when Slack retries aggressively
+type retryStormDetector struct {
+	mu          sync.Mutex
+	settings    retryStormSettings
+	windowStart time.Time
+	requests    int
+	retries     int
+	stormUntil  time.Time
+	storming    bool
+	delivered   map[string]time.Time
+}
+
+// retryStorms is the relay's retry storm detector; nil when protection is disabled
+var retryStorms *retryStormDetector
+
+// newRetryStormDetector creates a detector with the given settings
+func newRetryStormDetector(settings retryStormSettings, now time.Time) *retryStormDetector {
+	return &retryStormDetector{settings: settings, windowStart: now, delivered: make(map[string]time.Time)}
+}
+
+var metricSlackRetries = newCounterVec("slack_relay_slack_retries_total",
+	"Slack deliveries that were retries, by X-Slack-Retry-Reason.", "reason")
+var metricDuplicateRetries = newCounterVec("slack_relay_duplicate_retries_total",
+	"Slack retries of already delivered events dropped during a retry storm.")
+
+func init() {
+	newGaugeFunc("slack_relay_retry_storm", "1 while a Slack retry storm is detected and events are acknowledged before processing.", func() float64 {
+		if retryStorms != nil && retryStorms.fastAck(clock.Now()) {
+			return 1
+		}
+		return 0
+	})
+}
+
+// observe records a delivery of eventID, closing the window when it has ended.
+// It reports whether the delivery is a retry of an event already delivered
+// while a storm is in progress, which should be dropped. Events only count as
+// delivered once markDelivered is called, so a retry of a delivery that failed
+// is processed again.
+func (d *retryStormDetector) observe(eventID string, retry bool, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.windowStart) >= d.settings.Window {
+		d.closeWindow(now)
+	}
+	d.requests++
+	if retry {
+		d.retries++
+	}
+
+	if eventID == "" {
+		return false
+	}
+	_, delivered := d.delivered[eventID]
+	return retry && delivered && now.Before(d.stormUntil)
+}
+
+// markDelivered remembers that eventID was published or handed off for publishing
+func (d *retryStormDetector) markDelivered(eventID string, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, delivered := d.delivered[eventID]; !delivered && len(d.delivered) < retryStormMaxEvents {
+		d.delivered[eventID] = now
+	}
+}
+
+// markRetryStormDelivered remembers that an event callback was delivered, when
+// retry storm protection is enabled
+func markRetryStormDelivered(eventID string) {
+	if retryStorms == nil || eventID == "" {
+		return
+	}
+	retryStorms.markDelivered(eventID, clock.Now())
+}
+
+// closeWindow evaluates the window that just ended and starts a new one. The
+// caller must hold d.mu.
+func (d *retryStormDetector) closeWindow(now time.Time) {
+	if d.retries >= d.settings.MinRetries && d.retries*100 >= d.settings.Percent*d.requests {
+		d.stormUntil = now.Add(d.settings.Cooldown)
+		if !d.storming {
+			d.storming = true
+			logWarn("Slack retry storm detected: %d of %d deliveries in the last %s were retries; acknowledging events before processing",
+				d.retries, d.requests, d.settings.Window)
+			go publishControlEvent(map[string]interface{}{
+				"type":      "retry_storm_started",
+				"retries":   d.retries,
+				"requests":  d.requests,
+				"timestamp": now.UTC().Format(time.RFC3339),
+			})
+		}
+	} else if d.storming && !now.Before(d.stormUntil) {
+		d.storming = false
+		logInfo("Slack retry storm is over")
+		go publishControlEvent(map[string]interface{}{
+			"type":      "retry_storm_ended",
+			"timestamp": now.UTC().Format(time.RFC3339),
+		})
+	}
+	d.windowStart, d.requests, d.retries = now, 0, 0
+
+	for eventID, delivered := range d.delivered {
+		if now.Sub(delivered) > retryStormEventTTL {
+			delete(d.delivered, eventID)
+		}
+	}
+}
+
+// fastAck reports whether events should be acknowledged before processing
+func (d *retryStormDetector) fastAck(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return now.Before(d.stormUntil)
+}
+
+// handleRetryStorm records a Slack delivery and applies retry storm protection to
+// event callbacks. It returns the writer the rest of the request should use, or
+// nil when the request has been fully handled.
+func handleRetryStorm(w http.ResponseWriter, r *http.Request, parsed slackPayload) http.ResponseWriter {
+	// First deliveries have no retry header; skip parsing it
+	retryNum := 0
+	if value := r.Header.Get("X-Slack-Retry-Num"); value != "" {
+		retryNum, _ = strconv.Atoi(value)
+	}
+	if retryNum > 0 {
+		reason := r.Header.Get("X-Slack-Retry-Reason")
+		if reason == "" {
+			reason = "unknown"
+		}
+		metricSlackRetries.Inc(reason)
+	}
+	if retryStorms == nil || parsed.Type != "event_callback" {
+		return w
+	}
+
+	now := clock.Now()
+	if retryStorms.observe(parsed.EventID, retryNum > 0, now) {
+		logDebug("Dropping retry %d of already delivered event %s", retryNum, parsed.EventID)
+		metricDuplicateRetries.Inc()
+		writeSkipped(w, "already delivered")
+		return nil
+	}
+	if !retryStorms.fastAck(now) {
+		return w
+	}
+
+	// Acknowledge now and keep processing, so slow publishes cannot cause more retries
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, "Event received"); err != nil {
+		logError("Error writing response: %v", err)
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return discardResponseWriter{header: make(http.Header)}
+}
+
+// discardResponseWriter is an http.ResponseWriter that drops the response, used
+// once Slack has already been acknowledged
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d discardResponseWriter) Header() http.Header         { return d.header }
+func (d discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardResponseWriter) WriteHeader(int)             {}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryStormDetector(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	detector := newRetryStormDetector(retryStormSettings{Window: time.Minute, MinRetries: 5, Percent: 50, Cooldown: 2 * time.Minute}, start)
+
+	for i := 0; i < 10; i++ {
+		detector.observe(fmt.Sprintf("Ev%d", i), i%2 == 0, start)
+		detector.markDelivered(fmt.Sprintf("Ev%d", i), start)
+	}
+	if detector.fastAck(start) {
+		t.Fatal("expected no fast-ack before the window closes")
+	}
+
+	next := start.Add(time.Minute)
+	if !detector.observe("Ev1", true, next) {
+		t.Error("expected a retry of a delivered event to be dropped during a storm")
+	}
+	if !detector.fastAck(next) {
+		t.Fatal("expected fast-ack mode after a window of 50% retries")
+	}
+	if detector.observe("Ev1", false, next) {
+		t.Error("expected deliveries that are not retries never to be dropped")
+	}
+	if detector.observe("Ev99", true, next) {
+		t.Error("expected a retry of an unseen event to be delivered")
+	}
+
+	calm := next.Add(3 * time.Minute)
+	detector.observe("Ev100", false, calm)
+	if detector.fastAck(calm) {
+		t.Error("expected fast-ack mode to end after the cooldown")
+	}
+	if detector.observe("Ev1", true, calm) {
+		t.Error("expected retries to be delivered once the storm is over")
+	}
+}
+
+func TestHandleRetryStorm(t *testing.T) {
+	start := time.Now()
+	retryStorms = newRetryStormDetector(retryStormSettings{Window: time.Hour, Cooldown: time.Hour}, start)
+	retryStorms.stormUntil = start.Add(time.Hour)
+	defer func() { retryStorms = nil }()
+
+	request := func(retryNum string) (*httptest.ResponseRecorder, http.ResponseWriter) {
+		req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(""))
+		if retryNum != "" {
+			req.Header.Set("X-Slack-Retry-Num", retryNum)
+			req.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+		}
+		recorder := httptest.NewRecorder()
+		parsed := slackPayload{slackEnvelope: slackEnvelope{Type: "event_callback", EventID: "Ev123"}}
+		return recorder, handleRetryStorm(recorder, req, parsed)
+	}
+
+	recorder, w := request("")
+	markRetryStormDelivered("Ev123")
+	if _, ok := w.(discardResponseWriter); !ok {
+		t.Fatalf("expected processing to continue with a discarding writer, got %T", w)
+	}
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "Event received" {
+		t.Errorf("expected the event to be acknowledged before processing, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	recorder, w = request("1")
+	if w != nil {
+		t.Error("expected the duplicate retry to be fully handled")
+	}
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected the duplicate retry to be acknowledged, got %d", recorder.Code)
+	}
+}
+
+func TestRetryStormRetriesFailedDelivery(t *testing.T) {
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "slack-messages", RetryOnPublishFailure: true}})
+	defer setupTestEnvironment()
+	signingSecret = []byte{}
+	start := time.Unix(1700000000, 0)
+	defer useClock(newManualClock(start))()
+	retryStorms = newRetryStormDetector(retryStormSettings{Window: time.Hour, Cooldown: time.Hour}, start)
+	defer func() { retryStorms = nil }()
+
+	deliver := func(retryNum string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(`{"type":"event_callback","event_id":"Ev123","event":{"type":"message","text":"hi"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		if retryNum != "" {
+			req.Header.Set("X-Slack-Retry-Num", retryNum)
+		}
+		recorder := httptest.NewRecorder()
+		slackHandler(recorder, req)
+		return recorder
+	}
+
+	// The first delivery fails because Redis is down, and a storm follows
+	if recorder := deliver(""); recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the failed publish to be returned to Slack, got %d", recorder.Code)
+	}
+	retryStorms.stormUntil = start.Add(time.Hour)
+
+	commands := recordingRedis(t)
+	if recorder := deliver("1"); strings.Contains(recorder.Body.String(), "already delivered") {
+		t.Fatal("expected the retry of a failed delivery to be processed")
+	}
+	select {
+	case command := <-commands:
+		if !strings.EqualFold(command[0], "publish") {
+			t.Errorf("expected the retry to be published, got %q", command)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the retry to be published")
+	}
+
+	if recorder := deliver("2"); !strings.Contains(recorder.Body.String(), "already delivered") {
+		t.Errorf("expected a retry of the published event to be dropped, got %q", recorder.Body.String())
+	}
+}
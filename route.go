@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Reasons an event is acknowledged but not published. Slack receives
+// "Event received but <reason>" as the response body.
+const (
+	skipUnknownType   = "type unknown"
+	skipNotConfigured = "event type not configured"
+	skipTeamDisabled  = "team is uninstalled"
+	skipNoRouteMatch  = "no route matches"
+	skipOutsideHours  = "outside active hours"
+)
+
+// routedEvent is the outcome of running a Slack payload through the routing pipeline
+type routedEvent struct {
+	EventType string
+	// ConfiguredType is the slack-event-type of the routes that handle the
+	// event, which differs from EventType for events matched by a pattern
+	ConfiguredType string
+	TeamID         string
+	Config         EventConfig
+	// Payload is the final payload to publish, including any relay metadata
+	Payload []byte
+	// Skip is the reason the event is not published; empty when it is routed
+	Skip string
+	// Stale is the action taken because the event was older than its route's
+	// max age when received: drop, flag or divert
+	Stale string
+	// OutsideHours is the action taken because the event arrived outside its
+	// route's active hours: drop, buffer or divert. Diverted events are routed
+	// to the after-hours channel; buffered events are held until the window opens.
+	OutsideHours string
+	// Sensitive is the action taken because the event contained sensitive
+	// content: tag or quarantine
+	Sensitive string
+	// Region is the data residency region whose Redis the event is published
+	// to; empty for the default Redis
+	Region string
+	// Encrypted is set once Payload is encrypted with the route's encryption policy
+	Encrypted bool
+}
+
+// getEventType returns the Slack event type of a payload: the nested event type
+// for event callbacks, or the top-level type otherwise
+func getEventType(payload map[string]interface{}) string {
+	if payload["type"] == "event_callback" {
+		// Extract event type from nested event object
+		if event, ok := payload["event"].(map[string]interface{}); ok {
+			if et, ok := event["type"].(string); ok {
+				return et
+			}
+		}
+		return ""
+	}
+
+	// For other types, use the top-level type
+	et, _ := payload["type"].(string)
+	return et
+}
+
+// routeEvent matches a payload against the event configuration, applies filters
+// and attaches relay metadata. It has no side effects beyond Slack API lookups
+// and interaction state for enrichment and sensitive content classifier calls,
+// so it can be used to test routes without publishing.
+func routeEvent(payload map[string]interface{}, rawPayload []byte) routedEvent {
+	return routeDelivery(payload, rawPayload, false)
+}
+
+// routeDelivery routes a payload like routeEvent. Replayed payloads are flagged
+// as such, published to the route's replay channel and never treated as stale.
+func routeDelivery(payload map[string]interface{}, rawPayload []byte, replayed bool) routedEvent {
+	routed := routedEvent{Payload: rawPayload}
+	routed.EventType = getEventType(payload)
+	routed.TeamID, _ = payload["team_id"].(string)
+
+	if routed.EventType == "" {
+		routed.Skip = skipUnknownType
+		return routed
+	}
+
+	// The snapshot is loaded once, so a reload cannot change the routes
+	// between the lookups
+	snapshot := currentConfig()
+	configured := snapshot.matchEventType(routed.EventType, payload)
+	routed.ConfiguredType = configured
+
+	if !isLifecycleEvent(routed.EventType) && isTeamDisabled(routed.TeamID) {
+		routed.Skip = skipTeamDisabled
+		return routed
+	}
+	if residency.enabled() {
+		region, ok := residency.payloadRegion(payload)
+		if !ok && residency.Strict {
+			routed.Skip = skipNoRegion
+			return routed
+		}
+		routed.Region = region
+	}
+
+	// Check if event is configured
+	if _, ok := snapshot.byEventType[configured]; !ok {
+		routed.Skip = skipNotConfigured
+		return routed
+	}
+	attributes := snapshot.routeAttributes(routed.EventType, configured, payload)
+	config, ok := snapshot.lookupFilteredRoute(configured, attributes)
+	if !ok {
+		routed.Skip = skipNoRouteMatch
+		return routed
+	}
+	routed.Config = config
+	receivedAt := clock.Now()
+	routeHits.record(config.routeKey(), receivedAt)
+
+	// Collect relay metadata to attach to the published payload
+	var relayMetadata map[string]interface{}
+
+	if replayed {
+		setRelayMetadata(&relayMetadata, "replayed", true)
+		routed.Config.Channel = replayChannel(config.Channel)
+	}
+
+	if config.Stale.enabled() && !replayed {
+		if age, ok := eventAge(payload, receivedAt); ok && age > time.Duration(config.Stale.MaxAge) {
+			routed.Stale = config.Stale.action()
+			switch routed.Stale {
+			case staleDrop:
+				routed.Skip = skipStale
+				return routed
+			case staleFlag:
+				eventTime, _ := payloadEventTime(payload)
+				setRelayMetadata(&relayMetadata, "stale", staleMetadata(eventTime, age))
+			case staleDivert:
+				routed.Config.Channel = config.Stale.Channel
+			}
+		}
+	}
+
+	if config.Sensitive.enabled() {
+		if matches := detectSensitive(routed.EventType, routed.TeamID, config.Sensitive, payload); len(matches) > 0 {
+			routed.Sensitive = config.Sensitive.action()
+			setRelayMetadata(&relayMetadata, "sensitive", map[string]interface{}{"matches": matches, "action": routed.Sensitive})
+			if routed.Sensitive == sensitiveQuarantine {
+				routed.Config.Channel = config.Sensitive.Channel
+			}
+		}
+	}
+
+	// Stale events diverted to a backfill channel, quarantined events and
+	// replayed events are not held to active hours
+	if config.ActiveHours.enabled() && routed.Stale != staleDivert && routed.Sensitive != sensitiveQuarantine && !replayed && !config.ActiveHours.active(receivedAt) {
+		routed.OutsideHours = config.ActiveHours.action()
+		switch routed.OutsideHours {
+		case outsideHoursDrop:
+			routed.Skip = skipOutsideHours
+			return routed
+		case outsideHoursDivert:
+			routed.Config.Channel = config.ActiveHours.Channel
+		}
+	}
+
+	if len(config.Tags) > 0 {
+		setRelayMetadata(&relayMetadata, "tags", config.Tags)
+	}
+	if config.ExpandAuthorizations {
+		ctx, cancel := context.WithTimeout(context.Background(), slackAPITimeout)
+		authorizations, err := expandAuthorizations(ctx, payload)
+		cancel()
+		if err != nil {
+			logWarn("Could not expand authorizations for event type '%s': %v", routed.EventType, err)
+		} else {
+			setRelayMetadata(&relayMetadata, "authorizations", authorizations)
+		}
+	}
+
+	if config.Identity {
+		ctx, cancel := context.WithTimeout(context.Background(), slackAPITimeout)
+		if identity := identityMetadata(ctx, routed.EventType, payload); identity != nil {
+			setRelayMetadata(&relayMetadata, "identity", identity)
+		}
+		cancel()
+	}
+
+	if (config.ParseCommand || len(config.Commands) > 0) && routed.EventType == "app_mention" {
+		if command := parseMentionCommand(payload); command != nil {
+			setRelayMetadata(&relayMetadata, "command", command)
+		}
+	}
+
+	if config.DetectLanguage || len(config.Languages) > 0 {
+		language := attributes.Language
+		if len(config.Languages) == 0 {
+			language = payloadLanguage(payload)
+		}
+		if language != "" {
+			setRelayMetadata(&relayMetadata, "language", language)
+		}
+	}
+
+	if config.ExternalInfo || config.External != "" {
+		if external := externalMetadata(payload); external != nil {
+			setRelayMetadata(&relayMetadata, "external", external)
+		}
+	}
+
+	if config.FlattenText {
+		if text, ok := payloadPlainText(payload); ok {
+			setRelayMetadata(&relayMetadata, "plain_text", text)
+		}
+	}
+
+	if config.ExpandMembers && isSubteamEvent(routed.EventType) {
+		ctx, cancel := context.WithTimeout(context.Background(), slackAPITimeout)
+		subteam, err := subteamMetadata(ctx, payload)
+		cancel()
+		if err != nil {
+			logWarn("Could not expand user group members for event type '%s': %v", routed.EventType, err)
+		} else if subteam != nil {
+			setRelayMetadata(&relayMetadata, "subteam", subteam)
+		}
+	}
+
+	if config.State.enabled() {
+		if state := interactionState(routed.EventType, config.State, payload); state != nil {
+			setRelayMetadata(&relayMetadata, "state", state)
+		}
+	}
+
+	if config.NormalizeText.enabled() {
+		if normalized, changed := normalizedPayload(payload, config.NormalizeText); changed {
+			payload = normalized
+			encoded, err := json.Marshal(payload)
+			if err != nil {
+				logError("Error encoding normalized payload of event type '%s': %v", routed.EventType, err)
+			} else {
+				routed.Payload = encoded
+			}
+		}
+	}
+
+	if len(relayMetadata) > 0 {
+		enriched, err := withRelayMetadata(payload, relayMetadata)
+		if err != nil {
+			logError("Error attaching relay metadata: %v", err)
+		} else {
+			routed.Payload = enriched
+		}
+	}
+
+	limitPayloadSize(&routed, payload, relayMetadata)
+
+	if config.Encryption.enabled() {
+		encrypted, err := encryptPayload(routed.EventType, routed.Payload, config.Encryption)
+		if err != nil {
+			logError("Error encrypting payload of event type '%s' with key '%s': %v", routed.EventType, config.Encryption.KeyID, err)
+			metricEncryptionErrors.Inc(eventTypeLabel(routed.EventType))
+			routed.Skip = skipEncryptionFailed
+			return routed
+		}
+		routed.Payload = encrypted
+		routed.Encrypted = true
+	}
+	return routed
+}
+
+// setRelayMetadata sets a field of the relay metadata, creating the map on first
+// use so events without metadata do not allocate one
+func setRelayMetadata(metadata *map[string]interface{}, key string, value interface{}) {
+	if *metadata == nil {
+		*metadata = make(map[string]interface{})
+	}
+	(*metadata)[key] = value
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestGetEventType(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  map[string]interface{}
+		expected string
+	}{
+		{"event callback", map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{"type": "message"}}, "message"},
+		{"event callback without event", map[string]interface{}{"type": "event_callback"}, ""},
+		{"interactive payload", map[string]interface{}{"type": "block_actions"}, "block_actions"},
+		{"no type", map[string]interface{}{"text": "hello"}, ""},
+	}
+	for _, tt := range tests {
+		if got := getEventType(tt.payload); got != tt.expected {
+			t.Errorf("%s: getEventType() = %q, want %q", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestRouteEventSkipReasons(t *testing.T) {
+	setupTestEnvironment()
+
+	routed := routeEvent(map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{"type": "app_mention"}}, nil)
+	if routed.Skip != skipNotConfigured {
+		t.Errorf("expected skip %q, got %q", skipNotConfigured, routed.Skip)
+	}
+
+	raw := []byte(`{"type":"event_callback","event":{"type":"message"}}`)
+	routed = routeEvent(map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{"type": "message"}}, raw)
+	if routed.Skip != "" || routed.Config.Channel != "test-channel" || string(routed.Payload) != string(raw) {
+		t.Errorf("unexpected routing result: %+v", routed)
+	}
+}
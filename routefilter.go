@@ -0,0 +1,435 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Slack channel types a route can be limited to with channel-types
+var validChannelTypes = map[string]bool{
+	"channel":  true,
+	"group":    true,
+	"im":       true,
+	"mpim":     true,
+	"app_home": true,
+}
+
+// Containers a block_actions route can be limited to with container-types.
+// Actions in views are matched by the view's type.
+var validContainerTypes = map[string]bool{
+	"message":            true,
+	"message_attachment": true,
+	"modal":              true,
+	"home":               true,
+}
+
+// callbackIDTypes are the interactive payload types carrying a callback_id,
+// on their view or at the top level for shortcuts
+var callbackIDTypes = map[string]bool{
+	"block_actions":   true,
+	"view_submission": true,
+	"view_closed":     true,
+	"shortcut":        true,
+	"message_action":  true,
+}
+
+// routeAttributes are the attributes of a payload that routes can be limited to
+type routeAttributes struct {
+	// ChannelType is the channel_type of the event, e.g. "im"
+	ChannelType string
+	// Command is the command keyword of an app mention or the slash command
+	// without its slash, e.g. "deploy"
+	Command string
+	// Domains are the domains of the links of a link_shared event
+	Domains []string
+	// Language is the detected language of the event's text, e.g. "es"
+	Language string
+	// External is set for events from Slack Connect channels or external users
+	External bool
+	// ActionIDs are the action_ids of the actions of a block_actions payload
+	ActionIDs []string
+	// ContainerType is where the actions of a block_actions payload happened,
+	// e.g. "message" or "modal"
+	ContainerType string
+	// CallbackID is the callback_id of an interactive payload's view or shortcut
+	CallbackID string
+	// ChannelID, TeamID and UserID are the channel, workspace and user the
+	// payload came from
+	ChannelID string
+	TeamID    string
+	UserID    string
+}
+
+// routeMatcher records which attributes the filtered routes of an event type
+// match on, so only those are extracted from each payload
+type routeMatcher struct {
+	Command  bool
+	Domains  bool
+	Language bool
+	External bool
+	// Actions covers both action-ids and container-types
+	Actions    bool
+	CallbackID bool
+	ChannelID  bool
+	TeamID     bool
+	UserID     bool
+}
+
+// newRouteMatcher returns the matcher of the filtered routes of an event type
+func newRouteMatcher(routes []*EventConfig) routeMatcher {
+	var matcher routeMatcher
+	for _, config := range routes {
+		matcher.Command = matcher.Command || len(config.Commands) > 0
+		matcher.Domains = matcher.Domains || len(config.Domains) > 0
+		matcher.Language = matcher.Language || len(config.Languages) > 0
+		matcher.External = matcher.External || config.External != ""
+		matcher.Actions = matcher.Actions || len(config.ActionIDs) > 0 || len(config.ContainerTypes) > 0
+		matcher.CallbackID = matcher.CallbackID || len(config.CallbackIDs) > 0
+		matcher.ChannelID = matcher.ChannelID || len(config.ChannelIDs) > 0
+		matcher.TeamID = matcher.TeamID || len(config.TeamIDs) > 0
+		matcher.UserID = matcher.UserID || len(config.UserIDs) > 0
+	}
+	return matcher
+}
+
+// routeAttributes returns the attributes the routes of configured, the
+// slack-event-type handling eventType events, are matched against. Attributes
+// no route of configured filters on are left empty.
+func (s *configSnapshot) routeAttributes(eventType, configured string, payload map[string]interface{}) routeAttributes {
+	matcher := s.routeMatchers[configured]
+
+	attributes := routeAttributes{ChannelType: payloadChannelType(payload)}
+	if matcher.Language {
+		attributes.Language = payloadLanguage(payload)
+	}
+	if matcher.External {
+		attributes.External = payloadExternal(payload)
+	}
+	if matcher.Command && eventType == "app_mention" {
+		if command := parseMentionCommand(payload); command != nil {
+			attributes.Command = command.Name
+		}
+	}
+	if matcher.Command && eventType == slashCommandType {
+		command, _ := payload["command"].(string)
+		attributes.Command = strings.TrimPrefix(command, "/")
+	}
+	if matcher.Domains && eventType == linkSharedEventType {
+		attributes.Domains = payloadLinkDomains(payload)
+	}
+	if matcher.Actions && eventType == "block_actions" {
+		attributes.ActionIDs = payloadActionIDs(payload)
+		attributes.ContainerType = payloadContainerType(payload)
+	}
+	if matcher.CallbackID {
+		attributes.CallbackID = payloadCallbackID(payload)
+	}
+	if matcher.ChannelID {
+		attributes.ChannelID = payloadChannelID(payload)
+	}
+	if matcher.TeamID {
+		attributes.TeamID = payloadTeamID(payload)
+	}
+	if matcher.UserID {
+		attributes.UserID = payloadUserID(payload)
+	}
+	return attributes
+}
+
+// payloadChannelType returns the channel_type of an event callback's event,
+// e.g. "im" for a direct message to the bot, or an empty string when it has none
+func payloadChannelType(payload map[string]interface{}) string {
+	event, ok := payload["event"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	channelType, _ := event["channel_type"].(string)
+	return channelType
+}
+
+// payloadActionIDs returns the action_ids of the actions of a block_actions payload
+func payloadActionIDs(payload map[string]interface{}) []string {
+	actions, _ := payload["actions"].([]interface{})
+	ids := make([]string, 0, len(actions))
+	for _, item := range actions {
+		action, _ := item.(map[string]interface{})
+		if id, ok := action["action_id"].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// payloadContainerType returns the container.type of a block_actions payload,
+// or the view's type, "modal" or "home", for actions in a view
+func payloadContainerType(payload map[string]interface{}) string {
+	container, _ := payload["container"].(map[string]interface{})
+	containerType, _ := container["type"].(string)
+	if containerType == "view" {
+		view, _ := payload["view"].(map[string]interface{})
+		if viewType, ok := view["type"].(string); ok {
+			return viewType
+		}
+	}
+	return containerType
+}
+
+// payloadCallbackID returns the callback_id of an interactive payload's view,
+// or of the payload itself for shortcuts and message actions
+func payloadCallbackID(payload map[string]interface{}) string {
+	if view, ok := payload["view"].(map[string]interface{}); ok {
+		callbackID, _ := view["callback_id"].(string)
+		return callbackID
+	}
+	callbackID, _ := payload["callback_id"].(string)
+	return callbackID
+}
+
+// payloadChannelID returns the channel an event or interactive payload came
+// from: the event's channel, or the channel of the item reacted to or pinned,
+// the channel of interactive payloads, or the channel_id of slash commands
+func payloadChannelID(payload map[string]interface{}) string {
+	if event, ok := payload["event"].(map[string]interface{}); ok {
+		if id := objectID(event["channel"]); id != "" {
+			return id
+		}
+		if id, ok := event["channel_id"].(string); ok {
+			return id
+		}
+		item, _ := event["item"].(map[string]interface{})
+		id, _ := item["channel"].(string)
+		return id
+	}
+	if id := objectID(payload["channel"]); id != "" {
+		return id
+	}
+	id, _ := payload["channel_id"].(string)
+	return id
+}
+
+// payloadTeamID returns the workspace a payload came from: the team_id of event
+// callbacks and slash commands, or the team of interactive payloads
+func payloadTeamID(payload map[string]interface{}) string {
+	if id, ok := payload["team_id"].(string); ok && id != "" {
+		return id
+	}
+	return objectID(payload["team"])
+}
+
+// payloadUserID returns the user an event or interactive payload came from: the
+// event's user, the user of interactive payloads, or the user_id of slash commands
+func payloadUserID(payload map[string]interface{}) string {
+	if event, ok := payload["event"].(map[string]interface{}); ok {
+		return objectID(event["user"])
+	}
+	if id := objectID(payload["user"]); id != "" {
+		return id
+	}
+	id, _ := payload["user_id"].(string)
+	return id
+}
+
+// objectID returns value when it is an ID string, or the id of value when it is
+// an object, as Slack sends channels and users either way
+func objectID(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		id, _ := v["id"].(string)
+		return id
+	}
+	return ""
+}
+
+// filtered reports whether the route is limited to some payloads of its event type
+func (c EventConfig) filtered() bool {
+	return len(c.ChannelTypes) > 0 || len(c.Commands) > 0 || len(c.Domains) > 0 || len(c.Languages) > 0 || c.External != "" ||
+		len(c.ActionIDs) > 0 || len(c.ContainerTypes) > 0 || len(c.CallbackIDs) > 0 ||
+		len(c.ChannelIDs) > 0 || len(c.TeamIDs) > 0 || len(c.UserIDs) > 0
+}
+
+// accepts reports whether the route handles payloads with the given attributes.
+// Routes without filters accept every payload.
+func (c EventConfig) accepts(attributes routeAttributes) bool {
+	return c.rejectingFilter(attributes) == ""
+}
+
+// rejectingFilter returns the option of the first filter of the route that
+// payloads with the given attributes fail, e.g. "channel-types", or "" when
+// the route accepts them
+func (c EventConfig) rejectingFilter(attributes routeAttributes) string {
+	if len(c.ChannelTypes) > 0 && !containsString(c.ChannelTypes, attributes.ChannelType) {
+		return "channel-types"
+	}
+	if len(c.Commands) > 0 && !containsString(c.Commands, attributes.Command) {
+		return "commands"
+	}
+	if len(c.Domains) > 0 && !c.acceptsDomain(attributes.Domains) {
+		return "domains"
+	}
+	if len(c.Languages) > 0 && !containsString(c.Languages, attributes.Language) {
+		return "languages"
+	}
+	if (c.External == externalOnly && !attributes.External) || (c.External == externalExclude && attributes.External) {
+		return "external"
+	}
+	if len(c.ActionIDs) > 0 && !containsAny(c.ActionIDs, attributes.ActionIDs) {
+		return "action-ids"
+	}
+	if len(c.ContainerTypes) > 0 && !containsString(c.ContainerTypes, attributes.ContainerType) {
+		return "container-types"
+	}
+	if len(c.CallbackIDs) > 0 && !containsString(c.CallbackIDs, attributes.CallbackID) {
+		return "callback-ids"
+	}
+	if len(c.ChannelIDs) > 0 && !containsString(c.ChannelIDs, attributes.ChannelID) {
+		return "slack-channel-id"
+	}
+	if len(c.TeamIDs) > 0 && !containsString(c.TeamIDs, attributes.TeamID) {
+		return "team-id"
+	}
+	if len(c.UserIDs) > 0 && !containsString(c.UserIDs, attributes.UserID) {
+		return "user-id"
+	}
+	return ""
+}
+
+// acceptsDomain reports whether a link of one of domains belongs to the route's domains
+func (c EventConfig) acceptsDomain(domains []string) bool {
+	for _, domain := range domains {
+		if matchesDomain(c.Domains, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether values contains one of candidates
+func containsAny(values []string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if containsString(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeKey identifies a route within the configuration: its event type, plus its
+// filters when the event type is split across several routes
+func (c EventConfig) routeKey() string {
+	key := c.EventType
+	if len(c.ChannelTypes) > 0 {
+		key += "[channel-types=" + sortedJoin(c.ChannelTypes) + "]"
+	}
+	if len(c.Commands) > 0 {
+		key += "[commands=" + sortedJoin(c.Commands) + "]"
+	}
+	if len(c.Domains) > 0 {
+		key += "[domains=" + sortedJoin(c.Domains) + "]"
+	}
+	if len(c.Languages) > 0 {
+		key += "[languages=" + sortedJoin(c.Languages) + "]"
+	}
+	if c.External != "" {
+		key += "[external=" + c.External + "]"
+	}
+	if len(c.ActionIDs) > 0 {
+		key += "[action-ids=" + sortedJoin(c.ActionIDs) + "]"
+	}
+	if len(c.ContainerTypes) > 0 {
+		key += "[container-types=" + sortedJoin(c.ContainerTypes) + "]"
+	}
+	if len(c.CallbackIDs) > 0 {
+		key += "[callback-ids=" + sortedJoin(c.CallbackIDs) + "]"
+	}
+	if len(c.ChannelIDs) > 0 {
+		key += "[slack-channel-id=" + sortedJoin(c.ChannelIDs) + "]"
+	}
+	if len(c.TeamIDs) > 0 {
+		key += "[team-id=" + sortedJoin(c.TeamIDs) + "]"
+	}
+	if len(c.UserIDs) > 0 {
+		key += "[user-id=" + sortedJoin(c.UserIDs) + "]"
+	}
+	return key
+}
+
+// sortedJoin returns values sorted and joined with commas
+func sortedJoin(values []string) string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// validateRouteFilters checks that every route's channel-types are known Slack
+// channel types, that commands are only used on app_mention and slash_command
+// routes, that domains and unfurl templates are only used on link_shared
+// routes, that languages are ones the detector returns, that external filters
+// are valid and
+// that action-ids, container-types and callback-ids are only used on the
+// interactive payloads carrying them
+func validateRouteFilters(configs []EventConfig) error {
+	for _, config := range configs {
+		for _, channelType := range config.ChannelTypes {
+			if !validChannelTypes[channelType] {
+				return fmt.Errorf("route '%s' has invalid channel type '%s', expected one of channel, group, im, mpim or app_home", config.EventType, channelType)
+			}
+		}
+		if len(config.Commands) > 0 && config.EventType != "app_mention" && config.EventType != slashCommandType {
+			return fmt.Errorf("route '%s' has commands, which only apply to app_mention and slash_command routes", config.EventType)
+		}
+		if (len(config.Domains) > 0 || config.UnfurlTemplate != "") && config.EventType != linkSharedEventType {
+			return fmt.Errorf("route '%s' has domains or an unfurl template, which only apply to link_shared routes", config.EventType)
+		}
+		for _, language := range config.Languages {
+			if !detectableLanguages[language] {
+				return fmt.Errorf("route '%s' has language '%s', which is not detected; expected one of %s", config.EventType, language, strings.Join(sortedKeys(detectableLanguages), ", "))
+			}
+		}
+		switch config.External {
+		case "", externalOnly, externalExclude:
+		default:
+			return fmt.Errorf("route '%s' has invalid external filter '%s', expected only or exclude", config.EventType, config.External)
+		}
+		if (len(config.ActionIDs) > 0 || len(config.ContainerTypes) > 0) && config.EventType != "block_actions" {
+			return fmt.Errorf("route '%s' has action-ids or container-types, which only apply to block_actions routes", config.EventType)
+		}
+		for _, containerType := range config.ContainerTypes {
+			if !validContainerTypes[containerType] {
+				return fmt.Errorf("route '%s' has invalid container type '%s', expected one of message, message_attachment, modal or home", config.EventType, containerType)
+			}
+		}
+		if len(config.CallbackIDs) > 0 && !callbackIDTypes[config.EventType] {
+			return fmt.Errorf("route '%s' has callback-ids, which only apply to %s routes", config.EventType, strings.Join(sortedKeys(callbackIDTypes), ", "))
+		}
+	}
+	return nil
+}
+
+// lookupFilteredRoute returns the route of configured, the slack-event-type
+// returned by matchEventType, handling payloads with the given attributes.
+// Routes with filters are tried in order before the route without filters.
+func (s *configSnapshot) lookupFilteredRoute(configured string, attributes routeAttributes) (EventConfig, bool) {
+	for _, config := range s.filteredRoutes[configured] {
+		if config.accepts(attributes) {
+			return *config, true
+		}
+	}
+	config, ok := s.byEventType[configured]
+	if !ok || !config.accepts(attributes) {
+		return EventConfig{}, false
+	}
+	return *config, true
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRouteEventByChannelType(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "slack-messages"},
+		{EventType: "message", Channel: "slack-dms", ChannelTypes: []string{"im", "mpim"}},
+		{EventType: "app_mention", Channel: "slack-mentions", ChannelTypes: []string{"channel"}},
+	})
+	defer setupTestEnvironment()
+
+	event := func(eventType string, channelType string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":  "event_callback",
+			"event": map[string]interface{}{"type": eventType, "channel_type": channelType},
+		}
+	}
+
+	tests := []struct {
+		eventType   string
+		channelType string
+		channel     string
+		skip        string
+	}{
+		{"message", "im", "slack-dms", ""},
+		{"message", "mpim", "slack-dms", ""},
+		{"message", "channel", "slack-messages", ""},
+		{"message", "", "slack-messages", ""},
+		{"app_mention", "channel", "slack-mentions", ""},
+		{"app_mention", "group", "", skipNoRouteMatch},
+	}
+	for _, tt := range tests {
+		routed := routeEvent(event(tt.eventType, tt.channelType), nil)
+		if routed.Skip != tt.skip || routed.Config.Channel != tt.channel {
+			t.Errorf("%s in %q: expected channel %q and skip %q, got %q and %q",
+				tt.eventType, tt.channelType, tt.channel, tt.skip, routed.Config.Channel, routed.Skip)
+		}
+	}
+
+	if config, ok := lookupEventConfig("message"); !ok || config.Channel != "slack-messages" {
+		t.Errorf("expected the lookup to prefer the route without channel types, got %+v", config)
+	}
+}
+
+func TestParseEventConfigChannelTypes(t *testing.T) {
+	configs, err := parseEventConfig([]byte(`[
+		{"slack-event-type": "message", "channel": "slack-messages"},
+		{"slack-event-type": "message", "channel": "slack-dms", "channel-types": ["im"]}
+	]
+	[
+		{"slack-event-type": "message", "channel": "direct-messages", "channel-types": ["im"]}
+	]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(configs) != 2 || configs[1].Channel != "direct-messages" {
+		t.Errorf("expected routes to be merged by event type and channel types, got %+v", configs)
+	}
+
+	_, err = parseEventConfig([]byte(`[{"slack-event-type": "message", "channel": "x", "channel-types": ["dm"]}]`))
+	if err == nil || !strings.Contains(err.Error(), "invalid channel type 'dm'") {
+		t.Errorf("expected an invalid channel type error, got %v", err)
+	}
+}
+
+func TestRouteBlockActionsByContainer(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "block_actions", Channel: "slack-approval-modals", ActionIDs: []string{"approve"}, ContainerTypes: []string{"modal"}, CallbackIDs: []string{"approval_form"}},
+		{EventType: "block_actions", Channel: "slack-approval-messages", ActionIDs: []string{"approve"}, ContainerTypes: []string{"message"}},
+		{EventType: "block_actions", Channel: "slack-home", ContainerTypes: []string{"home"}},
+		{EventType: "block_actions", Channel: "slack-actions"},
+	})
+	defer setupTestEnvironment()
+
+	payload := func(actionID string, containerType string, view map[string]interface{}) map[string]interface{} {
+		payload := map[string]interface{}{
+			"type":      "block_actions",
+			"actions":   []interface{}{map[string]interface{}{"action_id": actionID}},
+			"container": map[string]interface{}{"type": containerType},
+		}
+		if view != nil {
+			payload["view"] = view
+		}
+		return payload
+	}
+	modal := map[string]interface{}{"type": "modal", "callback_id": "approval_form"}
+
+	tests := []struct {
+		name    string
+		payload map[string]interface{}
+		channel string
+	}{
+		{"approve in the approval modal", payload("approve", "view", modal), "slack-approval-modals"},
+		{"approve in another modal", payload("approve", "view", map[string]interface{}{"type": "modal", "callback_id": "other"}), "slack-actions"},
+		{"approve in a message", payload("approve", "message", nil), "slack-approval-messages"},
+		{"approve in the app home", payload("approve", "view", map[string]interface{}{"type": "home"}), "slack-home"},
+		{"another action in a message", payload("deny", "message", nil), "slack-actions"},
+	}
+	for _, tt := range tests {
+		if routed := routeEvent(tt.payload, nil); routed.Config.Channel != tt.channel {
+			t.Errorf("%s: expected channel %q, got %q", tt.name, tt.channel, routed.Config.Channel)
+		}
+	}
+}
+
+func TestParseEventConfigInteractiveFilters(t *testing.T) {
+	configs, err := parseEventConfig([]byte(`[
+		{"slack-event-type": "view_submission", "channel": "slack-approvals", "callback-ids": ["approval_form"]},
+		{"slack-event-type": "block_actions", "channel": "slack-modal-actions", "container-types": ["modal"]}
+	]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if configs[0].routeKey() != "view_submission[callback-ids=approval_form]" || configs[1].routeKey() != "block_actions[container-types=modal]" {
+		t.Errorf("unexpected route keys %q and %q", configs[0].routeKey(), configs[1].routeKey())
+	}
+
+	for config, want := range map[string]string{
+		`{"slack-event-type": "block_actions", "channel": "x", "container-types": ["view"]}`: "invalid container type 'view'",
+		`{"slack-event-type": "view_submission", "channel": "x", "action-ids": ["approve"]}`: "only apply to block_actions routes",
+		`{"slack-event-type": "message", "channel": "x", "callback-ids": ["approval_form"]}`: "has callback-ids",
+	} {
+		if _, err := parseEventConfig([]byte("[" + config + "]")); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, got %v", config, want, err)
+		}
+	}
+}
+
+func TestRouteEventByOrigin(t *testing.T) {
+	configs, err := parseEventConfig([]byte(`[
+		{"slack-event-type": "message", "channel": "slack-incidents", "slack-channel-id": "C0INCIDENT"},
+		{"slack-event-type": "message", "channel": "slack-vip", "team-id": "T0PARTNER", "user-id": ["U0CEO", "U0CTO"]},
+		{"slack-event-type": "message", "channel": "slack-partner", "team-id": "T0PARTNER"},
+		{"slack-event-type": "message", "channel": "slack-messages"},
+		{"slack-event-type": "block_actions", "channel": "slack-incident-actions", "slack-channel-id": ["C0INCIDENT"]}
+	]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	setEventConfigs(configs)
+	defer setupTestEnvironment()
+
+	message := func(teamID string, channelID string, userID string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":    "event_callback",
+			"team_id": teamID,
+			"event":   map[string]interface{}{"type": "message", "channel": channelID, "user": userID},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		payload map[string]interface{}
+		channel string
+	}{
+		{"incident channel", message("T0HOME", "C0INCIDENT", "U1"), "slack-incidents"},
+		{"partner executive", message("T0PARTNER", "C0GENERAL", "U0CTO"), "slack-vip"},
+		{"partner user", message("T0PARTNER", "C0GENERAL", "U1"), "slack-partner"},
+		{"anyone else", message("T0HOME", "C0GENERAL", "U1"), "slack-messages"},
+		{"interactive payload", map[string]interface{}{
+			"type":    "block_actions",
+			"team":    map[string]interface{}{"id": "T0HOME"},
+			"channel": map[string]interface{}{"id": "C0INCIDENT"},
+			"user":    map[string]interface{}{"id": "U1"},
+		}, "slack-incident-actions"},
+	}
+	for _, tt := range tests {
+		if routed := routeEvent(tt.payload, nil); routed.Config.Channel != tt.channel {
+			t.Errorf("%s: expected channel %q, got %q (skip %q)", tt.name, tt.channel, routed.Config.Channel, routed.Skip)
+		}
+	}
+
+	if _, err := parseEventConfig([]byte(`[{"slack-event-type": "message", "channel": "x", "team-id": 42}]`)); err == nil {
+		t.Error("expected a team-id that is not a string or list to be rejected")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// defaultRouteHitsSyncInterval is how often last hits are mirrored to Redis
+	defaultRouteHitsSyncInterval = 30 * time.Second
+	// routeLastHitMetric is the name of the last hit per route gauge
+	routeLastHitMetric = "slack_relay_route_last_hit_timestamp_seconds"
+	// routeHitResolution is the precision of last hits, which are exported in
+	// seconds
+	routeHitResolution = time.Second
+)
+
+// routeHitTracker records when each route last matched an event
+type routeHitTracker struct {
+	mu   sync.RWMutex
+	hits map[string]time.Time
+	// dirty are the keys of the routes hit since the last sync to Redis
+	dirty map[string]bool
+}
+
+// routeHits holds the last hit of each route, by route key
+var routeHits = newRouteHitTracker()
+
+func init() {
+	metricsRegistry = append(metricsRegistry, routeHitsCollector{})
+	newGaugeFunc("slack_relay_routes_never_hit", "Routes that have not matched an event since the relay started, or ever when last hits are mirrored to Redis.", func() float64 {
+		return float64(len(routeHits.idleRoutes(currentEventConfigs(), time.Time{})))
+	})
+}
+
+// newRouteHitTracker creates an empty routeHitTracker
+func newRouteHitTracker() *routeHitTracker {
+	return &routeHitTracker{hits: make(map[string]time.Time), dirty: make(map[string]bool)}
+}
+
+// record notes that the route with key matched an event at now. Hits within
+// routeHitResolution of the last one are not recorded, so busy routes mostly
+// take the read lock.
+func (t *routeHitTracker) record(key string, now time.Time) {
+	t.mu.RLock()
+	last := t.hits[key]
+	t.mu.RUnlock()
+	if now.Sub(last) < routeHitResolution {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.After(t.hits[key]) {
+		t.hits[key] = now
+		t.dirty[key] = true
+	}
+}
+
+// lastHit returns when the route with key last matched an event
+func (t *routeHitTracker) lastHit(key string) (time.Time, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	hit, ok := t.hits[key]
+	return hit, ok
+}
+
+// idleRoutes returns the routes of configs that have not matched an event
+// since cutoff, including those that never did
+func (t *routeHitTracker) idleRoutes(configs []EventConfig, cutoff time.Time) []EventConfig {
+	var idle []EventConfig
+	for _, config := range configs {
+		if hit, ok := t.lastHit(config.routeKey()); !ok || hit.Before(cutoff) {
+			idle = append(idle, config)
+		}
+	}
+	return idle
+}
+
+// takeDirty removes and returns the last hits recorded since the last sync
+func (t *routeHitTracker) takeDirty() map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dirty := make(map[string]time.Time, len(t.dirty))
+	for key := range t.dirty {
+		dirty[key] = t.hits[key]
+	}
+	t.dirty = make(map[string]bool)
+	return dirty
+}
+
+// restoreDirty marks last hits that could not be synced for the next sync
+func (t *routeHitTracker) restoreDirty(hits map[string]time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range hits {
+		t.dirty[key] = true
+	}
+}
+
+// merge adds last hits recorded elsewhere, keeping the latest hit of each route
+func (t *routeHitTracker) merge(hits map[string]time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, hit := range hits {
+		if hit.After(t.hits[key]) {
+			t.hits[key] = hit
+		}
+	}
+}
+
+// sync mirrors the last hits recorded since the previous sync to the sorted
+// set at key, scored by Unix milliseconds, and merges in the hits recorded by
+// the other replicas
+func (t *routeHitTracker) sync(ctx context.Context, key string) error {
+	if redisClient == nil {
+		return errRedisUnavailable
+	}
+	dirty := t.takeDirty()
+	if len(dirty) > 0 {
+		_, err := redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for route, hit := range dirty {
+				// GT never moves a route's last hit back in time
+				pipe.ZAddGT(ctx, key, redis.Z{Score: float64(hit.UnixMilli()), Member: route})
+			}
+			return nil
+		})
+		if err != nil {
+			t.restoreDirty(dirty)
+			return err
+		}
+	}
+
+	members, err := redisClient.ZRangeWithScores(ctx, key, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	hits := make(map[string]time.Time, len(members))
+	for _, member := range members {
+		if route, ok := member.Member.(string); ok {
+			hits[route] = time.UnixMilli(int64(member.Score))
+		}
+	}
+	t.merge(hits)
+	return nil
+}
+
+// watchRouteHits syncs the last hits with the sorted set at key every interval
+func watchRouteHits(ctx context.Context, key string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		syncCtx, cancel := context.WithTimeout(ctx, interval)
+		if err := routeHits.sync(syncCtx, key); err != nil {
+			logWarn("Error syncing route last hits with Redis key '%s': %v", key, err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// routeHitsCollector writes routeLastHitMetric for the active routes
+type routeHitsCollector struct{}
+
+// writeMetrics writes the last hit of each route that matched an event
+func (routeHitsCollector) writeMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", routeLastHitMetric,
+		"Unix time each route last matched an event.", routeLastHitMetric)
+	for _, config := range currentEventConfigs() {
+		hit, ok := routeHits.lastHit(config.routeKey())
+		if !ok {
+			continue
+		}
+		labels := formatLabels([]string{"event_type", "channel"}, []string{config.EventType, config.Channel})
+		fmt.Fprintf(w, "%s%s %.3f\n", routeLastHitMetric, labels, float64(hit.UnixMilli())/1e3)
+	}
+}
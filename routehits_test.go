@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteHitTracker(t *testing.T) {
+	tracker := newRouteHitTracker()
+	now := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+	tracker.record("message", now)
+	tracker.record("message", now.Add(-time.Minute))
+	if hit, ok := tracker.lastHit("message"); !ok || !hit.Equal(now) {
+		t.Errorf("expected the last hit to stay at %s, got %s", now, hit)
+	}
+
+	tracker.merge(map[string]time.Time{"message": now.Add(-time.Hour), "app_mention": now.Add(time.Second)})
+	if hit, _ := tracker.lastHit("message"); !hit.Equal(now) {
+		t.Errorf("expected an older remote hit to be ignored, got %s", hit)
+	}
+	if hit, ok := tracker.lastHit("app_mention"); !ok || !hit.Equal(now.Add(time.Second)) {
+		t.Errorf("expected a remote hit to be merged, got %s", hit)
+	}
+
+	configs := []EventConfig{
+		{EventType: "message", Channel: "slack-messages"},
+		{EventType: "app_mention", Channel: "slack-mentions"},
+		{EventType: "reaction_added", Channel: "slack-reactions"},
+	}
+	idle := tracker.idleRoutes(configs, now.Add(time.Millisecond))
+	if len(idle) != 2 || idle[0].EventType != "message" || idle[1].EventType != "reaction_added" {
+		t.Errorf("expected message and reaction_added to be idle, got %+v", idle)
+	}
+	if never := tracker.idleRoutes(configs, time.Time{}); len(never) != 1 || never[0].EventType != "reaction_added" {
+		t.Errorf("expected only reaction_added to never be hit, got %+v", never)
+	}
+}
+
+func TestRouteHitTrackerSyncWithoutRedis(t *testing.T) {
+	tracker := newRouteHitTracker()
+	tracker.record("message", time.Now())
+	if err := tracker.sync(context.Background(), "slack-relay:route-hits"); err != errRedisUnavailable {
+		t.Fatalf("expected errRedisUnavailable, got %v", err)
+	}
+	if dirty := tracker.takeDirty(); len(dirty) != 1 {
+		t.Errorf("expected the unsynced hit to be kept, got %v", dirty)
+	}
+	if dirty := tracker.takeDirty(); len(dirty) != 0 {
+		t.Errorf("expected no hits left to sync, got %v", dirty)
+	}
+}
+
+func TestRouteLastHitMetric(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "slack-messages"},
+		{EventType: "app_mention", Channel: "slack-mentions"},
+	})
+	defer setupTestEnvironment()
+	original := routeHits
+	routeHits = newRouteHitTracker()
+	defer func() { routeHits = original }()
+	routeHits.record("message", time.Unix(1893456000, 500*int64(time.Millisecond)))
+
+	var b bytes.Buffer
+	routeHitsCollector{}.writeMetrics(&b)
+	if !strings.Contains(b.String(), `slack_relay_route_last_hit_timestamp_seconds{event_type="message",channel="slack-messages"} 1893456000.500`) {
+		t.Errorf("expected the message route's last hit, got:\n%s", b.String())
+	}
+	if strings.Contains(b.String(), "app_mention") {
+		t.Errorf("expected no series for a route never hit, got:\n%s", b.String())
+	}
+}
+
+func TestRoutesHandlerIdle(t *testing.T) {
+	adminToken = "admin-secret"
+	defer func() { adminToken = "" }()
+	setEventConfigs([]EventConfig{
+		{EventType: "message", Channel: "slack-messages"},
+		{EventType: "app_mention", Channel: "slack-mentions"},
+	})
+	defer setupTestEnvironment()
+	original := routeHits
+	routeHits = newRouteHitTracker()
+	defer func() { routeHits = original }()
+	routeHits.record("message", time.Now())
+	routeHits.record("app_mention", time.Now().Add(-48*time.Hour))
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/routes?idle=24h", nil)
+	request.Header.Set("Authorization", "Bearer admin-secret")
+	routesHandler(recorder, request)
+
+	var response struct {
+		Routes []struct {
+			Route string `json:"route"`
+		} `json:"routes"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(response.Routes) != 1 || response.Routes[0].Route != "app_mention" {
+		t.Errorf("expected only app_mention to be idle, got %+v", response.Routes)
+	}
+
+	recorder = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodGet, "/admin/routes?idle=soon", nil)
+	request.Header.Set("Authorization", "Bearer admin-secret")
+	routesHandler(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid duration, got %d", recorder.Code)
+	}
+}
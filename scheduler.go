@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSlackScheduleAhead is how far ahead chat.scheduleMessage accepts post_at
+	maxSlackScheduleAhead = 120 * 24 * time.Hour
+	// minSlackScheduleLead is the least time ahead a message is scheduled with
+	// Slack; messages due sooner are posted right away
+	minSlackScheduleLead = 10 * time.Second
+	// defaultScheduleQueueSize caps the messages held in the local fallback queue
+	defaultScheduleQueueSize = 10000
+	// defaultScheduleCheckInterval is how often the local fallback queue is checked for due messages
+	defaultScheduleCheckInterval = time.Second
+)
+
+// Outcomes of a scheduled message, the result label of slack_relay_outbound_messages_total
+const (
+	scheduleResultScheduled = "scheduled"
+	scheduleResultQueued    = "queued"
+	scheduleResultPosted    = "posted"
+)
+
+func init() {
+	newGaugeFunc("slack_relay_scheduled_messages_pending", "Messages held in the local fallback queue until they are due.", func() float64 {
+		if scheduler == nil {
+			return 0
+		}
+		return float64(scheduler.depth())
+	})
+}
+
+// scheduler holds messages Slack could not schedule; nil unless OUTBOUND_CHANNEL is set
+var scheduler *messageScheduler
+
+// scheduledMessage is an outbound Slack message to post at PostAt
+type scheduledMessage struct {
+	PostAt time.Time
+	// Params are the chat.postMessage arguments, e.g. channel, text and blocks
+	Params url.Values
+}
+
+// messageScheduler schedules outbound messages with chat.scheduleMessage, holding
+// those Slack cannot schedule in a local queue until they are due
+type messageScheduler struct {
+	mu sync.Mutex
+	// pending is sorted by PostAt
+	pending    []scheduledMessage
+	maxPending int
+	// schedule and post call chat.scheduleMessage and chat.postMessage, overridable in tests
+	schedule func(ctx context.Context, params url.Values) error
+	post     func(ctx context.Context, params url.Values) error
+}
+
+// newMessageScheduler returns a scheduler holding at most maxPending messages
+// locally, calling the Slack API with the bot token
+func newMessageScheduler(maxPending int) *messageScheduler {
+	return &messageScheduler{
+		maxPending: maxPending,
+		schedule: func(ctx context.Context, params url.Values) error {
+			return callSlackBotAPI(ctx, "chat.scheduleMessage", params, nil)
+		},
+		post: func(ctx context.Context, params url.Values) error {
+			return callSlackBotAPI(ctx, "chat.postMessage", params, nil)
+		},
+	}
+}
+
+// submit schedules message with Slack, posts it right away when it is due, or
+// queues it locally when Slack cannot schedule it. It returns the outcome.
+func (s *messageScheduler) submit(ctx context.Context, message scheduledMessage, now time.Time) string {
+	channel := message.Params.Get("channel")
+	switch {
+	case message.PostAt.Before(now.Add(minSlackScheduleLead)):
+		return s.postNow(ctx, message)
+	case message.PostAt.After(now.Add(maxSlackScheduleAhead)):
+		logDebug("Holding message to '%s' for %s locally, beyond Slack's scheduling limit", channel, message.PostAt.Format(time.RFC3339))
+		return s.enqueue(message)
+	}
+
+	params := cloneValues(message.Params)
+	params.Set("post_at", strconv.FormatInt(message.PostAt.Unix(), 10))
+	if err := s.schedule(ctx, params); err != nil {
+		logWarn("Could not schedule message to '%s' with Slack, holding it locally: %v", channel, err)
+		return s.enqueue(message)
+	}
+	logInfo("Scheduled message to '%s' for %s", channel, message.PostAt.Format(time.RFC3339))
+	return scheduleResultScheduled
+}
+
+// postNow posts message with chat.postMessage
+func (s *messageScheduler) postNow(ctx context.Context, message scheduledMessage) string {
+	channel := message.Params.Get("channel")
+	if err := s.post(ctx, message.Params); err != nil {
+		logWarn("Error posting scheduled message to '%s': %v", channel, err)
+		return outboundResultFailed
+	}
+	logInfo("Posted scheduled message to '%s'", channel)
+	return scheduleResultPosted
+}
+
+// enqueue adds message to the local queue, keeping it sorted by PostAt
+func (s *messageScheduler) enqueue(message scheduledMessage) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) >= s.maxPending {
+		logWarn("Local schedule queue full, dropping message to '%s'", message.Params.Get("channel"))
+		return outboundResultDropped
+	}
+	i := sort.Search(len(s.pending), func(i int) bool {
+		return s.pending[i].PostAt.After(message.PostAt)
+	})
+	s.pending = append(s.pending, scheduledMessage{})
+	copy(s.pending[i+1:], s.pending[i:])
+	s.pending[i] = message
+	return scheduleResultQueued
+}
+
+// due removes and returns the queued messages due at now
+func (s *messageScheduler) due(now time.Time) []scheduledMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := sort.Search(len(s.pending), func(i int) bool {
+		return s.pending[i].PostAt.After(now)
+	})
+	due := append([]scheduledMessage(nil), s.pending[:i]...)
+	s.pending = s.pending[i:]
+	return due
+}
+
+// depth returns the number of locally queued messages
+func (s *messageScheduler) depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// cloneValues returns a copy of values
+func cloneValues(values url.Values) url.Values {
+	clone := make(url.Values, len(values))
+	for key, value := range values {
+		clone[key] = append([]string(nil), value...)
+	}
+	return clone
+}
+
+// watchScheduledMessages posts locally queued messages once they are due, until
+// ctx is cancelled
+func watchScheduledMessages(ctx context.Context, s *messageScheduler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, message := range s.due(now) {
+				postCtx, cancel := context.WithTimeout(ctx, slackAPITimeout)
+				metricOutboundMessages.Inc(outboundOpSchedule, s.postNow(postCtx, message))
+				cancel()
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMessageSchedulerSubmit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var scheduled, posted []url.Values
+	scheduleErr := error(nil)
+	s := newMessageScheduler(2)
+	s.schedule = func(ctx context.Context, params url.Values) error {
+		scheduled = append(scheduled, params)
+		return scheduleErr
+	}
+	s.post = func(ctx context.Context, params url.Values) error {
+		posted = append(posted, params)
+		return nil
+	}
+	message := func(postAt time.Time) scheduledMessage {
+		return scheduledMessage{PostAt: postAt, Params: url.Values{"channel": {"C123"}, "text": {"hi"}}}
+	}
+
+	if result := s.submit(context.Background(), message(now.Add(time.Hour)), now); result != scheduleResultScheduled {
+		t.Errorf("expected the message to be scheduled with Slack, got %s", result)
+	}
+	if len(scheduled) != 1 || scheduled[0].Get("post_at") != "1700003600" {
+		t.Errorf("expected chat.scheduleMessage with post_at, got %v", scheduled)
+	}
+
+	if result := s.submit(context.Background(), message(now.Add(-time.Minute)), now); result != scheduleResultPosted || len(posted) != 1 {
+		t.Errorf("expected a message due now to be posted, got %s", result)
+	}
+
+	if result := s.submit(context.Background(), message(now.Add(200*24*time.Hour)), now); result != scheduleResultQueued {
+		t.Errorf("expected a message beyond Slack's limit to be queued, got %s", result)
+	}
+
+	scheduleErr = errors.New("slack API chat.scheduleMessage error: ratelimited")
+	if result := s.submit(context.Background(), message(now.Add(2*time.Hour)), now); result != scheduleResultQueued {
+		t.Errorf("expected a message Slack rejects to be queued, got %s", result)
+	}
+	if result := s.submit(context.Background(), message(now.Add(3*time.Hour)), now); result != outboundResultDropped {
+		t.Errorf("expected a message to be dropped when the queue is full, got %s", result)
+	}
+	if s.depth() != 2 {
+		t.Fatalf("expected 2 queued messages, got %d", s.depth())
+	}
+
+	if due := s.due(now.Add(time.Hour)); len(due) != 0 {
+		t.Errorf("expected no due messages, got %d", len(due))
+	}
+	due := s.due(now.Add(2 * time.Hour))
+	if len(due) != 1 || !due[0].PostAt.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("expected the earliest message to be due, got %v", due)
+	}
+	if s.depth() != 1 {
+		t.Errorf("expected 1 queued message left, got %d", s.depth())
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultURLVerificationRate is the url_verification challenges answered per minute
+	defaultURLVerificationRate = 30
+	// maxCachedChallenges bounds the url_verification responses kept for Slack's
+	// retries of a challenge
+	maxCachedChallenges = 64
+)
+
+// Reasons requests are rejected before their body is read
+const (
+	screenMissingHeaders     = "missing_headers"
+	screenStaleTimestamp     = "stale_timestamp"
+	screenMalformedSignature = "malformed_signature"
+)
+
+var metricScreenedRequests = newCounterVec("slack_relay_screened_requests_total",
+	"Requests rejected from their headers before the body was read, by reason.", "reason")
+var metricURLVerificationLimited = newCounterVec("slack_relay_url_verification_limited_total",
+	"url_verification challenges rejected over URL_VERIFICATION_RATE.")
+
+// invalidSignatureResponse is the body of requests rejected as unsigned
+var invalidSignatureResponse = []byte("Invalid signature\n")
+
+// screenRequest checks the Slack headers of r before its body is read, so
+// scanner and bot traffic is turned away without reading or hashing a body. It
+// returns why r can never pass signature verification, or "" to go on. Without
+// a signing secret every request goes on.
+func screenRequest(r *http.Request) string {
+	if len(getSigningSecret()) == 0 {
+		return ""
+	}
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	signature := r.Header.Get("X-Slack-Signature")
+	if timestamp == "" || signature == "" {
+		// Slack's ssl_check probe of slash command URLs is an unsigned form post
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			return ""
+		}
+		return screenMissingHeaders
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || absInt64(clock.Now().Unix()-ts) > slackTimestampToleranceSeconds {
+		return screenStaleTimestamp
+	}
+	if !strings.HasPrefix(signature, "v0=") {
+		return screenMalformedSignature
+	}
+	return ""
+}
+
+// rejectScreened answers a request that failed screenRequest
+func rejectScreened(w http.ResponseWriter, r *http.Request, reason string) {
+	logDebug("Rejecting request from %s before reading its body: %s", clientIP(r), reason)
+	metricScreenedRequests.Inc(reason)
+	recordAbuse(r, abuseInvalidSignature)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusUnauthorized)
+	if _, err := w.Write(invalidSignatureResponse); err != nil {
+		logError("Error writing response: %v", err)
+	}
+}
+
+// urlVerificationLimiter caps the url_verification challenges answered per
+// minute, and caches the responses to the latest challenges so Slack's retries
+// of one are answered without encoding it again
+type urlVerificationLimiter struct {
+	mu sync.Mutex
+	// rate is the challenges answered per minute, 0 for no limit
+	rate        int
+	windowStart time.Time
+	answered    int
+	responses   map[string][]byte
+}
+
+// urlVerifications limits the relay's url_verification responses
+var urlVerifications = &urlVerificationLimiter{rate: defaultURLVerificationRate}
+
+// allow reports whether a challenge may be answered at now, counting it
+func (l *urlVerificationLimiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return true
+	}
+	if now.Sub(l.windowStart) >= time.Minute {
+		l.windowStart = now
+		l.answered = 0
+	}
+	if l.answered >= l.rate {
+		return false
+	}
+	l.answered++
+	return true
+}
+
+// response returns the JSON response to challenge
+func (l *urlVerificationLimiter) response(challenge string) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cached, ok := l.responses[challenge]; ok {
+		return cached
+	}
+	encoded, _ := json.Marshal(map[string]string{"challenge": challenge})
+	encoded = append(encoded, '\n')
+	if l.responses == nil || len(l.responses) >= maxCachedChallenges {
+		l.responses = make(map[string][]byte)
+	}
+	l.responses[challenge] = encoded
+	return encoded
+}
+
+// answerURLVerification responds to a url_verification challenge, asking Slack
+// to retry later once too many challenges were answered this minute
+func answerURLVerification(w http.ResponseWriter, r *http.Request, challenge string) {
+	if !urlVerifications.allow(clock.Now()) {
+		logWarn("Rate limiting URL verification challenge from %s", clientIP(r))
+		metricURLVerificationLimited.Inc()
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Too many URL verification challenges", http.StatusTooManyRequests)
+		return
+	}
+	logInfo("Responding to URL verification challenge")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(urlVerifications.response(challenge)); err != nil {
+		logError("Error writing response: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScreenRequest(t *testing.T) {
+	setupTestEnvironment()
+	defer setupTestEnvironment()
+
+	unsigned := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(`{"type":"event_callback"}`))
+	unsigned.Header.Set("Content-Type", "application/json")
+	if reason := screenRequest(unsigned); reason != "" {
+		t.Errorf("expected requests to go on without a signing secret, got %q", reason)
+	}
+
+	signingSecret = []byte("test-secret")
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	tests := []struct {
+		name        string
+		contentType string
+		timestamp   string
+		signature   string
+		want        string
+	}{
+		{"no headers", "application/json", "", "", screenMissingHeaders},
+		{"unsigned form", "application/x-www-form-urlencoded", "", "", ""},
+		{"stale timestamp", "application/json", stale, "v0=abc", screenStaleTimestamp},
+		{"invalid timestamp", "application/json", "yesterday", "v0=abc", screenStaleTimestamp},
+		{"malformed signature", "application/json", now, "abc", screenMalformedSignature},
+		{"well-formed", "application/json", now, "v0=abc", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", tt.contentType)
+		if tt.timestamp != "" {
+			req.Header.Set("X-Slack-Request-Timestamp", tt.timestamp)
+		}
+		if tt.signature != "" {
+			req.Header.Set("X-Slack-Signature", tt.signature)
+		}
+		if got := screenRequest(req); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestSlackHandlerScreensUnsignedRequests(t *testing.T) {
+	setupTestEnvironment()
+	defer setupTestEnvironment()
+	signingSecret = []byte("test-secret")
+
+	before := metricScreenedRequests.values[screenMissingHeaders]
+	req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(`{"type":"event_callback"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	slackHandler(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rr.Code)
+	}
+	if got := metricScreenedRequests.values[screenMissingHeaders] - before; got != 1 {
+		t.Errorf("expected 1 screened request, got %v", got)
+	}
+}
+
+func TestURLVerificationLimiter(t *testing.T) {
+	original := urlVerifications
+	urlVerifications = &urlVerificationLimiter{rate: 2}
+	defer func() { urlVerifications = original }()
+	setupTestEnvironment()
+	defer setupTestEnvironment()
+
+	challenge := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(`{"type":"url_verification","challenge":"abc123"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		slackHandler(rr, req)
+		return rr
+	}
+	for i := 0; i < 2; i++ {
+		if rr := challenge(); rr.Code != http.StatusOK || rr.Body.String() != "{\"challenge\":\"abc123\"}\n" {
+			t.Fatalf("expected the challenge to be answered, got %d %q", rr.Code, rr.Body.String())
+		}
+	}
+	if rr := challenge(); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After over the rate, got %d", rr.Code)
+	}
+
+	now := time.Now()
+	if !urlVerifications.allow(now.Add(time.Minute)) {
+		t.Error("expected challenges to be answered again the next minute")
+	}
+}
@@ -0,0 +1,63 @@
+#!/bin/sh
+# Compares benchmark results against a stored baseline and fails when any
+# benchmark's mean ns/op regressed by more than BENCH_TOLERANCE percent.
+#
+# usage: scripts/bench-compare.sh BASELINE RESULTS
+set -eu
+
+baseline=$1
+results=$2
+tolerance=${BENCH_TOLERANCE:-20}
+
+if [ ! -f "$baseline" ]; then
+	echo "No benchmark baseline at $baseline; run 'make bench-baseline' to create one" >&2
+	exit 1
+fi
+
+awk -v tolerance="$tolerance" '
+	# Mean ns/op per benchmark, with the -GOMAXPROCS suffix removed
+	/^Benchmark/ {
+		name = $1
+		sub(/-[0-9]+$/, "", name)
+		for (i = 2; i < NF; i++) {
+			if ($(i + 1) == "ns/op") {
+				sum[FILENAME, name] += $i
+				count[FILENAME, name]++
+			}
+		}
+		if (FILENAME == ARGV[1]) {
+			baseline[name] = 1
+		} else if (!(name in seen)) {
+			seen[name] = 1
+			order[++benchmarks] = name
+		}
+	}
+	END {
+		if (benchmarks == 0) {
+			print "No benchmark results in " ARGV[2]
+			exit 1
+		}
+		failed = 0
+		printf "%-32s %14s %14s %9s\n", "benchmark", "baseline ns/op", "current ns/op", "delta"
+		for (i = 1; i <= benchmarks; i++) {
+			name = order[i]
+			current = sum[ARGV[2], name] / count[ARGV[2], name]
+			if (!(name in baseline)) {
+				printf "%-32s %14s %14.1f %9s\n", name, "-", current, "new"
+				continue
+			}
+			old = sum[ARGV[1], name] / count[ARGV[1], name]
+			delta = (current - old) / old * 100
+			flag = ""
+			if (delta > tolerance) {
+				flag = "  REGRESSION"
+				failed = 1
+			}
+			printf "%-32s %14.1f %14.1f %+8.1f%%%s\n", name, old, current, delta, flag
+		}
+		if (failed) {
+			printf "\nBenchmarks regressed by more than %s%% against the baseline\n", tolerance
+			exit 1
+		}
+	}
+' "$baseline" "$results"
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the secrets used by the relay
+const (
+	secretSigningSecret    = "signing-secret"
+	secretRedisPassword    = "redis-password"
+	secretSlackAppToken    = "slack-app-token"
+	secretSlackBotToken    = "slack-bot-token"
+	secretSlackConfigToken = "slack-config-token"
+	secretEnvelopeKey      = "envelope-signing-key"
+	secretSlackAuditToken  = "slack-audit-token"
+	secretAdminToken       = "admin-token"
+	secretFederationSecret = "federation-secret"
+)
+
+// defaultSecretRefreshInterval is how often watched secrets are checked for changes
+const defaultSecretRefreshInterval = time.Minute
+
+// errSecretNotFound is returned by a SecretProvider that does not hold the requested secret
+var errSecretNotFound = errors.New("secret not found")
+
+// SecretProvider loads named secrets from a backing store
+type SecretProvider interface {
+	// Get returns the current value of the named secret, or errSecretNotFound
+	Get(ctx context.Context, name string) (string, error)
+	// Watch calls onChange with the new value whenever the named secret changes,
+	// until ctx is cancelled
+	Watch(ctx context.Context, name string, onChange func(value string))
+}
+
+// secretEnvNames maps secret names to the environment variables holding them
+var secretEnvNames = map[string]string{
+	secretSigningSecret:    "SLACK_SIGNING_SECRET",
+	secretRedisPassword:    "REDIS_PASSWORD",
+	secretSlackAppToken:    "SLACK_APP_TOKEN",
+	secretSlackBotToken:    "SLACK_BOT_TOKEN",
+	secretSlackConfigToken: "SLACK_CONFIG_TOKEN",
+	secretEnvelopeKey:      "ENVELOPE_SIGNING_KEY",
+	secretSlackAuditToken:  "SLACK_AUDIT_TOKEN",
+	secretAdminToken:       "ADMIN_TOKEN",
+	secretFederationSecret: "FEDERATION_SECRET",
+}
+
+// secretFileNames maps secret names to the files holding them. The signing secret
+// keeps its historical .secret file name.
+var secretFileNames = map[string]string{
+	secretSigningSecret:    ".secret",
+	secretRedisPassword:    ".redis-password",
+	secretSlackAppToken:    ".slack-app-token",
+	secretSlackBotToken:    ".slack-bot-token",
+	secretSlackConfigToken: ".slack-config-token",
+	secretEnvelopeKey:      ".envelope-signing-key",
+	secretSlackAuditToken:  ".slack-audit-token",
+	secretAdminToken:       ".admin-token",
+	secretFederationSecret: ".federation-secret",
+}
+
+// pollSecret calls get every interval and invokes onChange when the value changes,
+// until ctx is cancelled. It is the Watch implementation shared by all providers.
+// A secret that is no longer found, or found empty, keeps its last value, so a
+// deleted file or a Vault outage never disables signature checks.
+func pollSecret(ctx context.Context, interval time.Duration, name string, get func(context.Context, string) (string, error), onChange func(string)) {
+	current, _ := get(ctx, name)
+	missing := false
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			value, err := get(ctx, name)
+			if err != nil && !errors.Is(err, errSecretNotFound) {
+				logWarn("Error refreshing secret '%s': %v", name, err)
+				continue
+			}
+			if value == "" {
+				if current != "" && !missing {
+					logWarn("Secret '%s' is no longer found; keeping its last value", name)
+				}
+				missing = true
+				continue
+			}
+			missing = false
+			if value != current {
+				current = value
+				logInfo("Secret '%s' changed", name)
+				onChange(value)
+			}
+		}
+	}
+}
+
+// envSecretProvider reads secrets from environment variables
+type envSecretProvider struct {
+	interval time.Duration
+}
+
+// Get returns the secret from its environment variable
+func (p *envSecretProvider) Get(ctx context.Context, name string) (string, error) {
+	envName, ok := secretEnvNames[name]
+	if !ok {
+		envName = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	}
+	value := os.Getenv(envName)
+	if value == "" {
+		return "", errSecretNotFound
+	}
+	return value, nil
+}
+
+// Watch polls the environment variable for changes
+func (p *envSecretProvider) Watch(ctx context.Context, name string, onChange func(string)) {
+	pollSecret(ctx, p.interval, name, p.Get, onChange)
+}
+
+// fileSecretProvider reads secrets from files in a directory
+type fileSecretProvider struct {
+	dir      string
+	interval time.Duration
+}
+
+// path returns the file holding the named secret
+func (p *fileSecretProvider) path(name string) string {
+	fileName, ok := secretFileNames[name]
+	if !ok {
+		fileName = name
+	}
+	return filepath.Join(p.dir, fileName)
+}
+
+// Get returns the trimmed contents of the secret's file
+func (p *fileSecretProvider) Get(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(p.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errSecretNotFound
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Watch polls the secret's file for changes
+func (p *fileSecretProvider) Watch(ctx context.Context, name string, onChange func(string)) {
+	pollSecret(ctx, p.interval, name, p.Get, onChange)
+}
+
+// vaultSecretProvider reads secrets from a HashiCorp Vault KV secret. Each secret
+// name is a key of the secret at path; both KV v1 and v2 engines are supported.
+type vaultSecretProvider struct {
+	addr     string
+	token    string
+	path     string
+	client   *http.Client
+	interval time.Duration
+}
+
+// Get reads the secret at the provider's path and returns the named key
+func (p *vaultSecretProvider) Get(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.addr, "/")+"/v1/"+strings.TrimPrefix(p.path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("vault returned invalid JSON: %w", err)
+	}
+
+	// KV v2 nests the secret's keys under data.data
+	data := result.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	value, ok := data[name].(string)
+	if !ok || value == "" {
+		return "", errSecretNotFound
+	}
+	return value, nil
+}
+
+// Watch polls Vault for changes to the secret
+func (p *vaultSecretProvider) Watch(ctx context.Context, name string, onChange func(string)) {
+	pollSecret(ctx, p.interval, name, p.Get, onChange)
+}
+
+// chainSecretProvider tries each provider in order and returns the first secret found
+type chainSecretProvider struct {
+	providers []SecretProvider
+	interval  time.Duration
+}
+
+// Get returns the secret from the first provider that holds it
+func (p *chainSecretProvider) Get(ctx context.Context, name string) (string, error) {
+	for _, provider := range p.providers {
+		value, err := provider.Get(ctx, name)
+		if err == nil {
+			return value, nil
+		}
+		if !errors.Is(err, errSecretNotFound) {
+			return "", err
+		}
+	}
+	return "", errSecretNotFound
+}
+
+// Watch polls the chain, so a secret moving between providers is also detected
+func (p *chainSecretProvider) Watch(ctx context.Context, name string, onChange func(string)) {
+	pollSecret(ctx, p.interval, name, p.Get, onChange)
+}
+
+// newSecretProviderFromEnv builds the secret provider chain named by SECRET_PROVIDERS
+// (comma-separated, default "file,env")
+func newSecretProviderFromEnv() (SecretProvider, error) {
+	interval := getEnvDuration("SECRET_REFRESH_INTERVAL", defaultSecretRefreshInterval)
+	names := os.Getenv("SECRET_PROVIDERS")
+	if names == "" {
+		names = "file,env"
+	}
+
+	chain := &chainSecretProvider{interval: interval}
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "file":
+			dir := os.Getenv("SECRETS_DIR")
+			if dir == "" {
+				dir = "."
+			}
+			chain.providers = append(chain.providers, &fileSecretProvider{dir: dir, interval: interval})
+		case "env":
+			chain.providers = append(chain.providers, &envSecretProvider{interval: interval})
+		case "vault":
+			provider, err := newVaultSecretProviderFromEnv(interval)
+			if err != nil {
+				return nil, err
+			}
+			chain.providers = append(chain.providers, provider)
+		default:
+			return nil, fmt.Errorf("unknown secret provider '%s'", name)
+		}
+	}
+	return chain, nil
+}
+
+// newVaultSecretProviderFromEnv configures a Vault provider from VAULT_ADDR,
+// VAULT_TOKEN (or VAULT_TOKEN_FILE) and VAULT_SECRET_PATH
+func newVaultSecretProviderFromEnv(interval time.Duration) (*vaultSecretProvider, error) {
+	token, err := vaultTokenFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	provider := &vaultSecretProvider{
+		addr:     os.Getenv("VAULT_ADDR"),
+		token:    token,
+		path:     os.Getenv("VAULT_SECRET_PATH"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		interval: interval,
+	}
+	if provider.addr == "" || provider.token == "" || provider.path == "" {
+		return nil, errors.New("vault secret provider requires VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH")
+	}
+	return provider, nil
+}
+
+// vaultTokenFromEnv returns the Vault token from VAULT_TOKEN_FILE, or VAULT_TOKEN
+// when no token file is set
+func vaultTokenFromEnv() (string, error) {
+	tokenFile := os.Getenv("VAULT_TOKEN_FILE")
+	if tokenFile == "" {
+		return os.Getenv("VAULT_TOKEN"), nil
+	}
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("reading VAULT_TOKEN_FILE: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// secretProvider is the provider used for all relay secrets
+var secretProvider SecretProvider = &chainSecretProvider{
+	providers: []SecretProvider{&fileSecretProvider{dir: "."}, &envSecretProvider{}},
+	interval:  defaultSecretRefreshInterval,
+}
+
+// secretsMu guards secrets that are refreshed while the server is running
+var secretsMu sync.RWMutex
+
+// redisPassword is the current Redis password, read by the Redis client when
+// opening new connections
+var redisPassword string
+
+// getSigningSecret returns the current Slack signing secret
+func getSigningSecret() []byte {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return signingSecret
+}
+
+// loadSecret reads the named secret from the secret provider, returning an empty
+// string if it is not configured
+func loadSecret(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	value, err := secretProvider.Get(ctx, name)
+	if errors.Is(err, errSecretNotFound) {
+		return "", nil
+	}
+	return value, err
+}
+
+// watchSecrets refreshes the relay's secrets when they change in the secret provider
+func watchSecrets(ctx context.Context) {
+	go secretProvider.Watch(ctx, secretSigningSecret, func(value string) {
+		secretsMu.Lock()
+		signingSecret = []byte(value)
+		secretsMu.Unlock()
+	})
+	go secretProvider.Watch(ctx, secretRedisPassword, func(value string) {
+		secretsMu.Lock()
+		redisPassword = value
+		secretsMu.Unlock()
+	})
+	go secretProvider.Watch(ctx, secretSlackAppToken, func(value string) {
+		secretsMu.Lock()
+		slackAppToken = value
+		secretsMu.Unlock()
+	})
+	go secretProvider.Watch(ctx, secretSlackBotToken, func(value string) {
+		secretsMu.Lock()
+		slackBotToken = value
+		secretsMu.Unlock()
+	})
+	go secretProvider.Watch(ctx, secretSlackConfigToken, func(value string) {
+		secretsMu.Lock()
+		slackConfigToken = value
+		secretsMu.Unlock()
+	})
+	go secretProvider.Watch(ctx, secretEnvelopeKey, func(value string) {
+		secretsMu.Lock()
+		envelopeSigningKey = []byte(value)
+		secretsMu.Unlock()
+	})
+	go secretProvider.Watch(ctx, secretSlackAuditToken, func(value string) {
+		secretsMu.Lock()
+		slackAuditToken = value
+		secretsMu.Unlock()
+	})
+	go secretProvider.Watch(ctx, secretAdminToken, func(value string) {
+		secretsMu.Lock()
+		adminToken = value
+		secretsMu.Unlock()
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFileSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".secret"), []byte("signing-value\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	provider := &fileSecretProvider{dir: dir}
+
+	value, err := provider.Get(context.Background(), secretSigningSecret)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if value != "signing-value" {
+		t.Errorf("expected trimmed secret, got %q", value)
+	}
+
+	if _, err := provider.Get(context.Background(), secretRedisPassword); !errors.Is(err, errSecretNotFound) {
+		t.Errorf("expected errSecretNotFound for missing file, got %v", err)
+	}
+}
+
+func TestEnvSecretProvider(t *testing.T) {
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	provider := &envSecretProvider{}
+
+	value, err := provider.Get(context.Background(), secretSlackBotToken)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if value != "xoxb-test" {
+		t.Errorf("expected env secret, got %q", value)
+	}
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/slack-relay" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"signing-secret":"from-vault"},"metadata":{"version":1}}}`))
+	}))
+	defer server.Close()
+
+	provider := &vaultSecretProvider{addr: server.URL, token: "vault-token", path: "secret/data/slack-relay", client: server.Client()}
+
+	value, err := provider.Get(context.Background(), secretSigningSecret)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if value != "from-vault" {
+		t.Errorf("expected vault secret, got %q", value)
+	}
+	if _, err := provider.Get(context.Background(), secretRedisPassword); !errors.Is(err, errSecretNotFound) {
+		t.Errorf("expected errSecretNotFound for missing key, got %v", err)
+	}
+}
+
+func TestChainSecretProvider(t *testing.T) {
+	t.Setenv("REDIS_PASSWORD", "from-env")
+	chain := &chainSecretProvider{providers: []SecretProvider{&fileSecretProvider{dir: t.TempDir()}, &envSecretProvider{}}}
+
+	value, err := chain.Get(context.Background(), secretRedisPassword)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if value != "from-env" {
+		t.Errorf("expected fallback to env provider, got %q", value)
+	}
+	if _, err := chain.Get(context.Background(), "unknown-secret"); !errors.Is(err, errSecretNotFound) {
+		t.Errorf("expected errSecretNotFound, got %v", err)
+	}
+}
+
+func TestSecretProviderWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".secret")
+	if err := os.WriteFile(path, []byte("first"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	provider := &fileSecretProvider{dir: dir, interval: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan string, 1)
+	go provider.Watch(ctx, secretSigningSecret, func(value string) { changes <- value })
+
+	time.Sleep(20 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("second"), 0600); err != nil {
+		t.Fatalf("failed to update secret: %v", err)
+	}
+
+	select {
+	case value := <-changes:
+		if value != "second" {
+			t.Errorf("expected changed value 'second', got %q", value)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for secret change")
+	}
+}
+
+func TestWatchSecretsKeepsDeletedSigningSecret(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".secret")
+	if err := os.WriteFile(path, []byte("first"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	previousProvider := secretProvider
+	secretProvider = &fileSecretProvider{dir: dir, interval: 5 * time.Millisecond}
+	signingSecret = []byte("first")
+	defer func() {
+		secretProvider = previousProvider
+		secretsMu.Lock()
+		signingSecret = []byte{}
+		secretsMu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watchSecrets(ctx)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if secret := getSigningSecret(); string(secret) != "first" {
+		t.Errorf("expected the deleted secret to keep its last value, got %q", secret)
+	}
+	if verifySlackSignature([]byte(`{}`), strconv.FormatInt(time.Now().Unix(), 10), "v0=unsigned") {
+		t.Error("expected signature verification to fail closed after the secret was deleted")
+	}
+}
+
+func TestNewSecretProviderFromEnvUnknown(t *testing.T) {
+	t.Setenv("SECRET_PROVIDERS", "file,unknown")
+	if _, err := newSecretProviderFromEnv(); err == nil {
+		t.Error("expected error for unknown provider, got nil")
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions taken on events containing sensitive content
+const (
+	sensitiveTag        = "tag"
+	sensitiveQuarantine = "quarantine"
+)
+
+// allSensitiveRules selects every built-in sensitive content rule
+const allSensitiveRules = "all"
+
+// sensitiveClassifierTimeout bounds a call to an external sensitive content classifier
+const sensitiveClassifierTimeout = 3 * time.Second
+
+// sensitiveRules are the built-in rules detecting secrets, by name
+var sensitiveRules = map[string]*regexp.Regexp{
+	"aws-access-key":   regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+	"github-token":     regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	"google-api-key":   regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	"jwt":              regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+	"private-key":      regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`),
+	"slack-token":      regexp.MustCompile(`\bxox[abposre]-[0-9A-Za-z-]{10,}`),
+	"slack-webhook":    regexp.MustCompile(`https://hooks\.slack\.com/services/T[0-9A-Z]+/B[0-9A-Z]+/[0-9A-Za-z]+`),
+	"stripe-live-key":  regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`),
+	"generic-password": regexp.MustCompile(`(?i)\b(password|passwd|secret)\s*[:=]\s*\S{6,}`),
+}
+
+// sensitiveClassifierClient is the HTTP client used to call external classifiers
+var sensitiveClassifierClient = &http.Client{Timeout: sensitiveClassifierTimeout}
+
+var metricSensitiveEvents = newCounterVec("slack_relay_sensitive_events_total",
+	"Events found to contain sensitive content, by event type and action.", "event_type", "action")
+var metricClassifierErrors = newCounterVec("slack_relay_classifier_errors_total",
+	"Failed calls to external sensitive content classifiers, by event type.", "event_type")
+
+// SensitivePolicy detects secrets such as API keys in a route's messages and
+// tags them or quarantines them to a security channel
+type SensitivePolicy struct {
+	// Rules are the built-in rules to apply, or "all"
+	Rules []string `json:"rules,omitempty"`
+	// Patterns are additional regular expression rules, by name
+	Patterns map[string]string `json:"patterns,omitempty"`
+	// ClassifierURL is an external classifier called with messages no rule matches
+	ClassifierURL string `json:"classifier-url,omitempty"`
+	// Action is tag (default), which attaches the names of the matching rules, or
+	// quarantine, which also publishes the event to Channel instead of the route's
+	Action string `json:"action,omitempty"`
+	// Channel receives quarantined events, e.g. a security channel
+	Channel string `json:"channel,omitempty"`
+}
+
+// enabled reports whether the route checks its messages for sensitive content
+func (p SensitivePolicy) enabled() bool {
+	return len(p.Rules) > 0 || len(p.Patterns) > 0 || p.ClassifierURL != ""
+}
+
+// action returns the action on sensitive events
+func (p SensitivePolicy) action() string {
+	if p.Action == "" {
+		return sensitiveTag
+	}
+	return p.Action
+}
+
+// sensitivePatterns caches the compiled custom patterns by expression
+var sensitivePatterns sync.Map
+
+// compileSensitivePattern returns the compiled form of a custom pattern
+func compileSensitivePattern(expression string) (*regexp.Regexp, error) {
+	if cached, ok := sensitivePatterns.Load(expression); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	sensitivePatterns.Store(expression, compiled)
+	return compiled, nil
+}
+
+// validate checks the policy's rules, patterns and action
+func (p SensitivePolicy) validate() error {
+	for _, rule := range p.Rules {
+		if _, ok := sensitiveRules[rule]; !ok && rule != allSensitiveRules {
+			return fmt.Errorf("unknown rule %q, expected all or one of %s", rule, strings.Join(sortedSensitiveRules(), ", "))
+		}
+	}
+	for name, expression := range p.Patterns {
+		if _, err := compileSensitivePattern(expression); err != nil {
+			return fmt.Errorf("pattern %q: %w", name, err)
+		}
+	}
+	switch p.action() {
+	case sensitiveTag:
+	case sensitiveQuarantine:
+		if p.Channel == "" {
+			return fmt.Errorf("the quarantine action needs a channel")
+		}
+	default:
+		return fmt.Errorf("invalid action %q, expected tag or quarantine", p.Action)
+	}
+	return nil
+}
+
+// validateSensitivePolicies checks the sensitive content policy of every route
+func validateSensitivePolicies(configs []EventConfig) error {
+	for _, config := range configs {
+		if !config.Sensitive.enabled() {
+			continue
+		}
+		if err := config.Sensitive.validate(); err != nil {
+			return fmt.Errorf("route '%s' has an invalid sensitive content policy: %w", config.EventType, err)
+		}
+	}
+	return nil
+}
+
+// sortedSensitiveRules returns the names of the built-in rules in alphabetical order
+func sortedSensitiveRules() []string {
+	names := make([]string, 0, len(sensitiveRules))
+	for name := range sensitiveRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// matchingRules returns the names of the policy's rules matching text, sorted
+func (p SensitivePolicy) matchingRules(text string) []string {
+	var matches []string
+	all := containsString(p.Rules, allSensitiveRules)
+	for _, name := range sortedSensitiveRules() {
+		if (all || containsString(p.Rules, name)) && sensitiveRules[name].MatchString(text) {
+			matches = append(matches, name)
+		}
+	}
+	var custom []string
+	for name, expression := range p.Patterns {
+		// Patterns are validated when the configuration is loaded
+		if compiled, err := compileSensitivePattern(expression); err == nil && compiled.MatchString(text) {
+			custom = append(custom, name)
+		}
+	}
+	sort.Strings(custom)
+	return append(matches, custom...)
+}
+
+// classifierRequest is the body posted to an external classifier
+type classifierRequest struct {
+	EventType string `json:"event_type"`
+	TeamID    string `json:"team_id,omitempty"`
+	Text      string `json:"text"`
+}
+
+// classifierResponse is the verdict of an external classifier
+type classifierResponse struct {
+	Sensitive bool `json:"sensitive"`
+	// Labels name what the classifier found, e.g. ["customer-pii"]
+	Labels []string `json:"labels,omitempty"`
+}
+
+// classify asks an external classifier whether text is sensitive, and returns
+// the labels of what it found
+func classify(ctx context.Context, classifierURL string, request classifierRequest) ([]string, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, classifierURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := sensitiveClassifierClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("classifier returned status %d", resp.StatusCode)
+	}
+	var verdict classifierResponse
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return nil, fmt.Errorf("invalid classifier response: %w", err)
+	}
+	if !verdict.Sensitive {
+		return nil, nil
+	}
+	if len(verdict.Labels) == 0 {
+		return []string{"classifier"}, nil
+	}
+	return verdict.Labels, nil
+}
+
+// payloadScanText returns the text of a payload checked for sensitive content:
+// the plain text rendering of its message, and the message's raw text when it
+// differs, since link targets are only in the raw text
+func payloadScanText(payload map[string]interface{}) string {
+	plain, _ := payloadPlainText(payload)
+	event, _ := payload["event"].(map[string]interface{})
+	raw, _ := event["text"].(string)
+	if raw == "" || raw == plain {
+		return plain
+	}
+	if plain == "" {
+		return raw
+	}
+	return plain + "\n" + raw
+}
+
+// detectSensitive returns the names of the rules or classifier labels that
+// found sensitive content in a payload. The classifier is only called when no
+// rule matches; when it fails, the payload is treated as not sensitive.
+func detectSensitive(eventType string, teamID string, policy SensitivePolicy, payload map[string]interface{}) []string {
+	text := payloadScanText(payload)
+	if text == "" {
+		return nil
+	}
+	if matches := policy.matchingRules(text); len(matches) > 0 || policy.ClassifierURL == "" {
+		return matches
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sensitiveClassifierTimeout)
+	defer cancel()
+	labels, err := classify(ctx, policy.ClassifierURL, classifierRequest{EventType: eventType, TeamID: teamID, Text: text})
+	if err != nil {
+		logWarn("Error classifying event type '%s' for sensitive content: %v", eventType, err)
+		metricClassifierErrors.Inc(eventTypeLabel(eventType))
+		return nil
+	}
+	return labels
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// serverConfig holds the HTTP server tuning options
+type serverConfig struct {
+	ReadHeaderTimeout     time.Duration
+	ReadTimeout           time.Duration
+	WriteTimeout          time.Duration
+	IdleTimeout           time.Duration
+	MaxHeaderBytes        int
+	MaxBodyBytes          int64
+	KeepAlives            bool
+	H2C                   bool
+	MaxConcurrentStreams  int
+	MaxConcurrentRequests int
+	RequestQueueTimeout   time.Duration
+}
+
+// loadServerConfig reads the HTTP server tuning options from environment variables
+func loadServerConfig() serverConfig {
+	return serverConfig{
+		ReadHeaderTimeout:     getEnvDuration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:           getEnvDuration("SERVER_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:          getEnvDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:           getEnvDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+		MaxHeaderBytes:        getEnvInt("SERVER_MAX_HEADER_BYTES", http.DefaultMaxHeaderBytes),
+		MaxBodyBytes:          int64(getEnvInt("SERVER_MAX_BODY_BYTES", defaultMaxBodyBytes)),
+		KeepAlives:            getEnvBool("SERVER_KEEP_ALIVES", true),
+		H2C:                   getEnvBool("SERVER_H2C", false),
+		MaxConcurrentStreams:  getEnvInt("SERVER_MAX_CONCURRENT_STREAMS", 0),
+		MaxConcurrentRequests: getEnvInt("SERVER_MAX_CONCURRENT_REQUESTS", 0),
+		RequestQueueTimeout:   getEnvDuration("SERVER_REQUEST_QUEUE_TIMEOUT", defaultRequestQueueTimeout),
+	}
+}
+
+// newHTTPServer creates an HTTP server listening on addr with the given tuning options.
+// With H2C enabled the server also accepts unencrypted HTTP/2, as used by
+// internal load balancers that terminate TLS.
+func newHTTPServer(addr string, handler http.Handler, config serverConfig) *http.Server {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+		HTTP2: &http.HTTP2Config{
+			MaxConcurrentStreams: config.MaxConcurrentStreams,
+		},
+	}
+
+	if config.H2C {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		server.Protocols = protocols
+	}
+
+	server.SetKeepAlivesEnabled(config.KeepAlives)
+	return server
+}
+
+// newIngestMux serves the endpoints Slack calls and the custom endpoints of the
+// configuration, the only ones on the public port
+func newIngestMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slack", limitConcurrency(slackHandler))
+	mux.HandleFunc(federationPath, federationHandler)
+	mux.HandleFunc("/", customEndpointHandler)
+	return mux
+}
+
+// newAdminMux serves the metrics and admin endpoints on the private admin port
+func newAdminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/admin/maintenance", maintenanceHandler)
+	mux.HandleFunc("/admin/consumers", consumersHandler)
+	mux.HandleFunc("/admin/routes", routesHandler)
+	mux.HandleFunc("/admin/explain", explainHandler)
+	return mux
+}
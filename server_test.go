@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoadServerConfigDefaults(t *testing.T) {
+	config := loadServerConfig()
+
+	if config.ReadHeaderTimeout != 10*time.Second {
+		t.Errorf("expected ReadHeaderTimeout 10s, got %v", config.ReadHeaderTimeout)
+	}
+	if config.MaxHeaderBytes != http.DefaultMaxHeaderBytes {
+		t.Errorf("expected MaxHeaderBytes %d, got %d", http.DefaultMaxHeaderBytes, config.MaxHeaderBytes)
+	}
+	if !config.KeepAlives {
+		t.Error("expected keep-alives to be enabled by default")
+	}
+	if config.H2C {
+		t.Error("expected h2c to be disabled by default")
+	}
+}
+
+func TestLoadServerConfigFromEnv(t *testing.T) {
+	t.Setenv("SERVER_IDLE_TIMEOUT", "45s")
+	t.Setenv("SERVER_MAX_HEADER_BYTES", "4096")
+	t.Setenv("SERVER_KEEP_ALIVES", "false")
+	t.Setenv("SERVER_H2C", "true")
+	t.Setenv("SERVER_MAX_CONCURRENT_STREAMS", "50")
+
+	config := loadServerConfig()
+
+	if config.IdleTimeout != 45*time.Second {
+		t.Errorf("expected IdleTimeout 45s, got %v", config.IdleTimeout)
+	}
+	if config.MaxHeaderBytes != 4096 {
+		t.Errorf("expected MaxHeaderBytes 4096, got %d", config.MaxHeaderBytes)
+	}
+	if config.KeepAlives {
+		t.Error("expected keep-alives to be disabled")
+	}
+	if !config.H2C {
+		t.Error("expected h2c to be enabled")
+	}
+	if config.MaxConcurrentStreams != 50 {
+		t.Errorf("expected MaxConcurrentStreams 50, got %d", config.MaxConcurrentStreams)
+	}
+}
+
+func TestNewHTTPServerH2C(t *testing.T) {
+	server := newHTTPServer(":8080", http.NotFoundHandler(), serverConfig{H2C: true, MaxConcurrentStreams: 10})
+
+	if server.Protocols == nil || !server.Protocols.UnencryptedHTTP2() || !server.Protocols.HTTP1() {
+		t.Errorf("expected HTTP/1 and unencrypted HTTP/2 to be enabled, got %v", server.Protocols)
+	}
+	if server.HTTP2.MaxConcurrentStreams != 10 {
+		t.Errorf("expected MaxConcurrentStreams 10, got %d", server.HTTP2.MaxConcurrentStreams)
+	}
+}
+
+func TestAdminAddrFromEnv(t *testing.T) {
+	t.Setenv("ADMIN_ADDR", "")
+	if addr := adminAddrFromEnv(); addr != "127.0.0.1:9090" {
+		t.Errorf("expected the admin endpoints on localhost by default, got %s", addr)
+	}
+	t.Setenv("ADMIN_ADDR", "9100")
+	if addr := adminAddrFromEnv(); addr != "127.0.0.1:9100" {
+		t.Errorf("expected a bare port to listen on localhost, got %s", addr)
+	}
+	t.Setenv("ADMIN_ADDR", ":9100")
+	if addr := adminAddrFromEnv(); addr != ":9100" {
+		t.Errorf("expected an explicit address to be kept, got %s", addr)
+	}
+}
+
+func TestIngestAndAdminMuxesAreSplit(t *testing.T) {
+	serve := func(mux *http.ServeMux, path string) int {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Code
+	}
+	ingest, admin := newIngestMux(), newAdminMux()
+	for _, path := range []string{"/metrics", "/admin/routes", "/admin/maintenance"} {
+		if code := serve(ingest, path); code != http.StatusNotFound {
+			t.Errorf("expected %s not to be served on the public port, got %d", path, code)
+		}
+	}
+	if code := serve(ingest, "/slack"); code != http.StatusMethodNotAllowed {
+		t.Errorf("expected /slack on the public port, got %d", code)
+	}
+	if code := serve(admin, "/metrics"); code != http.StatusOK {
+		t.Errorf("expected /metrics on the admin port, got %d", code)
+	}
+	if code := serve(admin, "/slack"); code != http.StatusNotFound {
+		t.Errorf("expected /slack not to be served on the admin port, got %d", code)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policies for events belonging to another shard
+const (
+	shardPolicyReject = "reject"
+	shardPolicyProxy  = "proxy"
+)
+
+// shardForwardedHeader marks a request forwarded by another replica, which is
+// always processed locally so misconfigured peers cannot forward in a loop
+const shardForwardedHeader = "X-Slack-Relay-Forwarded-By"
+
+// shardRetryAfterSeconds is the Retry-After sent with rejected events of another shard
+const shardRetryAfterSeconds = 1
+
+// shardConfig assigns this replica a subset of teams
+type shardConfig struct {
+	// Count is the number of shards; sharding is disabled when it is 1 or less
+	Count int
+	// Index is this replica's shard, from 0 to Count-1
+	Index int
+	// Policy is what happens to events of other shards: reject or proxy
+	Policy string
+	// Peers are the request URLs of every shard, indexed by shard, for the proxy policy
+	Peers []string
+}
+
+// shards is this replica's shard assignment
+var shards shardConfig
+
+// instanceID identifies this replica in logs, control events and forwarded requests
+var instanceID string
+
+// shardClient is the HTTP client used to forward events to their shard
+var shardClient = &http.Client{Timeout: 10 * time.Second}
+
+var metricShardMismatches = newCounterVec("slack_relay_shard_mismatches_total",
+	"Events received for a team assigned to another shard, by policy.", "policy")
+
+// loadInstanceID returns INSTANCE_ID, or the hostname when it is not set
+func loadInstanceID() string {
+	if id := os.Getenv("INSTANCE_ID"); id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// loadShardConfig reads the shard assignment from SHARD_COUNT, SHARD_INDEX,
+// SHARD_POLICY and SHARD_PEERS
+func loadShardConfig() (shardConfig, error) {
+	config := shardConfig{
+		Count:  getEnvInt("SHARD_COUNT", 1),
+		Index:  getEnvInt("SHARD_INDEX", 0),
+		Policy: os.Getenv("SHARD_POLICY"),
+		Peers:  splitList(os.Getenv("SHARD_PEERS")),
+	}
+	if config.Policy == "" {
+		config.Policy = shardPolicyReject
+	}
+	if config.Count <= 1 {
+		return config, nil
+	}
+	if config.Index < 0 || config.Index >= config.Count {
+		return config, fmt.Errorf("SHARD_INDEX must be between 0 and %d", config.Count-1)
+	}
+	switch config.Policy {
+	case shardPolicyReject:
+	case shardPolicyProxy:
+		if len(config.Peers) != config.Count {
+			return config, fmt.Errorf("SHARD_PEERS must list %d URLs, one per shard", config.Count)
+		}
+	default:
+		return config, fmt.Errorf("invalid SHARD_POLICY '%s', expected '%s' or '%s'", config.Policy, shardPolicyReject, shardPolicyProxy)
+	}
+	return config, nil
+}
+
+// shardOf returns the shard of a team ID
+func (c shardConfig) shardOf(teamID string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(teamID))
+	return int(hash.Sum32() % uint32(c.Count))
+}
+
+// payloadShardKey returns the team an event is sharded by: the team_id of event
+// callbacks, the team of interactive payloads, or the enterprise for org-wide events
+func payloadShardKey(payload map[string]interface{}) string {
+	if teamID, ok := payload["team_id"].(string); ok && teamID != "" {
+		return teamID
+	}
+	if team, ok := payload["team"].(map[string]interface{}); ok {
+		if teamID, ok := team["id"].(string); ok && teamID != "" {
+			return teamID
+		}
+	}
+	enterpriseID, _ := payload["enterprise_id"].(string)
+	return enterpriseID
+}
+
+// handleOtherShard checks whether a payload belongs to another shard and, if so,
+// rejects or forwards the request. It reports whether the request was handled.
+func handleOtherShard(w http.ResponseWriter, r *http.Request, body []byte, parsed *slackPayload) bool {
+	if shards.Count <= 1 || r.Header.Get(shardForwardedHeader) != "" {
+		return false
+	}
+	key := payloadShardKey(parsed.Fields())
+	shard := shards.shardOf(key)
+	if shard == shards.Index {
+		return false
+	}
+
+	metricShardMismatches.Inc(shards.Policy)
+	if shards.Policy == shardPolicyProxy {
+		logDebug("Forwarding event for team '%s' to shard %d", key, shard)
+		forwardToShard(w, r, body, shards.Peers[shard])
+		return true
+	}
+
+	logDebug("Rejecting event for team '%s', which belongs to shard %d", key, shard)
+	w.Header().Set("Retry-After", strconv.Itoa(shardRetryAfterSeconds))
+	http.Error(w, "Event belongs to another relay shard", http.StatusServiceUnavailable)
+	return true
+}
+
+// newForwardedRequest builds a POST of body to target carrying the original
+// request headers, so the Slack signature can still be verified by the receiver
+func newForwardedRequest(ctx context.Context, header http.Header, body []byte, target string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		if strings.EqualFold(name, "Connection") || strings.EqualFold(name, "Content-Length") {
+			continue
+		}
+		req.Header[name] = values
+	}
+	return req, nil
+}
+
+// forwardToShard replays the original request, signature headers included, to
+// target and copies its response back to Slack
+func forwardToShard(w http.ResponseWriter, r *http.Request, body []byte, target string) {
+	ctx, cancel := context.WithTimeout(r.Context(), shardClient.Timeout)
+	defer cancel()
+	req, err := newForwardedRequest(ctx, r.Header, body, target)
+	if err != nil {
+		logError("Error forwarding event to %s: %v", target, err)
+		http.Error(w, "Error forwarding event", http.StatusBadGateway)
+		return
+	}
+	req.Header.Set(shardForwardedHeader, instanceID)
+
+	resp, err := shardClient.Do(req)
+	if err != nil {
+		logWarn("Error forwarding event to %s: %v", target, err)
+		http.Error(w, "Error forwarding event", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		logError("Error writing response: %v", err)
+	}
+}
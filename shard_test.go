@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoadShardConfig(t *testing.T) {
+	t.Setenv("SHARD_COUNT", "3")
+	t.Setenv("SHARD_INDEX", "3")
+	if _, err := loadShardConfig(); err == nil {
+		t.Error("expected an error for a shard index out of range")
+	}
+
+	t.Setenv("SHARD_INDEX", "1")
+	t.Setenv("SHARD_POLICY", shardPolicyProxy)
+	t.Setenv("SHARD_PEERS", "http://relay-0/slack,http://relay-1/slack")
+	if _, err := loadShardConfig(); err == nil {
+		t.Error("expected an error when SHARD_PEERS does not list every shard")
+	}
+
+	t.Setenv("SHARD_PEERS", "http://relay-0/slack,http://relay-1/slack,http://relay-2/slack")
+	config, err := loadShardConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Count != 3 || config.Index != 1 || len(config.Peers) != 3 {
+		t.Errorf("unexpected shard config %+v", config)
+	}
+}
+
+func TestPayloadShardKey(t *testing.T) {
+	tests := []struct {
+		payload  map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"team_id": "T1"}, "T1"},
+		{map[string]interface{}{"team": map[string]interface{}{"id": "T2"}}, "T2"},
+		{map[string]interface{}{"enterprise_id": "E1"}, "E1"},
+	}
+	for _, tt := range tests {
+		if got := payloadShardKey(tt.payload); got != tt.expected {
+			t.Errorf("payloadShardKey(%v) = %q, want %q", tt.payload, got, tt.expected)
+		}
+	}
+}
+
+// teamForShard returns a team ID assigned to shard by config
+func teamForShard(t *testing.T, config shardConfig, shard int) string {
+	t.Helper()
+	for _, team := range []string{"T1", "T2", "T3", "T4", "T5", "T6", "T7", "T8"} {
+		if config.shardOf(team) == shard {
+			return team
+		}
+	}
+	t.Fatalf("no test team hashes to shard %d", shard)
+	return ""
+}
+
+func TestHandleOtherShard(t *testing.T) {
+	var forwarded *http.Request
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r
+		body, _ := io.ReadAll(r.Body)
+		w.Write(append([]byte("forwarded "), body...))
+	}))
+	defer peer.Close()
+
+	shards = shardConfig{Count: 2, Index: 0, Policy: shardPolicyReject, Peers: []string{peer.URL, peer.URL}}
+	instanceID = "relay-0"
+	defer func() { shards, instanceID = shardConfig{}, "" }()
+	local, remote := teamForShard(t, shards, 0), teamForShard(t, shards, 1)
+
+	request := func(team string) (*httptest.ResponseRecorder, bool) {
+		body := `{"team_id":"` + team + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(body))
+		req.Header.Set("X-Slack-Signature", "v0=abc")
+		recorder := httptest.NewRecorder()
+		return recorder, handleOtherShard(recorder, req, []byte(body), &slackPayload{fields: map[string]interface{}{"team_id": team}})
+	}
+
+	if _, handled := request(local); handled {
+		t.Error("expected events of the local shard to be processed locally")
+	}
+	recorder, handled := request(remote)
+	if !handled || recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a 503 with Retry-After, got %d", recorder.Code)
+	}
+
+	shards.Policy = shardPolicyProxy
+	recorder, handled = request(remote)
+	if !handled || recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Body.String(), "forwarded ") {
+		t.Errorf("expected the peer's response, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if forwarded.Header.Get("X-Slack-Signature") != "v0=abc" || forwarded.Header.Get(shardForwardedHeader) != "relay-0" {
+		t.Errorf("expected the signature and forwarding headers to be sent, got %v", forwarded.Header)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// SheddingPolicy configures dropping a route's events while its backlog in the
+// publish queue is too deep, so other routes keep flowing during downstream
+// slowness
+type SheddingPolicy struct {
+	// QueueDepth is the number of the route's events waiting in the publish queue
+	// above which shedding starts; zero disables shedding
+	QueueDepth int `json:"queue-depth,omitempty"`
+	// KeepRatio is the fraction of events still published while shedding (0 to 1)
+	KeepRatio float64 `json:"keep-ratio,omitempty"`
+}
+
+// skipShed is the skip reason for events dropped by their route's shedding policy
+const skipShed = "event was shed"
+
+// routeBacklog counts each event type's events waiting in the publish queue
+type routeBacklog struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// queuedEvents is the per-event-type backlog of the publish queue
+var queuedEvents = &routeBacklog{counts: make(map[string]int)}
+
+// add changes the backlog of eventType by delta
+func (b *routeBacklog) add(eventType string, delta int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.counts[eventType] += delta
+	if b.counts[eventType] <= 0 {
+		delete(b.counts, eventType)
+	}
+}
+
+// depth returns the backlog of eventType
+func (b *routeBacklog) depth(eventType string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.counts[eventType]
+}
+
+var metricShedEvents = newCounterVec("slack_relay_shed_events_total",
+	"Events dropped by load shedding because their route's queue backlog was too deep, by event type.", "event_type")
+
+// shouldShed reports whether an event of eventType should be dropped under policy
+func shouldShed(eventType string, policy SheddingPolicy) bool {
+	if policy.QueueDepth <= 0 || queuedEvents.depth(eventType) <= policy.QueueDepth {
+		return false
+	}
+	return rand.Float64() >= policy.KeepRatio
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShouldShed(t *testing.T) {
+	queuedEvents.add("shedding_test", 10)
+	defer queuedEvents.add("shedding_test", -10)
+
+	tests := []struct {
+		name     string
+		policy   SheddingPolicy
+		expected bool
+	}{
+		{"disabled", SheddingPolicy{}, false},
+		{"below threshold", SheddingPolicy{QueueDepth: 10}, false},
+		{"above threshold", SheddingPolicy{QueueDepth: 5}, true},
+		{"above threshold keeping all", SheddingPolicy{QueueDepth: 5, KeepRatio: 1}, false},
+	}
+	for _, tt := range tests {
+		if got := shouldShed("shedding_test", tt.policy); got != tt.expected {
+			t.Errorf("%s: shouldShed = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+
+	if shouldShed("app_mention", SheddingPolicy{QueueDepth: 5}) {
+		t.Error("expected other event types not to be shed")
+	}
+}
+
+func TestEnqueuePublishTracksBacklog(t *testing.T) {
+	publishQueue = make(chan publishJob, 1)
+	defer func() { publishQueue = nil }()
+
+	enqueuePublish(publishJob{eventType: "team_join"})
+	enqueuePublish(publishJob{eventType: "team_join"})
+	if depth := queuedEvents.depth("team_join"); depth != 1 {
+		t.Errorf("expected backlog of 1 after a rejected enqueue, got %d", depth)
+	}
+	queuedEvents.add("team_join", -1)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// envelopeSignatureVersion prefixes envelope signatures and their base string,
+// following Slack's request signing scheme
+const envelopeSignatureVersion = "v1"
+
+// envelopeSigningKey is the key published events are signed with. Empty
+// disables envelope signing.
+var envelopeSigningKey []byte
+
+// envelopeKeyID identifies envelopeSigningKey to consumers holding several keys
+var envelopeKeyID string
+
+// signedEnvelope wraps a published payload with the relay's signature
+type signedEnvelope struct {
+	Type      string          `json:"type"`
+	KeyID     string          `json:"key_id,omitempty"`
+	Timestamp int64           `json:"timestamp"`
+	Signature string          `json:"signature"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// envelopePayloadPlaceholder is marshaled in place of the payload, the last
+// field of signedEnvelope, and replaced by the payload bytes
+var envelopePayloadPlaceholder = json.RawMessage("null")
+
+// getEnvelopeSigningKey returns the current envelope signing key
+func getEnvelopeSigningKey() []byte {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return envelopeSigningKey
+}
+
+// pooledMAC is a reusable HMAC-SHA256 hash with a scratch buffer for the
+// signed prefix and the sum
+type pooledMAC struct {
+	hash.Hash
+	buf []byte
+}
+
+// hmacPool reuses HMAC hashes keyed with the most recently used key, since
+// hmac.New allocates the hash states and key pads on every call
+type hmacPool struct {
+	mu   sync.Mutex
+	key  []byte
+	pool *sync.Pool
+}
+
+// slackMACs and envelopeMACs pool the hashes of Slack request verification and
+// envelope signing
+var slackMACs, envelopeMACs hmacPool
+
+// get returns a reset hash keyed with key, and the pool to put it back in.
+// Rotating the key starts a new pool.
+func (p *hmacPool) get(key []byte) (*pooledMAC, *sync.Pool) {
+	p.mu.Lock()
+	if p.pool == nil || !bytes.Equal(p.key, key) {
+		poolKey := bytes.Clone(key)
+		p.key = poolKey
+		p.pool = &sync.Pool{New: func() interface{} {
+			return &pooledMAC{Hash: hmac.New(sha256.New, poolKey), buf: make([]byte, 0, 2*sha256.Size+32)}
+		}}
+	}
+	pool := p.pool
+	p.mu.Unlock()
+
+	mac := pool.Get().(*pooledMAC)
+	mac.Reset()
+	return mac, pool
+}
+
+// signedSum appends the hex HMAC of "<version>:<timestamp>:<body>" to the
+// mac's scratch buffer and returns it. It is valid until the mac is put back.
+func (m *pooledMAC) signedSum(version string, timestamp []byte, body []byte) []byte {
+	m.buf = append(m.buf[:0], version...)
+	m.buf = append(m.buf, ':')
+	m.buf = append(m.buf, timestamp...)
+	m.buf = append(m.buf, ':')
+	m.Write(m.buf)
+	m.Write(body)
+	sum := m.Sum(m.buf[:0])
+	return hex.AppendEncode(sum[len(sum):], sum)
+}
+
+// envelopeSignature computes the signature of payload at timestamp:
+// v1=hex(HMAC-SHA256(key, "v1:<timestamp>:<payload>"))
+func envelopeSignature(key []byte, timestamp int64, payload []byte) string {
+	mac, pool := envelopeMACs.get(key)
+	defer pool.Put(mac)
+	var ts [20]byte
+	return envelopeSignatureVersion + "=" + string(mac.signedSum(envelopeSignatureVersion, strconv.AppendInt(ts[:0], timestamp, 10), payload))
+}
+
+// signPayload wraps payload in a signed envelope when envelope signing is
+// enabled, and returns it unchanged otherwise
+func signPayload(payload []byte) []byte {
+	key := getEnvelopeSigningKey()
+	if len(key) == 0 {
+		return payload
+	}
+
+	timestamp := clock.Now().Unix()
+	header, err := json.Marshal(signedEnvelope{
+		Type:      "signed",
+		KeyID:     envelopeKeyID,
+		Timestamp: timestamp,
+		Signature: envelopeSignature(key, timestamp, payload),
+		Payload:   envelopePayloadPlaceholder,
+	})
+	if err != nil {
+		logError("Error signing published payload: %v", err)
+		return payload
+	}
+
+	// The payload is spliced in as is: marshaling it as a RawMessage compacts
+	// it and escapes <, > and &, so it would no longer match its signature
+	data := make([]byte, 0, len(header)+len(payload))
+	data = append(data, header[:len(header)-len(envelopePayloadPlaceholder)-1]...)
+	data = append(data, payload...)
+	return append(data, '}')
+}
+
+// verifyEnvelope checks a signed envelope against key and returns its payload.
+// Envelopes older than maxAge are rejected; zero disables the age check.
+func verifyEnvelope(data []byte, key []byte, maxAge time.Duration, now time.Time) ([]byte, bool) {
+	var envelope signedEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Type != "signed" {
+		return nil, false
+	}
+	if maxAge > 0 && now.Sub(time.Unix(envelope.Timestamp, 0)).Abs() > maxAge {
+		return nil, false
+	}
+	expected := envelopeSignature(key, envelope.Timestamp, envelope.Payload)
+	if !hmac.Equal([]byte(expected), []byte(envelope.Signature)) {
+		return nil, false
+	}
+	return envelope.Payload, true
+}
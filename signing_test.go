@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSignPayload(t *testing.T) {
+	payload := []byte(`{"type":"event_callback","event":{"type":"message"}}`)
+
+	envelopeSigningKey = nil
+	if got := signPayload(payload); string(got) != string(payload) {
+		t.Errorf("expected payload unchanged without a signing key, got %s", got)
+	}
+
+	envelopeSigningKey, envelopeKeyID = []byte("relay-key"), "2026-10"
+	defer func() { envelopeSigningKey, envelopeKeyID = nil, "" }()
+
+	signed := signPayload(payload)
+	var envelope signedEnvelope
+	if err := json.Unmarshal(signed, &envelope); err != nil {
+		t.Fatalf("unexpected error decoding envelope: %v", err)
+	}
+	if envelope.Type != "signed" || envelope.KeyID != "2026-10" || string(envelope.Payload) != string(payload) {
+		t.Errorf("unexpected envelope %s", signed)
+	}
+
+	now := time.Unix(envelope.Timestamp, 0)
+	if verified, ok := verifyEnvelope(signed, []byte("relay-key"), 5*time.Minute, now); !ok || string(verified) != string(payload) {
+		t.Errorf("expected envelope to verify, got %s, %v", verified, ok)
+	}
+	if _, ok := verifyEnvelope(signed, []byte("other-key"), 5*time.Minute, now); ok {
+		t.Error("expected verification with the wrong key to fail")
+	}
+	if _, ok := verifyEnvelope(signed, []byte("relay-key"), 5*time.Minute, now.Add(10*time.Minute)); ok {
+		t.Error("expected verification of a stale envelope to fail")
+	}
+
+	// Mentions, links and & are published as received, so the signature holds
+	mention := []byte(`{"type":"event_callback", "event":{"type":"message","text":"<@U123> & bye <https://example.com?a=1&b=2>"}}`)
+	signedMention := signPayload(mention)
+	if verified, ok := verifyEnvelope(signedMention, []byte("relay-key"), 0, now); !ok || string(verified) != string(mention) {
+		t.Errorf("expected an envelope of a payload with a mention to verify, got %s, %v", signedMention, ok)
+	}
+
+	envelope.Payload = json.RawMessage(`{"type":"event_callback","event":{"type":"app_mention"}}`)
+	tampered, _ := json.Marshal(envelope)
+	if _, ok := verifyEnvelope(tampered, []byte("relay-key"), 0, now); ok {
+		t.Error("expected verification of a tampered payload to fail")
+	}
+}
+
+func TestHMACPoolKeyRotation(t *testing.T) {
+	body := []byte(`{"type":"event_callback"}`)
+	expected := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:1531420618:"))
+		mac.Write(body)
+		return "v0=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	// Pooled hashes are reset between uses and rebuilt when the key changes
+	for _, secret := range []string{"first-secret", "first-secret", "second-secret", "first-secret"} {
+		if got := computeSlackSignature(body, "1531420618", []byte(secret)); got != expected(secret) {
+			t.Errorf("secret %s: expected %s, got %s", secret, expected(secret), got)
+		}
+	}
+}
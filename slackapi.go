@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// slackAPITimeout bounds every Slack Web API call made by the relay
+	slackAPITimeout = 5 * time.Second
+)
+
+// slackAPIBaseURL is the Slack Web API base URL, overridable in tests
+var slackAPIBaseURL = "https://slack.com/api/"
+
+// slackBotToken is the bot token (xoxb-...) used for Slack Web API calls
+var slackBotToken string
+
+// getSlackBotToken returns the current Slack bot token
+func getSlackBotToken() string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return slackBotToken
+}
+
+// slackAPIClient is the HTTP client used for Slack Web API calls
+var slackAPIClient = &http.Client{Timeout: slackAPITimeout}
+
+// slackAPIResponse holds the fields common to every Slack Web API response
+type slackAPIResponse struct {
+	OK               bool   `json:"ok"`
+	Error            string `json:"error,omitempty"`
+	ResponseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	} `json:"response_metadata"`
+}
+
+// slackRateLimitedError is returned when Slack rejects a call with 429 Too Many Requests
+type slackRateLimitedError struct {
+	Method string
+	// RetryAfter is how long Slack asks to wait before calling the method again
+	RetryAfter time.Duration
+}
+
+func (e *slackRateLimitedError) Error() string {
+	return fmt.Sprintf("slack API %s rate limited, retry after %s", e.Method, e.RetryAfter)
+}
+
+// defaultSlackRetryAfter is the wait assumed when a 429 response has no valid Retry-After header
+const defaultSlackRetryAfter = 30 * time.Second
+
+// callSlackAPI calls a Slack Web API method with form-encoded params and decodes
+// the JSON response into result. It returns an error if the request fails or
+// Slack responds with ok=false.
+func callSlackAPI(ctx context.Context, method string, token string, params url.Values, result interface{}) error {
+	_, err := callSlackAPIWithHeaders(ctx, method, token, params, result)
+	return err
+}
+
+// callSlackAPIWithHeaders is callSlackAPI, also returning the response headers,
+// which carry information such as the token's granted scopes
+func callSlackAPIWithHeaders(ctx context.Context, method string, token string, params url.Values, result interface{}) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, slackAPIBaseURL+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := slackAPIClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := defaultSlackRetryAfter
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, &slackRateLimitedError{Method: method, RetryAfter: retryAfter}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("slack API %s returned status %d", method, resp.StatusCode)
+	}
+
+	var status slackAPIResponse
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, fmt.Errorf("slack API %s returned invalid JSON: %w", method, err)
+	}
+	if !status.OK {
+		return nil, fmt.Errorf("slack API %s error: %s", method, status.Error)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(body, result); err != nil {
+			return nil, err
+		}
+	}
+	return resp.Header, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultMetricsSnapshotInterval is how often counters are saved when snapshots are enabled
+const defaultMetricsSnapshotInterval = time.Minute
+
+var metricSnapshotErrors = newCounterVec("slack_relay_metrics_snapshot_errors_total",
+	"Failed saves and restores of the metrics snapshot, by operation.", "operation")
+
+// metricsSnapshot is the saved state of the relay's counters
+type metricsSnapshot struct {
+	SavedAt time.Time `json:"saved_at"`
+	// Counters are the series of each counter, by name
+	Counters map[string][]snapshotSeries `json:"counters"`
+}
+
+// snapshotSeries is the value of a counter for one set of label values
+type snapshotSeries struct {
+	Labels []string `json:"labels"`
+	Value  float64  `json:"value"`
+}
+
+// snapshotStore persists the metrics snapshot
+type snapshotStore interface {
+	load(ctx context.Context) ([]byte, error)
+	save(ctx context.Context, data []byte) error
+	String() string
+}
+
+// fileSnapshotStore keeps the snapshot in a file, replaced atomically on save
+type fileSnapshotStore struct {
+	path string
+}
+
+func (s fileSnapshotStore) load(ctx context.Context) ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s fileSnapshotStore) save(ctx context.Context, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".metrics-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s fileSnapshotStore) String() string {
+	return "file " + s.path
+}
+
+// redisSnapshotStore keeps the snapshot in a Redis key
+type redisSnapshotStore struct {
+	key string
+}
+
+func (s redisSnapshotStore) load(ctx context.Context) ([]byte, error) {
+	if redisClient == nil {
+		return nil, errRedisUnavailable
+	}
+	data, err := redisClient.Get(ctx, s.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s redisSnapshotStore) save(ctx context.Context, data []byte) error {
+	if redisClient == nil {
+		return errRedisUnavailable
+	}
+	return redisClient.Set(ctx, s.key, data, 0).Err()
+}
+
+func (s redisSnapshotStore) String() string {
+	return "Redis key " + s.key
+}
+
+// snapshotStoreFromEnv returns the snapshot store configured by
+// METRICS_SNAPSHOT_FILE or METRICS_SNAPSHOT_KEY, or nil when snapshots are disabled
+func snapshotStoreFromEnv() (snapshotStore, error) {
+	file, key := os.Getenv("METRICS_SNAPSHOT_FILE"), os.Getenv("METRICS_SNAPSHOT_KEY")
+	switch {
+	case file != "" && key != "":
+		return nil, fmt.Errorf("set METRICS_SNAPSHOT_FILE or METRICS_SNAPSHOT_KEY, not both")
+	case file != "":
+		return fileSnapshotStore{path: file}, nil
+	case key != "":
+		return redisSnapshotStore{key: key}, nil
+	}
+	return nil, nil
+}
+
+// registeredCounters returns the counters exposed on /metrics
+func registeredCounters() []*counterVec {
+	var counters []*counterVec
+	for _, collector := range metricsRegistry {
+		if counter, ok := collector.(*counterVec); ok {
+			counters = append(counters, counter)
+		}
+	}
+	return counters
+}
+
+// takeMetricsSnapshot returns the current values of the counters
+func takeMetricsSnapshot(counters []*counterVec, now time.Time) metricsSnapshot {
+	snapshot := metricsSnapshot{SavedAt: now.UTC(), Counters: make(map[string][]snapshotSeries, len(counters))}
+	for _, counter := range counters {
+		counter.mu.Lock()
+		for key, value := range counter.values {
+			labels := []string{}
+			if len(counter.labels) > 0 {
+				labels = strings.Split(key, "\xff")
+			}
+			snapshot.Counters[counter.name] = append(snapshot.Counters[counter.name], snapshotSeries{Labels: labels, Value: value})
+		}
+		counter.mu.Unlock()
+	}
+	return snapshot
+}
+
+// restoreMetricsSnapshot adds the saved values to the counters. Counters that
+// no longer exist, or whose labels changed, are skipped.
+func restoreMetricsSnapshot(counters []*counterVec, snapshot metricsSnapshot) int {
+	restored := 0
+	for _, counter := range counters {
+		for _, series := range snapshot.Counters[counter.name] {
+			if len(series.Labels) != len(counter.labels) {
+				continue
+			}
+			counter.Add(series.Value, series.Labels...)
+			restored++
+		}
+	}
+	return restored
+}
+
+// saveMetricsSnapshot saves the current values of the counters to store
+func saveMetricsSnapshot(ctx context.Context, store snapshotStore, now time.Time) error {
+	data, err := json.Marshal(takeMetricsSnapshot(registeredCounters(), now))
+	if err != nil {
+		return err
+	}
+	return store.save(ctx, data)
+}
+
+// loadMetricsSnapshot restores the counters from store, if it holds a snapshot
+func loadMetricsSnapshot(ctx context.Context, store snapshotStore) error {
+	data, err := store.load(ctx)
+	if err != nil || data == nil {
+		return err
+	}
+	var snapshot metricsSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("invalid snapshot: %w", err)
+	}
+	restored := restoreMetricsSnapshot(registeredCounters(), snapshot)
+	logInfo("Restored %d counter series from the metrics snapshot saved at %s", restored, snapshot.SavedAt.Format(time.RFC3339))
+	return nil
+}
+
+// watchMetricsSnapshot saves the counters to store every interval
+func watchMetricsSnapshot(ctx context.Context, store snapshotStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			saveCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if err := saveMetricsSnapshot(saveCtx, store, now); err != nil {
+				logWarn("Error saving the metrics snapshot to %s: %v", store, err)
+				metricSnapshotErrors.Inc("save")
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMetricsSnapshotRoundTrip(t *testing.T) {
+	published := &counterVec{name: "test_published_total", labels: []string{"event_type"}, values: make(map[string]float64)}
+	pipelines := &counterVec{name: "test_pipelines_total", values: make(map[string]float64)}
+	published.Add(5, "message")
+	published.Add(2, "app_mention")
+	pipelines.Add(3)
+
+	store := fileSnapshotStore{path: filepath.Join(t.TempDir(), "metrics.json")}
+	snapshot := takeMetricsSnapshot([]*counterVec{published, pipelines}, time.Now())
+
+	// A missing snapshot restores nothing
+	if data, err := store.load(context.Background()); err != nil || data != nil {
+		t.Fatalf("expected no snapshot, got %q, %v", data, err)
+	}
+
+	restoredPublished := &counterVec{name: "test_published_total", labels: []string{"event_type"}, values: map[string]float64{"message": 1}}
+	restoredPipelines := &counterVec{name: "test_pipelines_total", values: make(map[string]float64)}
+	relabeled := &counterVec{name: "test_pipelines_total", labels: []string{"result"}, values: make(map[string]float64)}
+	if restored := restoreMetricsSnapshot([]*counterVec{restoredPublished, restoredPipelines}, snapshot); restored != 3 {
+		t.Errorf("expected 3 restored series, got %d", restored)
+	}
+	if restoredPublished.values["message"] != 6 || restoredPublished.values["app_mention"] != 2 || restoredPipelines.values[""] != 3 {
+		t.Errorf("unexpected restored values %v and %v", restoredPublished.values, restoredPipelines.values)
+	}
+	if restored := restoreMetricsSnapshot([]*counterVec{relabeled}, snapshot); restored != 0 {
+		t.Errorf("expected counters whose labels changed to be skipped, got %d", restored)
+	}
+}
+
+func TestFileSnapshotStore(t *testing.T) {
+	store := fileSnapshotStore{path: filepath.Join(t.TempDir(), "metrics.json")}
+	if err := saveMetricsSnapshot(context.Background(), store, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := loadMetricsSnapshot(context.Background(), fileSnapshotStore{path: filepath.Join(t.TempDir(), "missing.json")}); err != nil {
+		t.Errorf("expected a missing snapshot to be ignored, got %v", err)
+	}
+	data, err := store.load(context.Background())
+	if err != nil || len(data) == 0 {
+		t.Errorf("expected the saved snapshot, got %q, %v", data, err)
+	}
+}
+
+func TestSnapshotStoreFromEnv(t *testing.T) {
+	t.Setenv("METRICS_SNAPSHOT_FILE", "/data/metrics.json")
+	t.Setenv("METRICS_SNAPSHOT_KEY", "slack-relay:metrics")
+	if _, err := snapshotStoreFromEnv(); err == nil {
+		t.Error("expected both stores to be rejected")
+	}
+	t.Setenv("METRICS_SNAPSHOT_FILE", "")
+	if store, err := snapshotStoreFromEnv(); err != nil || store != (redisSnapshotStore{key: "slack-relay:metrics"}) {
+		t.Errorf("expected the Redis store, got %v, %v", store, err)
+	}
+}
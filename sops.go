@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// sopsDecryptTimeout bounds how long decrypting the config file may take,
+// including any KMS calls made by sops
+const sopsDecryptTimeout = 30 * time.Second
+
+// isSOPSEncrypted reports whether data is a JSON object carrying SOPS metadata
+func isSOPSEncrypted(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return false
+	}
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &document); err != nil {
+		return false
+	}
+	_, ok := document["sops"]
+	return ok
+}
+
+// decryptConfigIfNeeded decrypts data, the SOPS-encrypted content of a config
+// file, by piping it to the sops binary (SOPS_BINARY, default "sops"), which
+// handles the KMS, age or PGP keys the file was encrypted with. The file is not
+// read again, so sops decrypts exactly the content that was loaded. Content
+// without SOPS metadata is returned unchanged; filename is only used in messages.
+func decryptConfigIfNeeded(filename string, data []byte) ([]byte, error) {
+	if !isSOPSEncrypted(data) {
+		return data, nil
+	}
+
+	binary := os.Getenv("SOPS_BINARY")
+	if binary == "" {
+		binary = "sops"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sopsDecryptTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, "--decrypt", "--input-type", "json", "--output-type", "json", "/dev/stdin")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	decrypted, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s with %s: %w: %s", filename, binary, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	logInfo("Decrypted SOPS-encrypted configuration file %s", filename)
+	return decrypted, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsSOPSEncrypted(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`{"routes":[],"sops":{"kms":[]}}`, true},
+		{`{"routes":[]}`, false},
+		{`[{"slack-event-type":"message","channel":"c"}]`, false},
+		{`not-json`, false},
+	}
+	for _, tt := range tests {
+		if got := isSOPSEncrypted([]byte(tt.input)); got != tt.expected {
+			t.Errorf("isSOPSEncrypted(%q) = %v, want %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadEventConfigDecryptsSOPS(t *testing.T) {
+	dir := t.TempDir()
+
+	// A fake sops binary that saves its arguments and input, and prints the
+	// decrypted document
+	fakeSOPS := filepath.Join(dir, "sops")
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\ncat > " + filepath.Join(dir, "input") + "\necho '{\"routes\":[{\"slack-event-type\":\"message\",\"channel\":\"decrypted-channel\"}]}'\n"
+	if err := os.WriteFile(fakeSOPS, []byte(script), 0700); err != nil {
+		t.Fatalf("failed to write fake sops: %v", err)
+	}
+	t.Setenv("SOPS_BINARY", fakeSOPS)
+
+	configPath := filepath.Join(dir, "config.json")
+	encrypted := `{"routes":[{"slack-event-type":"ENC[AES256_GCM,data:abc]","channel":"ENC[AES256_GCM,data:def]"}],"sops":{"kms":[{"arn":"arn:aws:kms:test"}]}}`
+	if err := os.WriteFile(configPath, []byte(encrypted), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if err := loadEventConfig(configPath); err != nil {
+		t.Fatalf("loadEventConfig returned error: %v", err)
+	}
+	if currentConfig().byEventType["message"].Channel != "decrypted-channel" {
+		t.Errorf("expected decrypted channel, got %v", currentConfig().byEventType["message"].Channel)
+	}
+	if args, _ := os.ReadFile(filepath.Join(dir, "args")); strings.Contains(string(args), configPath) {
+		t.Errorf("expected sops not to read the config file again, got arguments %s", args)
+	}
+	if input, _ := os.ReadFile(filepath.Join(dir, "input")); string(input) != encrypted {
+		t.Errorf("expected the loaded content on stdin, got %q", input)
+	}
+}
+
+func TestLoadEventConfigSOPSFailure(t *testing.T) {
+	t.Setenv("SOPS_BINARY", filepath.Join(t.TempDir(), "missing-sops"))
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"routes":[],"sops":{}}`), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if err := loadEventConfig(configPath); err == nil {
+		t.Error("expected error when sops is unavailable, got nil")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Actions taken on stale events
+const (
+	staleDrop   = "drop"
+	staleFlag   = "flag"
+	staleDivert = "divert"
+)
+
+// skipStale is the skip reason for stale events dropped by their route
+const skipStale = "event is stale"
+
+var metricStaleEvents = newCounterVec("slack_relay_stale_events_total",
+	"Events older than their route's max age when received, by event type and action.", "event_type", "action")
+
+// StalePolicy decides what happens to events delivered long after they
+// happened, such as after a Slack outage, so consumers don't act on them as if
+// they were fresh
+type StalePolicy struct {
+	// MaxAge is the age above which an event is stale, measured from its
+	// event_time; zero disables the policy
+	MaxAge Duration `json:"max-age,omitempty"`
+	// Action is drop (default), flag, which attaches the event's age to the
+	// payload, or divert to Channel
+	Action string `json:"action,omitempty"`
+	// Channel receives stale events with the divert action, e.g. a backfill channel
+	Channel string `json:"channel,omitempty"`
+}
+
+// enabled reports whether the route checks the age of its events
+func (p StalePolicy) enabled() bool {
+	return p.MaxAge > 0
+}
+
+// action returns the action on stale events
+func (p StalePolicy) action() string {
+	if p.Action == "" {
+		return staleDrop
+	}
+	return p.Action
+}
+
+// validateStalePolicies checks the stale event policy of every route
+func validateStalePolicies(configs []EventConfig) error {
+	for _, config := range configs {
+		if !config.Stale.enabled() {
+			continue
+		}
+		switch config.Stale.action() {
+		case staleDrop, staleFlag:
+		case staleDivert:
+			if config.Stale.Channel == "" {
+				return fmt.Errorf("route '%s' diverts stale events but has no stale channel", config.EventType)
+			}
+		default:
+			return fmt.Errorf("route '%s' has invalid stale action '%s', expected drop, flag or divert", config.EventType, config.Stale.Action)
+		}
+	}
+	return nil
+}
+
+// payloadEventTime returns the event_time of an event callback, when Slack
+// says the event happened. It reports false for payloads without one, such as
+// interactive payloads.
+func payloadEventTime(payload map[string]interface{}) (time.Time, bool) {
+	seconds, ok := payload["event_time"].(float64)
+	if !ok || seconds <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// eventAge returns how long before now the payload's event happened. It
+// reports false for payloads without an event_time.
+func eventAge(payload map[string]interface{}, now time.Time) (time.Duration, bool) {
+	eventTime, ok := payloadEventTime(payload)
+	if !ok {
+		return 0, false
+	}
+	return now.Sub(eventTime), true
+}
+
+// staleMetadata returns the relay metadata flagging a stale event
+func staleMetadata(eventTime time.Time, age time.Duration) map[string]interface{} {
+	return map[string]interface{}{
+		"event_time":  eventTime.Unix(),
+		"age_seconds": int64(age.Seconds()),
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRouteStaleEvents(t *testing.T) {
+	defer setupTestEnvironment()
+
+	event := func(age time.Duration) map[string]interface{} {
+		return map[string]interface{}{
+			"type":       "event_callback",
+			"event_time": float64(time.Now().Add(-age).Unix()),
+			"event":      map[string]interface{}{"type": "message"},
+		}
+	}
+
+	for _, tt := range []struct {
+		action  string
+		age     time.Duration
+		stale   string
+		skip    string
+		channel string
+	}{
+		{staleDrop, time.Minute, "", "", "messages"},
+		{staleDrop, 3 * time.Hour, staleDrop, skipStale, "messages"},
+		{staleFlag, 3 * time.Hour, staleFlag, "", "messages"},
+		{staleDivert, 3 * time.Hour, staleDivert, "", "messages-backfill"},
+	} {
+		policy := StalePolicy{MaxAge: Duration(10 * time.Minute), Action: tt.action, Channel: "messages-backfill"}
+		setEventConfigs([]EventConfig{{EventType: "message", Channel: "messages", Stale: policy}})
+
+		payload := event(tt.age)
+		raw, _ := json.Marshal(payload)
+		routed := routeEvent(payload, raw)
+		if routed.Stale != tt.stale || routed.Skip != tt.skip || routed.Config.Channel != tt.channel {
+			t.Errorf("%s after %s: expected stale %q, skip %q and channel %q, got %+v", tt.action, tt.age, tt.stale, tt.skip, tt.channel, routed)
+		}
+
+		var published map[string]interface{}
+		json.Unmarshal(routed.Payload, &published)
+		metadata, _ := published[relayMetadataKey].(map[string]interface{})
+		stale, flagged := metadata["stale"].(map[string]interface{})
+		if flagged != (tt.stale == staleFlag) {
+			t.Errorf("%s after %s: expected flagged %v, got %v", tt.action, tt.age, tt.stale == staleFlag, published)
+		}
+		if flagged && stale["age_seconds"].(float64) < (3*time.Hour).Seconds() {
+			t.Errorf("expected the event's age, got %v", stale)
+		}
+	}
+
+	// Payloads without an event_time are never stale
+	setEventConfigs([]EventConfig{{EventType: "block_actions", Channel: "actions", Stale: StalePolicy{MaxAge: Duration(time.Second)}}})
+	if routed := routeEvent(map[string]interface{}{"type": "block_actions"}, nil); routed.Stale != "" || routed.Skip != "" {
+		t.Errorf("expected an interactive payload to be routed, got %+v", routed)
+	}
+}
+
+func TestValidateStalePolicies(t *testing.T) {
+	for _, config := range []string{
+		`[{"slack-event-type": "message", "channel": "messages", "stale": {"max-age": "10m", "action": "divert"}}]`,
+		`[{"slack-event-type": "message", "channel": "messages", "stale": {"max-age": "10m", "action": "ignore"}}]`,
+	} {
+		if _, err := parseEventConfig([]byte(config)); err == nil {
+			t.Errorf("expected %s to be invalid", config)
+		}
+	}
+	if _, err := parseEventConfig([]byte(`[{"slack-event-type": "message", "channel": "messages", "stale": {"max-age": "10m", "action": "divert", "channel": "backfill"}}]`)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// defaultStateKeyPrefix prefixes the Redis keys of interaction state
+	defaultStateKeyPrefix = "slack-relay:state:"
+	// defaultStateTTL is how long interaction state is kept after it was last saved
+	defaultStateTTL = time.Hour
+	// stateTimeout bounds the Redis round trip made for a route's state
+	stateTimeout = time.Second
+)
+
+var (
+	// stateKeyPrefix prefixes the Redis keys of interaction state
+	stateKeyPrefix = defaultStateKeyPrefix
+	// stateTTL is the default time to live of interaction state
+	stateTTL = defaultStateTTL
+)
+
+var metricStateErrors = newCounterVec("slack_relay_state_errors_total",
+	"Interaction state reads and writes that failed, by event type.", "event_type")
+
+// StatePolicy configures a route's use of the interaction state store, a Redis
+// hash per interaction that carries context between the steps of multi-step
+// modal flows
+type StatePolicy struct {
+	// Load attaches the interaction's stored state to the published payload
+	Load bool `json:"load,omitempty"`
+	// Save stores these fields in the interaction's state. Values are templates
+	// rendered with the payload; fields rendering empty are not saved.
+	Save map[string]string `json:"save,omitempty"`
+	// TTL is how long the state is kept after it was last saved (default STATE_TTL)
+	TTL Duration `json:"ttl,omitempty"`
+}
+
+// enabled reports whether the route reads or writes interaction state
+func (p StatePolicy) enabled() bool {
+	return p.Load || len(p.Save) > 0
+}
+
+// ttl returns how long saved state is kept
+func (p StatePolicy) ttl() time.Duration {
+	if p.TTL > 0 {
+		return time.Duration(p.TTL)
+	}
+	return stateTTL
+}
+
+// interactionStateKey returns the ID the state of a payload's interaction is
+// stored under: the root view of a modal, which stays the same as views are
+// pushed and updated, or else the trigger_id. It returns an empty string for
+// payloads that are not interactions.
+func interactionStateKey(payload map[string]interface{}) string {
+	if view, ok := payload["view"].(map[string]interface{}); ok {
+		if id, _ := view["root_view_id"].(string); id != "" {
+			return id
+		}
+		if id, _ := view["id"].(string); id != "" {
+			return id
+		}
+	}
+	triggerID, _ := payload["trigger_id"].(string)
+	return triggerID
+}
+
+// stateFields renders the fields the policy saves for payload, leaving out
+// those rendering empty. Payload fields missing from a map render as
+// "<no value>", which counts as empty.
+func stateFields(policy StatePolicy, payload map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(policy.Save))
+	for name, value := range policy.Save {
+		if rendered := renderTemplateString(value, payload); rendered != "" && rendered != "<no value>" {
+			fields[name] = rendered
+		}
+	}
+	return fields
+}
+
+// interactionState saves the route's fields in the state of the payload's
+// interaction and returns the state when the route loads it, including the
+// fields just saved. It returns nil when the payload is not an interaction or
+// Redis is unavailable.
+func interactionState(eventType string, policy StatePolicy, payload map[string]interface{}) map[string]string {
+	id := interactionStateKey(payload)
+	if id == "" || redisClient == nil {
+		return nil
+	}
+	key := stateKeyPrefix + id
+	fields := stateFields(policy, payload)
+
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+
+	var loaded *redis.MapStringStringCmd
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(fields) > 0 {
+			pipe.HSet(ctx, key, fields)
+			pipe.Expire(ctx, key, policy.ttl())
+		}
+		if policy.Load {
+			loaded = pipe.HGetAll(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		logWarn("Error accessing state of interaction %s for event type '%s': %v", id, eventType, err)
+		metricStateErrors.Inc(eventTypeLabel(eventType))
+		return nil
+	}
+	if loaded == nil {
+		return nil
+	}
+	return loaded.Val()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestInteractionStateKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"pushed view", `{"type": "view_submission", "trigger_id": "1.2.abc", "view": {"id": "V2", "root_view_id": "V1"}}`, "V1"},
+		{"root view", `{"type": "view_submission", "view": {"id": "V1", "root_view_id": null}}`, "V1"},
+		{"message action", `{"type": "block_actions", "trigger_id": "1.2.abc", "container": {"type": "message"}}`, "1.2.abc"},
+		{"event", `{"type": "event_callback", "event": {"type": "message"}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.payload), &payload); err != nil {
+				t.Fatal(err)
+			}
+			if got := interactionStateKey(payload); got != tt.want {
+				t.Errorf("expected key %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStateFields(t *testing.T) {
+	policy := StatePolicy{Save: map[string]string{
+		"order_id": "{{(index .actions 0).value}}",
+		"step":     "confirm",
+		"note":     "{{.missing}}",
+	}}
+	payload := map[string]interface{}{
+		"actions": []interface{}{map[string]interface{}{"value": "1042"}},
+	}
+
+	fields := stateFields(policy, payload)
+	if len(fields) != 2 || fields["order_id"] != "1042" || fields["step"] != "confirm" {
+		t.Errorf("expected order_id and step, got %v", fields)
+	}
+}
+
+func TestStatePolicyTTL(t *testing.T) {
+	if ttl := (StatePolicy{}).ttl(); ttl != stateTTL {
+		t.Errorf("expected the default TTL %s, got %s", stateTTL, ttl)
+	}
+	if ttl := (StatePolicy{TTL: Duration(15 * time.Minute)}).ttl(); ttl != 15*time.Minute {
+		t.Errorf("expected 15m, got %s", ttl)
+	}
+}
+
+func TestStatePolicyInConfig(t *testing.T) {
+	configs, err := parseEventConfig([]byte(`[{"slack-event-type": "view_submission", "channel": "slack-refunds", "state": {"load": true, "ttl": "15m"}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !configs[0].State.enabled() || time.Duration(configs[0].State.TTL) != 15*time.Minute {
+		t.Errorf("expected a state policy loading with a 15m TTL, got %+v", configs[0].State)
+	}
+	if (StatePolicy{}).enabled() {
+		t.Error("expected an empty state policy to be disabled")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Publish modes of a route
+const (
+	// publishModePubSub publishes events to a pub/sub channel, reaching only the
+	// subscribers connected at the time
+	publishModePubSub = "pubsub"
+	// publishModeStream adds events to a Redis stream, where they are kept for
+	// consumers that connect later or replay them
+	publishModeStream = "stream"
+)
+
+// outputList is the route output pushing events onto a Redis list
+const outputList = "list"
+
+// defaultStreamMaxLen is the approximate number of entries streams are trimmed
+// to when their route sets no stream-maxlen
+const defaultStreamMaxLen = 10000
+
+// streamPayloadField is the field of stream entries holding the payload
+const streamPayloadField = "payload"
+
+// publishTarget is where events are written in Redis: a pub/sub channel, a
+// stream of the same name trimmed to about maxLen entries, or a list
+type publishTarget struct {
+	channel string
+	// mode is publishModeStream, outputList, or empty for pub/sub
+	mode   string
+	maxLen int64
+}
+
+// pubsubTarget returns the target publishing to a pub/sub channel
+func pubsubTarget(channel string) publishTarget {
+	return publishTarget{channel: channel}
+}
+
+// publishTarget returns the target of the route's events written to channel,
+// which is the route's channel or a channel its events are diverted to. The
+// route's own events are pushed onto its list-key, if set, and diverted events
+// onto the list named after their channel.
+func (c EventConfig) publishTarget(channel string) publishTarget {
+	if c.Output == outputList {
+		if channel == c.Channel && c.ListKey != "" {
+			channel = c.ListKey
+		}
+		return publishTarget{channel: channel, mode: outputList}
+	}
+	if c.PublishMode != publishModeStream {
+		return pubsubTarget(channel)
+	}
+	maxLen := c.StreamMaxLen
+	if maxLen == 0 {
+		maxLen = defaultStreamMaxLen
+	}
+	return publishTarget{channel: channel, mode: publishModeStream, maxLen: maxLen}
+}
+
+// send writes payload to the target with client, which may be a pipeline
+func (t publishTarget) send(ctx context.Context, client redis.Cmdable, payload []byte) redis.Cmder {
+	switch t.mode {
+	case publishModeStream:
+		return client.XAdd(ctx, &redis.XAddArgs{
+			Stream: t.channel,
+			MaxLen: t.maxLen,
+			Approx: true,
+			Values: map[string]interface{}{streamPayloadField: payload},
+		})
+	case outputList:
+		return client.RPush(ctx, t.channel, payload)
+	}
+	return client.Publish(ctx, t.channel, payload)
+}
+
+// String describes the target for logs
+func (t publishTarget) String() string {
+	switch t.mode {
+	case publishModeStream:
+		return fmt.Sprintf("Redis stream '%s'", t.channel)
+	case outputList:
+		return fmt.Sprintf("Redis list '%s'", t.channel)
+	}
+	return fmt.Sprintf("Redis channel '%s'", t.channel)
+}
+
+// validatePublishModes checks the publish mode and output of every route
+func validatePublishModes(configs []EventConfig) error {
+	for _, config := range configs {
+		switch config.PublishMode {
+		case "", publishModePubSub:
+			if config.StreamMaxLen != 0 {
+				return fmt.Errorf("route '%s' has stream-maxlen, which only applies to the stream publish mode", config.EventType)
+			}
+		case publishModeStream:
+			if config.StreamMaxLen < 0 {
+				return fmt.Errorf("route '%s' has negative stream-maxlen %d", config.EventType, config.StreamMaxLen)
+			}
+		default:
+			return fmt.Errorf("route '%s' has invalid publish-mode '%s', expected pubsub or stream", config.EventType, config.PublishMode)
+		}
+
+		switch config.Output {
+		case "":
+			if config.ListKey != "" {
+				return fmt.Errorf("route '%s' has list-key, which only applies to the list output", config.EventType)
+			}
+		case outputList:
+			if config.PublishMode != "" {
+				return fmt.Errorf("route '%s' has output list, which cannot be combined with publish-mode", config.EventType)
+			}
+		default:
+			return fmt.Errorf("route '%s' has invalid output '%s', expected list", config.EventType, config.Output)
+		}
+	}
+	return nil
+}
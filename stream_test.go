@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseEventConfigPublishMode(t *testing.T) {
+	configs, err := parseEventConfig([]byte(`[
+		{"slack-event-type": "message", "channel": "slack-messages", "publish-mode": "stream", "stream-maxlen": 500},
+		{"slack-event-type": "app_mention", "channel": "slack-mentions", "publish-mode": "stream"},
+		{"slack-event-type": "team_join", "channel": "slack-joins"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target publishTarget
+		want   publishTarget
+	}{
+		{configs[0].publishTarget("slack-messages"), publishTarget{channel: "slack-messages", mode: publishModeStream, maxLen: 500}},
+		{configs[1].publishTarget("slack-mentions"), publishTarget{channel: "slack-mentions", mode: publishModeStream, maxLen: defaultStreamMaxLen}},
+		{configs[2].publishTarget("slack-joins"), pubsubTarget("slack-joins")},
+	}
+	for _, tt := range tests {
+		if tt.target != tt.want {
+			t.Errorf("expected target %+v, got %+v", tt.want, tt.target)
+		}
+	}
+
+	invalid := map[string]string{
+		`[{"slack-event-type": "message", "channel": "c", "publish-mode": "list"}]`:                        "invalid publish-mode",
+		`[{"slack-event-type": "message", "channel": "c", "stream-maxlen": 100}]`:                          "only applies to the stream publish mode",
+		`[{"slack-event-type": "message", "channel": "c", "publish-mode": "stream", "stream-maxlen": -1}]`: "negative stream-maxlen",
+	}
+	for data, want := range invalid {
+		if _, err := parseEventConfig([]byte(data)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q for %s, got %v", want, data, err)
+		}
+	}
+}
+
+// commandArgs formats the arguments of a Redis command, payloads as strings
+func commandArgs(cmd redis.Cmder) string {
+	args := make([]string, len(cmd.Args()))
+	for i, arg := range cmd.Args() {
+		if data, ok := arg.([]byte); ok {
+			arg = string(data)
+		}
+		args[i] = fmt.Sprint(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+func TestPublishTargetSend(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	defer client.Close()
+	pipe := client.Pipeline()
+	ctx := context.Background()
+
+	cmd := pubsubTarget("slack-messages").send(ctx, pipe, []byte(`{}`))
+	if args := commandArgs(cmd); args != "publish slack-messages {}" {
+		t.Errorf("expected a PUBLISH, got %s", args)
+	}
+
+	stream := EventConfig{PublishMode: publishModeStream, StreamMaxLen: 500}.publishTarget("slack-messages")
+	cmd = stream.send(ctx, pipe, []byte(`{}`))
+	if args := commandArgs(cmd); args != "xadd slack-messages maxlen ~ 500 * payload {}" {
+		t.Errorf("expected an XADD trimmed to about 500 entries, got %s", args)
+	}
+	if got := stream.String(); got != "Redis stream 'slack-messages'" {
+		t.Errorf("unexpected description %q", got)
+	}
+}
+
+func TestListOutput(t *testing.T) {
+	configs, err := parseEventConfig([]byte(`[
+		{"slack-event-type": "app_mention", "channel": "slack-mentions", "output": "list", "list-key": "jobs:mentions", "stale": {"max-age": "10m", "action": "divert", "channel": "slack-backfill"}},
+		{"slack-event-type": "message", "channel": "slack-messages", "output": "list"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target publishTarget
+		want   publishTarget
+	}{
+		{configs[0].publishTarget("slack-mentions"), publishTarget{channel: "jobs:mentions", mode: outputList}},
+		{configs[0].publishTarget("slack-backfill"), publishTarget{channel: "slack-backfill", mode: outputList}},
+		{configs[1].publishTarget("slack-messages"), publishTarget{channel: "slack-messages", mode: outputList}},
+	}
+	for _, tt := range tests {
+		if tt.target != tt.want {
+			t.Errorf("expected target %+v, got %+v", tt.want, tt.target)
+		}
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	defer client.Close()
+	cmd := tests[0].target.send(context.Background(), client.Pipeline(), []byte(`{}`))
+	if args := commandArgs(cmd); args != "rpush jobs:mentions {}" {
+		t.Errorf("expected an RPUSH, got %s", args)
+	}
+
+	invalid := map[string]string{
+		`[{"slack-event-type": "message", "channel": "c", "output": "queue"}]`:                          "invalid output",
+		`[{"slack-event-type": "message", "channel": "c", "list-key": "jobs"}]`:                         "only applies to the list output",
+		`[{"slack-event-type": "message", "channel": "c", "output": "list", "publish-mode": "stream"}]`: "cannot be combined with publish-mode",
+	}
+	for data, want := range invalid {
+		if _, err := parseEventConfig([]byte(data)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q for %s, got %v", want, data, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// usergroupUsersResponse is the usergroups.users.list response
+type usergroupUsersResponse struct {
+	slackAPIResponse
+	Users []string `json:"users"`
+}
+
+// isSubteamEvent reports whether eventType is a user group (subteam) event
+func isSubteamEvent(eventType string) bool {
+	return strings.HasPrefix(eventType, "subteam_")
+}
+
+// payloadSubteamID returns the user group ID of a subteam event: the ID of the
+// subteam object of subteam_created and subteam_updated, or the subteam_id of the
+// other subteam events
+func payloadSubteamID(payload map[string]interface{}) string {
+	event, _ := payload["event"].(map[string]interface{})
+	if subteam, ok := event["subteam"].(map[string]interface{}); ok {
+		if id, ok := subteam["id"].(string); ok {
+			return id
+		}
+	}
+	id, _ := event["subteam_id"].(string)
+	return id
+}
+
+// subteamMetadata builds the subteam metadata of a user group event: the group's
+// ID, handle and full member list. Members listed in the event are used as they
+// are; otherwise they are fetched with usergroups.users.list. It returns nil for
+// payloads without a user group ID.
+func subteamMetadata(ctx context.Context, payload map[string]interface{}) (map[string]interface{}, error) {
+	id := payloadSubteamID(payload)
+	if id == "" {
+		return nil, nil
+	}
+	event, _ := payload["event"].(map[string]interface{})
+	subteam, _ := event["subteam"].(map[string]interface{})
+
+	metadata := map[string]interface{}{"id": id}
+	for _, field := range []string{"handle", "name"} {
+		if value, ok := subteam[field]; ok {
+			metadata[field] = value
+		}
+	}
+	for _, field := range []string{"added_users", "removed_users"} {
+		if value, ok := event[field]; ok {
+			metadata[field] = value
+		}
+	}
+
+	if users, ok := subteam["users"].([]interface{}); ok {
+		metadata["members"] = users
+		metadata["member_count"] = len(users)
+		return metadata, nil
+	}
+
+	members, err := listUsergroupMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	metadata["members"] = members
+	metadata["member_count"] = len(members)
+	return metadata, nil
+}
+
+// listUsergroupMembers returns the user IDs of a user group's members
+func listUsergroupMembers(ctx context.Context, usergroupID string) ([]string, error) {
+	token := getSlackBotToken()
+	if token == "" {
+		return nil, errors.New("SLACK_BOT_TOKEN is not configured")
+	}
+	var result usergroupUsersResponse
+	params := url.Values{"usergroup": {usergroupID}}
+	if err := callSlackAPI(ctx, "usergroups.users.list", token, params, &result); err != nil {
+		return nil, err
+	}
+	if result.Users == nil {
+		return []string{}, nil
+	}
+	return result.Users, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSubteamMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/usergroups.users.list" || r.Form.Get("usergroup") != "S1" {
+			http.Error(w, "unexpected request", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"ok":true,"users":["U1","U2","U3"]}`))
+	}))
+	defer server.Close()
+	originalURL := slackAPIBaseURL
+	slackAPIBaseURL = server.URL + "/"
+	defer func() { slackAPIBaseURL = originalURL }()
+	slackBotToken = "xoxb-test"
+	defer func() { slackBotToken = "" }()
+
+	changed := map[string]interface{}{"event": map[string]interface{}{
+		"type":          "subteam_members_changed",
+		"subteam_id":    "S1",
+		"added_users":   []interface{}{"U3"},
+		"removed_users": []interface{}{},
+	}}
+	subteam, err := subteamMetadata(context.Background(), changed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	members, _ := subteam["members"].([]string)
+	if subteam["id"] != "S1" || len(members) != 3 || subteam["member_count"] != 3 {
+		t.Errorf("expected the members to be fetched, got %v", subteam)
+	}
+	if added, _ := subteam["added_users"].([]interface{}); len(added) != 1 {
+		t.Errorf("expected the added users to be kept, got %v", subteam)
+	}
+
+	updated := map[string]interface{}{"event": map[string]interface{}{
+		"type":    "subteam_updated",
+		"subteam": map[string]interface{}{"id": "S2", "handle": "oncall", "users": []interface{}{"U9"}},
+	}}
+	subteam, err = subteamMetadata(context.Background(), updated)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if subteam["id"] != "S2" || subteam["handle"] != "oncall" || subteam["member_count"] != 1 {
+		t.Errorf("expected the members listed in the event to be used, got %v", subteam)
+	}
+}
+
+func TestRouteEventExpandMembers(t *testing.T) {
+	setEventConfigs([]EventConfig{{EventType: "subteam_updated", Channel: "usergroups", ExpandMembers: true}})
+	defer setupTestEnvironment()
+
+	payload := map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{
+		"type":    "subteam_updated",
+		"subteam": map[string]interface{}{"id": "S2", "users": []interface{}{"U9"}},
+	}}
+	routed := routeEvent(payload, nil)
+
+	var published map[string]interface{}
+	if err := json.Unmarshal(routed.Payload, &published); err != nil {
+		t.Fatalf("unexpected error decoding payload: %v", err)
+	}
+	metadata, _ := published[relayMetadataKey].(map[string]interface{})
+	subteam, _ := metadata["subteam"].(map[string]interface{})
+	if subteam["id"] != "S2" {
+		t.Errorf("expected subteam metadata, got %v", published)
+	}
+}
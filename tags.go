@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// routeInfoMetric exposes each route's channel and tags, so dashboards and
+// alerts can join them onto the event_type label of the other metrics
+const routeInfoMetric = "slack_relay_route_info"
+
+// routeInfoCollector writes routeInfoMetric for the active routes
+type routeInfoCollector struct{}
+
+func init() {
+	metricsRegistry = append(metricsRegistry, routeInfoCollector{})
+}
+
+// writeMetrics writes one series per route, with a tag_<name> label per tag and
+// channel_types, commands, domains, languages, external, action_ids,
+// container_types, callback_ids, channel_ids, team_ids and user_ids labels on
+// filtered routes
+func (routeInfoCollector) writeMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", routeInfoMetric,
+		"Configured routes, labeled with their channel and tags.", routeInfoMetric)
+	for _, config := range currentEventConfigs() {
+		names := []string{"event_type", "channel"}
+		values := []string{config.EventType, config.Channel}
+		if len(config.ChannelTypes) > 0 {
+			names = append(names, "channel_types")
+			values = append(values, strings.Join(config.ChannelTypes, ","))
+		}
+		if len(config.Commands) > 0 {
+			names = append(names, "commands")
+			values = append(values, strings.Join(config.Commands, ","))
+		}
+		if len(config.Domains) > 0 {
+			names = append(names, "domains")
+			values = append(values, strings.Join(config.Domains, ","))
+		}
+		if len(config.Languages) > 0 {
+			names = append(names, "languages")
+			values = append(values, strings.Join(config.Languages, ","))
+		}
+		if config.External != "" {
+			names = append(names, "external")
+			values = append(values, config.External)
+		}
+		if len(config.ActionIDs) > 0 {
+			names = append(names, "action_ids")
+			values = append(values, strings.Join(config.ActionIDs, ","))
+		}
+		if len(config.ContainerTypes) > 0 {
+			names = append(names, "container_types")
+			values = append(values, strings.Join(config.ContainerTypes, ","))
+		}
+		if len(config.CallbackIDs) > 0 {
+			names = append(names, "callback_ids")
+			values = append(values, strings.Join(config.CallbackIDs, ","))
+		}
+		if len(config.ChannelIDs) > 0 {
+			names = append(names, "channel_ids")
+			values = append(values, strings.Join(config.ChannelIDs, ","))
+		}
+		if len(config.TeamIDs) > 0 {
+			names = append(names, "team_ids")
+			values = append(values, strings.Join(config.TeamIDs, ","))
+		}
+		if len(config.UserIDs) > 0 {
+			names = append(names, "user_ids")
+			values = append(values, strings.Join(config.UserIDs, ","))
+		}
+		for _, key := range sortedTagKeys(config.Tags) {
+			names = append(names, "tag_"+tagLabelName(key))
+			values = append(values, config.Tags[key])
+		}
+		fmt.Fprintf(w, "%s%s 1\n", routeInfoMetric, formatLabels(names, values))
+	}
+}
+
+// tagLabelName turns a tag name into a valid Prometheus label name suffix by
+// replacing every character other than letters, digits and underscores
+func tagLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// sortedTagKeys returns the tag names in alphabetical order
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatRouteTags renders tags for log lines as " [name=value ...]", or an empty
+// string when the route has no tags
+func formatRouteTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(tags))
+	for _, key := range sortedTagKeys(tags) {
+		pairs = append(pairs, key+"="+tags[key])
+	}
+	return " [" + strings.Join(pairs, " ") + "]"
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteEventAttachesTags(t *testing.T) {
+	setupTestEnvironment()
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "test-channel", Tags: map[string]string{"team": "payments", "severity": "high"}}})
+	defer setupTestEnvironment()
+
+	payload := map[string]interface{}{"type": "event_callback", "event": map[string]interface{}{"type": "message"}}
+	routed := routeEvent(payload, []byte(`{"type":"event_callback","event":{"type":"message"}}`))
+
+	var published struct {
+		Relay struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"slack_relay"`
+	}
+	if err := json.Unmarshal(routed.Payload, &published); err != nil {
+		t.Fatalf("unexpected error decoding payload: %v", err)
+	}
+	if published.Relay.Tags["team"] != "payments" || published.Relay.Tags["severity"] != "high" {
+		t.Errorf("expected route tags in relay metadata, got %s", routed.Payload)
+	}
+}
+
+func TestRouteInfoMetric(t *testing.T) {
+	setupTestEnvironment()
+	setEventConfigs([]EventConfig{{EventType: "message", Channel: "test-channel", Tags: map[string]string{"owner-team": "payments"}}})
+	defer setupTestEnvironment()
+
+	recorder := httptest.NewRecorder()
+	routeInfoCollector{}.writeMetrics(recorder)
+
+	expected := `slack_relay_route_info{event_type="message",channel="test-channel",tag_owner_team="payments"} 1`
+	if !strings.Contains(recorder.Body.String(), expected) {
+		t.Errorf("expected %q in output, got:\n%s", expected, recorder.Body.String())
+	}
+}
+
+func TestFormatRouteTags(t *testing.T) {
+	if got := formatRouteTags(nil); got != "" {
+		t.Errorf("expected no output without tags, got %q", got)
+	}
+	if got := formatRouteTags(map[string]string{"team": "payments", "severity": "high"}); got != " [severity=high team=payments]" {
+		t.Errorf("unexpected formatted tags %q", got)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// timeLayouts names the layouts formatTime accepts besides Go layouts
+var timeLayouts = map[string]string{
+	"RFC3339":  time.RFC3339,
+	"RFC1123":  time.RFC1123,
+	"Kitchen":  time.Kitchen,
+	"DateTime": time.DateTime,
+	"DateOnly": time.DateOnly,
+	"TimeOnly": time.TimeOnly,
+}
+
+// libraryTemplateFuncs are the general purpose template functions: time
+// formatting, string operations, JSON path extraction, hashing, URL building
+// and user and channel names. Functions taking a value take it last, so it can be piped in.
+func libraryTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// Time
+		"now":        func() time.Time { return clock.Now().UTC() },
+		"toTime":     toTemplateTime,
+		"formatTime": formatTemplateTime,
+
+		// Strings
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       joinTemplateValues,
+		"truncate":   truncateTemplateString,
+		"default":    defaultTemplateValue,
+
+		// JSON
+		"jsonPath": jsonPathValue,
+		"toJSON":   toTemplateJSON,
+
+		// Hashing
+		"md5":    func(s string) string { sum := md5.Sum([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"sha1":   func(s string) string { sum := sha1.Sum([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"sha256": func(s string) string { sum := sha256.Sum256([]byte(s)); return hex.EncodeToString(sum[:]) },
+
+		// URLs
+		"urlEncode":  url.QueryEscape,
+		"pathEscape": url.PathEscape,
+		"urlJoin":    joinTemplateURL,
+		"urlQuery":   buildTemplateQuery,
+
+		// Directory
+		"userName":    directoryUserName,
+		"channelName": directoryChannelName,
+	}
+}
+
+// toTemplateTime converts a time, a Slack timestamp such as "1712345678.000100",
+// Unix seconds or an RFC 3339 string to a UTC time
+func toTemplateTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case float64:
+		return time.Unix(0, int64(v*float64(time.Second))).UTC(), nil
+	case int:
+		return time.Unix(int64(v), 0).UTC(), nil
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	case json.Number:
+		return toTemplateTime(v.String())
+	case string:
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			return toTemplateTime(seconds)
+		}
+		return time.Parse(time.RFC3339, v)
+	}
+	return time.Time{}, fmt.Errorf("cannot convert %T to a time", value)
+}
+
+// formatTemplateTime formats value, converted with toTemplateTime, with a Go
+// layout or one of the names of timeLayouts
+func formatTemplateTime(layout string, value interface{}) (string, error) {
+	t, err := toTemplateTime(value)
+	if err != nil {
+		return "", err
+	}
+	if named, ok := timeLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout), nil
+}
+
+// joinTemplateValues joins the elements of a list with sep
+func joinTemplateValues(sep string, values interface{}) string {
+	switch v := values.(type) {
+	case []string:
+		return strings.Join(v, sep)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	}
+	return fmt.Sprint(values)
+}
+
+// truncateTemplateString shortens s to at most n characters, ending it with an
+// ellipsis when it was cut
+func truncateTemplateString(n int, s string) string {
+	runes := []rune(s)
+	if n <= 0 || len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// defaultTemplateValue returns value, or fallback when value is missing or empty
+func defaultTemplateValue(fallback interface{}, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return fallback
+	case string:
+		if v == "" {
+			return fallback
+		}
+	}
+	return value
+}
+
+// jsonPathValue returns the value at a dotted path, such as "event.files.0.name",
+// in data. Numeric segments index lists. It returns nil when the path does not exist.
+func jsonPathValue(path string, data interface{}) interface{} {
+	current := data
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		if segment == "" {
+			continue
+		}
+		switch v := current.(type) {
+		case map[string]interface{}:
+			current = v[segment]
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil
+			}
+			current = v[index]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// toTemplateJSON encodes value as JSON
+func toTemplateJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// joinTemplateURL appends path segments to base, escaping each segment
+func joinTemplateURL(base string, segments ...interface{}) (string, error) {
+	parts := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		parts = append(parts, fmt.Sprint(segment))
+	}
+	return url.JoinPath(base, parts...)
+}
+
+// buildTemplateQuery encodes alternating keys and values as a query string
+func buildTemplateQuery(pairs ...interface{}) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("urlQuery needs key and value pairs, got %d arguments", len(pairs))
+	}
+	query := url.Values{}
+	for i := 0; i < len(pairs); i += 2 {
+		query.Add(fmt.Sprint(pairs[i]), fmt.Sprint(pairs[i+1]))
+	}
+	return query.Encode(), nil
+}
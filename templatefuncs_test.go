@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLibraryTemplateFuncs(t *testing.T) {
+	payload := map[string]interface{}{
+		"user":  map[string]interface{}{"name": "Ada Lovelace", "id": "U123"},
+		"event": map[string]interface{}{"ts": "1712345678.000100", "files": []interface{}{map[string]interface{}{"name": "report.pdf"}}},
+		"tags":  []interface{}{"urgent", "billing"},
+		"text":  "  the quick brown fox  ",
+	}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{`{{formatTime "RFC3339" .event.ts}}`, "2024-04-05T19:34:38Z"},
+		{`{{.event.ts | formatTime "2006-01-02"}}`, "2024-04-05"},
+		{`{{.user.name | upper}}`, "ADA LOVELACE"},
+		{`{{.text | trim | replace "quick" "slow"}}`, "the slow brown fox"},
+		{`{{.text | trim | truncate 9}}`, "the quic…"},
+		{`{{join ", " .tags}}`, "urgent, billing"},
+		{`{{.user.missing | default "someone"}}`, "someone"},
+		{`{{if .user.name | hasPrefix "Ada"}}yes{{end}}`, "yes"},
+		{`{{jsonPath "event.files.0.name" .}}`, "report.pdf"},
+		{`{{jsonPath "event.files.3.name" . | default "none"}}`, "none"},
+		{`{{toJSON .tags}}`, `["urgent","billing"]`},
+		{`{{sha256 .user.id}}`, "64a7152bdd91f6f345d04a789b802724d369ead611ed2f7252c27507a74b8fd1"},
+		{`{{urlJoin "https://example.com/users" .user.id "profile"}}`, "https://example.com/users/U123/profile"},
+		{`https://example.com/search?{{urlQuery "q" .user.name "page" 2}}`, "https://example.com/search?page=2&q=Ada+Lovelace"},
+		{`{{urlEncode "a b&c"}}`, "a+b%26c"},
+	}
+	for _, tt := range tests {
+		if got := renderTemplateString(tt.template, payload); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.template, tt.want, got)
+		}
+	}
+
+	defer useClock(newManualClock(time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)))()
+	if now := renderTemplateString(`{{now | formatTime "2006"}}`, nil); now != "2030" {
+		t.Errorf("expected the clock's year, got %q", now)
+	}
+}
+
+func TestToTemplateTime(t *testing.T) {
+	for _, value := range []interface{}{"1712345678", 1712345678.0, 1712345678, "2024-04-05T19:34:38Z"} {
+		got, err := toTemplateTime(value)
+		if err != nil || got.Unix() != 1712345678 {
+			t.Errorf("%v: expected 1712345678, got %v (%v)", value, got.Unix(), err)
+		}
+	}
+	if _, err := toTemplateTime(true); err == nil {
+		t.Error("expected a bool to be rejected")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultResponseRedisTimeout bounds each Redis lookup made while rendering a
+// response, keeping Slack's 3-second acknowledgement deadline safe
+const defaultResponseRedisTimeout = 100 * time.Millisecond
+
+// responseRedisTimeout is the timeout of each Redis lookup in a response template
+var responseRedisTimeout = defaultResponseRedisTimeout
+
+// templateFuncs returns the functions available in response templates: the
+// function library and redis lookups
+func templateFuncs() template.FuncMap {
+	funcs := libraryTemplateFuncs()
+	funcs["redis"] = redisTemplateValue
+	return funcs
+}
+
+// redisTemplateValue returns the string value of a Redis key, or the optional
+// fallback if Redis is unavailable, the key is missing or the lookup times out
+func redisTemplateValue(key string, fallback ...string) string {
+	defaultValue := ""
+	if len(fallback) > 0 {
+		defaultValue = fallback[0]
+	}
+	if redisClient == nil {
+		return defaultValue
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), responseRedisTimeout)
+	defer cancel()
+
+	value, err := redisClient.Get(ctx, key).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			logWarn("Error reading Redis key '%s' for response template: %v", key, err)
+		}
+		return defaultValue
+	}
+	return value
+}
+
+// renderTemplateString renders text as a template with data. Strings without
+// template actions are returned unchanged; templates that fail to parse or
+// execute are logged and returned unrendered.
+func renderTemplateString(text string, data interface{}) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+
+	tmpl, err := template.New("response").Funcs(templateFuncs()).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		logError("Error parsing response template %q: %v", text, err)
+		return text
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		logError("Error rendering response template %q: %v", text, err)
+		return text
+	}
+	return sb.String()
+}
+
+// renderResponse renders every string in a configured response as a template,
+// with the Slack payload as data. The configured response is not modified.
+func renderResponse(response map[string]interface{}, payload map[string]interface{}) map[string]interface{} {
+	if response == nil {
+		return nil
+	}
+	rendered, _ := renderTemplateValue(response, payload).(map[string]interface{})
+	return rendered
+}
+
+// renderTemplateValue renders strings nested anywhere in value
+func renderTemplateValue(value interface{}, data interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return renderTemplateString(v, data)
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered[key] = renderTemplateValue(item, data)
+		}
+		return rendered
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered[i] = renderTemplateValue(item, data)
+		}
+		return rendered
+	default:
+		return value
+	}
+}
+
+// setMessageTemplates replaces the message templates of the active configuration
+func setMessageTemplates(templates map[string]map[string]interface{}) {
+	updateConfig(func(next *configSnapshot) {
+		next.templates = templates
+	})
+}
+
+// mergeMessageTemplates overlays templates on base, replacing templates with the same name
+func mergeMessageTemplates(base map[string]map[string]interface{}, overlay map[string]map[string]interface{}) map[string]map[string]interface{} {
+	if len(overlay) == 0 {
+		return base
+	}
+	result := make(map[string]map[string]interface{}, len(base)+len(overlay))
+	for name, template := range base {
+		result[name] = template
+	}
+	for name, template := range overlay {
+		result[name] = template
+	}
+	return result
+}
+
+// validateResponseTemplates checks that every route's response-template and
+// unfurl-template is defined
+func validateResponseTemplates(configs []EventConfig, templates map[string]map[string]interface{}) error {
+	for _, config := range configs {
+		if _, ok := templates[config.ResponseTemplate]; config.ResponseTemplate != "" && !ok {
+			return fmt.Errorf("route '%s' uses undefined response template '%s'", config.EventType, config.ResponseTemplate)
+		}
+		if _, ok := templates[config.UnfurlTemplate]; config.UnfurlTemplate != "" && !ok {
+			return fmt.Errorf("route '%s' uses undefined unfurl template '%s'", config.EventType, config.UnfurlTemplate)
+		}
+	}
+	return nil
+}
+
+// renderMessageTemplate renders every string in the named message template with
+// data. The template itself is not modified.
+func renderMessageTemplate(name string, data interface{}) (map[string]interface{}, error) {
+	template, ok := currentConfig().templates[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined message template '%s'", name)
+	}
+	rendered, _ := renderTemplateValue(template, data).(map[string]interface{})
+	return rendered, nil
+}
+
+// routeResponse returns the rendered response of a route: its response template
+// or its response, with the Slack payload as data. It returns nil when the route
+// has neither.
+func routeResponse(config EventConfig, payload map[string]interface{}) map[string]interface{} {
+	if config.ResponseTemplate == "" {
+		return renderResponse(config.Response, payload)
+	}
+	response, err := renderMessageTemplate(config.ResponseTemplate, payload)
+	if err != nil {
+		logError("Error rendering response of event type '%s': %v", config.EventType, err)
+	}
+	return response
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderTemplateStringWithoutActions(t *testing.T) {
+	if got := renderTemplateString("plain text", nil); got != "plain text" {
+		t.Errorf("expected unchanged string, got %q", got)
+	}
+}
+
+func TestRenderTemplateStringPayloadData(t *testing.T) {
+	payload := map[string]interface{}{"user": map[string]interface{}{"name": "alice"}}
+	if got := renderTemplateString("Thanks {{.user.name}}", payload); got != "Thanks alice" {
+		t.Errorf("expected rendered string, got %q", got)
+	}
+}
+
+func TestRenderTemplateStringInvalid(t *testing.T) {
+	if got := renderTemplateString("{{ broken", nil); got != "{{ broken" {
+		t.Errorf("expected invalid template to be returned unrendered, got %q", got)
+	}
+}
+
+func TestRedisTemplateValueFallback(t *testing.T) {
+	redisClient = nil
+	if got := renderTemplateString(`On call: {{redis "oncall:name" "nobody"}}`, nil); got != "On call: nobody" {
+		t.Errorf("expected fallback value without Redis, got %q", got)
+	}
+}
+
+func TestRenderResponseNested(t *testing.T) {
+	redisClient = nil
+	response := map[string]interface{}{
+		"response_action": "errors",
+		"errors": map[string]interface{}{
+			"block": `Contact {{redis "oncall" "the on-call engineer"}}`,
+		},
+		"items": []interface{}{"{{.type}}", 3.0},
+	}
+	payload := map[string]interface{}{"type": "view_submission"}
+
+	rendered := renderResponse(response, payload)
+
+	errs := rendered["errors"].(map[string]interface{})
+	if errs["block"] != "Contact the on-call engineer" {
+		t.Errorf("expected nested string to be rendered, got %v", errs["block"])
+	}
+	items := rendered["items"].([]interface{})
+	if items[0] != "view_submission" || items[1] != 3.0 {
+		t.Errorf("expected array items to be rendered, got %v", items)
+	}
+	if response["errors"].(map[string]interface{})["block"] == errs["block"] {
+		t.Error("expected configured response to be left unchanged")
+	}
+}
+
+func TestMessageTemplates(t *testing.T) {
+	parsed, err := parseConfigFrom(".", []byte(`{
+		"templates": {
+			"alert": {
+				"text": "{{.title}}",
+				"blocks": [{"type": "header", "text": {"type": "plain_text", "text": "{{.title}}"}}]
+			},
+			"approval-errors": {"response_action": "errors", "errors": {"reason": "Sorry {{.user.name}}, a reason is required"}}
+		},
+		"routes": [{"slack-event-type": "view_submission", "channel": "views", "response-template": "approval-errors"}]
+	}`), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	setEventConfigs(parsed.Routes)
+	setMessageTemplates(parsed.Templates)
+	defer setMessageTemplates(nil)
+	defer setupTestEnvironment()
+
+	config, _ := lookupEventConfig("view_submission")
+	response := routeResponse(config, map[string]interface{}{"user": map[string]interface{}{"name": "alice"}})
+	errs, _ := response["errors"].(map[string]interface{})
+	if response["response_action"] != "errors" || errs["reason"] != "Sorry alice, a reason is required" {
+		t.Errorf("expected the rendered response template, got %v", response)
+	}
+
+	message, err := parseOutboundMessage([]byte(`{"op":"update","channel":"C1","ts":"1.000001","template":"alert","data":{"title":"Deploy finished"},"text":"Deploy finished!"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if message.Params.Get("text") != "Deploy finished!" {
+		t.Errorf("expected the message's own text to take precedence, got %q", message.Params.Get("text"))
+	}
+	if message.Params.Get("blocks") != `[{"text":{"text":"Deploy finished","type":"plain_text"},"type":"header"}]` {
+		t.Errorf("expected the rendered template blocks, got %q", message.Params.Get("blocks"))
+	}
+	if message.Params.Has("template") || message.Params.Has("data") {
+		t.Errorf("expected template and data not to be passed to Slack, got %v", message.Params)
+	}
+
+	if _, err := parseOutboundMessage([]byte(`{"op":"update","channel":"C1","ts":"1.000001","template":"missing"}`)); err == nil {
+		t.Error("expected an undefined template to be invalid")
+	}
+	if _, err := parseConfigFrom(".", []byte(`[{"slack-event-type": "view_submission", "channel": "views", "response-template": "missing"}]`), 0); err == nil {
+		t.Error("expected a route using an undefined template to be invalid")
+	}
+}
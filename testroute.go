@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// runTestRouteCommand implements the "test-route" subcommand, which runs a
+// fixture payload through the routing pipeline and prints where it would be
+// published without publishing it
+func runTestRouteCommand(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("test-route", flag.ContinueOnError)
+	eventFile := flags.String("event", "", "JSON fixture of a Slack payload")
+	configPath := flags.String("config", "", "config file to test (default: CONFIG_FILE or config.json)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *eventFile == "" {
+		fmt.Fprintln(os.Stderr, "usage: slack-relay test-route -event fixture.json [-config config.json]")
+		return 2
+	}
+
+	configFile, required := configFileFromEnv()
+	if *configPath != "" {
+		configFile, required = *configPath, true
+	}
+	source, err := loadEventConfigWithDefaults(configFile, required)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration file '%s': %v\n", configFile, err)
+		return 1
+	}
+
+	rawPayload, err := os.ReadFile(*eventFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading event fixture: %v\n", err)
+		return 1
+	}
+	parsed, err := parseSlackPayload("application/json", bytes.TrimSpace(rawPayload))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing event fixture: %v\n", err)
+		return 1
+	}
+	payload := parsed.Fields()
+
+	routed := routeEvent(payload, parsed.Raw)
+
+	fmt.Fprintf(stdout, "Config:     %s (%d route(s))\n", source, len(currentEventConfigs()))
+	fmt.Fprintf(stdout, "Event type: %s\n", routed.EventType)
+	if routed.Skip != "" {
+		fmt.Fprintf(stdout, "Result:     not published (%s)\n", routed.Skip)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "Result:     published\n")
+	fmt.Fprintf(stdout, "Channel:    %s\n", routed.Config.Channel)
+	if routed.Region != "" {
+		fmt.Fprintf(stdout, "Region:     %s\n", routed.Region)
+	}
+	if routed.OutsideHours == outsideHoursBuffer {
+		fmt.Fprintf(stdout, "Held until: %s\n", routed.Config.ActiveHours.nextOpening(clock.Now()).Format(time.RFC3339))
+	}
+	if rendered := routeResponse(routed.Config, payload); rendered != nil {
+		response, _ := json.Marshal(rendered)
+		fmt.Fprintf(stdout, "Response:   %s\n", response)
+	}
+
+	fmt.Fprintf(stdout, "Payload:\n%s\n", indentedJSON(routed.Payload))
+	return 0
+}
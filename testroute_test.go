@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestRunTestRouteCommandRouted(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestFile(t, dir, "config.json", `[{"slack-event-type":"view_submission","channel":"views","response":{"response_action":"clear"}}]`)
+	event := writeTestFile(t, dir, "event.json", `{"type":"view_submission","view":{"id":"V1"}}`)
+
+	var out strings.Builder
+	code := runTestRouteCommand([]string{"-event", event, "-config", config}, &out)
+
+	if code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+	for _, expected := range []string{"Event type: view_submission", "Channel:    views", `"response_action":"clear"`, `"id": "V1"`} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestRunTestRouteCommandNotConfigured(t *testing.T) {
+	dir := t.TempDir()
+	config := writeTestFile(t, dir, "config.json", `[{"slack-event-type":"message","channel":"messages"}]`)
+	event := writeTestFile(t, dir, "event.json", `{"type":"event_callback","event":{"type":"app_mention"}}`)
+
+	var out strings.Builder
+	code := runTestRouteCommand([]string{"-event", event, "-config", config}, &out)
+
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(out.String(), skipNotConfigured) {
+		t.Errorf("expected output to explain skip, got:\n%s", out.String())
+	}
+}
+
+func TestRunTestRouteCommandUsage(t *testing.T) {
+	var out strings.Builder
+	if code := runTestRouteCommand(nil, &out); code != 2 {
+		t.Errorf("expected usage exit code 2, got %d", code)
+	}
+}
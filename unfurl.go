@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// linkSharedEventType is the event Slack sends when a message contains links to
+// the app's unfurl domains
+const linkSharedEventType = "link_shared"
+
+var metricUnfurls = newCounterVec("slack_relay_unfurls_total",
+	"Links unfurled from a route's unfurl template, by result.", "result")
+
+// sharedLink is a link of a link_shared event
+type sharedLink struct {
+	URL    string `json:"url"`
+	Domain string `json:"domain"`
+}
+
+// payloadLinks returns the links of a link_shared event
+func payloadLinks(payload map[string]interface{}) []sharedLink {
+	event, _ := payload["event"].(map[string]interface{})
+	items, _ := event["links"].([]interface{})
+	links := make([]sharedLink, 0, len(items))
+	for _, item := range items {
+		item, _ := item.(map[string]interface{})
+		link := sharedLink{}
+		link.URL, _ = item["url"].(string)
+		link.Domain, _ = item["domain"].(string)
+		if link.URL != "" {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// payloadLinkDomains returns the domains of a link_shared event's links
+func payloadLinkDomains(payload map[string]interface{}) []string {
+	var domains []string
+	for _, link := range payloadLinks(payload) {
+		if !containsString(domains, link.Domain) {
+			domains = append(domains, link.Domain)
+		}
+	}
+	return domains
+}
+
+// matchesDomain reports whether domain is one of domains or a subdomain of one
+func matchesDomain(domains []string, domain string) bool {
+	domain = strings.ToLower(domain)
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeLinks returns the links of a link_shared event handled by the route: those
+// of its domains, or every link when the route is not limited to domains
+func routeLinks(config EventConfig, payload map[string]interface{}) []sharedLink {
+	links := payloadLinks(payload)
+	if len(config.Domains) == 0 {
+		return links
+	}
+	matched := links[:0]
+	for _, link := range links {
+		if matchesDomain(config.Domains, link.Domain) {
+			matched = append(matched, link)
+		}
+	}
+	return matched
+}
+
+// unfurlParams returns the chat.unfurl arguments for the route's links of a
+// link_shared event, each unfurled with the route's unfurl template rendered
+// with the payload plus the link under "link". Links shared in the message
+// composer are identified by unfurl_id and source, others by channel and ts.
+func unfurlParams(config EventConfig, payload map[string]interface{}) (url.Values, error) {
+	unfurls := make(map[string]interface{})
+	for _, link := range routeLinks(config, payload) {
+		data := make(map[string]interface{}, len(payload)+1)
+		for key, value := range payload {
+			data[key] = value
+		}
+		data["link"] = map[string]interface{}{"url": link.URL, "domain": link.Domain}
+		unfurl, err := renderMessageTemplate(config.UnfurlTemplate, data)
+		if err != nil {
+			return nil, err
+		}
+		unfurls[link.URL] = unfurl
+	}
+	if len(unfurls) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(unfurls)
+	if err != nil {
+		return nil, err
+	}
+
+	event, _ := payload["event"].(map[string]interface{})
+	params := url.Values{"unfurls": {string(encoded)}}
+	if unfurlID, _ := event["unfurl_id"].(string); unfurlID != "" && event["source"] == "composer" {
+		params.Set("unfurl_id", unfurlID)
+		params.Set("source", "composer")
+	} else {
+		channel, _ := event["channel"].(string)
+		ts, _ := event["message_ts"].(string)
+		params.Set("channel", channel)
+		params.Set("ts", ts)
+	}
+	if team, _ := payload["team_id"].(string); team != "" {
+		params.Set("team_id", team)
+	}
+	return params, nil
+}
+
+// unfurlLinks unfurls the route's links of a link_shared event with its unfurl
+// template. It runs independently of the publish, so consumers can still unfurl
+// the links themselves through the outbound channel.
+func unfurlLinks(config EventConfig, payload map[string]interface{}) {
+	params, err := unfurlParams(config, payload)
+	if err != nil {
+		logError("Error rendering unfurl template '%s': %v", config.UnfurlTemplate, err)
+		metricUnfurls.Inc("failure")
+		return
+	}
+	if params == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), outboundTimeout)
+	defer cancel()
+	if err := callSlackBotAPI(ctx, "chat.unfurl", params, nil); err != nil {
+		logWarn("Error unfurling links with template '%s': %v", config.UnfurlTemplate, err)
+		metricUnfurls.Inc("failure")
+		return
+	}
+	metricUnfurls.Inc("success")
+}
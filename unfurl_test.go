@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// linkSharedPayload returns a link_shared event with links to the given URLs and domains
+func linkSharedPayload(links ...sharedLink) map[string]interface{} {
+	items := make([]interface{}, len(links))
+	for i, link := range links {
+		items[i] = map[string]interface{}{"url": link.URL, "domain": link.Domain}
+	}
+	return map[string]interface{}{
+		"type":    "event_callback",
+		"team_id": "T1",
+		"event": map[string]interface{}{
+			"type":       "link_shared",
+			"channel":    "C1",
+			"message_ts": "1700000000.000100",
+			"links":      items,
+		},
+	}
+}
+
+func TestRouteLinkSharedByDomain(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "link_shared", Channel: "slack-links"},
+		{EventType: "link_shared", Channel: "slack-jira-links", Domains: []string{"jira.example.com"}},
+		{EventType: "link_shared", Channel: "slack-docs-links", Domains: []string{"Docs.example.com"}},
+	})
+	defer setupTestEnvironment()
+
+	tests := []struct {
+		domain  string
+		channel string
+	}{
+		{"jira.example.com", "slack-jira-links"},
+		{"eu.docs.example.com", "slack-docs-links"},
+		{"example.com", "slack-links"},
+		{"notdocs.example.com", "slack-links"},
+	}
+	for _, tt := range tests {
+		routed := routeEvent(linkSharedPayload(sharedLink{URL: "https://" + tt.domain + "/x", Domain: tt.domain}), nil)
+		if routed.Skip != "" || routed.Config.Channel != tt.channel {
+			t.Errorf("%s: expected channel %q, got %q (skip %q)", tt.domain, tt.channel, routed.Config.Channel, routed.Skip)
+		}
+	}
+
+	if _, err := parseEventConfig([]byte(`[{"slack-event-type": "message", "channel": "messages", "domains": ["example.com"]}]`)); err == nil {
+		t.Error("expected domains on a route other than link_shared to be invalid")
+	}
+}
+
+func TestUnfurlParams(t *testing.T) {
+	setMessageTemplates(map[string]map[string]interface{}{
+		"ticket": {"title": "Ticket {{.link.url}}", "footer": "{{.link.domain}}"},
+	})
+	defer setMessageTemplates(nil)
+
+	config := EventConfig{EventType: "link_shared", Domains: []string{"jira.example.com"}, UnfurlTemplate: "ticket"}
+	payload := linkSharedPayload(
+		sharedLink{URL: "https://jira.example.com/browse/OPS-1", Domain: "jira.example.com"},
+		sharedLink{URL: "https://other.example.org/", Domain: "other.example.org"},
+	)
+	params, err := unfurlParams(config, payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params.Get("channel") != "C1" || params.Get("ts") != "1700000000.000100" || params.Get("team_id") != "T1" {
+		t.Errorf("expected the message to be identified by channel and ts, got %v", params)
+	}
+	var unfurls map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(params.Get("unfurls")), &unfurls); err != nil {
+		t.Fatalf("invalid unfurls: %v", err)
+	}
+	want := map[string]map[string]interface{}{
+		"https://jira.example.com/browse/OPS-1": {"title": "Ticket https://jira.example.com/browse/OPS-1", "footer": "jira.example.com"},
+	}
+	if !reflect.DeepEqual(unfurls, want) {
+		t.Errorf("unfurls = %v, want %v", unfurls, want)
+	}
+
+	event := payload["event"].(map[string]interface{})
+	event["source"] = "composer"
+	event["unfurl_id"] = "C1.U1.abc"
+	params, _ = unfurlParams(config, payload)
+	if params.Get("unfurl_id") != "C1.U1.abc" || params.Get("source") != "composer" || params.Has("ts") {
+		t.Errorf("expected composer links to be identified by unfurl_id and source, got %v", params)
+	}
+
+	params, err = unfurlParams(config, linkSharedPayload(sharedLink{URL: "https://other.example.org/", Domain: "other.example.org"}))
+	if err != nil || params != nil {
+		t.Errorf("expected nothing to unfurl without links of the route's domains, got %v, %v", params, err)
+	}
+}
+
+func TestUnfurlLinks(t *testing.T) {
+	var received url.Values
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/chat.unfurl" {
+			http.NotFound(w, r)
+			return
+		}
+		received = r.Form
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer slack.Close()
+	originalURL := slackAPIBaseURL
+	slackAPIBaseURL = slack.URL + "/"
+	defer func() { slackAPIBaseURL = originalURL }()
+	slackBotToken = "xoxb-test"
+	defer func() { slackBotToken = "" }()
+	unlimitedSlackCalls(t)
+	setMessageTemplates(map[string]map[string]interface{}{"link": {"title": "{{.link.url}}"}})
+	defer setMessageTemplates(nil)
+
+	unfurlLinks(EventConfig{EventType: "link_shared", UnfurlTemplate: "link"},
+		linkSharedPayload(sharedLink{URL: "https://example.com/a", Domain: "example.com"}))
+	if received.Get("unfurls") != `{"https://example.com/a":{"title":"https://example.com/a"}}` {
+		t.Errorf("expected the link to be unfurled, got %v", received)
+	}
+
+	// Consumers can unfurl links themselves through the outbound channel
+	received = nil
+	message, err := parseOutboundMessage([]byte(`{"op":"unfurl","channel":"C1","ts":"1700000000.000100","unfurls":{"https://example.com/b":{"text":"B"}}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := handleOutboundMessage(context.Background(), nil, message, time.Now()); result != "unfurled" {
+		t.Errorf("expected the links to be unfurled, got %s", result)
+	}
+	if received.Get("unfurls") != `{"https://example.com/b":{"text":"B"}}` {
+		t.Errorf("expected the unfurls to be passed to Slack, got %v", received)
+	}
+	if _, err := parseOutboundMessage([]byte(`{"op":"unfurl","channel":"C1","unfurls":{}}`)); err == nil {
+		t.Error("expected an unfurl without ts or unfurl_id to be invalid")
+	}
+}
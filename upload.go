@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// uploadTimeout bounds an upload operation, from fetching the content to
+	// sharing the file
+	uploadTimeout = 2 * time.Minute
+	// defaultUploadMaxBytes caps the size of uploaded files, which are held in memory
+	defaultUploadMaxBytes = 50 << 20
+)
+
+// uploadMaxBytes caps the size of uploaded files
+var uploadMaxBytes int64 = defaultUploadMaxBytes
+
+// uploadClient is the HTTP client used to fetch upload content and send it to Slack
+var uploadClient = &http.Client{Timeout: uploadTimeout}
+
+// uploadSources are the arguments an upload's content is read from, exactly one
+// of which is required
+var uploadSources = []string{"content", "content_base64", "url"}
+
+// validateUploadSource checks that an upload has exactly one content source
+func validateUploadSource(params url.Values) error {
+	found := 0
+	for _, source := range uploadSources {
+		if params.Has(source) {
+			found++
+		}
+	}
+	if found != 1 {
+		return errors.New("upload needs exactly one of content, content_base64 or url")
+	}
+	return nil
+}
+
+// uploadContent returns the content of an upload: inline text, base64 encoded
+// bytes or the body fetched from a URL, such as a presigned S3 URL
+func uploadContent(ctx context.Context, params url.Values) ([]byte, error) {
+	var content []byte
+	switch {
+	case params.Has("content"):
+		content = []byte(params.Get("content"))
+	case params.Has("content_base64"):
+		decoded, err := base64.StdEncoding.DecodeString(params.Get("content_base64"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid content_base64: %w", err)
+		}
+		content = decoded
+	default:
+		fetched, err := fetchUploadContent(ctx, params.Get("url"))
+		if err != nil {
+			return nil, err
+		}
+		content = fetched
+	}
+	if int64(len(content)) > uploadMaxBytes {
+		return nil, fmt.Errorf("file is larger than %d bytes", uploadMaxBytes)
+	}
+	return content, nil
+}
+
+// fetchUploadContent downloads the content of an upload, reading at most one
+// byte more than uploadMaxBytes
+func fetchUploadContent(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s returned status %d", req.URL.Redacted(), resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, uploadMaxBytes+1))
+}
+
+// uploadFile uploads a file to a Slack channel with the external upload flow:
+// files.getUploadURLExternal, sending the content to the returned URL, then
+// files.completeUploadExternal to share it. It returns the outcome.
+func uploadFile(ctx context.Context, params url.Values) string {
+	channel, filename := params.Get("channel"), params.Get("filename")
+	fileID, err := func() (string, error) {
+		content, err := uploadContent(ctx, params)
+		if err != nil {
+			return "", err
+		}
+
+		var upload struct {
+			slackAPIResponse
+			UploadURL string `json:"upload_url"`
+			FileID    string `json:"file_id"`
+		}
+		uploadParams := url.Values{"filename": {filename}, "length": {strconv.Itoa(len(content))}}
+		if team := params.Get("team_id"); team != "" {
+			uploadParams.Set("team_id", team)
+		}
+		if err := callSlackBotAPI(ctx, "files.getUploadURLExternal", uploadParams, &upload); err != nil {
+			return "", err
+		}
+		if err := sendUploadContent(ctx, upload.UploadURL, content); err != nil {
+			return "", err
+		}
+
+		title := params.Get("title")
+		if title == "" {
+			title = filename
+		}
+		files, err := json.Marshal([]map[string]string{{"id": upload.FileID, "title": title}})
+		if err != nil {
+			return "", err
+		}
+		completeParams := url.Values{"files": {string(files)}, "channel_id": {channel}}
+		for _, name := range []string{"initial_comment", "thread_ts", "team_id"} {
+			if value := params.Get(name); value != "" {
+				completeParams.Set(name, value)
+			}
+		}
+		return upload.FileID, callSlackBotAPI(ctx, "files.completeUploadExternal", completeParams, nil)
+	}()
+	if err != nil {
+		logWarn("Error uploading '%s' to '%s': %v", filename, channel, err)
+		return outboundResultFailed
+	}
+	logInfo("Uploaded '%s' to '%s' as file %s", filename, channel, fileID)
+	return "uploaded"
+}
+
+// sendUploadContent sends file content to the upload URL returned by
+// files.getUploadURLExternal
+func sendUploadContent(ctx context.Context, uploadURL string, content []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sending file content returned status %d", resp.StatusCode)
+	}
+	return nil
+}
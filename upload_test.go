@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestUploadFile(t *testing.T) {
+	var uploaded string
+	var completed url.Values
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/report.csv":
+			w.Write([]byte("a,b\n1,2\n"))
+		case "/files.getUploadURLExternal":
+			r.ParseForm()
+			if r.Form.Get("filename") != "report.csv" || r.Form.Get("length") != "8" {
+				t.Errorf("unexpected upload URL request %v", r.Form)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "upload_url": server.URL + "/upload/F1", "file_id": "F1"})
+		case "/upload/F1":
+			body, _ := io.ReadAll(r.Body)
+			uploaded = string(body)
+		case "/files.completeUploadExternal":
+			r.ParseForm()
+			completed = r.Form
+			w.Write([]byte(`{"ok":true}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	originalURL := slackAPIBaseURL
+	slackAPIBaseURL = server.URL + "/"
+	defer func() { slackAPIBaseURL = originalURL }()
+	slackBotToken = "xoxb-test"
+	defer func() { slackBotToken = "" }()
+	unlimitedSlackCalls(t)
+
+	message, err := parseOutboundMessage([]byte(`{"op":"upload","channel":"C1","filename":"report.csv","url":"` + server.URL + `/report.csv","initial_comment":"Weekly report"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result := handleOutboundMessage(context.Background(), nil, message, time.Now()); result != "uploaded" {
+		t.Fatalf("expected the file to be uploaded, got %s", result)
+	}
+	if uploaded != "a,b\n1,2\n" {
+		t.Errorf("expected the fetched content to be sent, got %q", uploaded)
+	}
+	if completed.Get("channel_id") != "C1" || completed.Get("initial_comment") != "Weekly report" || completed.Get("files") != `[{"id":"F1","title":"report.csv"}]` {
+		t.Errorf("expected the file to be shared to the channel, got %v", completed)
+	}
+
+	message, _ = parseOutboundMessage([]byte(`{"op":"upload","channel":"C1","filename":"report.csv","content_base64":"YSxiCjEsMgo="}`))
+	if result := handleOutboundMessage(context.Background(), nil, message, time.Now()); result != "uploaded" || uploaded != "a,b\n1,2\n" {
+		t.Errorf("expected base64 content to be decoded, got %s with %q", result, uploaded)
+	}
+
+	originalMax := uploadMaxBytes
+	uploadMaxBytes = 4
+	defer func() { uploadMaxBytes = originalMax }()
+	message, _ = parseOutboundMessage([]byte(`{"op":"upload","channel":"C1","filename":"notes.txt","content":"too long"}`))
+	if result := handleOutboundMessage(context.Background(), nil, message, time.Now()); result != outboundResultFailed {
+		t.Errorf("expected content above the limit to fail, got %s", result)
+	}
+}
+
+func TestParseOutboundUpload(t *testing.T) {
+	for _, data := range []string{
+		`{"op":"upload","channel":"C1","filename":"a.txt"}`,
+		`{"op":"upload","channel":"C1","filename":"a.txt","content":"x","url":"https://example.com/a.txt"}`,
+		`{"op":"upload","channel":"C1","content":"x"}`,
+	} {
+		if _, err := parseOutboundMessage([]byte(data)); err == nil {
+			t.Errorf("expected %s to be invalid", data)
+		}
+	}
+}
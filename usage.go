@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Usage summary periods
+const (
+	usageDaily   = "daily"
+	usageMonthly = "monthly"
+)
+
+// Usage summary file formats
+const (
+	usageFormatJSON = "json"
+	usageFormatCSV  = "csv"
+)
+
+const (
+	// defaultUsageKeyPrefix prefixes the Redis keys usage is aggregated in
+	defaultUsageKeyPrefix = "slack-relay:usage:"
+	// usageFlushInterval is how often each replica adds its usage to Redis
+	usageFlushInterval = 30 * time.Second
+	// usageReportDelay is how long after a period ends its summary is reported,
+	// so every replica has flushed its usage of the period
+	usageReportDelay = 5 * time.Minute
+	// usageRetention is how long aggregated usage is kept in Redis
+	usageRetention = 400 * 24 * time.Hour
+	// usageSummaryType is the type of the published usage summaries
+	usageSummaryType = "slack_relay_usage"
+)
+
+var metricUsageReports = newCounterVec("slack_relay_usage_reports_total",
+	"Usage summaries reported by this replica, by period and result.", "period", "result")
+
+// usageReporter aggregates the events relayed per team and event type into
+// daily and monthly summaries for chargeback
+type usageReporter struct {
+	// Channel receives the summaries, if set
+	Channel string
+	// Dir receives the summaries as files in Format, if set
+	Dir    string
+	Format string
+	// KeyPrefix prefixes the Redis keys usage is aggregated in
+	KeyPrefix string
+
+	mu     sync.Mutex
+	counts map[usageKey]int64
+}
+
+// usageKey identifies the usage of an event type by a team
+type usageKey struct {
+	team      string
+	eventType string
+}
+
+// field returns the Redis hash field of the key
+func (k usageKey) field() string {
+	return k.team + "|" + k.eventType
+}
+
+// usage is the relay's usage reporter; nil when usage reporting is disabled
+var usage *usageReporter
+
+// usageReporterFromEnv returns the usage reporter configured by USAGE_CHANNEL,
+// USAGE_DIR, USAGE_FORMAT and USAGE_KEY_PREFIX, or nil when usage reporting is disabled
+func usageReporterFromEnv() (*usageReporter, error) {
+	reporter := &usageReporter{
+		Channel:   os.Getenv("USAGE_CHANNEL"),
+		Dir:       os.Getenv("USAGE_DIR"),
+		Format:    os.Getenv("USAGE_FORMAT"),
+		KeyPrefix: os.Getenv("USAGE_KEY_PREFIX"),
+		counts:    make(map[usageKey]int64),
+	}
+	if reporter.Channel == "" && reporter.Dir == "" {
+		return nil, nil
+	}
+	if reporter.Format == "" {
+		reporter.Format = usageFormatJSON
+	}
+	if reporter.Format != usageFormatJSON && reporter.Format != usageFormatCSV {
+		return nil, fmt.Errorf("invalid USAGE_FORMAT '%s', expected json or csv", reporter.Format)
+	}
+	if reporter.KeyPrefix == "" {
+		reporter.KeyPrefix = defaultUsageKeyPrefix
+	}
+	return reporter, nil
+}
+
+// record counts an event relayed for a team
+func (u *usageReporter) record(team string, eventType string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.counts[usageKey{team: team, eventType: eventType}]++
+}
+
+// take removes and returns the usage recorded since the last flush
+func (u *usageReporter) take() map[usageKey]int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	counts := u.counts
+	u.counts = make(map[usageKey]int64)
+	return counts
+}
+
+// restore adds back usage that could not be flushed
+func (u *usageReporter) restore(counts map[usageKey]int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for key, count := range counts {
+		u.counts[key] += count
+	}
+}
+
+// usagePeriod is a day or month of usage, in UTC
+type usagePeriod struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// label returns the period's date, e.g. "2030-01-02" or "2030-01"
+func (p usagePeriod) label() string {
+	if p.Name == usageMonthly {
+		return p.Start.Format("2006-01")
+	}
+	return p.Start.Format("2006-01-02")
+}
+
+// usagePeriodsOf returns the day and month now belongs to
+func usagePeriodsOf(now time.Time) []usagePeriod {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return []usagePeriod{
+		{Name: usageDaily, Start: day, End: day.AddDate(0, 0, 1)},
+		{Name: usageMonthly, Start: month, End: month.AddDate(0, 1, 0)},
+	}
+}
+
+// key returns the Redis hash holding the usage of a period
+func (u *usageReporter) key(period usagePeriod) string {
+	return u.KeyPrefix + period.Name + ":" + period.label()
+}
+
+// flush adds the usage recorded since the last flush, made at now, to the
+// daily and monthly hashes in Redis
+func (u *usageReporter) flush(ctx context.Context, now time.Time) error {
+	counts := u.take()
+	if len(counts) == 0 {
+		return nil
+	}
+	if redisClient == nil {
+		u.restore(counts)
+		return errRedisUnavailable
+	}
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, period := range usagePeriodsOf(now) {
+			key := u.key(period)
+			for usageKey, count := range counts {
+				pipe.HIncrBy(ctx, key, usageKey.field(), count)
+			}
+			pipe.Expire(ctx, key, usageRetention)
+		}
+		return nil
+	})
+	if err != nil {
+		u.restore(counts)
+	}
+	return err
+}
+
+// usageSummary is the usage of a period, published and written as JSON
+type usageSummary struct {
+	Type   string      `json:"type"`
+	Period string      `json:"period"`
+	Start  string      `json:"start"`
+	End    string      `json:"end"`
+	Total  int64       `json:"total"`
+	Teams  []teamUsage `json:"teams"`
+}
+
+// teamUsage is the usage of one team in a summary
+type teamUsage struct {
+	TeamID     string           `json:"team_id"`
+	Total      int64            `json:"total"`
+	EventTypes map[string]int64 `json:"event_types"`
+}
+
+// buildUsageSummary returns the summary of a period from the fields of its
+// Redis hash. Teams are sorted by ID.
+func buildUsageSummary(period usagePeriod, fields map[string]string) usageSummary {
+	summary := usageSummary{
+		Type:   usageSummaryType,
+		Period: period.Name,
+		Start:  period.Start.Format("2006-01-02"),
+		End:    period.End.Format("2006-01-02"),
+		Teams:  []teamUsage{},
+	}
+	teams := make(map[string]*teamUsage)
+	for field, value := range fields {
+		team, eventType, ok := strings.Cut(field, "|")
+		count, err := strconv.ParseInt(value, 10, 64)
+		if !ok || err != nil {
+			continue
+		}
+		entry, ok := teams[team]
+		if !ok {
+			entry = &teamUsage{TeamID: team, EventTypes: make(map[string]int64)}
+			teams[team] = entry
+		}
+		entry.EventTypes[eventType] += count
+		entry.Total += count
+		summary.Total += count
+	}
+	for _, entry := range teams {
+		summary.Teams = append(summary.Teams, *entry)
+	}
+	sort.Slice(summary.Teams, func(i, j int) bool { return summary.Teams[i].TeamID < summary.Teams[j].TeamID })
+	return summary
+}
+
+// csv renders the summary with one row per team and event type
+func (s usageSummary) csv() []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"period", "start", "end", "team_id", "event_type", "events"})
+	for _, team := range s.Teams {
+		eventTypes := make([]string, 0, len(team.EventTypes))
+		for eventType := range team.EventTypes {
+			eventTypes = append(eventTypes, eventType)
+		}
+		sort.Strings(eventTypes)
+		for _, eventType := range eventTypes {
+			w.Write([]string{s.Period, s.Start, s.End, team.TeamID, eventType, strconv.FormatInt(team.EventTypes[eventType], 10)})
+		}
+	}
+	w.Flush()
+	return b.Bytes()
+}
+
+// write saves the summary in dir as usage-<period>-<date>.<format>
+func (s usageSummary) write(dir string, format string, label string) error {
+	data := s.csv()
+	if format == usageFormatJSON {
+		var err error
+		if data, err = json.MarshalIndent(s, "", "  "); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, fmt.Sprintf("usage-%s-%s.%s", s.Period, label, format)), data, 0o644)
+}
+
+// report publishes and writes the summary of a period, unless another replica
+// already reported it. A failed report releases the claim so it is retried.
+func (u *usageReporter) report(ctx context.Context, period usagePeriod) error {
+	if redisClient == nil {
+		return errRedisUnavailable
+	}
+	claim := u.key(period) + ":reported"
+	claimed, err := redisClient.SetNX(ctx, claim, instanceID, usageRetention).Result()
+	if err != nil || !claimed {
+		return err
+	}
+	if err := u.publishSummary(ctx, period); err != nil {
+		redisClient.Del(context.Background(), claim)
+		return err
+	}
+	return nil
+}
+
+// publishSummary publishes and writes the summary of a period
+func (u *usageReporter) publishSummary(ctx context.Context, period usagePeriod) error {
+	fields, err := redisClient.HGetAll(ctx, u.key(period)).Result()
+	if err != nil {
+		return err
+	}
+
+	summary := buildUsageSummary(period, fields)
+	if u.Channel != "" {
+		data, err := json.Marshal(summary)
+		if err != nil {
+			return err
+		}
+		if err := publishEvent(u.Channel, data); err != nil {
+			return err
+		}
+	}
+	if u.Dir != "" {
+		if err := summary.write(u.Dir, u.Format, period.label()); err != nil {
+			return err
+		}
+	}
+	logInfo("Reported %s usage of %s: %d event(s) from %d team(s)", period.Name, period.label(), summary.Total, len(summary.Teams))
+	return nil
+}
+
+// duePeriods returns the periods that ended just before now and are due for
+// reporting: the previous day, and the previous month on the first of a month
+func duePeriods(now time.Time) []usagePeriod {
+	var due []usagePeriod
+	for _, period := range usagePeriodsOf(now.Add(-usageReportDelay)) {
+		previous := usagePeriodsOf(period.Start.Add(-time.Nanosecond))
+		for _, candidate := range previous {
+			if candidate.Name == period.Name && !now.Before(candidate.End.Add(usageReportDelay)) {
+				due = append(due, candidate)
+			}
+		}
+	}
+	return due
+}
+
+// watchUsage flushes the usage recorded by this replica and reports the
+// summaries of the periods that ended
+func watchUsage(ctx context.Context, u *usageReporter) {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+	reported := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := clock.Now()
+			runCtx, cancel := context.WithTimeout(ctx, usageFlushInterval)
+			if err := u.flush(runCtx, now); err != nil {
+				logWarn("Error flushing usage to Redis: %v", err)
+			}
+			for _, period := range duePeriods(now) {
+				key := u.key(period)
+				if reported[key] {
+					continue
+				}
+				if err := u.report(runCtx, period); err != nil {
+					logWarn("Error reporting %s usage of %s: %v", period.Name, period.label(), err)
+					metricUsageReports.Inc(period.Name, "failure")
+					continue
+				}
+				reported[key] = true
+				metricUsageReports.Inc(period.Name, "success")
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsagePeriodsOf(t *testing.T) {
+	periods := usagePeriodsOf(time.Date(2030, 1, 31, 23, 59, 0, 0, time.UTC))
+	if len(periods) != 2 {
+		t.Fatalf("expected daily and monthly periods, got %v", periods)
+	}
+	if periods[0].label() != "2030-01-31" || !periods[0].End.Equal(time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected daily period %+v", periods[0])
+	}
+	if periods[1].label() != "2030-01" || !periods[1].End.Equal(time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected monthly period %+v", periods[1])
+	}
+}
+
+func TestDuePeriods(t *testing.T) {
+	// Before the report delay, the day and month before the last are still due
+	if due := duePeriods(time.Date(2030, 2, 1, 0, 2, 0, 0, time.UTC)); len(due) != 2 || due[0].label() != "2030-01-30" || due[1].label() != "2029-12" {
+		t.Errorf("expected the day and month before the last to be due, got %v", due)
+	}
+	due := duePeriods(time.Date(2030, 2, 1, 0, 6, 0, 0, time.UTC))
+	if len(due) != 2 || due[0].label() != "2030-01-31" || due[1].label() != "2030-01" {
+		t.Errorf("expected January 31 and January to be due, got %v", due)
+	}
+	due = duePeriods(time.Date(2030, 2, 14, 12, 0, 0, 0, time.UTC))
+	if len(due) != 2 || due[0].label() != "2030-02-13" || due[1].label() != "2030-01" {
+		t.Errorf("expected February 13 and January to be due, got %v", due)
+	}
+}
+
+func TestBuildUsageSummary(t *testing.T) {
+	period := usagePeriodsOf(time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC))[0]
+	summary := buildUsageSummary(period, map[string]string{
+		"T2|message":     "3",
+		"T1|message":     "5",
+		"T1|app_mention": "2",
+		"invalid":        "1",
+		"T3|message":     "x",
+	})
+	if summary.Total != 10 || len(summary.Teams) != 2 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if summary.Teams[0].TeamID != "T1" || summary.Teams[0].Total != 7 || summary.Teams[0].EventTypes["app_mention"] != 2 {
+		t.Errorf("unexpected first team %+v", summary.Teams[0])
+	}
+	if summary.Start != "2030-01-02" || summary.End != "2030-01-03" || summary.Type != usageSummaryType {
+		t.Errorf("unexpected summary period %+v", summary)
+	}
+
+	expected := "period,start,end,team_id,event_type,events\n" +
+		"daily,2030-01-02,2030-01-03,T1,app_mention,2\n" +
+		"daily,2030-01-02,2030-01-03,T1,message,5\n" +
+		"daily,2030-01-02,2030-01-03,T2,message,3\n"
+	if csv := string(summary.csv()); csv != expected {
+		t.Errorf("unexpected CSV:\n%s", csv)
+	}
+
+	dir := t.TempDir()
+	if err := summary.write(dir, usageFormatJSON, period.label()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "usage-daily-2030-01-02.json"))
+	if err != nil {
+		t.Fatalf("expected the summary file: %v", err)
+	}
+	var written usageSummary
+	if err := json.Unmarshal(data, &written); err != nil || written.Total != 10 {
+		t.Errorf("unexpected summary file %s", data)
+	}
+}
+
+func TestUsageReporterRecord(t *testing.T) {
+	reporter := &usageReporter{counts: make(map[usageKey]int64)}
+	reporter.record("T1", "message")
+	reporter.record("T1", "message")
+	reporter.record("T2", "app_mention")
+
+	// Without Redis the counts are kept for the next flush
+	if err := reporter.flush(context.Background(), time.Now()); err == nil {
+		t.Error("expected the flush to fail without Redis")
+	}
+	counts := reporter.take()
+	if counts[usageKey{team: "T1", eventType: "message"}] != 2 || counts[usageKey{team: "T2", eventType: "app_mention"}] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+	if len(reporter.take()) != 0 {
+		t.Error("expected take to reset the counts")
+	}
+}
+
+func TestUsageReporterFromEnv(t *testing.T) {
+	t.Setenv("USAGE_CHANNEL", "")
+	t.Setenv("USAGE_DIR", "")
+	if reporter, err := usageReporterFromEnv(); err != nil || reporter != nil {
+		t.Errorf("expected usage reporting to be disabled, got %v, %v", reporter, err)
+	}
+	t.Setenv("USAGE_DIR", "/data/usage")
+	t.Setenv("USAGE_FORMAT", "xml")
+	if _, err := usageReporterFromEnv(); err == nil || !strings.Contains(err.Error(), "USAGE_FORMAT") {
+		t.Errorf("expected an invalid format error, got %v", err)
+	}
+	t.Setenv("USAGE_FORMAT", "")
+	reporter, err := usageReporterFromEnv()
+	if err != nil || reporter.Format != usageFormatJSON || reporter.KeyPrefix != defaultUsageKeyPrefix {
+		t.Errorf("unexpected reporter %+v, %v", reporter, err)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+)
+
+// verificationTestMode acknowledges every request that passes signature
+// verification with an empty 200 and relays nothing, so the request URLs of a
+// Slack app can be validated before routes are set up
+var verificationTestMode bool
+
+// acknowledgeVerificationTest answers a verified request in verification test
+// mode, logging what Slack sent
+func acknowledgeVerificationTest(w http.ResponseWriter, r *http.Request, parsed slackPayload) {
+	kind := parsed.Type
+	if parsed.Type == slashCommandType {
+		kind += " " + parsed.Command
+	}
+	if len(getSigningSecret()) == 0 {
+		logWarn("Verification test mode: acknowledged %s request from %s, but its signature was not checked without a signing secret", kind, clientIP(r))
+	} else {
+		logInfo("Verification test mode: acknowledged %s request from %s with a valid signature", kind, clientIP(r))
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedFormRequest returns a POST /slack request with a form body signed with secret
+func signedFormRequest(body string, secret []byte) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != nil {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", computeSlackSignature([]byte(body), timestamp, secret))
+	}
+	return req
+}
+
+func TestSlackHandlerSSLCheck(t *testing.T) {
+	setupTestEnvironment()
+	signingSecret = []byte("test-secret")
+	defer setupTestEnvironment()
+
+	rr := httptest.NewRecorder()
+	slackHandler(rr, signedFormRequest("ssl_check=1&token=abc", nil))
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+		t.Errorf("expected an empty 200, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSlackHandlerSlashCommand(t *testing.T) {
+	setEventConfigs([]EventConfig{
+		{EventType: "slash_command", Channel: "slack-deploys", Commands: []string{"deploy"}},
+	})
+	defer setupTestEnvironment()
+	signingSecret = []byte("test-secret")
+
+	rr := httptest.NewRecorder()
+	slackHandler(rr, signedFormRequest("command=%2Fdeploy&text=api", signingSecret))
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+		t.Errorf("expected an empty 200 for a routed command, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	routed := routeEvent(map[string]interface{}{"type": "slash_command", "command": "/oncall"}, nil)
+	if routed.Skip != skipNoRouteMatch {
+		t.Errorf("expected /oncall to match no route, got %+v", routed)
+	}
+}
+
+func TestSlackHandlerVerificationTestMode(t *testing.T) {
+	setupTestEnvironment()
+	defer setupTestEnvironment()
+	signingSecret = []byte("test-secret")
+	verificationTestMode = true
+	defer func() { verificationTestMode = false }()
+
+	rr := httptest.NewRecorder()
+	slackHandler(rr, signedFormRequest("command=%2Fdeploy&text=api", signingSecret))
+	if rr.Code != http.StatusOK || rr.Body.Len() != 0 {
+		t.Errorf("expected an empty 200 for a verified request, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	slackHandler(rr, signedFormRequest("command=%2Fdeploy&text=api", []byte("wrong-secret")))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an invalid signature, got %d", rr.Code)
+	}
+}
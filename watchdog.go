@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultIdleCheckInterval is how often routes are checked for idleness
+const defaultIdleCheckInterval = time.Minute
+
+// defaultIdleAlertAfter is how long a route may go without events before an
+// alert is raised, for routes without their own idle-alert-after. Zero disables
+// the watchdog for those routes.
+var defaultIdleAlertAfter time.Duration
+
+// idleWatchdog tracks when each event type was last received and which event
+// types are currently reported as idle
+type idleWatchdog struct {
+	mu           sync.Mutex
+	started      time.Time
+	lastReceived map[string]time.Time
+	idle         map[string]bool
+}
+
+// watchdog is the relay's idle-event watchdog
+var watchdog = newIdleWatchdog(clock.Now())
+
+// newIdleWatchdog creates a watchdog that treats event types never received as
+// last seen at started
+func newIdleWatchdog(started time.Time) *idleWatchdog {
+	return &idleWatchdog{
+		started:      started,
+		lastReceived: make(map[string]time.Time),
+		idle:         make(map[string]bool),
+	}
+}
+
+var metricIdleAlerts = newCounterVec("slack_relay_idle_alerts_total",
+	"Alerts raised because a route received no events for longer than its idle threshold, by event type.", "event_type")
+
+// received records that an event of eventType arrived at now
+func (w *idleWatchdog) received(eventType string, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastReceived[eventType] = now
+}
+
+// idleAlert describes a route that went quiet or resumed
+type idleAlert struct {
+	EventType    string
+	LastReceived time.Time
+	Idle         bool
+}
+
+// check returns the routes that went idle, or resumed after being idle, since the
+// last check
+func (w *idleWatchdog) check(configs []EventConfig, now time.Time) []idleAlert {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var alerts []idleAlert
+	for _, config := range configs {
+		threshold := time.Duration(config.IdleAlertAfter)
+		if threshold == 0 {
+			threshold = defaultIdleAlertAfter
+		}
+		if threshold <= 0 {
+			continue
+		}
+
+		last, ok := w.lastReceived[config.EventType]
+		if !ok {
+			last = w.started
+		}
+		idle := now.Sub(last) > threshold
+		if idle != w.idle[config.EventType] {
+			w.idle[config.EventType] = idle
+			alerts = append(alerts, idleAlert{EventType: config.EventType, LastReceived: last, Idle: idle})
+		}
+	}
+	return alerts
+}
+
+// reportIdleRoutes checks the routes for idleness, and logs and publishes an
+// alert to the control channel for every change
+func reportIdleRoutes(now time.Time) {
+	for _, alert := range watchdog.check(currentEventConfigs(), now) {
+		record := map[string]interface{}{
+			"type":          "event_type_resumed",
+			"event_type":    alert.EventType,
+			"last_received": alert.LastReceived.UTC().Format(time.RFC3339),
+			"timestamp":     now.UTC().Format(time.RFC3339),
+		}
+		if alert.Idle {
+			record["type"] = "event_type_idle"
+			record["idle_for"] = now.Sub(alert.LastReceived).Round(time.Second).String()
+			metricIdleAlerts.Inc(eventTypeLabel(alert.EventType))
+			logWarn("No '%s' events received since %s; check the Slack event subscription and request URL",
+				alert.EventType, alert.LastReceived.UTC().Format(time.RFC3339))
+		} else {
+			logInfo("Events of type '%s' are being received again", alert.EventType)
+		}
+		publishControlEvent(record)
+	}
+}
+
+// watchIdleRoutes checks the routes for idleness every interval until ctx is cancelled
+func watchIdleRoutes(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reportIdleRoutes(clock.Now())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleWatchdogCheck(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	w := newIdleWatchdog(start)
+	configs := []EventConfig{
+		{EventType: "message", IdleAlertAfter: Duration(10 * time.Minute)},
+		{EventType: "team_join"},
+	}
+
+	w.received("message", start.Add(5*time.Minute))
+	if alerts := w.check(configs, start.Add(14*time.Minute)); len(alerts) != 0 {
+		t.Errorf("expected no alerts within the threshold, got %+v", alerts)
+	}
+
+	alerts := w.check(configs, start.Add(16*time.Minute))
+	if len(alerts) != 1 || alerts[0].EventType != "message" || !alerts[0].Idle || !alerts[0].LastReceived.Equal(start.Add(5*time.Minute)) {
+		t.Fatalf("expected idle alert for 'message', got %+v", alerts)
+	}
+	if alerts := w.check(configs, start.Add(30*time.Minute)); len(alerts) != 0 {
+		t.Errorf("expected idle alert to be raised once, got %+v", alerts)
+	}
+
+	w.received("message", start.Add(31*time.Minute))
+	alerts = w.check(configs, start.Add(32*time.Minute))
+	if len(alerts) != 1 || alerts[0].Idle {
+		t.Errorf("expected resumed alert for 'message', got %+v", alerts)
+	}
+}
+
+func TestIdleWatchdogDefaultThreshold(t *testing.T) {
+	defer func(d time.Duration) { defaultIdleAlertAfter = d }(defaultIdleAlertAfter)
+	defaultIdleAlertAfter = time.Hour
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	w := newIdleWatchdog(start)
+	alerts := w.check([]EventConfig{{EventType: "team_join"}}, start.Add(2*time.Hour))
+	if len(alerts) != 1 || alerts[0].EventType != "team_join" || !alerts[0].LastReceived.Equal(start) {
+		t.Errorf("expected never-received route to be idle since startup, got %+v", alerts)
+	}
+}